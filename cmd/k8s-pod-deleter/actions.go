@@ -0,0 +1,49 @@
+package main
+
+import (
+	"github.com/bakins/k8s-pod-deleter/pkg/config"
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/k8s"
+	"github.com/pkg/errors"
+)
+
+// buildActions creates the built-in evict, rollout-restart, and delete-job
+// actions and the actions defined in the configuration file.
+func buildActions(client *k8s.Client, specs map[string]config.Action) (map[string]controller.Action, error) {
+	actions := map[string]controller.Action{
+		"evict":           controller.EvictAction(client),
+		"rollout-restart": controller.RolloutRestartAction(client, controller.DefaultRestartCooldown),
+		"delete-job":      controller.DeleteJobAction(client, controller.DeleteAction(client)),
+	}
+
+	for name, spec := range specs {
+		var a controller.Action
+		switch spec.Type {
+		case "delete":
+			a = controller.DeleteAction(client)
+		case "evict":
+			a = controller.EvictAction(client)
+		case "annotate":
+			a = controller.AnnotateAction(client, spec.Annotations)
+		case "label":
+			a = controller.LabelAction(client, spec.Labels)
+		case "deletionCost":
+			a = controller.DeletionCostAction(client, spec.Cost)
+		case "rolloutRestart":
+			cooldown := spec.Cooldown
+			if cooldown == 0 {
+				cooldown = controller.DefaultRestartCooldown
+			}
+			a = controller.RolloutRestartAction(client, cooldown)
+		case "deleteJob":
+			a = controller.DeleteJobAction(client, controller.DeleteAction(client))
+		case "annotateJob":
+			a = controller.AnnotateJobAction(client, spec.Annotations, controller.DeleteAction(client))
+		default:
+			return nil, errors.Errorf("action %q has unknown type %q", name, spec.Type)
+		}
+		actions[name] = a
+	}
+
+	return actions, nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/history"
+	"github.com/pkg/errors"
+)
+
+// admin serves the admin API. Every request must include the token
+// as a bearer token.
+type admin struct {
+	c     *controller.Controller
+	token string
+}
+
+type adminStatus struct {
+	Paused   bool                 `json:"paused"`
+	Disabled bool                 `json:"disabled"`
+	LastRun  controller.RunStatus `json:"lastRun"`
+}
+
+// newAdmin reads the token from filename and returns the admin API.
+func newAdmin(c *controller.Controller, filename string) (*admin, error) {
+	token, err := readAdminToken(filename)
+	if err != nil {
+		return nil, err
+	}
+	return &admin{c: c, token: token}, nil
+}
+
+// readAdminToken returns the token in filename, without surrounding
+// whitespace.
+func readAdminToken(filename string) (string, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read admin token from %q", filename)
+	}
+
+	token := strings.TrimSpace(string(data))
+	if token == "" {
+		return "", errors.Errorf("admin token file %q is empty", filename)
+	}
+	return token, nil
+}
+
+// register adds the admin API to mux. bundle serves the support bundle.
+func (a *admin) register(mux *http.ServeMux, bundle http.Handler) {
+	mux.Handle("/admin/status", a.handle(http.MethodGet, http.StatusOK, a.status))
+	mux.Handle("/admin/candidates", a.handle(http.MethodGet, http.StatusOK, a.candidates))
+	mux.Handle("/admin/history", a.handle(http.MethodGet, http.StatusOK, a.history))
+	mux.Handle("/admin/budget", a.handle(http.MethodGet, http.StatusOK, a.budget))
+	// the run happens in the background
+	mux.Handle("/admin/run", a.handle(http.MethodPost, http.StatusAccepted, a.run))
+	mux.Handle("/admin/pause", a.handle(http.MethodPost, http.StatusOK, a.pause))
+	mux.Handle("/admin/resume", a.handle(http.MethodPost, http.StatusOK, a.resume))
+	mux.Handle("/admin/support-bundle", a.restrict(http.MethodGet, bundle))
+}
+
+// restrict checks the method and token before calling h.
+func (a *admin) restrict(method string, h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !a.authorized(r) {
+			w.Header().Set("WWW-Authenticate", "Bearer")
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		if r.Method != method {
+			w.Header().Set("Allow", method)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// handle checks the method and token before calling fn. The value
+// returned by fn is written as JSON with the status code.
+func (a *admin) handle(method string, code int, fn func(r *http.Request) (interface{}, error)) http.Handler {
+	return a.restrict(method, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		v, err := fn(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(code)
+		if err := json.NewEncoder(w).Encode(v); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}))
+}
+
+func (a *admin) authorized(r *http.Request) bool {
+	const prefix = "Bearer "
+	h := r.Header.Get("Authorization")
+	if !strings.HasPrefix(h, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(h, prefix)), []byte(a.token)) == 1
+}
+
+func (a *admin) status(r *http.Request) (interface{}, error) {
+	return adminStatus{
+		Paused:   a.c.Paused(),
+		Disabled: a.c.Disabled(),
+		LastRun:  a.c.LastRun(),
+	}, nil
+}
+
+func (a *admin) candidates(r *http.Request) (interface{}, error) {
+	candidates, err := a.c.Candidates()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to get candidates")
+	}
+	return newCandidateList(candidates), nil
+}
+
+// history returns the deletions within the duration in the since
+// query parameter. Default is one hour.
+func (a *admin) history(r *http.Request) (interface{}, error) {
+	since := time.Hour
+	if v := r.URL.Query().Get("since"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid since %q", v)
+		}
+		since = d
+	}
+
+	deletions := a.c.History(time.Now().Add(-since))
+	if deletions == nil {
+		deletions = []history.Deletion{}
+	}
+	return deletions, nil
+}
+
+func (a *admin) budget(r *http.Request) (interface{}, error) {
+	return a.c.Budget(), nil
+}
+
+func (a *admin) run(r *http.Request) (interface{}, error) {
+	a.c.Trigger()
+	return a.status(r)
+}
+
+func (a *admin) pause(r *http.Request) (interface{}, error) {
+	a.c.Pause()
+	return a.status(r)
+}
+
+func (a *admin) resume(r *http.Request) (interface{}, error) {
+	a.c.Resume()
+	return a.status(r)
+}
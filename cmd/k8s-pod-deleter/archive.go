@@ -0,0 +1,120 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/archive"
+	"github.com/pkg/errors"
+)
+
+type archiveOptions struct {
+	url        string
+	cluster    string
+	events     bool
+	region     string
+	endpoint   string
+	accessKey  string
+	secretFile string
+}
+
+// archiver creates the archiver for pod manifests from --archive, which is
+// a URL with the bucket or container as the host and an optional prefix
+// for keys as the path.
+func (m *mainCommand) archiver() (*archive.Archiver, error) {
+	if strings.HasPrefix(m.archive.url, "file:") {
+		return archive.New(archive.Directory(strings.TrimPrefix(m.archive.url, "file:")), archive.WithCluster(m.archive.cluster))
+	}
+
+	parts := strings.SplitN(m.archive.url, "://", 2)
+	if len(parts) != 2 {
+		return nil, errors.Errorf("invalid archive %q. Must be s3://bucket/prefix, gs://bucket/prefix, azblob://account/container/prefix, or file:/path", m.archive.url)
+	}
+	scheme := parts[0]
+	path := strings.SplitN(parts[1], "/", 2)
+	bucket := path[0]
+	var prefix string
+	if len(path) == 2 {
+		prefix = path[1]
+	}
+	if bucket == "" {
+		return nil, errors.Errorf("invalid archive %q. The bucket must not be empty", m.archive.url)
+	}
+
+	secret, err := m.archiveSecret()
+	if err != nil {
+		return nil, err
+	}
+
+	var store archive.Store
+	switch scheme {
+	case "s3", "gs":
+		accessKey, token := m.archive.accessKey, ""
+		if accessKey == "" {
+			accessKey = os.Getenv("AWS_ACCESS_KEY_ID")
+		}
+		if secret == "" {
+			secret = os.Getenv("AWS_SECRET_ACCESS_KEY")
+			token = os.Getenv("AWS_SESSION_TOKEN")
+		}
+		if accessKey == "" || secret == "" {
+			return nil, errors.New("--archive-access-key and --archive-secret-file, or $AWS_ACCESS_KEY_ID and $AWS_SECRET_ACCESS_KEY, are required")
+		}
+
+		region, endpoint := m.archive.region, m.archive.endpoint
+		if scheme == "gs" {
+			if region == "" {
+				region = "auto"
+			}
+			if endpoint == "" {
+				endpoint = archive.GCSEndpoint
+			}
+		}
+		if region == "" {
+			region = os.Getenv("AWS_REGION")
+		}
+		if region == "" {
+			region = "us-east-1"
+		}
+		if endpoint == "" {
+			endpoint = "https://s3." + region + ".amazonaws.com"
+		}
+		store = archive.S3(endpoint, bucket, region, accessKey, secret, token)
+	case "azblob":
+		// the container is the first part of the path
+		path := strings.SplitN(prefix, "/", 2)
+		if path[0] == "" {
+			return nil, errors.Errorf("invalid archive %q. Must be azblob://account/container/prefix", m.archive.url)
+		}
+		prefix = ""
+		if len(path) == 2 {
+			prefix = path[1]
+		}
+		endpoint := m.archive.endpoint
+		if endpoint == "" {
+			endpoint = "https://" + bucket + ".blob.core.windows.net"
+		}
+		store = archive.AzureBlob(strings.TrimSuffix(endpoint, "/")+"/"+path[0], secret)
+	default:
+		return nil, errors.Errorf("invalid archive %q. Must be s3://bucket/prefix, gs://bucket/prefix, azblob://account/container/prefix, or file:/path", m.archive.url)
+	}
+
+	if prefix != "" && !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+	return archive.New(store, archive.WithPrefix(prefix), archive.WithCluster(m.archive.cluster))
+}
+
+// archiveSecret reads the secret key or shared access signature, if a
+// file is set
+func (m *mainCommand) archiveSecret() (string, error) {
+	if m.archive.secretFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(m.archive.secretFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read archive secret from %q", m.archive.secretFile)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
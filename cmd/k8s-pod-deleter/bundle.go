@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/bundle"
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/version"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/expfmt"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v2"
+)
+
+func (m *mainCommand) supportBundleCommand() *cobra.Command {
+	var output, address, tokenFile string
+
+	cmd := &cobra.Command{
+		Use:   "support-bundle",
+		Short: "write a support bundle to attach to bug reports",
+		Long: `Write a gzipped tarball with the effective configuration, recent decisions,
+budget state, metrics, and version information.
+
+If --address is set, the bundle is downloaded from a running deleter's
+admin API, authenticating with the token in --token-file. Otherwise,
+the bundle is created by this process, and the decisions are the
+current candidates.`,
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			w := io.Writer(os.Stdout)
+			if output != "-" {
+				f, err := os.Create(output)
+				if err != nil {
+					return errors.Wrapf(err, "failed to create %q", output)
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if address != "" {
+				return downloadBundle(w, address, tokenFile)
+			}
+
+			_, _, c, err := m.setup(cmd)
+			if err != nil {
+				return err
+			}
+
+			candidates, err := c.Candidates()
+			if err != nil {
+				return errors.Wrap(err, "failed to get candidates")
+			}
+
+			decisions := make([]controller.Decision, 0, len(candidates))
+			for _, cand := range candidates {
+				decisions = append(decisions, controller.Decision{
+					Time:      time.Now(),
+					Namespace: cand.Pod.ObjectMeta.Namespace,
+					Name:      cand.Pod.ObjectMeta.Name,
+					Rule:      cand.Rule,
+					Reason:    cand.Reason,
+					Action:    "candidate",
+				})
+			}
+
+			registry := prometheus.NewRegistry()
+			if err := registry.Register(c); err != nil {
+				return errors.Wrap(err, "failed to register metrics")
+			}
+
+			return m.writeBundle(w, c, decisions, registry)
+		},
+	}
+
+	cmd.Flags().StringVarP(&output, "output", "o", "support-bundle.tar.gz", `file to write the bundle to. "-" for stdout`)
+	cmd.Flags().StringVar(&address, "address", "", "base URL of a running deleter's HTTP server, such as http://localhost:8080")
+	cmd.Flags().StringVar(&tokenFile, "token-file", "", "file containing the admin API token of the deleter at --address")
+
+	return cmd
+}
+
+func downloadBundle(w io.Writer, address string, tokenFile string) error {
+	if tokenFile == "" {
+		return errors.New("--token-file is required with --address")
+	}
+	token, err := readAdminToken(tokenFile)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodGet, address+"/admin/support-bundle", nil)
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to get support bundle")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return errors.Errorf("unexpected status getting support bundle: %s", resp.Status)
+	}
+
+	_, err = io.Copy(w, resp.Body)
+	return errors.Wrap(err, "failed to write support bundle")
+}
+
+// writeBundle writes a support bundle for a controller.
+func (m *mainCommand) writeBundle(w io.Writer, c *controller.Controller, decisions []controller.Decision, gatherer prometheus.Gatherer) error {
+	cfg, err := yaml.Marshal(m.effectiveConfig())
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal configuration")
+	}
+
+	decisionsData, err := json.MarshalIndent(decisions, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal decisions")
+	}
+
+	budget, err := json.MarshalIndent(c.Budget(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal budget")
+	}
+
+	versionData, err := json.MarshalIndent(version.Get(), "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to marshal version")
+	}
+
+	families, err := gatherer.Gather()
+	if err != nil {
+		return errors.Wrap(err, "failed to gather metrics")
+	}
+
+	var metrics bytes.Buffer
+	for _, mf := range families {
+		if _, err := expfmt.MetricFamilyToText(&metrics, mf); err != nil {
+			return errors.Wrap(err, "failed to write metrics")
+		}
+	}
+
+	dir := "support-bundle-" + time.Now().UTC().Format("20060102T150405Z")
+	return bundle.Write(w, dir, []bundle.File{
+		{Name: "config.yaml", Data: cfg},
+		{Name: "decisions.json", Data: decisionsData},
+		{Name: "budget.json", Data: budget},
+		{Name: "metrics.txt", Data: metrics.Bytes()},
+		{Name: "version.json", Data: versionData},
+	})
+}
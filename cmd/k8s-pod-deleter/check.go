@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/printer"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type explanation struct {
+	controller.Explanation
+}
+
+func (e explanation) Table() printer.TableData {
+	t := printer.TableData{
+		Columns: []printer.Column{
+			{Name: "RULE"},
+			{Name: "CHECK"},
+			{Name: "VERDICT"},
+			{Name: "REASON"},
+			{Name: "DETAIL", Wide: true},
+		},
+	}
+	for _, r := range e.Rules {
+		for _, step := range r.Steps {
+			t.Rows = append(t.Rows, []string{ruleName(r.Rule), step.Check, step.Verdict, step.Reason, step.Detail})
+		}
+	}
+
+	if !e.Matched() {
+		t.Footer = []string{fmt.Sprintf("\nVerdict for %s/%s: skip. No rule matched the pod", e.Namespace, e.Name)}
+	} else {
+		t.Footer = []string{fmt.Sprintf("\nVerdict for %s/%s: %s, rule %s, reason %s", e.Namespace, e.Name, e.Action, ruleName(e.Rule), e.Reason)}
+	}
+	return t
+}
+
+func (m *mainCommand) checkCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:           "check NAMESPACE/POD",
+		Short:         "explain what would be done with a single pod, and why",
+		Args:          cobra.ExactArgs(1),
+		RunE:          m.runCheck,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+}
+
+func (m *mainCommand) runCheck(cmd *cobra.Command, args []string) error {
+	parts := strings.SplitN(args[0], "/", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return errors.Errorf("pod must be namespace/name: %q", args[0])
+	}
+
+	p, err := printer.New(m.output)
+	if err != nil {
+		return err
+	}
+
+	client, _, c, err := m.setup(cmd)
+	if err != nil {
+		return err
+	}
+
+	pod, err := client.GetPod(parts[0], parts[1])
+	if err != nil {
+		return errors.Wrapf(err, "failed to get pod %s", args[0])
+	}
+
+	e, err := c.Explain(*pod)
+	if err != nil {
+		return errors.Wrap(err, "failed to explain pod")
+	}
+
+	return p.Print(os.Stdout, explanation{e})
+}
+
+func ruleName(name string) string {
+	if name == "" {
+		return "<default>"
+	}
+	return name
+}
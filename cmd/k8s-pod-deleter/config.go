@@ -0,0 +1,694 @@
+package main
+
+import (
+	"github.com/bakins/k8s-pod-deleter/pkg/config"
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/k8s"
+	"github.com/pkg/errors"
+	"github.com/spf13/pflag"
+)
+
+// reload reads the configuration file again and applies the
+// pod selection settings to the controller. m should hold only the values from flags.
+func (m mainCommand) reload(f *pflag.FlagSet, client *k8s.Client, c *controller.Controller) error {
+	if m.configFile == "" {
+		return errors.New("no configuration file specified")
+	}
+
+	cfg, err := config.Load(m.configFile)
+	if err != nil {
+		return errors.Wrap(err, "failed to load configuration")
+	}
+
+	if err := m.applyConfig(f, cfg); err != nil {
+		return errors.Wrap(err, "failed to apply configuration")
+	}
+
+	actions, err := buildActions(client, m.actions)
+	if err != nil {
+		return errors.Wrap(err, "failed to create actions")
+	}
+
+	return c.Reconfigure(
+		controller.WithNamespace(m.namespace),
+		controller.WithSelector(m.selector),
+		controller.WithExcludeSelector(m.excludeSel),
+		controller.WithAnnotationSelector(m.annotations),
+		controller.WithGrace(m.grace),
+		controller.WithGraceFrom(m.graceFrom),
+		controller.WithMinTerminatedAge(m.minTermAge),
+		controller.WithReasons(m.reasons),
+		controller.WithReasonGrace(m.reasonGrace),
+		controller.WithRestartRate(m.restartRate),
+		controller.WithRestartThreshold(m.restarts.threshold, m.restarts.window),
+		controller.WithNotReadyTimeout(m.notReady),
+		controller.WithConditions(m.conditions),
+		controller.WithImageFilters(m.images.include, m.images.exclude),
+		controller.WithContainers(m.containers.include, m.containers.exclude),
+		controller.WithExcludeServiceAccounts(m.excludeSAs),
+		controller.WithMinProtectedPriority(m.priority.min),
+		controller.WithPriorityClasses(m.priority.classes),
+		controller.WithIgnoreDisruptionAnnotations(m.ignoreAnno),
+		controller.WithPhases(m.phases),
+		controller.WithActions(actions),
+		controller.WithDefaultAction(m.action),
+		controller.WithOrder(m.order),
+		controller.WithRules(m.rules),
+		controller.WithNamespaceOverrides(m.overrides),
+		controller.WithWindows(m.windows),
+	)
+}
+
+// applyConfig sets values from the configuration file for any flags
+// that were not explicitly set on the command line.
+func (m *mainCommand) applyConfig(f *pflag.FlagSet, cfg *config.Config) error {
+	setString := func(name string, dest *string, value string) {
+		if !f.Changed(name) && value != "" {
+			*dest = value
+		}
+	}
+
+	setString("kubeconfig", &m.kubeconfig, cfg.Kubeconfig)
+	setString("context", &m.kubeContext, cfg.Context)
+	setString("as", &m.kubeAs, cfg.As)
+	setString("namespace", &m.namespace, cfg.Namespace)
+	setString("schedule", &m.schedule, cfg.Schedule)
+	setString("history", &m.history.store, cfg.History)
+	setString("redis-password-file", &m.history.passwordFile, cfg.RedisPasswordFile)
+	setString("status-configmap", &m.statusCM, cfg.StatusConfigMap)
+	setString("control-configmap", &m.controlCM, cfg.ControlConfigMap)
+	setString("log-format", &m.logFormat, cfg.LogFormat)
+	setString("log-output", &m.logOutput, cfg.LogOutput)
+	setString("selector", &m.selector, cfg.Selector)
+	setString("exclude-selector", &m.excludeSel, cfg.ExcludeSelector)
+	setString("annotation-selector", &m.annotations, cfg.AnnotationSelector)
+	setString("grace-from", &m.graceFrom, cfg.GraceFrom)
+	setString("order", &m.order, cfg.Order)
+	setString("report-format", &m.reportFormat, cfg.ReportFormat)
+	setString("report-file", &m.reportFile, cfg.ReportFile)
+	setString("summary-file", &m.summaryFile, cfg.SummaryFile)
+
+	if !f.Changed("log-sampling") && cfg.LogSampling != nil {
+		m.logSampling = *cfg.LogSampling
+	}
+
+	if !f.Changed("list-chunk-size") && cfg.ListChunkSize != nil {
+		m.chunkSize = *cfg.ListChunkSize
+	}
+
+	if !f.Changed("kube-api-json") && cfg.KubeAPIJSON {
+		m.kubeJSON = true
+	}
+
+	if !f.Changed("as-group") && len(cfg.AsGroups) > 0 {
+		m.kubeAsGroup = cfg.AsGroups
+	}
+
+	if !f.Changed("resync-period") && cfg.ResyncPeriod != nil {
+		m.resync = *cfg.ResyncPeriod
+	}
+
+	if !f.Changed("kubeconfig-reload") && cfg.KubeconfigReload != 0 {
+		m.kubeReload = cfg.KubeconfigReload
+	}
+
+	if !f.Changed("tombstone") && cfg.Tombstone {
+		m.tombstone = true
+	}
+
+	if !f.Changed("annotate-owners") && cfg.AnnotateOwners {
+		m.annotateOwner = true
+	}
+
+	if !f.Changed("check-pdb") && cfg.CheckPDB {
+		m.checkPDB = true
+	}
+
+	setString("statefulset-mode", &m.stsMode, cfg.StatefulSetMode)
+
+	if !f.Changed("check-rollouts") && cfg.CheckRollouts {
+		m.checkRollout = true
+	}
+
+	if !f.Changed("allow-last-ready-replica") && cfg.AllowLastReadyReplica {
+		m.allowLast = true
+	}
+
+	if !f.Changed("log-capture-lines") && cfg.LogCaptureLines != 0 {
+		m.logCapture.lines = cfg.LogCaptureLines
+	}
+
+	setString("log-capture-dir", &m.logCapture.dir, cfg.LogCaptureDir)
+	setString("http-address", &m.httpAddress, cfg.HTTPAddress)
+	setString("admin-token-file", &m.adminToken, cfg.AdminTokenFile)
+	setString("debug-addr", &m.debugAddr, cfg.DebugAddr)
+	setString("canary-namespace", &m.canary.namespace, cfg.CanaryNamespace)
+	setString("canary-image", &m.canary.image, cfg.CanaryImage)
+
+	if !f.Changed("canary-interval") && cfg.CanaryInterval != 0 {
+		m.canary.interval = cfg.CanaryInterval
+	}
+
+	if !f.Changed("canary-slo") && cfg.CanarySLO != 0 {
+		m.canary.slo = cfg.CanarySLO
+	}
+
+	setString("audit-file", &m.audit.file, cfg.AuditFile)
+	setString("audit-level", &m.audit.level, cfg.AuditLevel)
+
+	if !f.Changed("audit-max-size") && cfg.AuditMaxSize != nil {
+		m.audit.maxSize = *cfg.AuditMaxSize
+	}
+
+	if !f.Changed("audit-max-age") && cfg.AuditMaxAge != nil {
+		m.audit.maxAge = *cfg.AuditMaxAge
+	}
+
+	if !f.Changed("audit-max-backups") && cfg.AuditMaxBackups != nil {
+		m.audit.maxBackups = *cfg.AuditMaxBackups
+	}
+
+	setString("archive", &m.archive.url, cfg.Archive)
+	setString("archive-cluster", &m.archive.cluster, cfg.ArchiveCluster)
+	setString("archive-region", &m.archive.region, cfg.ArchiveRegion)
+	setString("archive-endpoint", &m.archive.endpoint, cfg.ArchiveEndpoint)
+	setString("archive-access-key", &m.archive.accessKey, cfg.ArchiveAccessKey)
+	setString("archive-secret-file", &m.archive.secretFile, cfg.ArchiveSecretFile)
+
+	if !f.Changed("archive-events") && cfg.ArchiveEvents {
+		m.archive.events = true
+	}
+
+	setString("statsd-addr", &m.statsd.address, cfg.StatsDAddr)
+
+	if !f.Changed("statsd-prefix") && cfg.StatsDPrefix != nil {
+		m.statsd.prefix = *cfg.StatsDPrefix
+	}
+
+	if !f.Changed("statsd-no-tags") && cfg.StatsDNoTags {
+		m.statsd.noTags = true
+	}
+
+	setString("pushgateway-url", &m.pushgateway.url, cfg.PushgatewayURL)
+	setString("pushgateway-job", &m.pushgateway.job, cfg.PushgatewayJob)
+
+	if !f.Changed("pushgateway-grouping") && len(cfg.PushgatewayGrouping) > 0 {
+		m.pushgateway.grouping = cfg.PushgatewayGrouping
+	}
+
+	setString("stream-nats", &m.stream.nats, cfg.StreamNATS)
+	setString("stream-kafka-rest", &m.stream.kafkaREST, cfg.StreamKafkaREST)
+	setString("stream-topic", &m.stream.topic, cfg.StreamTopic)
+	setString("stream-user", &m.stream.user, cfg.StreamUser)
+	setString("stream-password-file", &m.stream.passwordFile, cfg.StreamPasswordFile)
+	setString("stream-level", &m.stream.level, cfg.StreamLevel)
+	setString("cloudevents-sink", &m.cloudEvents.sink, cfg.CloudEventsSink)
+	setString("cloudevents-source", &m.cloudEvents.source, cfg.CloudEventsSource)
+	setString("cloudevents-password-file", &m.cloudEvents.passwordFile, cfg.CloudEventsPasswordFile)
+	setString("datadog-api-key-file", &m.datadog.apiKeyFile, cfg.DatadogAPIKeyFile)
+	setString("datadog-site", &m.datadog.site, cfg.DatadogSite)
+
+	if !f.Changed("datadog-tags") && len(cfg.DatadogTags) > 0 {
+		m.datadog.tags = cfg.DatadogTags
+	}
+
+	if !f.Changed("datadog-rollup") && cfg.DatadogRollup {
+		m.datadog.rollup = true
+	}
+
+	if !f.Changed("history-retention") && cfg.HistoryRetention != 0 {
+		m.history.retention = cfg.HistoryRetention
+	}
+
+	if !f.Changed("kube-api-qps") && cfg.KubeAPIQPS != 0 {
+		m.kubeQPS = cfg.KubeAPIQPS
+	}
+
+	if !f.Changed("kube-api-burst") && cfg.KubeAPIBurst != 0 {
+		m.kubeBurst = cfg.KubeAPIBurst
+	}
+
+	if !f.Changed("kube-api-timeout") && cfg.KubeAPITimeout != 0 {
+		m.kubeTimeout = cfg.KubeAPITimeout
+	}
+
+	if !f.Changed("log-level") && cfg.LogLevel != "" {
+		if err := m.logLevel.Set(cfg.LogLevel); err != nil {
+			return errors.Wrapf(err, "invalid log level %q", cfg.LogLevel)
+		}
+	}
+
+	if !f.Changed("reasons") && len(cfg.Reasons.Names) > 0 {
+		m.reasons = cfg.Reasons.Names
+	}
+	m.reasonGrace = cfg.Reasons.Grace
+
+	if !f.Changed("dry-run") && cfg.DryRun {
+		m.dryRun = true
+	}
+
+	if !f.Changed("explain") && cfg.Explain {
+		m.explain = true
+	}
+
+	if !f.Changed("once") && cfg.Once {
+		m.once = true
+	}
+
+	if !f.Changed("exit-code-on-delete") && cfg.ExitCodeOnDelete != 0 {
+		m.exitCodes.delete = cfg.ExitCodeOnDelete
+	}
+
+	if !f.Changed("exit-code-on-candidates") && cfg.ExitCodeOnCandidates != 0 {
+		m.exitCodes.candidates = cfg.ExitCodeOnCandidates
+	}
+
+	if !f.Changed("grace-period") && cfg.GracePeriod != 0 {
+		m.grace = cfg.GracePeriod
+	}
+
+	if !f.Changed("min-terminated-age") && cfg.MinTerminatedAge != 0 {
+		m.minTermAge = cfg.MinTerminatedAge
+	}
+
+	if !f.Changed("restart-rate") && cfg.RestartRate != 0 {
+		m.restartRate = cfg.RestartRate
+	}
+
+	if !f.Changed("restart-threshold") && cfg.RestartThreshold != 0 {
+		m.restarts.threshold = cfg.RestartThreshold
+	}
+
+	if !f.Changed("restart-window") && cfg.RestartWindow != 0 {
+		m.restarts.window = cfg.RestartWindow
+	}
+
+	if !f.Changed("not-ready-timeout") && cfg.NotReadyTimeout != 0 {
+		m.notReady = cfg.NotReadyTimeout
+	}
+
+	if !f.Changed("event-reasons") && len(cfg.EventReasons) > 0 {
+		m.events.reasons = cfg.EventReasons
+	}
+
+	if !f.Changed("event-threshold") && cfg.EventThreshold != nil {
+		m.events.threshold = *cfg.EventThreshold
+	}
+
+	if !f.Changed("event-window") && cfg.EventWindow != 0 {
+		m.events.window = cfg.EventWindow
+	}
+
+	if !f.Changed("max-memory-percent") && cfg.MaxMemoryPercent != 0 {
+		m.usage.memory = cfg.MaxMemoryPercent
+	}
+
+	if !f.Changed("max-cpu-percent") && cfg.MaxCPUPercent != 0 {
+		m.usage.cpu = cfg.MaxCPUPercent
+	}
+
+	if !f.Changed("containers") && len(cfg.Containers) > 0 {
+		m.containers.include = cfg.Containers
+	}
+
+	if !f.Changed("exclude-containers") && len(cfg.ExcludeContainers) > 0 {
+		m.containers.exclude = cfg.ExcludeContainers
+	}
+
+	if !f.Changed("include-images") && len(cfg.IncludeImages) > 0 {
+		m.images.include = cfg.IncludeImages
+	}
+
+	if !f.Changed("exclude-images") && len(cfg.ExcludeImages) > 0 {
+		m.images.exclude = cfg.ExcludeImages
+	}
+
+	if !f.Changed("exclude-service-accounts") && len(cfg.ExcludeServiceAccounts) > 0 {
+		m.excludeSAs = cfg.ExcludeServiceAccounts
+	}
+
+	if !f.Changed("min-protected-priority") && cfg.MinProtectedPriority != 0 {
+		m.priority.min = cfg.MinProtectedPriority
+	}
+
+	if !f.Changed("only-priority-classes") && len(cfg.OnlyPriorityClasses) > 0 {
+		m.priority.classes = cfg.OnlyPriorityClasses
+	}
+
+	if !f.Changed("ignore-disruption-annotations") && cfg.IgnoreDisruption {
+		m.ignoreAnno = true
+	}
+
+	if !f.Changed("phases") && len(cfg.Phases) > 0 {
+		m.phases = cfg.Phases
+	}
+
+	if !f.Changed("action") && cfg.Action != "" {
+		m.action = cfg.Action
+	}
+
+	if len(cfg.Actions) > 0 {
+		m.actions = cfg.Actions
+	}
+
+	if !f.Changed("interval") && cfg.Interval != 0 {
+		m.interval = cfg.Interval
+	}
+
+	if !f.Changed("drain-nodes") && len(cfg.DrainNodes) > 0 {
+		m.drainNodes = cfg.DrainNodes
+	}
+
+	if !f.Changed("drain-annotation") && cfg.DrainAnnotation {
+		m.drainAnno = true
+	}
+
+	if !f.Changed("cordoned-node-delay") && cfg.CordonedNodeDelay != 0 {
+		m.cordonDelay = cfg.CordonedNodeDelay
+	}
+
+	if !f.Changed("node-not-ready-timeout") && cfg.NodeNotReadyTimeout != 0 {
+		m.unready.timeout = cfg.NodeNotReadyTimeout
+	}
+
+	if !f.Changed("node-not-ready-force") && cfg.NodeNotReadyForce {
+		m.unready.force = true
+	}
+
+	if !f.Changed("unknown-phase-timeout") && cfg.UnknownPhaseTimeout != 0 {
+		m.unknown.timeout = cfg.UnknownPhaseTimeout
+	}
+
+	if !f.Changed("unknown-phase-force") && cfg.UnknownPhaseForce {
+		m.unknown.force = true
+	}
+
+	if !f.Changed("orphaned-pod-grace") && cfg.OrphanedPodGrace != 0 {
+		m.orphanGrace = cfg.OrphanedPodGrace
+	}
+
+	if !f.Changed("finished-job-ttl") && cfg.FinishedJobTTL != 0 {
+		m.finishedTTL = cfg.FinishedJobTTL
+	}
+
+	if !f.Changed("budget") && cfg.Budget != nil {
+		m.budget = *cfg.Budget
+	}
+
+	if !f.Changed("budget-window") && cfg.BudgetWindow != 0 {
+		m.budgetWin = cfg.BudgetWindow
+	}
+
+	if !f.Changed("keep-failing") && cfg.KeepFailing != 0 {
+		m.keepFailing = cfg.KeepFailing
+	}
+
+	if !f.Changed("mass-failure-percent") && cfg.MassFailurePercent != 0 {
+		m.massFailure.percent = cfg.MassFailurePercent
+	}
+
+	if !f.Changed("mass-failure-min-candidates") && cfg.MassFailureMin != nil {
+		m.massFailure.min = *cfg.MassFailureMin
+	}
+
+	if !f.Changed("node-health-percent") && cfg.NodeHealthPercent != 0 {
+		m.nodeHealth = cfg.NodeHealthPercent
+	}
+
+	if !f.Changed("flap-threshold") && cfg.FlapThreshold != 0 {
+		m.flapThreshold = cfg.FlapThreshold
+	}
+
+	if !f.Changed("flap-window") && cfg.FlapWindow != 0 {
+		m.flapWindow = cfg.FlapWindow
+	}
+
+	if !f.Changed("flap-scale-down") && cfg.FlapScaleDown {
+		m.flapScaleDown = true
+	}
+
+	if !f.Changed("retry-attempts") && cfg.RetryAttempts != 0 {
+		m.retry.attempts = cfg.RetryAttempts
+	}
+
+	if !f.Changed("retry-backoff") && cfg.RetryBackoff != 0 {
+		m.retry.backoff = cfg.RetryBackoff
+	}
+
+	if !f.Changed("retry-max-backoff") && cfg.RetryMaxBackoff != 0 {
+		m.retry.maxBackoff = cfg.RetryMaxBackoff
+	}
+
+	if !f.Changed("delete-delay") && cfg.DeleteDelay != 0 {
+		m.deleteDelay = cfg.DeleteDelay
+	}
+
+	if !f.Changed("replacement-window") && cfg.ReplacementWindow != 0 {
+		m.replaceWin = cfg.ReplacementWindow
+	}
+
+	if !f.Changed("wait-for-replacement") && cfg.WaitForReplacement != 0 {
+		m.waitReplace = cfg.WaitForReplacement
+	}
+
+	if !f.Changed("fail-fast") && cfg.FailFast {
+		m.failFast = true
+	}
+
+	if !f.Changed("no-eval-cache") && cfg.NoEvalCache {
+		m.noEvalCache = true
+	}
+
+	// replaced, not appended, when the configuration is reloaded
+	m.conditions = nil
+	for _, cond := range cfg.Conditions {
+		m.conditions = append(m.conditions, controller.Condition{
+			Type:   cond.Type,
+			Status: cond.Status,
+			Reason: cond.Reason,
+			For:    cond.For,
+		})
+	}
+
+	for _, r := range cfg.Rules {
+		m.rules = append(m.rules, controller.Rule{
+			Name:          r.Name,
+			Namespace:     r.Namespace,
+			Selector:      r.Selector,
+			Reasons:       r.Reasons.Names,
+			ReasonGrace:   r.Reasons.Grace,
+			Grace:         r.GracePeriod,
+			RestartRate:   r.RestartRate,
+			IncludeImages: r.IncludeImages,
+			ExcludeImages: r.ExcludeImages,
+			Action:        r.Action,
+			Windows:       config.ControllerWindows(r.Windows),
+		})
+	}
+
+	m.windows = config.ControllerWindows(cfg.Windows)
+
+	if len(cfg.Namespaces) > 0 {
+		m.overrides = make(map[string]controller.NamespaceOverride, len(cfg.Namespaces))
+		for ns, o := range cfg.Namespaces {
+			m.overrides[ns] = controller.NamespaceOverride{
+				Reasons:  o.Reasons,
+				Grace:    o.GracePeriod,
+				Priority: o.Priority,
+			}
+		}
+	}
+
+	return nil
+}
+
+// effectiveConfig returns the configuration in use, after flags and the
+// configuration file have been applied.
+func (m *mainCommand) effectiveConfig() *config.Config {
+	budget := m.budget
+	chunkSize := m.chunkSize
+	resync := m.resync
+	eventThreshold := m.events.threshold
+	auditMaxSize := m.audit.maxSize
+	auditMaxAge := m.audit.maxAge
+	auditMaxBackups := m.audit.maxBackups
+	statsdPrefix := m.statsd.prefix
+	logSampling := m.logSampling
+	cfg := &config.Config{
+		Kubeconfig:              m.kubeconfig,
+		Context:                 m.kubeContext,
+		ListChunkSize:           &chunkSize,
+		KubeAPIJSON:             m.kubeJSON,
+		KubeAPIQPS:              m.kubeQPS,
+		KubeAPIBurst:            m.kubeBurst,
+		KubeAPITimeout:          m.kubeTimeout,
+		As:                      m.kubeAs,
+		AsGroups:                m.kubeAsGroup,
+		ResyncPeriod:            &resync,
+		KubeconfigReload:        m.kubeReload,
+		Namespace:               m.namespace,
+		Selector:                m.selector,
+		ExcludeSelector:         m.excludeSel,
+		AnnotationSelector:      m.annotations,
+		LogLevel:                m.logLevel.String(),
+		LogFormat:               m.logFormat,
+		LogOutput:               m.logOutput,
+		LogSampling:             &logSampling,
+		Explain:                 m.explain,
+		Reasons:                 config.Reasons{Names: m.reasons, Grace: m.reasonGrace},
+		DryRun:                  m.dryRun,
+		Once:                    m.once,
+		ReportFormat:            m.reportFormat,
+		ReportFile:              m.reportFile,
+		SummaryFile:             m.summaryFile,
+		ExitCodeOnDelete:        m.exitCodes.delete,
+		ExitCodeOnCandidates:    m.exitCodes.candidates,
+		GracePeriod:             m.grace,
+		GraceFrom:               m.graceFrom,
+		MinTerminatedAge:        m.minTermAge,
+		RestartRate:             m.restartRate,
+		RestartThreshold:        m.restarts.threshold,
+		RestartWindow:           m.restarts.window,
+		NotReadyTimeout:         m.notReady,
+		EventReasons:            m.events.reasons,
+		EventThreshold:          &eventThreshold,
+		EventWindow:             m.events.window,
+		MaxMemoryPercent:        m.usage.memory,
+		MaxCPUPercent:           m.usage.cpu,
+		Containers:              m.containers.include,
+		ExcludeContainers:       m.containers.exclude,
+		IncludeImages:           m.images.include,
+		ExcludeImages:           m.images.exclude,
+		ExcludeServiceAccounts:  m.excludeSAs,
+		MinProtectedPriority:    m.priority.min,
+		OnlyPriorityClasses:     m.priority.classes,
+		IgnoreDisruption:        m.ignoreAnno,
+		Phases:                  m.phases,
+		Action:                  m.action,
+		Actions:                 m.actions,
+		Interval:                m.interval,
+		Schedule:                m.schedule,
+		Budget:                  &budget,
+		Order:                   m.order,
+		BudgetWindow:            m.budgetWin,
+		KeepFailing:             m.keepFailing,
+		MassFailurePercent:      m.massFailure.percent,
+		MassFailureMin:          &m.massFailure.min,
+		NodeHealthPercent:       m.nodeHealth,
+		FlapThreshold:           m.flapThreshold,
+		FlapWindow:              m.flapWindow,
+		FlapScaleDown:           m.flapScaleDown,
+		RetryAttempts:           m.retry.attempts,
+		RetryBackoff:            m.retry.backoff,
+		RetryMaxBackoff:         m.retry.maxBackoff,
+		DeleteDelay:             m.deleteDelay,
+		ReplacementWindow:       m.replaceWin,
+		WaitForReplacement:      m.waitReplace,
+		FailFast:                m.failFast,
+		NoEvalCache:             m.noEvalCache,
+		Tombstone:               m.tombstone,
+		AnnotateOwners:          m.annotateOwner,
+		CheckPDB:                m.checkPDB,
+		CheckRollouts:           m.checkRollout,
+		StatefulSetMode:         m.stsMode,
+		AllowLastReadyReplica:   m.allowLast,
+		HTTPAddress:             m.httpAddress,
+		AdminTokenFile:          m.adminToken,
+		DebugAddr:               m.debugAddr,
+		CanaryNamespace:         m.canary.namespace,
+		CanaryImage:             m.canary.image,
+		CanaryInterval:          m.canary.interval,
+		CanarySLO:               m.canary.slo,
+		AuditFile:               m.audit.file,
+		AuditLevel:              m.audit.level,
+		AuditMaxSize:            &auditMaxSize,
+		AuditMaxAge:             &auditMaxAge,
+		AuditMaxBackups:         &auditMaxBackups,
+		LogCaptureLines:         m.logCapture.lines,
+		LogCaptureDir:           m.logCapture.dir,
+		Archive:                 m.archive.url,
+		ArchiveCluster:          m.archive.cluster,
+		ArchiveEvents:           m.archive.events,
+		ArchiveRegion:           m.archive.region,
+		ArchiveEndpoint:         m.archive.endpoint,
+		ArchiveAccessKey:        m.archive.accessKey,
+		ArchiveSecretFile:       m.archive.secretFile,
+		StatsDAddr:              m.statsd.address,
+		StatsDPrefix:            &statsdPrefix,
+		StatsDNoTags:            m.statsd.noTags,
+		PushgatewayURL:          m.pushgateway.url,
+		PushgatewayJob:          m.pushgateway.job,
+		PushgatewayGrouping:     m.pushgateway.grouping,
+		StreamNATS:              m.stream.nats,
+		StreamKafkaREST:         m.stream.kafkaREST,
+		StreamTopic:             m.stream.topic,
+		StreamUser:              m.stream.user,
+		StreamPasswordFile:      m.stream.passwordFile,
+		StreamLevel:             m.stream.level,
+		CloudEventsSink:         m.cloudEvents.sink,
+		CloudEventsSource:       m.cloudEvents.source,
+		CloudEventsPasswordFile: m.cloudEvents.passwordFile,
+		DatadogAPIKeyFile:       m.datadog.apiKeyFile,
+		DatadogSite:             m.datadog.site,
+		DatadogTags:             m.datadog.tags,
+		DatadogRollup:           m.datadog.rollup,
+		History:                 m.history.store,
+		HistoryRetention:        m.history.retention,
+		RedisPasswordFile:       m.history.passwordFile,
+		StatusConfigMap:         m.statusCM,
+		ControlConfigMap:        m.controlCM,
+		DrainNodes:              m.drainNodes,
+		DrainAnnotation:         m.drainAnno,
+		CordonedNodeDelay:       m.cordonDelay,
+		NodeNotReadyTimeout:     m.unready.timeout,
+		NodeNotReadyForce:       m.unready.force,
+		UnknownPhaseTimeout:     m.unknown.timeout,
+		UnknownPhaseForce:       m.unknown.force,
+		OrphanedPodGrace:        m.orphanGrace,
+		FinishedJobTTL:          m.finishedTTL,
+	}
+
+	// the interval is not used with a schedule
+	if m.schedule != "" {
+		cfg.Interval = 0
+	}
+
+	for _, cond := range m.conditions {
+		cfg.Conditions = append(cfg.Conditions, config.Condition{
+			Type:   cond.Type,
+			Status: cond.Status,
+			Reason: cond.Reason,
+			For:    cond.For,
+		})
+	}
+
+	for _, r := range m.rules {
+		cfg.Rules = append(cfg.Rules, config.Rule{
+			Name:          r.Name,
+			Namespace:     r.Namespace,
+			Selector:      r.Selector,
+			Reasons:       config.Reasons{Names: r.Reasons, Grace: r.ReasonGrace},
+			GracePeriod:   r.Grace,
+			RestartRate:   r.RestartRate,
+			IncludeImages: r.IncludeImages,
+			ExcludeImages: r.ExcludeImages,
+			Action:        r.Action,
+			Windows:       config.ConfigWindows(r.Windows),
+		})
+	}
+
+	cfg.Windows = config.ConfigWindows(m.windows)
+
+	if len(m.overrides) > 0 {
+		cfg.Namespaces = make(map[string]config.NamespaceOverride, len(m.overrides))
+		for ns, o := range m.overrides {
+			cfg.Namespaces[ns] = config.NamespaceOverride{
+				Reasons:     o.Reasons,
+				GracePeriod: o.Grace,
+				Priority:    o.Priority,
+			}
+		}
+	}
+
+	return cfg
+}
@@ -0,0 +1,30 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+func newMux(m *mainCommand, c *controller.Controller, status *statusz) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	mux.Handle("/statusz", status)
+	mux.Handle("/status", m.statusHandler(c))
+	return mux
+}
+
+// bundleHandler serves a support bundle with the controller's recent
+// decisions. It is part of the admin API, as the bundle includes the
+// configuration.
+func (m *mainCommand) bundleHandler(c *controller.Controller) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/gzip")
+		w.Header().Set("Content-Disposition", `attachment; filename="support-bundle.tar.gz"`)
+		if err := m.writeBundle(w, c, c.RecentDecisions(), prometheus.DefaultGatherer); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
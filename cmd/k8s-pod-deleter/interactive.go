@@ -0,0 +1,73 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+)
+
+// prompter asks before each candidate is acted on. Declined candidates
+// are vetoed.
+type prompter struct {
+	in   *bufio.Reader
+	out  io.Writer
+	all  bool
+	quit bool
+}
+
+func newPrompter(in io.Reader, out io.Writer) *prompter {
+	return &prompter{
+		in:  bufio.NewReader(in),
+		out: out,
+	}
+}
+
+func (p *prompter) hooks() controller.Hooks {
+	return controller.Hooks{
+		BeforeDelete: p.beforeDelete,
+	}
+}
+
+func (p *prompter) beforeDelete(cand controller.Candidate) error {
+	if p.quit {
+		return errors.New("quit")
+	}
+	if p.all {
+		return nil
+	}
+
+	for {
+		fmt.Fprintf(p.out, "%s pod %s/%s (%s)? [y/N/a/q] ",
+			cand.Action,
+			cand.Pod.ObjectMeta.Namespace,
+			cand.Pod.ObjectMeta.Name,
+			cand.Reason,
+		)
+
+		line, err := p.in.ReadString('\n')
+		if err != nil && line == "" {
+			// no more input, such as when stdin is closed
+			fmt.Fprintln(p.out)
+			p.quit = true
+			return errors.New("quit")
+		}
+
+		switch strings.ToLower(strings.TrimSpace(line)) {
+		case "y", "yes":
+			return nil
+		case "", "n", "no":
+			return errors.New("declined")
+		case "a", "all":
+			p.all = true
+			return nil
+		case "q", "quit":
+			p.quit = true
+			return errors.New("quit")
+		}
+		fmt.Fprintln(p.out, "answer y, n, a to act on this and all remaining pods, or q to skip all remaining pods")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/printer"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+// candidate is a candidate as printed by list and served by the admin API
+type candidate struct {
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Rule      string    `json:"rule,omitempty"`
+	Reason    string    `json:"reason"`
+	Action    string    `json:"action"`
+	Owner     string    `json:"owner,omitempty"`
+	Node      string    `json:"node,omitempty"`
+	Created   time.Time `json:"created"`
+	Draining  bool      `json:"draining,omitempty"`
+}
+
+type candidateList []candidate
+
+func newCandidateList(candidates []controller.Candidate) candidateList {
+	out := make(candidateList, 0, len(candidates))
+	for _, cand := range candidates {
+		out = append(out, candidate{
+			Namespace: cand.Pod.ObjectMeta.Namespace,
+			Name:      cand.Pod.ObjectMeta.Name,
+			Rule:      cand.Rule,
+			Reason:    cand.Reason,
+			Action:    cand.Action,
+			Owner:     cand.Owner(),
+			Node:      cand.Pod.Spec.NodeName,
+			Created:   cand.Pod.ObjectMeta.CreationTimestamp.Time,
+			Draining:  cand.Draining,
+		})
+	}
+	return out
+}
+
+func (l candidateList) Table() printer.TableData {
+	t := printer.TableData{
+		Columns: []printer.Column{
+			{Name: "NAMESPACE"},
+			{Name: "NAME"},
+			{Name: "REASON"},
+			{Name: "AGE"},
+			{Name: "OWNER"},
+			{Name: "RULE", Wide: true},
+			{Name: "ACTION", Wide: true},
+			{Name: "NODE", Wide: true},
+		},
+	}
+	for _, cand := range l {
+		t.Rows = append(t.Rows, []string{
+			cand.Namespace,
+			cand.Name,
+			cand.Reason,
+			shortDuration(time.Since(cand.Created)),
+			cand.Owner,
+			ruleName(cand.Rule),
+			cand.Action,
+			cand.Node,
+		})
+	}
+	return t
+}
+
+func (m *mainCommand) listCommand() *cobra.Command {
+	return &cobra.Command{
+		Use:           "list",
+		Short:         "list pods that would be deleted",
+		Args:          cobra.NoArgs,
+		RunE:          m.runList,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+}
+
+func (m *mainCommand) runList(cmd *cobra.Command, args []string) error {
+	p, err := printer.New(m.output)
+	if err != nil {
+		return err
+	}
+
+	_, _, c, err := m.setup(cmd)
+	if err != nil {
+		return err
+	}
+
+	candidates, err := c.Candidates()
+	if err != nil {
+		return errors.Wrap(err, "failed to get candidates")
+	}
+
+	return p.Print(os.Stdout, newCandidateList(candidates))
+}
+
+// shortDuration formats a duration like kubectl does for ages
+func shortDuration(d time.Duration) string {
+	switch {
+	case d < time.Minute:
+		return fmt.Sprintf("%ds", int(d.Seconds()))
+	case d < time.Hour:
+		return fmt.Sprintf("%dm", int(d.Minutes()))
+	case d < time.Hour*48:
+		return fmt.Sprintf("%dh", int(d.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(d.Hours()/24))
+	}
+}
@@ -3,34 +3,262 @@ package main
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"os/signal"
+	"strings"
 	"syscall"
 	"time"
 
+	"github.com/bakins/k8s-pod-deleter/pkg/archive"
+	"github.com/bakins/k8s-pod-deleter/pkg/audit"
+	"github.com/bakins/k8s-pod-deleter/pkg/canary"
+	"github.com/bakins/k8s-pod-deleter/pkg/cloudevents"
+	"github.com/bakins/k8s-pod-deleter/pkg/config"
 	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/datadog"
+	"github.com/bakins/k8s-pod-deleter/pkg/flags"
+	"github.com/bakins/k8s-pod-deleter/pkg/history"
 	"github.com/bakins/k8s-pod-deleter/pkg/k8s"
+	"github.com/bakins/k8s-pod-deleter/pkg/podlogs"
+	"github.com/bakins/k8s-pod-deleter/pkg/printer"
+	"github.com/bakins/k8s-pod-deleter/pkg/statsd"
+	"github.com/bakins/k8s-pod-deleter/pkg/status"
+	"github.com/bakins/k8s-pod-deleter/pkg/stream"
+	"github.com/bakins/k8s-pod-deleter/pkg/version"
 	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"github.com/robfig/cron"
 	"github.com/spf13/cobra"
 	"github.com/spf13/pflag"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/client-go/tools/clientcmd"
 
 	// load auth methods
 	_ "k8s.io/client-go/plugin/pkg/client/auth"
 )
 
+type canaryOptions struct {
+	namespace string
+	image     string
+	interval  time.Duration
+	slo       time.Duration
+}
+
+type retryOptions struct {
+	attempts   int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+type imageOptions struct {
+	include []string
+	exclude []string
+}
+
+type containerOptions struct {
+	include []string
+	exclude []string
+}
+
+type priorityOptions struct {
+	min     int32
+	classes []string
+}
+
+type restartOptions struct {
+	threshold int32
+	window    time.Duration
+}
+
+type eventOptions struct {
+	reasons   []string
+	threshold int
+	window    time.Duration
+}
+
+type usageOptions struct {
+	memory float64
+	cpu    float64
+}
+
+type unreadyOptions struct {
+	timeout time.Duration
+	force   bool
+}
+
+type unknownOptions struct {
+	timeout time.Duration
+	force   bool
+}
+
+type statsdOptions struct {
+	address string
+	prefix  string
+	noTags  bool
+}
+
+type datadogOptions struct {
+	apiKeyFile string
+	site       string
+	tags       []string
+	rollup     bool
+}
+
+type streamOptions struct {
+	nats         string
+	kafkaREST    string
+	topic        string
+	user         string
+	passwordFile string
+	level        string
+}
+
+type cloudEventsOptions struct {
+	sink         string
+	source       string
+	passwordFile string
+}
+
+type auditOptions struct {
+	file       string
+	level      string
+	maxSize    int
+	maxAge     time.Duration
+	maxBackups int
+}
+
+type massFailureOptions struct {
+	percent float64
+	min     int
+}
+
+type logCaptureOptions struct {
+	lines int64
+	dir   string
+}
+
+type historyOptions struct {
+	store        string
+	retention    time.Duration
+	passwordFile string
+}
+
+type exitCodeOptions struct {
+	delete     int
+	candidates int
+}
+
 type mainCommand struct {
+	configFile  string
 	kubeconfig  string
 	kubeContext string
+	chunkSize   int64
+	kubeJSON    bool
+	kubeQPS     float32
+	kubeBurst   int
+	kubeTimeout time.Duration
+	kubeAs      string
+	kubeAsGroup []string
+	kubeFlags   clientcmd.ConfigOverrides
+	resync      time.Duration
+	kubeReload  time.Duration
 	namespace   string
 	selector    string
+	excludeSel  string
+	annotations string
 	logLevel    logLevel
+	logFormat   string
+	logOutput   string
+	logSampling int
+	explain     bool
+	output      string
 	reasons     []string
+	reasonGrace map[string]time.Duration
+	restartRate float64
+	restarts    restartOptions
+	notReady    time.Duration
+	events      eventOptions
+	usage       usageOptions
+	images      imageOptions
+	containers  containerOptions
+	excludeSAs  []string
+	priority    priorityOptions
+	ignoreAnno  bool
+	phases      []string
+	action      string
+	actions     map[string]config.Action
 	dryRun      bool
 	once        bool
+	interactive bool
 	grace       time.Duration
+	graceFrom   string
+	minTermAge  time.Duration
 	interval    time.Duration
+	schedule    string
+	budget      int
+	budgetWin   time.Duration
+	order       string
+	httpAddress string
+	debugAddr   string
+	adminToken  string
+	canary      canaryOptions
+	drainNodes  []string
+	drainAnno   bool
+	cordonDelay time.Duration
+	unready     unreadyOptions
+	unknown     unknownOptions
+	orphanGrace time.Duration
+	finishedTTL time.Duration
+	rules       []controller.Rule
+	windows     []controller.Window
+	conditions  []controller.Condition
+	overrides   map[string]controller.NamespaceOverride
+	version     bool
+
+	reportFormat string
+	reportFile   string
+	summaryFile  string
+	exitCodes    exitCodeOptions
+	noEvalCache  bool
+
+	flapThreshold int
+	flapWindow    time.Duration
+	flapScaleDown bool
+	retry         retryOptions
+	deleteDelay   time.Duration
+	replaceWin    time.Duration
+	waitReplace   time.Duration
+	failFast      bool
+	statsd        statsdOptions
+	datadog       datadogOptions
+	stream        streamOptions
+	cloudEvents   cloudEventsOptions
+	pushgateway   pushgatewayOptions
+	history       historyOptions
+	audit         auditOptions
+	logCapture    logCaptureOptions
+	archive       archiveOptions
+	tombstone     bool
+	annotateOwner bool
+	checkPDB      bool
+	allowLast     bool
+	checkRollout  bool
+	stsMode       string
+	keepFailing   int
+	massFailure   massFailureOptions
+	nodeHealth    float64
+	statusCM      string
+	controlCM     string
+
+	// only the long running deleter watches pods
+	watchPods bool
+	podCache  *k8s.PodCache
 }
 
 func main() {
@@ -44,65 +272,941 @@ func main() {
 		SilenceUsage:  true,
 	}
 
-	f := cmd.Flags()
-	f.StringVar(&m.kubeconfig, "kubeconfig", "", "Kubernetes client config. If not specified, an in-cluster client is tried.")
-	f.StringVar(&m.kubeContext, "context", "", "Kubernetes client context. Only used if kubeconfig is specified. Defaults to value in Kubernetes config file")
+	cmd.AddCommand(m.listCommand())
+	cmd.AddCommand(m.checkCommand())
+	cmd.AddCommand(m.planCommand())
+	cmd.AddCommand(m.applyCommand())
+	cmd.AddCommand(m.supportBundleCommand())
+	cmd.AddCommand(versionCommand())
+
+	// flags used by all commands
+	f := cmd.PersistentFlags()
+	f.StringVar(&m.configFile, "config", "", "configuration file. Flags that are set take precedence over values in the file")
+	f.StringVar(&m.kubeconfig, "kubeconfig", "", "Kubernetes client config. If not specified, $KUBECONFIG or ~/.kube/config is used, then an in-cluster client is tried")
+	f.StringVar(&m.kubeContext, "context", "", "Kubernetes client context. Defaults to value in Kubernetes config file")
+	bindKubeFlags(f, &m.kubeFlags)
+	f.Int64Var(&m.chunkSize, "list-chunk-size", 500, "maximum number of pods returned by each list request. Zero lists all pods at once")
+	f.BoolVar(&m.kubeJSON, "kube-api-json", false, "use JSON rather than protobuf when talking to the Kubernetes API. Useful for debugging")
+	f.Float32Var(&m.kubeQPS, "kube-api-qps", 5, "maximum queries per second to the Kubernetes API")
+	f.IntVar(&m.kubeBurst, "kube-api-burst", 10, "maximum burst of queries to the Kubernetes API above --kube-api-qps")
+	f.DurationVar(&m.kubeTimeout, "kube-api-timeout", 0, "timeout for each request to the Kubernetes API. Zero means no timeout")
+	// --request-timeout is the name kubectl uses
+	if err := flags.Alias(f, "request-timeout", "kube-api-timeout"); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+	f.StringVar(&m.kubeAs, "as", "", "username to impersonate for Kubernetes API requests")
+	f.StringSliceVar(&m.kubeAsGroup, "as-group", nil, "group to impersonate for Kubernetes API requests. Requires --as. May be passed multiple times")
+	f.DurationVar(&m.kubeReload, "kubeconfig-reload", 0, "how often to check the kubeconfig, and the certificates it refers to, for changes, and create the client again if they changed. Not used with --once. Zero disables")
+	f.DurationVar(&m.resync, "resync-period", time.Minute*10, "how often the pod cache lists all pods again. Zero disables the cache and lists pods on every run")
 	f.StringVar(&m.namespace, "namespace", "", "only consider pods in this namespace. Default is all namespaces")
 	f.StringVar(&m.selector, "selector", "", "only consider pods that match this label selector. Default is all pods")
-	f.BoolVar(&m.once, "once", false, "run controller loop once and exit")
-	f.BoolVar(&m.dryRun, "dry-run", false, "run controller but do not delete pods")
+	f.StringVar(&m.excludeSel, "exclude-selector", "", "never delete pods that match this label selector, such as team=storage")
+	f.StringVar(&m.annotations, "annotation-selector", "", "only consider pods whose annotations match this selector, using the label selector syntax, such as deploy-tool=spinnaker,!debug. Checked after listing pods")
 	f.StringSliceVar(&m.reasons, "reasons", controller.DefaultReasons, "reasons to delete pod. exact match only. May be passed multiple times for multiple reasons")
 	f.DurationVar(&m.grace, "grace-period", time.Hour, "pods that were created less than this time ago are not considered for deletion")
-	f.DurationVar(&m.interval, "interval", time.Minute*5, "how often to run controller loop")
+	f.StringVar(&m.graceFrom, "grace-from", controller.GraceFromCreation, "when the grace period starts. One of creation, or state to start when the pod became unhealthy")
+	f.DurationVar(&m.minTermAge, "min-terminated-age", 0, "only match a terminated container's reason if it stopped at least this long ago, so the kubelet can restart it first. Zero disables")
+	f.Float64Var(&m.restartRate, "restart-rate", 0, "delete pods whose containers restarted more than this many times per hour, measured across runs over --restart-window. Zero disables")
+	f.Int32Var(&m.restarts.threshold, "restart-threshold", 0, "delete pods whose containers restarted more than this many times within --restart-window, measured across runs. Zero disables")
+	f.DurationVar(&m.restarts.window, "restart-window", time.Hour, "window for counting restarts. Restart counts are kept in the history, if it is persisted")
+	f.DurationVar(&m.notReady, "not-ready-timeout", 0, "delete pods that have not been ready for this long, even if no container is in one of the reasons. Zero disables")
+	f.StringSliceVar(&m.events.reasons, "event-reasons", nil, "delete pods with more than --event-threshold warning events with these reasons, such as BackOff or FailedMount, within --event-window. Requires permission to list events")
+	f.IntVar(&m.events.threshold, "event-threshold", 5, "warning events within --event-window above which a pod is deleted")
+	f.DurationVar(&m.events.window, "event-window", time.Minute*10, "window for counting warning events")
+	f.Float64Var(&m.usage.memory, "max-memory-percent", 0, "delete pods with a container using more than this percentage of its memory limit, as reported by metrics-server. Requires permission to list pods.metrics.k8s.io. Disabled if zero")
+	f.Float64Var(&m.usage.cpu, "max-cpu-percent", 0, "delete pods with a container using more than this percentage of its CPU limit, as reported by metrics-server. Requires permission to list pods.metrics.k8s.io. Disabled if zero")
+	f.StringSliceVar(&m.containers.include, "containers", nil, "only consider the statuses of containers with these names")
+	f.StringSliceVar(&m.containers.exclude, "exclude-containers", nil, "ignore the statuses of containers with these names, such as sidecars")
+	f.StringSliceVar(&m.images.include, "include-images", nil, "only consider pods with a container image matching one of these patterns. Patterns are globs where * matches any characters, or regular expressions if prefixed with regex:")
+	f.StringSliceVar(&m.images.exclude, "exclude-images", nil, "never delete pods with a container image matching one of these patterns")
+	f.StringSliceVar(&m.excludeSAs, "exclude-service-accounts", nil, "never delete pods running as these service accounts. Use namespace/name to match a single namespace")
+	f.Int32Var(&m.priority.min, "min-protected-priority", 0, "never delete pods with a priority at or above this value, such as 2000000000 for system-cluster-critical. 0 disables")
+	f.StringSliceVar(&m.priority.classes, "only-priority-classes", nil, "only delete pods in these priority classes")
+	f.BoolVar(&m.ignoreAnno, "ignore-disruption-annotations", false, "do not skip pods that the cluster-autoscaler or Karpenter annotations mark as not safe to disrupt")
+	f.StringSliceVar(&m.phases, "phases", nil, "only evaluate pods in these phases: Pending, Running, Succeeded, Failed, or Unknown. Default is Running and Failed")
+	f.StringSliceVar(&m.drainNodes, "drain-nodes", nil, "nodes being drained. Candidates on these nodes are deleted first. May be passed multiple times")
+	f.BoolVar(&m.drainAnno, "drain-annotation", false, "delete candidates on nodes annotated with "+controller.DrainAnnotation+"=true first. Requires permission to list nodes")
+	f.DurationVar(&m.cordonDelay, "cordoned-node-delay", 0, "delete pods on nodes that have been cordoned for longer than this, to finish drains that stalled. DaemonSet and static pods are not deleted. Requires permission to list nodes. Disabled if zero")
+	f.DurationVar(&m.unready.timeout, "node-not-ready-timeout", 0, "delete pods on nodes that have not been ready for longer than this. Requires permission to list nodes. Disabled if zero")
+	f.BoolVar(&m.unready.force, "node-not-ready-force", false, "force delete pods on nodes that have not been ready for longer than --node-not-ready-timeout, rather than applying the action, as the kubelet will never confirm the deletion")
+	f.DurationVar(&m.unknown.timeout, "unknown-phase-timeout", 0, "delete pods that have been in the Unknown phase, because their kubelet cannot be reached, for longer than this. Disabled if zero")
+	f.BoolVar(&m.unknown.force, "unknown-phase-force", false, "force delete pods that have been in the Unknown phase for longer than --unknown-phase-timeout, rather than applying the action, as the kubelet may never confirm the deletion")
+	f.DurationVar(&m.orphanGrace, "orphaned-pod-grace", 0, "force delete pods on nodes that have not existed for longer than this. Requires permission to list nodes. Disabled if zero")
+	f.DurationVar(&m.finishedTTL, "finished-job-ttl", 0, "delete Succeeded and Failed pods of Jobs that finished longer ago than this, for clusters without the TTL-after-finished controller. Independent of the reasons and grace period. Requires permission to get jobs. Disabled if zero")
 	levelFlag(f, &m.logLevel, "log-level", zapcore.InfoLevel, "log level")
+	f.StringVar(&m.logFormat, "log-format", "json", "log format: json or console")
+	f.StringVar(&m.logOutput, "log-output", "stderr", "where to write logs: stderr, stdout, or file:/path")
+	f.IntVar(&m.logSampling, "log-sampling", 100, "each second, log the first this many entries with the same message and every this many thereafter. Zero disables sampling")
+	f.StringVarP(&m.output, "output", "o", printer.Table, "output format for list, check, plan, apply, and the --once summary: "+strings.Join(printer.Formats, ", ")+". wide adds more columns to the table")
+	f.BoolVar(&m.explain, "explain", false, "log why each pod was skipped by each rule at info level, with the setting it was compared with, without turning on debug logging")
+
+	f = cmd.Flags()
+	f.BoolVar(&m.version, "version", false, "print version information and exit")
+	f.BoolVar(&m.once, "once", false, "run controller loop once and exit")
+	f.BoolVar(&m.interactive, "interactive", false, "with --once, ask before acting on each pod")
+	f.BoolVar(&m.dryRun, "dry-run", false, "run controller but do not delete pods")
+	f.StringVar(&m.reportFormat, "report-format", "", "with --once, write a report of deleted and skipped pods in this format: json or yaml. Disabled if empty")
+	f.StringVar(&m.reportFile, "report-file", "-", "file to write the report to. Use - for stdout")
+	f.StringVar(&m.summaryFile, "summary-file", "", "with --once, write a JSON summary of the run, including how it ended, to this file when it exits, even if the run failed. Disabled if empty")
+	f.IntVar(&m.exitCodes.delete, "exit-code-on-delete", 0, "with --once, exit with this status if any pods were acted on and none failed. Errors always exit with 1")
+	f.IntVar(&m.exitCodes.candidates, "exit-code-on-candidates", 0, "with --once and --dry-run, exit with this status if any pods would have been acted on")
+	f.StringVar(&m.action, "action", controller.DeleteActionName, "action applied to pods that match. One of delete, evict, rollout-restart, delete-job, or an action defined in the configuration file")
+	f.DurationVar(&m.interval, "interval", time.Minute*5, "how often to run controller loop")
+	f.StringVar(&m.schedule, "schedule", "", "cron expression for when to run the controller loop, such as \"*/15 8-18 * * 1-5\". Used instead of --interval")
+	f.IntVar(&m.budget, "budget", -1, "maximum number of pods to delete within the budget window. Negative means no limit")
+	f.DurationVar(&m.budgetWin, "budget-window", time.Hour, "sliding time window for the deletion budget")
+	f.IntVar(&m.keepFailing, "keep-failing", 0, "keep the newest this many failing pods of each workload for debugging, and only act on older ones. Zero keeps none")
+	f.Float64Var(&m.massFailure.percent, "mass-failure-percent", 0, "abort a run, acting on no pods, if more than this percentage of the pods it evaluated are candidates, as that likely means a problem with the cluster, such as a registry outage. Zero disables")
+	f.IntVar(&m.massFailure.min, "mass-failure-min-candidates", 10, "only abort a run for --mass-failure-percent if it has at least this many candidates, so a few failing pods in a small namespace do not")
+	f.Float64Var(&m.nodeHealth, "node-health-percent", 0, "abort a run, acting on no pods, if more than this percentage of nodes are not ready, as pods fail with their nodes. Requires permission to list nodes. Zero disables")
+	f.StringVar(&m.order, "order", controller.OrderPriority, "order to delete candidates in when the budget cannot cover them all. One of priority (namespace priority), restarts (most restarts first), or oldest-failure")
+	f.IntVar(&m.flapThreshold, "flap-threshold", 0, "stop deleting pods of a workload after this many of its pods were deleted within the flap window. Zero disables")
+	f.DurationVar(&m.flapWindow, "flap-window", time.Hour, "sliding time window for flap detection")
+	f.BoolVar(&m.flapScaleDown, "flap-scale-down", false, "scale the Deployment of a workload to zero when it starts flapping. Requires --flap-threshold and permission to get and update Deployments and ReplicaSets")
+	f.IntVar(&m.retry.attempts, "retry-attempts", 3, "how many times to try a Kubernetes API call that fails with a transient error")
+	f.DurationVar(&m.retry.backoff, "retry-backoff", time.Second, "time to wait before the first retry. Doubled for each retry, with jitter")
+	f.DurationVar(&m.retry.maxBackoff, "retry-max-backoff", time.Second*30, "maximum time to wait between retries")
+	f.DurationVar(&m.replaceWin, "replacement-window", 0, "after deleting a pod, count whether its owner created a replacement that became ready within this time, in pod_deleter_replacements_total. Zero disables")
+	f.DurationVar(&m.waitReplace, "wait-for-replacement", 0, "when a run acts on several pods of the same owner, wait up to this long after each one for a ready replacement before acting on the next. Zero disables")
+	f.DurationVar(&m.deleteDelay, "delete-delay", 0, "time to wait between acting on pods within a run, so they are not all replaced at once. Retries do not wait for it. Zero disables")
+	f.BoolVar(&m.failFast, "fail-fast", false, "stop a run at the first pod that cannot be deleted instead of continuing with the rest")
+	f.BoolVar(&m.tombstone, "tombstone", false, "annotate pods with who is deleting them, the reason, and the time before deleting them. Requires permission to patch pods")
+	f.BoolVar(&m.annotateOwner, "annotate-owners", false, "annotate the workload that owns each deleted pod with the time of the last deletion and a count. Requires permission to get and patch workloads")
+	f.BoolVar(&m.allowLast, "allow-last-ready-replica", false, "act on a pod even if it is the only ready pod of its owner. By default, these pods are skipped so a degraded workload keeps serving")
+	f.BoolVar(&m.checkRollout, "check-rollouts", false, "skip pods of a Deployment that is rolling out and already has as many unavailable replicas as its strategy allows. Requires permission to get replicasets and deployments")
+	f.StringVar(&m.stsMode, "statefulset-mode", "", "how to handle pods owned by a StatefulSet: skip to never act on them, or serial to act on one pod of each StatefulSet at a time, after the previous one was replaced by a ready pod. Empty handles them as any other pod")
+	f.BoolVar(&m.checkPDB, "check-pdb", false, "skip ready pods covered by a pod disruption budget that allows no more disruptions. Requires permission to list poddisruptionbudgets")
+	f.StringVar(&m.history.store, "history", "memory", "where to keep the history of deletions, so the budget and flap detection survive restarts: memory, file:/path, configmap:namespace/name, or redis:host:port/key to share it between replicas")
+	f.DurationVar(&m.history.retention, "history-retention", time.Hour*24, "how long deletions are kept in the history")
+	f.StringVar(&m.history.passwordFile, "redis-password-file", "", "file containing the password for a redis history")
+	f.StringVar(&m.statusCM, "status-configmap", "", "namespace/name of a ConfigMap to write the status of each run to, so other tools can alert if the deleter stops making progress. Requires permission to get, create, and update it. Disabled if empty")
+	f.StringVar(&m.controlCM, "control-configmap", "", "namespace/name of a ConfigMap to watch as a kill switch, such as pod-deleter/pod-deleter-control. While its enabled key is \"false\", no pods are acted on. Requires permission to get and watch it. Disabled if empty")
+	f.BoolVar(&m.noEvalCache, "no-eval-cache", false, "evaluate every pod on each run instead of caching results until the pod changes")
+	f.StringVar(&m.httpAddress, "http-address", "", "address for the HTTP server that serves metrics, status, and the admin API. Disabled if empty")
+	f.StringVar(&m.audit.file, "audit-file", "", "file to write an audit log of deletions to, as JSON lines. Disabled if empty")
+	f.StringVar(&m.audit.level, "audit-level", "actions", "which decisions to audit: actions, candidates to include skipped candidates, or all to include pods that did not match a rule")
+	f.IntVar(&m.audit.maxSize, "audit-max-size", 100, "rotate the audit log when it would grow larger than this many megabytes. Zero disables")
+	f.DurationVar(&m.audit.maxAge, "audit-max-age", time.Hour*24, "rotate the audit log when it is older than this. Zero disables")
+	f.IntVar(&m.audit.maxBackups, "audit-max-backups", 7, "number of rotated audit logs to keep. Zero keeps all")
+	f.Int64Var(&m.logCapture.lines, "log-capture-lines", 0, "before acting on a pod, capture the last this many lines of the logs of each container, and of its previous instance if it restarted. Written to --log-capture-dir, --archive, or the audit log. Requires permission to get pods/log. Zero disables")
+	f.StringVar(&m.logCapture.dir, "log-capture-dir", "", "directory to write captured logs to, in namespace/pod-time/container.log. If empty, they are written to the archive or the audit log")
+	f.StringVar(&m.archive.url, "archive", "", "where to archive the manifest of each pod before acting on it: s3://bucket/prefix, gs://bucket/prefix, azblob://account/container/prefix, or file:/path. Disabled if empty")
+	f.StringVar(&m.archive.cluster, "archive-cluster", "", "name of the cluster, used as the first part of each key so clusters can share a bucket")
+	f.BoolVar(&m.archive.events, "archive-events", false, "include the pod's events in the archive. Requires permission to list events")
+	f.StringVar(&m.archive.region, "archive-region", "", "region of an s3:// bucket. Default is $AWS_REGION, or us-east-1")
+	f.StringVar(&m.archive.endpoint, "archive-endpoint", "", "URL of the storage service, such as a MinIO server. Default is the service for the scheme")
+	f.StringVar(&m.archive.accessKey, "archive-access-key", "", "access key ID for s3:// or gs:// with HMAC keys. Default is $AWS_ACCESS_KEY_ID")
+	f.StringVar(&m.archive.secretFile, "archive-secret-file", "", "file containing the secret access key for s3:// or gs://, or a shared access signature for azblob://. Default for s3:// and gs:// is $AWS_SECRET_ACCESS_KEY")
+	f.StringVar(&m.statsd.address, "statsd-addr", "", "address of a StatsD server to send deletion counts and run durations to. Disabled if empty")
+	f.StringVar(&m.statsd.prefix, "statsd-prefix", "pod_deleter.", "prefix for StatsD metric names")
+	f.BoolVar(&m.statsd.noTags, "statsd-no-tags", false, "do not send DogStatsD tags, for StatsD servers that do not support them")
+	f.StringVar(&m.pushgateway.url, "pushgateway-url", "", "with --once, URL of a Prometheus Pushgateway to push metrics to at the end of the run, for CronJobs that exit before they can be scraped. Disabled if empty")
+	f.StringVar(&m.pushgateway.job, "pushgateway-job", "k8s-pod-deleter", "job label of metrics pushed to the Pushgateway, such as the name of the CronJob")
+	f.StringSliceVar(&m.pushgateway.grouping, "pushgateway-grouping", nil, "name=value labels to add to the Pushgateway grouping key, such as cluster=production. May be passed multiple times")
+	f.StringVar(&m.datadog.apiKeyFile, "datadog-api-key-file", "", "file containing a Datadog API key. If set, deletions are posted as Datadog events")
+	f.StringVar(&m.datadog.site, "datadog-site", "datadoghq.com", "Datadog site to post events to, such as datadoghq.eu")
+	f.StringSliceVar(&m.datadog.tags, "datadog-tags", nil, "tags to add to every Datadog event, such as cluster:production")
+	f.BoolVar(&m.datadog.rollup, "datadog-rollup", false, "post a single Datadog event per run rather than one per deletion")
+	f.StringVar(&m.stream.nats, "stream-nats", "", "address of a NATS server, such as nats:4222, to publish a message to for every pod acted on. Disabled if empty")
+	f.StringVar(&m.stream.kafkaREST, "stream-kafka-rest", "", "URL of a Confluent Kafka REST Proxy, such as http://kafka-rest:8082, to produce a message through for every pod acted on. Kafka brokers cannot be reached directly. Disabled if empty")
+	f.StringVar(&m.stream.topic, "stream-topic", stream.DefaultTopic, "NATS subject or Kafka topic to publish messages to")
+	f.StringVar(&m.stream.user, "stream-user", "", "user to authenticate to NATS or the Kafka REST Proxy as")
+	f.StringVar(&m.stream.passwordFile, "stream-password-file", "", "file containing the password for --stream-user. For NATS without a user, it is sent as a token")
+	f.StringVar(&m.stream.level, "stream-level", "actions", "which decisions to publish, as for --audit-level: actions, candidates, or all")
+	f.StringVar(&m.cloudEvents.sink, "cloudevents-sink", "", "where to send CloudEvents for pods acted on and workloads escalated: an http:// or https:// URL, or mqtt://[user@]host:port/topic. Disabled if empty")
+	f.StringVar(&m.cloudEvents.source, "cloudevents-source", cloudevents.DefaultSource, "source of every CloudEvent, such as /clusters/production/k8s-pod-deleter")
+	f.StringVar(&m.cloudEvents.passwordFile, "cloudevents-password-file", "", "file containing the password for the user of an MQTT sink")
+	f.StringVar(&m.adminToken, "admin-token-file", "", "file containing the bearer token for the admin API. The admin API is served by the HTTP server and is disabled if empty")
+	f.StringVar(&m.debugAddr, "debug-addr", "", "address for an HTTP server that serves pprof profiles and expvar. Disabled if empty")
+	f.StringVar(&m.canary.namespace, "canary-namespace", "", "namespace to create canary pods in. Canary checks are disabled if empty")
+	f.StringVar(&m.canary.image, "canary-image", "busybox", "image for canary pods. Must include sh")
+	f.DurationVar(&m.canary.interval, "canary-interval", time.Hour*2, "how often to create a canary pod")
+	f.DurationVar(&m.canary.slo, "canary-slo", time.Hour*2, "how long a canary pod may exist before the check fails. Must be longer than the grace period plus interval")
+
+	// groups for help output. Ungrouped flags are listed as "Flags."
+	r := flags.New()
+	r.Group("Kubernetes", "kubeconfig", "context", "cluster", "user", "server", "certificate-authority", "insecure-skip-tls-verify", "token", "client-certificate", "client-key", "list-chunk-size", "kube-api-json", "kube-api-qps", "kube-api-burst", "kube-api-timeout", "as", "as-group", "kubeconfig-reload", "resync-period")
+	r.Group("Selection", "namespace", "selector", "exclude-selector", "annotation-selector", "reasons", "grace-period", "grace-from", "min-terminated-age", "restart-rate", "restart-threshold", "restart-window", "not-ready-timeout", "event-reasons", "event-threshold", "event-window", "max-memory-percent", "max-cpu-percent", "containers", "exclude-containers", "include-images", "exclude-images", "exclude-service-accounts", "min-protected-priority", "only-priority-classes", "ignore-disruption-annotations", "phases", "drain-nodes", "drain-annotation", "cordoned-node-delay", "node-not-ready-timeout", "node-not-ready-force", "unknown-phase-timeout", "unknown-phase-force", "orphaned-pod-grace", "finished-job-ttl")
+	r.Group("Logging", "log-level", "log-format", "log-output", "log-sampling", "explain")
+	r.Group("Output", "output")
+	r.Group("Run", "once", "interactive", "dry-run", "report-format", "report-file", "summary-file", "exit-code-on-delete", "exit-code-on-candidates", "action", "interval", "schedule", "budget", "budget-window", "keep-failing", "mass-failure-percent", "mass-failure-min-candidates", "node-health-percent", "order", "flap-threshold", "flap-window", "flap-scale-down", "retry-attempts", "retry-backoff", "retry-max-backoff", "delete-delay", "wait-for-replacement", "fail-fast", "replacement-window", "check-pdb", "check-rollouts", "statefulset-mode", "allow-last-ready-replica", "tombstone", "annotate-owners", "history", "history-retention", "redis-password-file", "status-configmap", "control-configmap", "no-eval-cache")
+	r.Group("HTTP", "http-address", "admin-token-file", "debug-addr")
+	r.Group("Audit", "audit-file", "audit-level", "audit-max-size", "audit-max-age", "audit-max-backups", "log-capture-lines", "log-capture-dir")
+	r.Group("Archive", "archive", "archive-cluster", "archive-events", "archive-region", "archive-endpoint", "archive-access-key", "archive-secret-file")
+	r.Group("StatsD", "statsd-addr", "statsd-prefix", "statsd-no-tags")
+	r.Group("Pushgateway", "pushgateway-url", "pushgateway-job", "pushgateway-grouping")
+	r.Group("Datadog", "datadog-api-key-file", "datadog-site", "datadog-tags", "datadog-rollup")
+	r.Group("Stream", "stream-nats", "stream-kafka-rest", "stream-topic", "stream-user", "stream-password-file", "stream-level")
+	r.Group("CloudEvents", "cloudevents-sink", "cloudevents-source", "cloudevents-password-file")
+	r.Group("Canary", "canary-namespace", "canary-image", "canary-interval", "canary-slo")
+	cmd.SetUsageFunc(r.UsageFunc())
 
 	if err := cmd.Execute(); err != nil {
+		if code, ok := err.(exitCode); ok {
+			os.Exit(int(code))
+		}
 		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
 }
 
+// bindKubeFlags adds the standard kubectl flags for choosing and
+// connecting to a cluster. --context, --namespace, --as, and --as-group
+// are defined separately, as they can be set in the configuration file
+// or mean something else here. --request-timeout is a deprecated alias
+// of --kube-api-timeout.
+func bindKubeFlags(f *pflag.FlagSet, overrides *clientcmd.ConfigOverrides) {
+	names := clientcmd.RecommendedConfigOverrideFlags("")
+	clientcmd.BindClusterFlags(&overrides.ClusterInfo, f, names.ClusterOverrideFlags)
+	names.AuthOverrideFlags.Token.BindStringFlag(f, &overrides.AuthInfo.Token).AddSecretAnnotation(f)
+	names.AuthOverrideFlags.ClientCertificate.BindStringFlag(f, &overrides.AuthInfo.ClientCertificate).AddSecretAnnotation(f)
+	names.AuthOverrideFlags.ClientKey.BindStringFlag(f, &overrides.AuthInfo.ClientKey).AddSecretAnnotation(f)
+	names.ContextOverrideFlags.ClusterName.BindStringFlag(f, &overrides.Context.Cluster)
+	names.ContextOverrideFlags.AuthInfoName.BindStringFlag(f, &overrides.Context.AuthInfo)
+}
+
+// exitCode is returned by a command that succeeded but should exit with
+// a status other than zero. Nothing is printed.
+type exitCode int
+
+func (e exitCode) Error() string {
+	return fmt.Sprintf("exit status %d", int(e))
+}
+
+// exitCode returns the status for a successful run in once mode, if
+// --exit-code-on-delete or --exit-code-on-candidates applies.
+func (m *mainCommand) exitCode(result *controller.RunResult) error {
+	if len(result.Deleted) == 0 {
+		return nil
+	}
+
+	code := m.exitCodes.delete
+	if result.DryRun {
+		code = m.exitCodes.candidates
+	}
+	if code == 0 {
+		return nil
+	}
+	return exitCode(code)
+}
+
 func (m *mainCommand) runDeleter(cmd *cobra.Command, args []string) error {
+	if m.version {
+		return printVersion(false)
+	}
 
-	client, err := k8s.New(m.kubeconfig, m.kubeContext)
+	switch m.reportFormat {
+	case "", "json", "yaml":
+	default:
+		return errors.Errorf("invalid report format %q. Must be json or yaml", m.reportFormat)
+	}
 
+	// keep the values from flags so the configuration file can be reapplied on reload
+	base := *m
+
+	m.watchPods = true
+
+	client, logger, c, err := m.setup(cmd)
 	if err != nil {
-		return errors.Wrap(err, "failed to create Kubernetes client")
+		return err
 	}
 
-	logger, err := createLogger(m.logLevel.Level)
-	if err != nil {
-		return errors.Wrap(err, "failed to create logger")
+	// once may be set in the configuration file
+	if m.reportFormat != "" && !m.once {
+		return errors.New("--report-format requires --once")
 	}
 
-	c, err := controller.New(client, client,
-		controller.WithNamespace(m.namespace),
-		controller.WithSelector(m.selector),
-		controller.WithLogger(logger),
-		controller.WithDryRun(m.dryRun),
-		controller.WithGrace(m.grace),
-		controller.WithInterval(m.interval),
-	)
+	if m.summaryFile != "" && !m.once {
+		return errors.New("--summary-file requires --once")
+	}
+
+	if m.interactive && !m.once {
+		return errors.New("--interactive requires --once")
+	}
+
+	var pusher *push.Pusher
+	if m.pushgateway.url != "" {
+		if !m.once {
+			return errors.New("--pushgateway-url requires --once")
+		}
+		pusher, err = m.pusher(c)
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, opt := range []struct {
+		name string
+		code int
+	}{
+		{"exit-code-on-delete", m.exitCodes.delete},
+		{"exit-code-on-candidates", m.exitCodes.candidates},
+	} {
+		if opt.code == 0 {
+			continue
+		}
+		if !m.once {
+			return errors.Errorf("--%s requires --once", opt.name)
+		}
+		// 1 is the status for errors
+		if opt.code < 2 || opt.code > 255 {
+			return errors.Errorf("--%s must be between 2 and 255", opt.name)
+		}
+	}
 
+	// the summary is only printed if asked for, so --once stays quiet by default
+	var summary *printer.Printer
+	if cmd.Flags().Changed("output") {
+		if !m.once {
+			return errors.New("--output requires --once")
+		}
+		summary, err = printer.New(m.output)
+		if err != nil {
+			return err
+		}
+	}
+
+	if m.adminToken != "" && m.httpAddress == "" {
+		return errors.New("--admin-token-file requires --http-address")
+	}
+
+	if m.schedule != "" && m.once {
+		return errors.New("--schedule cannot be used with --once")
+	}
+
+	schedule, err := m.parseSchedule()
 	if err != nil {
-		return errors.Wrap(err, "failed to create controller")
+		return err
+	}
+
+	var control []string
+	if m.controlCM != "" {
+		control = strings.SplitN(m.controlCM, "/", 2)
+		if len(control) != 2 || control[0] == "" || control[1] == "" {
+			return errors.Errorf("invalid control ConfigMap %q. Must be namespace/name", m.controlCM)
+		}
+	}
+
+	collectors := []prometheus.Collector{c}
+
+	var can *canary.Canary
+	if m.canary.namespace != "" && !m.once {
+		can, err = canary.New(client, m.canary.namespace,
+			canary.WithLogger(logger),
+			canary.WithImage(m.canary.image),
+			canary.WithInterval(m.canary.interval),
+			canary.WithSLO(m.canary.slo),
+		)
+		if err != nil {
+			return errors.Wrap(err, "failed to create canary")
+		}
+		collectors = append(collectors, can)
+	}
+
+	if m.httpAddress != "" {
+		for _, collector := range collectors {
+			if err := prometheus.Register(collector); err != nil {
+				return errors.Wrap(err, "failed to register metrics")
+			}
+		}
+
+		status := &statusz{
+			client:   client,
+			c:        c,
+			canary:   can,
+			interval: m.interval,
+			schedule: schedule,
+		}
+
+		mux := newMux(m, c, status)
+		if m.adminToken != "" {
+			a, err := newAdmin(c, m.adminToken)
+			if err != nil {
+				return err
+			}
+			a.register(mux, m.bundleHandler(c))
+		}
+
+		go func() {
+			if err := http.ListenAndServe(m.httpAddress, mux); err != nil {
+				logger.Fatal("failed to run HTTP server", zap.Error(err))
+			}
+		}()
+	}
+
+	if m.debugAddr != "" {
+		go func() {
+			if err := http.ListenAndServe(m.debugAddr, newDebugMux()); err != nil {
+				logger.Fatal("failed to run debug HTTP server", zap.Error(err))
+			}
+		}()
 	}
 
 	if m.once {
-		return c.Once(context.Background())
+		if control != nil {
+			if err := readControl(client, control, c); err != nil {
+				return err
+			}
+		}
+
+		start := time.Now()
+		result, err := m.runOnce(c, pusher, summary, logger)
+		if m.summaryFile != "" {
+			if serr := writeSummaryFile(m.summaryFile, start, result, err); serr != nil {
+				if err == nil {
+					return serr
+				}
+				logger.Error("failed to write summary file", zap.Error(serr))
+			}
+		}
+		return err
 	}
 
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
 	sigs := make(chan os.Signal, 1)
 	signal.Notify(sigs, syscall.SIGINT, syscall.SIGTERM)
 
 	go func() {
 		<-sigs
+		cancel()
 		c.Stop()
 	}()
 
+	if can != nil {
+		go can.Loop(ctx)
+	}
+
+	if m.kubeReload > 0 {
+		go client.WatchConfig(ctx, m.kubeReload, logger)
+	}
+
+	if control != nil {
+		// stay disabled until the control ConfigMap has been read, so a
+		// failure to read it does not turn deletions on
+		c.Disable()
+		if err := readControl(client, control, c); err != nil {
+			logger.Error("failed to read control ConfigMap, disabled until it is read", zap.Error(err))
+		}
+		go client.WatchConfigMap(ctx, control[0], control[1], logger, c.SetControl)
+	}
+
+	if m.podCache != nil {
+		go m.podCache.Run(ctx)
+		if err := m.podCache.WaitForSync(ctx); err != nil {
+			return err
+		}
+	}
+
+	usr2 := make(chan os.Signal, 1)
+	signal.Notify(usr2, syscall.SIGUSR2)
+
+	go func() {
+		for range usr2 {
+			if c.Paused() {
+				c.Resume()
+			} else {
+				c.Pause()
+			}
+		}
+	}()
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+
+	go func() {
+		for range hup {
+			if err := base.reload(cmd.Flags(), client, c); err != nil {
+				logger.Error("failed to reload configuration", zap.Error(err))
+				continue
+			}
+			logger.Info("reloaded configuration", zap.String("config", m.configFile))
+		}
+	}()
+
 	return c.Loop()
 }
 
+// readControl enables or disables the controller from the control
+// ConfigMap. A missing ConfigMap enables it.
+func readControl(client *k8s.Client, control []string, c *controller.Controller) error {
+	cm, err := client.GetConfigMap(control[0], control[1])
+	switch {
+	case k8sErrors.IsNotFound(err):
+		c.SetControl(nil)
+	case err != nil:
+		return errors.Wrap(err, "failed to get control ConfigMap")
+	default:
+		c.SetControl(cm)
+	}
+	return nil
+}
+
+// runOnce runs the controller once, and writes the report and summary
+// if asked for. It returns the result, if the run got that far, along
+// with the error the command should exit with.
+func (m *mainCommand) runOnce(c *controller.Controller, pusher *push.Pusher, summary *printer.Printer, logger *zap.Logger) (*controller.RunResult, error) {
+	result, err := c.Run(context.Background())
+	// push even if the run failed, so the failure is recorded
+	if pusher != nil {
+		if err := pusher.Push(); err != nil {
+			logger.Error("failed to push metrics to the Pushgateway", zap.Error(err))
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	if m.reportFormat != "" {
+		if err := m.writeReport(result); err != nil {
+			return result, err
+		}
+	}
+	if summary != nil {
+		if err := summary.Print(os.Stdout, runSummary{result}); err != nil {
+			return result, err
+		}
+	}
+	if err := result.Err(); err != nil {
+		return result, err
+	}
+	return result, m.exitCode(result)
+}
+
+// setup loads the configuration file, if any, and creates the
+// Kubernetes client, logger, and controller.
+func (m *mainCommand) setup(cmd *cobra.Command) (*k8s.Client, *zap.Logger, *controller.Controller, error) {
+	if m.configFile != "" {
+		cfg, err := config.Load(m.configFile)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to load configuration")
+		}
+		if err := m.applyConfig(cmd.Flags(), cfg); err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to apply configuration")
+		}
+	}
+
+	if m.schedule != "" && cmd.Flags().Changed("interval") {
+		return nil, nil, nil, errors.New("--schedule and --interval cannot be used together")
+	}
+
+	kubeOptions := []k8s.Option{
+		k8s.WithOverrides(m.kubeFlags),
+		k8s.WithChunkSize(m.chunkSize),
+		k8s.WithRateLimit(m.kubeQPS, m.kubeBurst),
+		k8s.WithTimeout(m.kubeTimeout),
+		k8s.WithImpersonation(m.kubeAs, m.kubeAsGroup),
+	}
+	if m.kubeJSON {
+		kubeOptions = append(kubeOptions, k8s.WithJSON())
+	}
+
+	client, err := k8s.New(m.kubeconfig, m.kubeContext, kubeOptions...)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to create Kubernetes client")
+	}
+
+	logger, err := m.createLogger()
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to create logger")
+	}
+	logger = logger.With(zap.String("version", version.Version))
+
+	actions, err := buildActions(client, m.actions)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to create actions")
+	}
+
+	schedule, err := m.parseSchedule()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	options := []controller.Option{
+		controller.WithNamespace(m.namespace),
+		controller.WithSelector(m.selector),
+		controller.WithExcludeSelector(m.excludeSel),
+		controller.WithAnnotationSelector(m.annotations),
+		controller.WithLogger(logger),
+		controller.WithDryRun(m.dryRun),
+		controller.WithExplain(m.explain),
+		controller.WithGrace(m.grace),
+		controller.WithGraceFrom(m.graceFrom),
+		controller.WithMinTerminatedAge(m.minTermAge),
+		controller.WithInterval(m.interval),
+		controller.WithSchedule(schedule),
+		controller.WithReasons(m.reasons),
+		controller.WithReasonGrace(m.reasonGrace),
+		controller.WithRestartRate(m.restartRate),
+		controller.WithRestartThreshold(m.restarts.threshold, m.restarts.window),
+		controller.WithNotReadyTimeout(m.notReady),
+		controller.WithConditions(m.conditions),
+		controller.WithImageFilters(m.images.include, m.images.exclude),
+		controller.WithContainers(m.containers.include, m.containers.exclude),
+		controller.WithExcludeServiceAccounts(m.excludeSAs),
+		controller.WithMinProtectedPriority(m.priority.min),
+		controller.WithPriorityClasses(m.priority.classes),
+		controller.WithIgnoreDisruptionAnnotations(m.ignoreAnno),
+		controller.WithPhases(m.phases),
+		controller.WithActions(actions),
+		controller.WithDefaultAction(m.action),
+		controller.WithRules(m.rules),
+		controller.WithNamespaceOverrides(m.overrides),
+		controller.WithWindows(m.windows),
+		controller.WithBudget(m.budget, m.budgetWin),
+		controller.WithKeepFailing(m.keepFailing),
+		controller.WithMassFailureThreshold(m.massFailure.percent, m.massFailure.min),
+		controller.WithOrder(m.order),
+		controller.WithFlapDetection(m.flapThreshold, m.flapWindow),
+		controller.WithRetry(m.retry.attempts, m.retry.backoff, m.retry.maxBackoff),
+		controller.WithDeleteDelay(m.deleteDelay),
+		controller.WithReplacementCheck(m.replaceWin),
+		controller.WithWaitForReplacement(m.waitReplace),
+		controller.WithFailFast(m.failFast),
+		controller.WithDrainNodes(m.drainNodes),
+		controller.WithEvalCache(!m.noEvalCache),
+		controller.WithWarningEvents(client, m.events.reasons, m.events.threshold, m.events.window),
+		controller.WithResourceUsage(client, m.usage.memory, m.usage.cpu),
+		controller.WithCordonedNodes(client, m.cordonDelay),
+		controller.WithNodeHealth(client, m.nodeHealth),
+	}
+
+	var force, unknownForce controller.PodForceDeleter
+	if m.unready.force {
+		force = client
+	}
+	if m.unknown.force {
+		unknownForce = client
+	}
+	options = append(options,
+		controller.WithNodeNotReady(client, m.unready.timeout, force),
+		controller.WithUnknownPhase(m.unknown.timeout, unknownForce),
+		controller.WithOrphanedPods(client, m.orphanGrace, client),
+		controller.WithFinishedJobPods(client, m.finishedTTL),
+	)
+
+	if m.drainAnno {
+		options = append(options, controller.WithNodeLister(client))
+	}
+
+	store, err := m.historyStore(client)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	options = append(options, controller.WithHistory(store))
+
+	if m.tombstone {
+		hostname, err := os.Hostname()
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to get hostname")
+		}
+		identity := fmt.Sprintf("k8s-pod-deleter/%s (%s)", version.Version, hostname)
+		options = append(options, controller.WithTombstone(client, identity))
+	}
+
+	if m.annotateOwner {
+		options = append(options, controller.WithOwnerAnnotations(client))
+	}
+
+	if m.checkPDB {
+		options = append(options, controller.WithDisruptionBudgetCheck(client))
+	}
+
+	if m.stsMode != "" {
+		options = append(options, controller.WithStatefulSets(m.stsMode, client))
+	}
+
+	if m.checkRollout {
+		options = append(options, controller.WithRolloutCheck(client))
+	}
+
+	if m.allowLast {
+		options = append(options, controller.WithAllowLastReadyReplica(true))
+	}
+
+	var auditLog *audit.Log
+	if m.audit.file != "" {
+		auditLog, err = audit.New(m.audit.file,
+			audit.WithLevel(audit.Level(m.audit.level)),
+			audit.WithRotation(int64(m.audit.maxSize)*1024*1024, m.audit.maxAge, m.audit.maxBackups),
+			audit.WithLogger(logger),
+		)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to create audit log")
+		}
+		options = append(options, controller.WithAuditor(auditLog))
+	}
+
+	var archiver *archive.Archiver
+	if m.archive.url != "" {
+		archiver, err = m.archiver()
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to create archive")
+		}
+		var events controller.PodEventGetter
+		if m.archive.events {
+			events = client
+		}
+		options = append(options, controller.WithArchive(archiver, events))
+	}
+
+	if m.logCapture.lines > 0 {
+		var sink controller.LogSink
+		switch {
+		case m.logCapture.dir != "":
+			sink = podlogs.Directory(m.logCapture.dir)
+		case archiver != nil:
+			sink = archiver
+		case auditLog != nil:
+			sink = auditLog
+		default:
+			return nil, nil, nil, errors.New("--log-capture-lines requires --log-capture-dir, --archive, or --audit-file")
+		}
+		options = append(options, controller.WithLogCapture(client, m.logCapture.lines, sink))
+	}
+
+	if m.statsd.address != "" {
+		sink, err := statsd.New(m.statsd.address,
+			statsd.WithPrefix(m.statsd.prefix),
+			statsd.WithTags(!m.statsd.noTags),
+		)
+		if err != nil {
+			return nil, nil, nil, errors.Wrap(err, "failed to create StatsD client")
+		}
+		options = append(options, controller.WithMetricsSink(sink))
+	}
+
+	if m.datadog.apiKeyFile != "" {
+		dd, err := m.datadogClient(logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		options = append(options, controller.WithAuditor(dd))
+	}
+
+	if m.stream.nats != "" || m.stream.kafkaREST != "" {
+		e, err := m.streamExporter(logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		options = append(options, controller.WithAuditor(e))
+	}
+
+	if m.cloudEvents.sink != "" {
+		e, err := m.cloudEventsEmitter(logger)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+		options = append(options, controller.WithAuditor(e), controller.WithHooks(e.Hooks()))
+	}
+
+	if m.flapThreshold > 0 {
+		options = append(options, controller.WithEventRecorder(client))
+	}
+
+	if m.flapScaleDown {
+		if m.flapThreshold <= 0 {
+			return nil, nil, nil, errors.New("--flap-scale-down requires --flap-threshold")
+		}
+		options = append(options, controller.WithFlapScaleDown(client))
+	}
+
+	if m.statusCM != "" {
+		parts := strings.SplitN(m.statusCM, "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, nil, nil, errors.Errorf("invalid status ConfigMap %q. Must be namespace/name", m.statusCM)
+		}
+		options = append(options, controller.WithStatusPublisher(status.NewConfigMapPublisher(client, parts[0], parts[1])))
+	}
+
+	if m.interactive {
+		// prompts go to stderr so they do not mix with a report on stdout
+		options = append(options, controller.WithHooks(newPrompter(os.Stdin, os.Stderr).hooks()))
+	}
+
+	var lister controller.PodLister = client
+	if m.watchPods && !m.once && m.resync > 0 {
+		m.podCache = k8s.NewPodCache(client, m.cacheNamespace(), m.resync, logger)
+		lister = m.podCache
+	}
+
+	c, err := controller.New(lister, client, options...)
+	if err != nil {
+		return nil, nil, nil, errors.Wrap(err, "failed to create controller")
+	}
+
+	return client, logger, c, nil
+}
+
+// datadogClient reads the API key and creates the client that posts
+// deletions as Datadog events.
+func (m *mainCommand) datadogClient(logger *zap.Logger) (*datadog.Client, error) {
+	data, err := ioutil.ReadFile(m.datadog.apiKeyFile)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read Datadog API key from %q", m.datadog.apiKeyFile)
+	}
+
+	dd, err := datadog.New(strings.TrimSpace(string(data)),
+		datadog.WithSite(m.datadog.site),
+		datadog.WithTags(m.datadog.tags),
+		datadog.WithRollup(m.datadog.rollup),
+		datadog.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create Datadog client")
+	}
+	return dd, nil
+}
+
+// streamExporter creates the exporter that publishes decisions to NATS or
+// the Kafka REST Proxy.
+func (m *mainCommand) streamExporter(logger *zap.Logger) (*stream.Exporter, error) {
+	if m.stream.nats != "" && m.stream.kafkaREST != "" {
+		return nil, errors.New("only one of --stream-nats and --stream-kafka-rest may be set")
+	}
+
+	var password string
+	if m.stream.passwordFile != "" {
+		data, err := ioutil.ReadFile(m.stream.passwordFile)
+		if err != nil {
+			return nil, errors.Wrapf(err, "failed to read stream password from %q", m.stream.passwordFile)
+		}
+		password = strings.TrimSpace(string(data))
+	}
+
+	var p stream.Publisher
+	if m.stream.nats != "" {
+		p = stream.NATS(m.stream.nats, m.stream.user, password)
+	} else {
+		p = stream.KafkaREST(m.stream.kafkaREST, m.stream.user, password)
+	}
+
+	e, err := stream.New(p,
+		stream.WithTopic(m.stream.topic),
+		stream.WithLevel(audit.Level(m.stream.level)),
+		stream.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create stream exporter")
+	}
+	return e, nil
+}
+
+// cloudEventsEmitter creates the emitter that sends CloudEvents to the
+// sink, choosing HTTP or MQTT by its scheme.
+func (m *mainCommand) cloudEventsEmitter(logger *zap.Logger) (*cloudevents.Emitter, error) {
+	u, err := url.Parse(m.cloudEvents.sink)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid CloudEvents sink %q", m.cloudEvents.sink)
+	}
+
+	var sender cloudevents.Sender
+	switch u.Scheme {
+	case "http", "https":
+		sender = cloudevents.HTTP(m.cloudEvents.sink)
+	case "mqtt":
+		topic := strings.TrimPrefix(u.Path, "/")
+		if u.Host == "" || topic == "" {
+			return nil, errors.Errorf("invalid CloudEvents sink %q. MQTT must be mqtt://host:port/topic", m.cloudEvents.sink)
+		}
+		var password string
+		if m.cloudEvents.passwordFile != "" {
+			data, err := ioutil.ReadFile(m.cloudEvents.passwordFile)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to read CloudEvents password from %q", m.cloudEvents.passwordFile)
+			}
+			password = strings.TrimSpace(string(data))
+		}
+		sender = cloudevents.MQTT(u.Host, topic, u.User.Username(), password)
+	default:
+		return nil, errors.Errorf("invalid CloudEvents sink %q. Must be an http, https, or mqtt URL", m.cloudEvents.sink)
+	}
+
+	e, err := cloudevents.New(sender,
+		cloudevents.WithSource(m.cloudEvents.source),
+		cloudevents.WithLogger(logger),
+	)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create CloudEvents emitter")
+	}
+	return e, nil
+}
+
+// historyStore creates the deletion history store from the history flag.
+func (m *mainCommand) historyStore(client *k8s.Client) (*history.Store, error) {
+	var backend history.Backend
+	switch {
+	case m.history.store == "memory":
+	case strings.HasPrefix(m.history.store, "file:"):
+		backend = history.FileBackend(strings.TrimPrefix(m.history.store, "file:"))
+	case strings.HasPrefix(m.history.store, "configmap:"):
+		parts := strings.SplitN(strings.TrimPrefix(m.history.store, "configmap:"), "/", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid history %q. ConfigMap must be namespace/name", m.history.store)
+		}
+		backend = history.ConfigMapBackend(client, parts[0], parts[1])
+	case strings.HasPrefix(m.history.store, "redis:"):
+		parts := strings.SplitN(strings.TrimPrefix(m.history.store, "redis:"), "/", 2)
+		if parts[0] == "" {
+			return nil, errors.Errorf("invalid history %q. Redis must be host:port or host:port/key", m.history.store)
+		}
+		var key string
+		if len(parts) == 2 {
+			key = parts[1]
+		}
+		password, err := m.redisPassword()
+		if err != nil {
+			return nil, err
+		}
+		backend = history.RedisBackend(parts[0], password, key)
+	default:
+		return nil, errors.Errorf("invalid history %q. Must be memory, file:/path, configmap:namespace/name, or redis:host:port/key", m.history.store)
+	}
+
+	store, err := history.New(backend, m.history.retention)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create history")
+	}
+	return store, nil
+}
+
+// redisPassword reads the password for a redis history, if a file is set
+func (m *mainCommand) redisPassword() (string, error) {
+	if m.history.passwordFile == "" {
+		return "", nil
+	}
+	data, err := ioutil.ReadFile(m.history.passwordFile)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read redis password from %q", m.history.passwordFile)
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+// parseSchedule parses the schedule flag. It returns nil if there is
+// no schedule, so the interval is used.
+func (m *mainCommand) parseSchedule() (controller.Schedule, error) {
+	if m.schedule == "" {
+		return nil, nil
+	}
+	s, err := cron.ParseStandard(m.schedule)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid schedule %q", m.schedule)
+	}
+	return s, nil
+}
+
+// cacheNamespace returns the namespace to watch: the namespace flag if
+// every rule is limited to it, otherwise all namespaces.
+func (m *mainCommand) cacheNamespace() string {
+	for _, r := range m.rules {
+		if r.Namespace != "" && r.Namespace != m.namespace {
+			return ""
+		}
+	}
+	return m.namespace
+}
+
 type logLevel struct {
 	zapcore.Level
 }
@@ -116,8 +1220,36 @@ func levelFlag(f *pflag.FlagSet, l *logLevel, name string, defaultLevel zapcore.
 	f.Var(l, name, usage)
 }
 
-func createLogger(level zapcore.Level) (*zap.Logger, error) {
+func (m *mainCommand) createLogger() (*zap.Logger, error) {
 	config := zap.NewProductionConfig()
-	config.Level.SetLevel(level)
+	config.Level.SetLevel(m.logLevel.Level)
+
+	switch m.logFormat {
+	case "json":
+	case "console":
+		config.Encoding = "console"
+		config.EncoderConfig = zap.NewDevelopmentEncoderConfig()
+	default:
+		return nil, errors.Errorf("invalid log format %q. Must be json or console", m.logFormat)
+	}
+
+	switch {
+	case m.logOutput == "stderr", m.logOutput == "stdout":
+		config.OutputPaths = []string{m.logOutput}
+	case strings.HasPrefix(m.logOutput, "file:") && len(m.logOutput) > len("file:"):
+		config.OutputPaths = []string{strings.TrimPrefix(m.logOutput, "file:")}
+	default:
+		return nil, errors.Errorf("invalid log output %q. Must be stderr, stdout, or file:/path", m.logOutput)
+	}
+
+	if m.logSampling > 0 {
+		config.Sampling = &zap.SamplingConfig{
+			Initial:    m.logSampling,
+			Thereafter: m.logSampling,
+		}
+	} else {
+		config.Sampling = nil
+	}
+
 	return config.Build()
 }
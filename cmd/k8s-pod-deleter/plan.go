@@ -0,0 +1,134 @@
+package main
+
+import (
+	"context"
+	"io"
+	"io/ioutil"
+	"os"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/printer"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+type planOutput struct {
+	*controller.Plan
+}
+
+func (p planOutput) Table() printer.TableData {
+	t := printer.TableData{
+		Columns: []printer.Column{
+			{Name: "NAMESPACE"},
+			{Name: "NAME"},
+			{Name: "REASON"},
+			{Name: "ACTION"},
+			{Name: "RULE", Wide: true},
+			{Name: "OWNER", Wide: true},
+			{Name: "UID", Wide: true},
+		},
+	}
+	for _, item := range p.Items {
+		t.Rows = append(t.Rows, []string{item.Namespace, item.Name, item.Reason, item.Action, ruleName(item.Rule), item.Owner, string(item.UID)})
+	}
+	return t
+}
+
+func (m *mainCommand) planCommand() *cobra.Command {
+	var file string
+
+	cmd := &cobra.Command{
+		Use:   "plan",
+		Short: "write the pods that would be deleted to a plan file, to review before apply",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			// a plan is written as JSON, so it can be applied, unless another format is asked for
+			format := printer.JSON
+			if cmd.Flags().Changed("output") {
+				format = m.output
+			}
+			p, err := printer.New(format)
+			if err != nil {
+				return err
+			}
+
+			_, _, c, err := m.setup(cmd)
+			if err != nil {
+				return err
+			}
+
+			result, err := c.Plan()
+			if err != nil {
+				return errors.Wrap(err, "failed to create plan")
+			}
+
+			var w io.Writer = os.Stdout
+			if file != "-" {
+				f, err := os.Create(file)
+				if err != nil {
+					return errors.Wrap(err, "failed to create plan file")
+				}
+				defer f.Close()
+				w = f
+			}
+
+			if err := p.Print(w, planOutput{result}); err != nil {
+				return errors.Wrap(err, "failed to write plan")
+			}
+			return nil
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	cmd.Flags().StringVarP(&file, "file", "f", "-", `file to write the plan to. "-" for stdout`)
+
+	return cmd
+}
+
+func (m *mainCommand) applyCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "apply PLAN",
+		Short: "delete the pods in a plan file, if they have not been replaced",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			p, err := printer.New(m.output)
+			if err != nil {
+				return err
+			}
+
+			data, err := ioutil.ReadFile(args[0])
+			if err != nil {
+				return errors.Wrap(err, "failed to read plan")
+			}
+
+			// JSON is valid YAML, so either can be applied
+			var plan controller.Plan
+			if err := yaml.Unmarshal(data, &plan); err != nil {
+				return errors.Wrapf(err, "failed to parse plan %q", args[0])
+			}
+
+			client, _, c, err := m.setup(cmd)
+			if err != nil {
+				return err
+			}
+
+			result, err := c.Apply(context.Background(), &plan, client)
+			if err != nil {
+				return err
+			}
+
+			if err := p.Print(os.Stdout, runSummary{result}); err != nil {
+				return err
+			}
+			return result.Err()
+		},
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+
+	cmd.Flags().BoolVar(&m.dryRun, "dry-run", false, "check the plan but do not delete pods")
+
+	return cmd
+}
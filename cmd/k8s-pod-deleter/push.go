@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+type pushgatewayOptions struct {
+	url      string
+	job      string
+	grouping []string
+}
+
+// pusher creates the pusher for the controller's metrics. Each push
+// replaces the metrics pushed by the previous run with the same job and
+// grouping key.
+func (m *mainCommand) pusher(c *controller.Controller) (*push.Pusher, error) {
+	if m.pushgateway.job == "" {
+		return nil, errors.New("--pushgateway-job must not be empty")
+	}
+
+	p := push.New(m.pushgateway.url, m.pushgateway.job).
+		Collector(c).
+		Client(&http.Client{Timeout: time.Second * 10})
+
+	for _, g := range m.pushgateway.grouping {
+		parts := strings.SplitN(g, "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, errors.Errorf("invalid Pushgateway grouping %q. Must be name=value", g)
+		}
+		p = p.Grouping(parts[0], parts[1])
+	}
+	return p, nil
+}
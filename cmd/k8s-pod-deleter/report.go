@@ -0,0 +1,114 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"os"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// writeReport writes the result of a run to the report file, or
+// stdout if the file is "-", in the report format.
+func (m *mainCommand) writeReport(report *controller.RunResult) error {
+	var data []byte
+	var err error
+	switch m.reportFormat {
+	case "json":
+		data, err = json.MarshalIndent(report, "", "  ")
+		data = append(data, '\n')
+	case "yaml":
+		data, err = yaml.Marshal(report)
+	default:
+		return errors.Errorf("unknown report format %q", m.reportFormat)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to encode report")
+	}
+
+	var w io.Writer = os.Stdout
+	if m.reportFile != "-" {
+		f, err := os.Create(m.reportFile)
+		if err != nil {
+			return errors.Wrap(err, "failed to create report file")
+		}
+		defer f.Close()
+		w = f
+	}
+
+	if _, err := w.Write(data); err != nil {
+		return errors.Wrap(err, "failed to write report")
+	}
+	return nil
+}
+
+// runOutcome is written to the summary file at the end of a run in once
+// mode. It includes the result, if the run got that far, and how the run
+// ended, so wrappers need not parse logs or guess from the exit status.
+type runOutcome struct {
+	*controller.RunResult
+	// Status is success, or error if the run failed or any pod could not
+	// be acted on
+	Status   string        `json:"status"`
+	ExitCode int           `json:"exitCode"`
+	Error    string        `json:"error,omitempty"`
+	Counts   outcomeCounts `json:"counts"`
+	Duration float64       `json:"durationSeconds"`
+}
+
+type outcomeCounts struct {
+	Deleted     int `json:"deleted"`
+	Skipped     int `json:"skipped"`
+	Errors      int `json:"errors"`
+	Terminating int `json:"terminating"`
+}
+
+// writeSummaryFile writes the outcome of a run as JSON. result is nil if
+// the run failed before pods were evaluated, and runErr is the error the
+// run exits with, if any.
+func writeSummaryFile(path string, start time.Time, result *controller.RunResult, runErr error) error {
+	out := runOutcome{
+		RunResult: result,
+		Status:    "success",
+		Duration:  time.Since(start).Seconds(),
+	}
+	if result != nil {
+		out.Counts = outcomeCounts{
+			Deleted:     len(result.Deleted),
+			Skipped:     len(result.Skipped),
+			Errors:      len(result.Errors),
+			Terminating: result.Terminating,
+		}
+	}
+
+	switch e := runErr.(type) {
+	case nil:
+	case exitCode:
+		// a successful run that asked for a different status
+		out.ExitCode = int(e)
+	default:
+		out.Status = "error"
+		out.ExitCode = 1
+		out.Error = runErr.Error()
+	}
+
+	data, err := json.MarshalIndent(out, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode summary")
+	}
+	data = append(data, '\n')
+
+	// write to a temporary file first, so a reader never sees a partial summary
+	tmp := path + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrap(err, "failed to write summary file")
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return errors.Wrap(err, "failed to write summary file")
+	}
+	return nil
+}
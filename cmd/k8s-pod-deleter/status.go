@@ -0,0 +1,62 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"net/http"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/version"
+	"github.com/pkg/errors"
+	"gopkg.in/yaml.v2"
+)
+
+// statusResponse summarizes the last run for monitors and humans.
+// Unlike /statusz, it does not judge whether the deleter is healthy.
+type statusResponse struct {
+	LastRun    controller.RunStatus `json:"lastRun"`
+	Paused     bool                 `json:"paused"`
+	Disabled   bool                 `json:"disabled"`
+	DryRun     bool                 `json:"dryRun"`
+	ConfigHash string               `json:"configHash"`
+	Version    string               `json:"version"`
+}
+
+// configHash returns the SHA-256 of the configuration in use, so a
+// change of configuration can be spotted without comparing it.
+func (m *mainCommand) configHash() (string, error) {
+	data, err := yaml.Marshal(m.effectiveConfig())
+	if err != nil {
+		return "", errors.Wrap(err, "failed to marshal configuration")
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// statusHandler serves the status of the last run as JSON.
+func (m *mainCommand) statusHandler(c *controller.Controller) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		hash, err := m.configHash()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		resp := statusResponse{
+			LastRun:    c.LastRun(),
+			Paused:     c.Paused(),
+			Disabled:   c.Disabled(),
+			DryRun:     m.dryRun,
+			ConfigHash: hash,
+			Version:    version.Version,
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(resp); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/canary"
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/k8s"
+)
+
+// subsystemStatus is the health of a single part of the deleter
+type subsystemStatus struct {
+	Healthy bool        `json:"healthy"`
+	Message string      `json:"message,omitempty"`
+	Details interface{} `json:"details,omitempty"`
+}
+
+type statuszResponse struct {
+	Healthy    bool                       `json:"healthy"`
+	Subsystems map[string]subsystemStatus `json:"subsystems"`
+}
+
+// statusz reports the health of each subsystem. canary may be nil.
+type statusz struct {
+	client   *k8s.Client
+	c        *controller.Controller
+	canary   *canary.Canary
+	interval time.Duration
+	// schedule is used instead of interval if set
+	schedule controller.Schedule
+}
+
+func (s *statusz) status() statuszResponse {
+	resp := statuszResponse{
+		Healthy: true,
+		Subsystems: map[string]subsystemStatus{
+			"kubernetes": s.kubernetes(),
+			"controller": s.controller(),
+			"budget":     s.budget(),
+		},
+	}
+
+	if s.canary != nil {
+		resp.Subsystems["canary"] = s.canaryStatus()
+	}
+
+	for _, sub := range resp.Subsystems {
+		if !sub.Healthy {
+			resp.Healthy = false
+		}
+	}
+	return resp
+}
+
+func (s *statusz) kubernetes() subsystemStatus {
+	v, err := s.client.ServerVersion()
+	if err != nil {
+		return subsystemStatus{Message: err.Error()}
+	}
+	return subsystemStatus{Healthy: true, Message: "server version " + v}
+}
+
+func (s *statusz) controller() subsystemStatus {
+	run := s.c.LastRun()
+	switch {
+	case run.Time.IsZero():
+		return subsystemStatus{Healthy: true, Message: "waiting for first run"}
+	case run.Error != "":
+		return subsystemStatus{Message: run.Error, Details: run}
+	case run.Errors > 0:
+		return subsystemStatus{Message: fmt.Sprintf("failed to delete %d pods", run.Errors), Details: run}
+	case s.overdue(run):
+		return subsystemStatus{Message: "last run was " + shortDuration(time.Since(run.Time)) + " ago", Details: run}
+	case s.c.Paused():
+		return subsystemStatus{Healthy: true, Message: "paused", Details: run}
+	case s.c.Disabled():
+		return subsystemStatus{Healthy: true, Message: "disabled by control ConfigMap", Details: run}
+	}
+	return subsystemStatus{Healthy: true, Details: run}
+}
+
+// overdue returns true if the controller has missed two runs
+func (s *statusz) overdue(run controller.RunStatus) bool {
+	if s.schedule != nil {
+		next := s.schedule.Next(s.schedule.Next(run.Time.Add(run.Duration)))
+		return !next.IsZero() && time.Now().After(next)
+	}
+	return time.Since(run.Time) > s.interval*2+run.Duration
+}
+
+func (s *statusz) budget() subsystemStatus {
+	b := s.c.Budget()
+	status := subsystemStatus{Healthy: true, Details: b}
+	if b.Remaining == 0 {
+		// deleting is paused, but this is the budget working as intended
+		status.Message = "budget exhausted"
+	}
+	return status
+}
+
+func (s *statusz) canaryStatus() subsystemStatus {
+	check := s.canary.LastCheck()
+	switch {
+	case check.Time.IsZero():
+		return subsystemStatus{Healthy: true, Message: "waiting for first check"}
+	case !check.Success:
+		return subsystemStatus{Message: check.Error, Details: check}
+	}
+	return subsystemStatus{Healthy: true, Details: check}
+}
+
+// ServeHTTP writes the status as JSON. The status code is 503 if
+// any subsystem is unhealthy.
+func (s *statusz) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	resp := s.status()
+
+	w.Header().Set("Content-Type", "application/json")
+	if !resp.Healthy {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	if err := enc.Encode(resp); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/printer"
+)
+
+// runSummary prints the result of a run or an applied plan
+type runSummary struct {
+	*controller.RunResult
+}
+
+func (s runSummary) Table() printer.TableData {
+	t := printer.TableData{
+		Columns: []printer.Column{
+			{Name: "NAMESPACE"},
+			{Name: "NAME"},
+			{Name: "RESULT"},
+			{Name: "REASON"},
+			{Name: "RULE", Wide: true},
+			{Name: "OWNER", Wide: true},
+			{Name: "DETAIL", Wide: true},
+		},
+	}
+
+	row := func(d controller.Decision, result string, reason string) {
+		t.Rows = append(t.Rows, []string{d.Namespace, d.Name, result, reason, ruleName(d.Rule), d.Owner, d.Detail})
+	}
+	for _, d := range s.Deleted {
+		row(d, d.Action, d.Reason)
+	}
+	for _, d := range s.Skipped {
+		row(d, "skipped", d.Skip)
+	}
+	for _, d := range s.Errors {
+		row(d, "error", d.Error)
+	}
+
+	footer := fmt.Sprintf("\n%d evaluated, %d acted on, %d skipped, %d errors", s.Evaluated, len(s.Deleted), len(s.Skipped), len(s.Errors))
+	if s.Terminating > 0 {
+		footer += fmt.Sprintf(", %d already terminating", s.Terminating)
+	}
+	if s.DryRun {
+		footer += " (dry run)"
+	}
+	t.Footer = []string{footer}
+	if s.Aborted != "" {
+		t.Footer = append(t.Footer, "run aborted: "+s.Aborted)
+	}
+	return t
+}
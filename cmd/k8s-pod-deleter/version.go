@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/version"
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+)
+
+func versionCommand() *cobra.Command {
+	var asJSON bool
+
+	cmd := &cobra.Command{
+		Use:           "version",
+		Short:         "print version information",
+		Args:          cobra.NoArgs,
+		SilenceErrors: true,
+		SilenceUsage:  true,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return printVersion(asJSON)
+		},
+	}
+
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print version information as JSON")
+	return cmd
+}
+
+func printVersion(asJSON bool) error {
+	info := version.Get()
+	if !asJSON {
+		fmt.Println(info)
+		return nil
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return errors.Wrap(enc.Encode(info), "failed to write version")
+}
@@ -0,0 +1,131 @@
+// Package archive writes the manifests of pods, and the logs captured from
+// them, to object storage before the controller acts on them, so they can
+// be analyzed after the pods are gone.
+package archive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+)
+
+// timeFormat is used in keys, so they sort and have no colons
+const timeFormat = "20060102T150405Z"
+
+// Store saves objects by key
+type Store interface {
+	Put(key string, data []byte) error
+}
+
+// Archiver writes pod records and captured logs to a store, as JSON,
+// keyed by cluster/namespace/pod/time. It implements controller.Archiver
+// and controller.LogSink.
+type Archiver struct {
+	store   Store
+	prefix  string
+	cluster string
+}
+
+// Option sets options when creating a new Archiver
+type Option func(*Archiver) error
+
+// New creates an archiver that writes to s.
+func New(s Store, options ...Option) (*Archiver, error) {
+	if s == nil {
+		return nil, errors.New("store is required")
+	}
+
+	a := &Archiver{store: s}
+
+	for _, o := range options {
+		if err := o(a); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	return a, nil
+}
+
+// WithPrefix returns an Option that adds prefix, such as pod-deleter/, to
+// every key.
+func WithPrefix(prefix string) Option {
+	return func(a *Archiver) error {
+		a.prefix = prefix
+		return nil
+	}
+}
+
+// WithCluster returns an Option that sets the name of the cluster, which
+// is the first part of every key, so a bucket can be shared by clusters.
+// If empty, which is the default, keys start with the namespace.
+func WithCluster(cluster string) Option {
+	return func(a *Archiver) error {
+		a.cluster = cluster
+		return nil
+	}
+}
+
+// ArchivePod writes a pod record to key cluster/namespace/pod/time.json
+func (a *Archiver) ArchivePod(r *controller.PodRecord) error {
+	data, err := json.Marshal(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode pod")
+	}
+
+	key := a.key(r.Pod.ObjectMeta.Namespace, r.Pod.ObjectMeta.Name, r.Time.UTC().Format(timeFormat)+".json")
+	if err := a.store.Put(key, data); err != nil {
+		return errors.Wrapf(err, "failed to archive %s", key)
+	}
+	return nil
+}
+
+// WriteLogs writes captured logs to key cluster/namespace/pod/time.logs.json
+func (a *Archiver) WriteLogs(logs *controller.CapturedLogs) error {
+	data, err := json.Marshal(logs)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode logs")
+	}
+
+	key := a.key(logs.Namespace, logs.Name, logs.Time.UTC().Format(timeFormat)+".logs.json")
+	if err := a.store.Put(key, data); err != nil {
+		return errors.Wrapf(err, "failed to archive %s", key)
+	}
+	return nil
+}
+
+func (a *Archiver) key(namespace string, name string, file string) string {
+	return a.prefix + path.Join(a.cluster, namespace, name, file)
+}
+
+type directory struct {
+	path string
+}
+
+// Directory returns a Store that writes each object to a file under path,
+// such as a mounted volume.
+func Directory(path string) Store {
+	return &directory{path: path}
+}
+
+func (d *directory) Put(key string, data []byte) error {
+	name := filepath.Join(d.path, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(name), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create directory for %s", name)
+	}
+
+	// write to a temporary file and rename, so readers never see a partial object
+	tmp := name + ".tmp"
+	if err := ioutil.WriteFile(tmp, data, 0644); err != nil {
+		return errors.Wrapf(err, "failed to write %s", tmp)
+	}
+	if err := os.Rename(tmp, name); err != nil {
+		os.Remove(tmp)
+		return errors.Wrapf(err, "failed to rename %s", tmp)
+	}
+	return nil
+}
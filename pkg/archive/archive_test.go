@@ -0,0 +1,131 @@
+package archive
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func testRecord() *controller.PodRecord {
+	return &controller.PodRecord{
+		Time:   time.Date(2018, 4, 20, 15, 4, 5, 0, time.UTC),
+		Reason: "CrashLoopBackOff",
+		Action: "deleted",
+		Pod: &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-1"},
+		},
+	}
+}
+
+// testServer records the objects put to it
+type testServer struct {
+	mu      sync.Mutex
+	paths   []string
+	queries []string
+	headers []http.Header
+	bodies  []string
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := ioutil.ReadAll(r.Body)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.paths = append(s.paths, r.URL.EscapedPath())
+	s.queries = append(s.queries, r.URL.RawQuery)
+	s.headers = append(s.headers, r.Header)
+	s.bodies = append(s.bodies, string(body))
+	w.WriteHeader(http.StatusCreated)
+}
+
+func TestDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "archive")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	a, err := New(Directory(dir), WithCluster("production"))
+	require.NoError(t, err)
+	require.NoError(t, a.ArchivePod(testRecord()))
+	require.NoError(t, a.WriteLogs(&controller.CapturedLogs{
+		Time:      time.Date(2018, 4, 20, 15, 4, 5, 0, time.UTC),
+		Namespace: "default",
+		Name:      "web-1",
+	}))
+
+	data, err := ioutil.ReadFile(filepath.Join(dir, "production", "default", "web-1", "20180420T150405Z.json"))
+	require.NoError(t, err)
+	var record controller.PodRecord
+	require.NoError(t, json.Unmarshal(data, &record))
+	require.Equal(t, "web-1", record.Pod.ObjectMeta.Name)
+	require.Equal(t, "CrashLoopBackOff", record.Reason)
+
+	_, err = os.Stat(filepath.Join(dir, "production", "default", "web-1", "20180420T150405Z.logs.json"))
+	require.NoError(t, err)
+}
+
+func TestS3(t *testing.T) {
+	s := &testServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	store := S3(server.URL+"/", "pods", "us-east-1", "AKID", "secret", "session")
+	store.(*s3Store).now = func() time.Time {
+		return time.Date(2018, 4, 20, 15, 4, 5, 0, time.UTC)
+	}
+	a, err := New(store, WithPrefix("deleter/"))
+	require.NoError(t, err)
+	require.NoError(t, a.ArchivePod(testRecord()))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.Equal(t, []string{"/pods/deleter/default/web-1/20180420T150405Z.json"}, s.paths)
+	h := s.headers[0]
+	require.Equal(t, "20180420T150405Z", h.Get("X-Amz-Date"))
+	require.Equal(t, sha256Hex([]byte(s.bodies[0])), h.Get("X-Amz-Content-Sha256"))
+	require.Equal(t, "session", h.Get("X-Amz-Security-Token"))
+	require.True(t, strings.HasPrefix(h.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKID/20180420/us-east-1/s3/aws4_request, SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date;x-amz-security-token, Signature="))
+}
+
+func TestS3Errors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	err := S3(server.URL, "pods", "us-east-1", "AKID", "secret", "").Put("key", []byte("{}"))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "AccessDenied")
+}
+
+func TestAzureBlob(t *testing.T) {
+	s := &testServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	a, err := New(AzureBlob(server.URL+"/pods", "?sv=2019-12-12&sig=abc"))
+	require.NoError(t, err)
+	require.NoError(t, a.ArchivePod(testRecord()))
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.Equal(t, []string{"/pods/default/web-1/20180420T150405Z.json"}, s.paths)
+	require.Equal(t, "sv=2019-12-12&sig=abc", s.queries[0])
+	require.Equal(t, "BlockBlob", s.headers[0].Get("X-Ms-Blob-Type"))
+}
+
+func TestURIEncode(t *testing.T) {
+	require.Equal(t, "a/b%20c/d~e", uriEncode("a/b c/d~e", true))
+	require.Equal(t, "a%2Fb", uriEncode("a/b", false))
+}
@@ -0,0 +1,58 @@
+package archive
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// azureVersion is the version of the Blob service API used
+const azureVersion = "2019-12-12"
+
+type azureStore struct {
+	container string
+	sas       string
+	client    *http.Client
+}
+
+// AzureBlob returns a Store that puts objects as block blobs in an Azure
+// Storage container, such as https://account.blob.core.windows.net/pods,
+// authorized with a shared access signature that allows creating and
+// writing blobs.
+func AzureBlob(container string, sas string) Store {
+	return &azureStore{
+		container: strings.TrimSuffix(container, "/"),
+		sas:       strings.TrimPrefix(sas, "?"),
+		client:    &http.Client{Timeout: time.Second * 30},
+	}
+}
+
+func (a *azureStore) Put(key string, data []byte) error {
+	url := a.container + "/" + uriEncode(key, true)
+	if a.sas != "" {
+		url += "?" + a.sas
+	}
+	req, err := http.NewRequest(http.MethodPut, url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Ms-Blob-Type", "BlockBlob")
+	req.Header.Set("X-Ms-Version", azureVersion)
+
+	resp, err := a.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to put blob")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return errors.Errorf("unexpected status putting blob: %s: %s", resp.Status, bytes.TrimSpace(body))
+	}
+	return nil
+}
@@ -0,0 +1,195 @@
+// Package audit writes the controller's decisions to an append only
+// JSON lines file, separate from the operational log.
+package audit
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Level sets which decisions are written to the audit log
+type Level string
+
+const (
+	// LevelActions writes pods that were deleted, or acted on, and those
+	// that could not be. In dry-run mode, pods that would have been.
+	LevelActions Level = "actions"
+	// LevelCandidates also writes candidates that were skipped, such as
+	// because of the budget.
+	LevelCandidates Level = "candidates"
+	// LevelAll also writes every pod that did not match a rule.
+	LevelAll Level = "all"
+)
+
+// candidateSkips are the skip reasons for pods that matched a rule
+var candidateSkips = map[string]bool{
+	"Budget":           true,
+	"Flapping":         true,
+	"Vetoed":           true,
+	"DisruptionBudget": true,
+	"LastReadyReplica": true,
+	"Rollout":          true,
+	"StatefulSet":      true,
+	"KeepFailing":      true,
+	"MassFailure":      true,
+	"NodeHealth":       true,
+}
+
+// Validate returns an error if the level is not one of the levels above.
+func (l Level) Validate() error {
+	switch l {
+	case LevelActions, LevelCandidates, LevelAll:
+		return nil
+	}
+	return errors.Errorf("invalid audit level %q. Must be actions, candidates, or all", l)
+}
+
+// Includes returns true if a skipped decision is written at the level.
+// Pods acted on, or that could not be, are written at every level.
+func (l Level) Includes(d controller.Decision) bool {
+	return l == LevelAll || (l == LevelCandidates && candidateSkips[d.Skip])
+}
+
+// Log is an audit log. It implements controller.Auditor.
+type Log struct {
+	file   *rotatingFile
+	level  Level
+	logger *zap.Logger
+	mu     sync.Mutex
+}
+
+// Option sets options when creating a new Log
+type Option func(*Log) error
+
+// New creates an audit log that writes to path.
+func New(path string, options ...Option) (*Log, error) {
+	l := &Log{
+		file: &rotatingFile{
+			path:       path,
+			maxSize:    100 * 1024 * 1024,
+			maxAge:     time.Hour * 24,
+			maxBackups: 7,
+		},
+		level:  LevelActions,
+		logger: zap.NewNop(),
+	}
+
+	for _, o := range options {
+		if err := o(l); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	// fail now, rather than on the first write, if the file cannot be opened
+	l.file.mu.Lock()
+	defer l.file.mu.Unlock()
+	if err := l.file.open(); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// WithLevel returns an Option that sets which decisions are written.
+// Default is LevelActions.
+func WithLevel(level Level) Option {
+	return func(l *Log) error {
+		if err := level.Validate(); err != nil {
+			return err
+		}
+		l.level = level
+		return nil
+	}
+}
+
+// WithRotation returns an Option that sets when the file is rotated:
+// when it would grow larger than maxSize bytes or is older than maxAge.
+// Only maxBackups rotated files are kept. Zero disables each limit.
+// Default is 100MB, 24 hours, and 7 backups.
+func WithRotation(maxSize int64, maxAge time.Duration, maxBackups int) Option {
+	return func(l *Log) error {
+		if maxSize < 0 || maxAge < 0 || maxBackups < 0 {
+			return errors.New("rotation limits must not be negative")
+		}
+		l.file.maxSize = maxSize
+		l.file.maxAge = maxAge
+		l.file.maxBackups = maxBackups
+		return nil
+	}
+}
+
+// WithLogger returns an Option that sets the logger used to report
+// errors writing the audit log.
+func WithLogger(logger *zap.Logger) Option {
+	return func(l *Log) error {
+		l.logger = logger
+		return nil
+	}
+}
+
+// Audit writes the decisions in a run result, one JSON object per line.
+func (l *Log) Audit(r *controller.RunResult) {
+	var decisions []controller.Decision
+	decisions = append(decisions, r.Deleted...)
+	decisions = append(decisions, r.Errors...)
+	for _, d := range r.Skipped {
+		if l.level.Includes(d) {
+			decisions = append(decisions, d)
+		}
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Time.Before(decisions[j].Time)
+	})
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	for _, d := range decisions {
+		var buf bytes.Buffer
+		if err := json.NewEncoder(&buf).Encode(d); err != nil {
+			l.logger.Error("failed to encode audit record", zap.Error(err))
+			continue
+		}
+		if _, err := l.file.Write(buf.Bytes()); err != nil {
+			l.logger.Error("failed to write audit log", zap.Error(err))
+			return
+		}
+	}
+}
+
+// logsRecord is the line written for logs captured before a pod was acted
+// on. Type distinguishes it from decisions.
+type logsRecord struct {
+	Type string `json:"type"`
+	*controller.CapturedLogs
+}
+
+// WriteLogs writes logs captured before a pod was acted on as a single
+// line. It implements controller.LogSink.
+func (l *Log) WriteLogs(logs *controller.CapturedLogs) error {
+	var buf bytes.Buffer
+	if err := json.NewEncoder(&buf).Encode(logsRecord{Type: "logs", CapturedLogs: logs}); err != nil {
+		return errors.Wrap(err, "failed to encode logs")
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if _, err := l.file.Write(buf.Bytes()); err != nil {
+		return errors.Wrap(err, "failed to write audit log")
+	}
+	return nil
+}
+
+// Close closes the audit log
+func (l *Log) Close() error {
+	return l.file.Close()
+}
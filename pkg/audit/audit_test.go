@@ -0,0 +1,101 @@
+package audit
+
+import (
+	"bufio"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+)
+
+func readRecords(t *testing.T, path string) []controller.Decision {
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	defer f.Close()
+
+	var out []controller.Decision
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		var d controller.Decision
+		require.NoError(t, json.Unmarshal(s.Bytes(), &d))
+		out = append(out, d)
+	}
+	require.NoError(t, s.Err())
+	return out
+}
+
+func testResult() *controller.RunResult {
+	now := time.Now()
+	return &controller.RunResult{
+		Time: now,
+		Deleted: []controller.Decision{
+			{Time: now, Name: "pod0", Action: "deleted"},
+		},
+		Errors: []controller.Decision{
+			{Time: now.Add(time.Second), Name: "pod1", Action: "deleted", Error: "forbidden"},
+		},
+		Skipped: []controller.Decision{
+			{Time: now, Name: "pod2", Action: "skipped", Skip: "Budget"},
+			{Time: now, Name: "pod3", Action: "skipped", Skip: "Reason"},
+		},
+	}
+}
+
+func TestAuditLevels(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	tests := []struct {
+		level Level
+		names []string
+	}{
+		{LevelActions, []string{"pod0", "pod1"}},
+		{LevelCandidates, []string{"pod0", "pod2", "pod1"}},
+		{LevelAll, []string{"pod0", "pod2", "pod3", "pod1"}},
+	}
+
+	for _, test := range tests {
+		path := filepath.Join(dir, string(test.level)+".log")
+		l, err := New(path, WithLevel(test.level))
+		require.NoError(t, err)
+		l.Audit(testResult())
+		require.NoError(t, l.Close())
+
+		var names []string
+		for _, d := range readRecords(t, path) {
+			names = append(names, d.Name)
+		}
+		require.Equal(t, test.names, names, string(test.level))
+	}
+
+	_, err = New(filepath.Join(dir, "bad.log"), WithLevel("some"))
+	require.Error(t, err)
+}
+
+func TestAuditRotation(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "audit.log")
+
+	// every write is larger than the limit, so each goes to a new file
+	l, err := New(path, WithRotation(10, 0, 2))
+	require.NoError(t, err)
+	defer l.Close()
+
+	for i := 0; i < 4; i++ {
+		l.Audit(testResult())
+	}
+
+	backups, err := filepath.Glob(path + ".*")
+	require.NoError(t, err)
+	require.Len(t, backups, 2)
+	require.Len(t, readRecords(t, path), 1)
+}
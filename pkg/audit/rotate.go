@@ -0,0 +1,127 @@
+package audit
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// rotatingFile is an append only file that is renamed, and a new one
+// started, when it grows too large or too old. Renamed files have the time
+// of the rotation appended to their name.
+type rotatingFile struct {
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	mu     sync.Mutex
+	f      *os.File
+	size   int64
+	opened time.Time
+}
+
+const backupTimeFormat = "20060102T150405.000000000"
+
+func (r *rotatingFile) open() error {
+	f, err := os.OpenFile(r.path, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0640)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open %q", r.path)
+	}
+
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to stat %q", r.path)
+	}
+
+	r.f = f
+	r.size = info.Size()
+	r.opened = time.Now()
+	return nil
+}
+
+// Write writes p to the file, rotating it first if needed. p should be
+// a whole record, so records are never split across files.
+func (r *rotatingFile) Write(p []byte) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		if err := r.open(); err != nil {
+			return 0, err
+		}
+	}
+
+	tooLarge := r.maxSize > 0 && r.size > 0 && r.size+int64(len(p)) > r.maxSize
+	tooOld := r.maxAge > 0 && time.Since(r.opened) > r.maxAge
+	if tooLarge || tooOld {
+		if err := r.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := r.f.Write(p)
+	r.size += int64(n)
+	return n, err
+}
+
+// rotate renames the current file and opens a new one. Must be called with mu held.
+func (r *rotatingFile) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return errors.Wrapf(err, "failed to close %q", r.path)
+	}
+	r.f = nil
+
+	backup := r.path + "." + time.Now().UTC().Format(backupTimeFormat)
+	if err := os.Rename(r.path, backup); err != nil {
+		return errors.Wrapf(err, "failed to rename %q", r.path)
+	}
+
+	if err := r.prune(); err != nil {
+		return err
+	}
+
+	return r.open()
+}
+
+// prune removes the oldest backups beyond maxBackups. Zero keeps all backups.
+func (r *rotatingFile) prune() error {
+	if r.maxBackups <= 0 {
+		return nil
+	}
+
+	backups, err := filepath.Glob(r.path + ".*")
+	if err != nil {
+		return errors.Wrap(err, "failed to list backups")
+	}
+	if len(backups) <= r.maxBackups {
+		return nil
+	}
+
+	// the time format sorts oldest first
+	sort.Strings(backups)
+	for _, b := range backups[:len(backups)-r.maxBackups] {
+		if err := os.Remove(b); err != nil {
+			return errors.Wrapf(err, "failed to remove %q", b)
+		}
+	}
+	return nil
+}
+
+// Close closes the file
+func (r *rotatingFile) Close() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.f == nil {
+		return nil
+	}
+	err := r.f.Close()
+	r.f = nil
+	return err
+}
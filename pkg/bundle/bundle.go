@@ -0,0 +1,51 @@
+// Package bundle writes support bundles: gzipped tarballs of files
+// describing the state of the deleter, to attach to bug reports.
+package bundle
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"io"
+	"path"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// File is a single file in a bundle
+type File struct {
+	Name string
+	Data []byte
+}
+
+// Write writes files as a gzipped tarball to w. Files are placed in a
+// directory named dir.
+func Write(w io.Writer, dir string, files []File) error {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+
+	now := time.Now()
+	for _, f := range files {
+		hdr := &tar.Header{
+			Name:    path.Join(dir, f.Name),
+			Mode:    0644,
+			Size:    int64(len(f.Data)),
+			ModTime: now,
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			return errors.Wrapf(err, "failed to write header for %q", f.Name)
+		}
+		if _, err := tw.Write(f.Data); err != nil {
+			return errors.Wrapf(err, "failed to write %q", f.Name)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return errors.Wrap(err, "failed to close tar writer")
+	}
+
+	if err := gz.Close(); err != nil {
+		return errors.Wrap(err, "failed to close gzip writer")
+	}
+	return nil
+}
@@ -0,0 +1,42 @@
+package bundle
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite(t *testing.T) {
+	var buf bytes.Buffer
+	err := Write(&buf, "bundle", []File{
+		{Name: "config.yaml", Data: []byte("namespace: default\n")},
+		{Name: "version.json", Data: []byte("{}")},
+	})
+	require.NoError(t, err)
+
+	gz, err := gzip.NewReader(&buf)
+	require.NoError(t, err)
+	tr := tar.NewReader(gz)
+
+	files := map[string]string{}
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		require.NoError(t, err)
+		data, err := ioutil.ReadAll(tr)
+		require.NoError(t, err)
+		files[hdr.Name] = string(data)
+	}
+
+	require.Equal(t, map[string]string{
+		"bundle/config.yaml":  "namespace: default\n",
+		"bundle/version.json": "{}",
+	}, files)
+}
@@ -0,0 +1,307 @@
+// Package canary periodically creates a pod that is designed to fail and
+// checks that it is deleted within a time limit. This verifies that the whole
+// pipeline - permissions, rules, and deletion - is working.
+package canary
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LabelName is the label set on canary pods
+const LabelName = "pod-deleter.bakins.io/canary"
+
+// Client creates, gets, and deletes pods
+type Client interface {
+	CreatePod(pod *v1.Pod) (*v1.Pod, error)
+	GetPod(namespace string, name string) (*v1.Pod, error)
+	DeletePod(namespace string, name string) error
+}
+
+// Canary runs canary checks
+type Canary struct {
+	client    Client
+	namespace string
+	image     string
+	logger    *zap.Logger
+	interval  time.Duration
+	slo       time.Duration
+	poll      time.Duration
+
+	checks       *prometheus.CounterVec
+	lastSuccess  prometheus.Gauge
+	lastDuration prometheus.Gauge
+
+	mu        sync.Mutex
+	lastCheck CheckStatus
+}
+
+// CheckStatus is the outcome of a canary check
+type CheckStatus struct {
+	Time     time.Time     `json:"time"`
+	Success  bool          `json:"success"`
+	Duration time.Duration `json:"duration"`
+	Error    string        `json:"error,omitempty"`
+}
+
+// Option sets options when creating a new canary
+type Option func(*Canary) error
+
+// New creates a canary that creates pods in namespace.
+func New(client Client, namespace string, options ...Option) (*Canary, error) {
+	c := &Canary{
+		client:    client,
+		namespace: namespace,
+		image:     "busybox",
+		interval:  time.Hour * 2,
+		slo:       time.Hour * 2,
+		poll:      time.Second * 30,
+		checks: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pod_deleter_canary_checks_total",
+				Help: "Number of canary checks by result: success, failure, or error.",
+			},
+			[]string{"result"},
+		),
+		lastSuccess: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pod_deleter_canary_last_success",
+				Help: "1 if the last canary pod was deleted within the SLO, otherwise 0.",
+			},
+		),
+		lastDuration: prometheus.NewGauge(
+			prometheus.GaugeOpts{
+				Name: "pod_deleter_canary_last_duration_seconds",
+				Help: "Seconds between creating the last canary pod and it being deleted.",
+			},
+		),
+	}
+
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	if c.namespace == "" {
+		return nil, errors.New("namespace is required")
+	}
+
+	if c.logger == nil {
+		l, err := zap.NewProduction()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to create logger")
+		}
+		c.logger = l
+	}
+
+	return c, nil
+}
+
+// Loop runs a check every interval until the context is done.
+func (c *Canary) Loop(ctx context.Context) {
+	t := time.NewTicker(c.interval)
+	defer t.Stop()
+
+	for {
+		if err := c.Check(ctx); err != nil {
+			c.logger.Error("canary check failed", zap.Error(err))
+		}
+
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// Check creates a canary pod and waits for it to be deleted. An error
+// is returned if the pod could not be created or was not deleted within the SLO.
+func (c *Canary) Check(ctx context.Context) error {
+	start := time.Now()
+
+	pod, err := c.client.CreatePod(c.pod())
+	if err != nil {
+		c.checks.WithLabelValues("error").Inc()
+		c.lastSuccess.Set(0)
+		err = errors.Wrap(err, "failed to create canary pod")
+		c.record(start, err)
+		return err
+	}
+
+	name := pod.ObjectMeta.Name
+	logger := c.logger.With(
+		zap.String("namespace", c.namespace),
+		zap.String("name", name),
+	)
+	logger.Debug("created canary pod")
+
+	t := time.NewTicker(c.poll)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			c.cleanup(name)
+			return nil
+		}
+
+		_, err := c.client.GetPod(c.namespace, name)
+		if err != nil {
+			if !k8sErrors.IsNotFound(err) {
+				logger.Warn("failed to get canary pod", zap.Error(err))
+				continue
+			}
+
+			d := time.Since(start)
+			c.checks.WithLabelValues("success").Inc()
+			c.lastSuccess.Set(1)
+			c.lastDuration.Set(d.Seconds())
+			logger.Info("canary pod was deleted", zap.Duration("duration", d))
+			c.record(start, nil)
+			return nil
+		}
+
+		if time.Since(start) > c.slo {
+			c.checks.WithLabelValues("failure").Inc()
+			c.lastSuccess.Set(0)
+			c.cleanup(name)
+			err := errors.Errorf("canary pod %s/%s was not deleted within %s", c.namespace, name, c.slo)
+			c.record(start, err)
+			return err
+		}
+	}
+}
+
+func (c *Canary) record(start time.Time, err error) {
+	status := CheckStatus{
+		Time:     start,
+		Success:  err == nil,
+		Duration: time.Since(start),
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.lastCheck = status
+}
+
+// LastCheck returns the outcome of the most recent completed check. The
+// time is zero if no check has completed.
+func (c *Canary) LastCheck() CheckStatus {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lastCheck
+}
+
+func (c *Canary) cleanup(name string) {
+	if err := c.client.DeletePod(c.namespace, name); err != nil && !k8sErrors.IsNotFound(err) {
+		c.logger.Warn("failed to delete canary pod",
+			zap.String("namespace", c.namespace),
+			zap.String("name", name),
+			zap.Error(err),
+		)
+	}
+}
+
+// pod returns a pod that exits with an error as soon as it starts,
+// so it will go into CrashLoopBackOff.
+func (c *Canary) pod() *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:    c.namespace,
+			GenerateName: "pod-deleter-canary-",
+			Labels: map[string]string{
+				LabelName: "true",
+			},
+		},
+		Spec: v1.PodSpec{
+			RestartPolicy: v1.RestartPolicyAlways,
+			Containers: []v1.Container{
+				{
+					Name:    "canary",
+					Image:   c.image,
+					Command: []string{"sh", "-c", "exit 1"},
+				},
+			},
+		},
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Canary) Describe(ch chan<- *prometheus.Desc) {
+	c.checks.Describe(ch)
+	c.lastSuccess.Describe(ch)
+	c.lastDuration.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Canary) Collect(ch chan<- prometheus.Metric) {
+	c.checks.Collect(ch)
+	c.lastSuccess.Collect(ch)
+	c.lastDuration.Collect(ch)
+}
+
+// WithLogger returns an Option that sets the logger.
+func WithLogger(l *zap.Logger) Option {
+	return func(c *Canary) error {
+		c.logger = l
+		return nil
+	}
+}
+
+// WithImage returns an Option that sets the image used for canary pods.
+// The image must have sh. Default is busybox.
+func WithImage(image string) Option {
+	return func(c *Canary) error {
+		c.image = image
+		return nil
+	}
+}
+
+// WithInterval returns an Option that sets how often a canary pod is created.
+func WithInterval(d time.Duration) Option {
+	return func(c *Canary) error {
+		if d <= 0 {
+			return errors.New("canary interval must be greater than zero")
+		}
+		c.interval = d
+		return nil
+	}
+}
+
+// WithSLO returns an Option that sets how long to wait for a canary
+// pod to be deleted before the check fails.
+func WithSLO(d time.Duration) Option {
+	return func(c *Canary) error {
+		if d <= 0 {
+			return errors.New("canary SLO must be greater than zero")
+		}
+		c.slo = d
+		return nil
+	}
+}
+
+// WithPollInterval returns an Option that sets how often to check
+// if the canary pod has been deleted.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Canary) error {
+		if d <= 0 {
+			return errors.New("canary poll interval must be greater than zero")
+		}
+		c.poll = d
+		return nil
+	}
+}
@@ -0,0 +1,143 @@
+package canary
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pkg/errors"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type testClient struct {
+	sync.Mutex
+	pods map[string]*v1.Pod
+	// number of gets before the pod "is deleted." negative means never
+	gets int
+	// returned by CreatePod, if set
+	createErr error
+}
+
+func (t *testClient) CreatePod(pod *v1.Pod) (*v1.Pod, error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.createErr != nil {
+		return nil, t.createErr
+	}
+	pod.ObjectMeta.Name = pod.ObjectMeta.GenerateName + "test"
+	t.pods[pod.ObjectMeta.Name] = pod
+	return pod, nil
+}
+
+func (t *testClient) GetPod(namespace string, name string) (*v1.Pod, error) {
+	t.Lock()
+	defer t.Unlock()
+	if t.gets == 0 {
+		delete(t.pods, name)
+	}
+	t.gets--
+	pod, ok := t.pods[name]
+	if !ok {
+		return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+	}
+	return pod, nil
+}
+
+func (t *testClient) DeletePod(namespace string, name string) error {
+	t.Lock()
+	defer t.Unlock()
+	delete(t.pods, name)
+	return nil
+}
+
+func TestCheck(t *testing.T) {
+	tests := []struct {
+		description string
+		gets        int
+		success     bool
+	}{
+		{
+			description: "deleted",
+			gets:        2,
+			success:     true,
+		},
+		{
+			description: "not deleted",
+			gets:        -1,
+			success:     false,
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			t.Parallel()
+
+			client := &testClient{
+				pods: make(map[string]*v1.Pod),
+				gets: test.gets,
+			}
+
+			c, err := New(client, "canary",
+				WithLogger(zap.NewNop()),
+				WithPollInterval(time.Millisecond),
+				WithSLO(time.Millisecond*50),
+			)
+			require.NoError(t, err)
+
+			err = c.Check(context.Background())
+			if test.success {
+				require.NoError(t, err)
+			} else {
+				require.Error(t, err)
+			}
+
+			// canary pod is always cleaned up
+			require.Len(t, client.pods, 0)
+
+			status := c.LastCheck()
+			require.Equal(t, test.success, status.Success)
+			require.False(t, status.Time.IsZero())
+		})
+	}
+}
+
+func TestCheckCreateError(t *testing.T) {
+	client := &testClient{
+		pods: make(map[string]*v1.Pod),
+		gets: 1,
+	}
+
+	c, err := New(client, "canary",
+		WithLogger(zap.NewNop()),
+		WithPollInterval(time.Millisecond),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Check(context.Background()))
+	require.Equal(t, float64(1), testutil.ToFloat64(c.lastSuccess))
+
+	// a pod that cannot be created is not a success
+	client.createErr = errors.New("forbidden")
+	require.Error(t, c.Check(context.Background()))
+	require.Equal(t, float64(0), testutil.ToFloat64(c.lastSuccess))
+	require.False(t, c.LastCheck().Success)
+}
+
+func TestOptions(t *testing.T) {
+	for _, o := range []Option{
+		WithInterval(0),
+		WithInterval(-time.Minute),
+		WithSLO(0),
+		WithPollInterval(0),
+	} {
+		_, err := New(&testClient{}, "canary", WithLogger(zap.NewNop()), o)
+		require.Error(t, err)
+	}
+}
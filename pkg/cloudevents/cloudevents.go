@@ -0,0 +1,184 @@
+// Package cloudevents emits the controller's deletions and escalations as
+// CloudEvents, over HTTP or MQTT, so the deleter plugs into eventing
+// systems such as Knative Eventing or Argo Events.
+package cloudevents
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// Event types
+const (
+	// TypeDeleted is emitted for each pod deleted, or acted on
+	TypeDeleted = "io.bakins.pod-deleter.pod.deleted"
+	// TypeFailed is emitted for each pod that could not be acted on
+	TypeFailed = "io.bakins.pod-deleter.pod.failed"
+	// TypeEscalated is emitted when a workload is escalated, such as
+	// when it starts flapping or is scaled down. The reason is in the
+	// data.
+	TypeEscalated = "io.bakins.pod-deleter.workload.escalated"
+)
+
+// DefaultSource is the source of events if none is set
+const DefaultSource = "/k8s-pod-deleter"
+
+// Event is a CloudEvent in the structured JSON format
+type Event struct {
+	SpecVersion     string      `json:"specversion"`
+	ID              string      `json:"id"`
+	Source          string      `json:"source"`
+	Type            string      `json:"type"`
+	Subject         string      `json:"subject,omitempty"`
+	Time            time.Time   `json:"time"`
+	DataContentType string      `json:"datacontenttype"`
+	Data            interface{} `json:"data"`
+}
+
+// Escalation is the data of a TypeEscalated event
+type Escalation struct {
+	Namespace string `json:"namespace"`
+	// Kind and Name are the workload that was escalated
+	Kind    string `json:"kind"`
+	Name    string `json:"name"`
+	Reason  string `json:"reason"`
+	Message string `json:"message"`
+	// Pod is the pod whose deletion caused the escalation
+	Pod   string `json:"pod"`
+	RunID string `json:"runID,omitempty"`
+}
+
+// Sender delivers events
+type Sender interface {
+	Send(e Event) error
+}
+
+// Emitter turns decisions and escalations into events. It implements
+// controller.Auditor, and its Hooks report escalations.
+type Emitter struct {
+	sender Sender
+	source string
+	logger *zap.Logger
+}
+
+// Option sets options when creating a new Emitter
+type Option func(*Emitter) error
+
+// New creates an emitter that delivers events with s.
+func New(s Sender, options ...Option) (*Emitter, error) {
+	if s == nil {
+		return nil, errors.New("sender is required")
+	}
+
+	e := &Emitter{
+		sender: s,
+		source: DefaultSource,
+		logger: zap.NewNop(),
+	}
+
+	for _, o := range options {
+		if err := o(e); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	return e, nil
+}
+
+// WithSource returns an Option that sets the source of every event, such
+// as /clusters/production/k8s-pod-deleter. Default is DefaultSource.
+func WithSource(source string) Option {
+	return func(e *Emitter) error {
+		if source == "" {
+			return errors.New("source must not be empty")
+		}
+		e.source = source
+		return nil
+	}
+}
+
+// WithLogger returns an Option that sets the logger used to report
+// errors sending events.
+func WithLogger(logger *zap.Logger) Option {
+	return func(e *Emitter) error {
+		e.logger = logger
+		return nil
+	}
+}
+
+// Audit emits an event for each pod acted on in a run, or that could not
+// be. The data is the decision and the subject is the pod's namespace and
+// name.
+func (e *Emitter) Audit(r *controller.RunResult) {
+	var events []Event
+	for _, d := range r.Deleted {
+		events = append(events, e.event(TypeDeleted, d.Namespace+"/"+d.Name, d.Time, d))
+	}
+	for _, d := range r.Errors {
+		events = append(events, e.event(TypeFailed, d.Namespace+"/"+d.Name, d.Time, d))
+	}
+
+	for _, ev := range events {
+		if err := e.sender.Send(ev); err != nil {
+			// a sink that is down would fail every event, each after a timeout
+			e.logger.Error("failed to send cloud event", zap.String("type", ev.Type), zap.Error(err))
+			return
+		}
+	}
+}
+
+// Hooks returns controller hooks that emit an event when a workload is
+// escalated.
+func (e *Emitter) Hooks() controller.Hooks {
+	return controller.Hooks{
+		OnEscalate: e.escalate,
+	}
+}
+
+func (e *Emitter) escalate(cand controller.Candidate, event *v1.Event) {
+	obj := event.InvolvedObject
+	data := Escalation{
+		Namespace: obj.Namespace,
+		Kind:      obj.Kind,
+		Name:      obj.Name,
+		Reason:    event.Reason,
+		Message:   event.Message,
+		Pod:       cand.Pod.ObjectMeta.Name,
+		RunID:     cand.RunID,
+	}
+	subject := obj.Namespace + "/" + strings.ToLower(obj.Kind) + "/" + obj.Name
+
+	ev := e.event(TypeEscalated, subject, event.FirstTimestamp.Time, data)
+	if err := e.sender.Send(ev); err != nil {
+		e.logger.Error("failed to send cloud event", zap.String("type", ev.Type), zap.Error(err))
+	}
+}
+
+func (e *Emitter) event(kind string, subject string, t time.Time, data interface{}) Event {
+	return Event{
+		SpecVersion:     "1.0",
+		ID:              newID(),
+		Source:          e.source,
+		Type:            kind,
+		Subject:         subject,
+		Time:            t.UTC(),
+		DataContentType: "application/json",
+		Data:            data,
+	}
+}
+
+// newID returns a random ID, unique within the source
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return time.Now().UTC().Format("20060102T150405.000000000")
+	}
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,191 @@
+package cloudevents
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+type testServer struct {
+	mu           sync.Mutex
+	events       []map[string]interface{}
+	contentTypes []string
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e map[string]interface{}
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	s.contentTypes = append(s.contentTypes, r.Header.Get("Content-Type"))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func TestHTTP(t *testing.T) {
+	s := &testServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	e, err := New(HTTP(server.URL), WithSource("/clusters/test"))
+	require.NoError(t, err)
+
+	now := time.Now()
+	e.Audit(&controller.RunResult{
+		ID: "f00d",
+		Deleted: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-1", Reason: "CrashLoopBackOff", Action: "deleted", RunID: "f00d"},
+		},
+		Errors: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-2", Reason: "Error", Action: "deleted", Error: "forbidden", RunID: "f00d"},
+		},
+		Skipped: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-3", Action: "skipped", Skip: "Budget"},
+		},
+	})
+
+	pod := v1.Pod{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "web-4"}}
+	e.Hooks().OnEscalate(controller.Candidate{Pod: pod, RunID: "f00d"}, &v1.Event{
+		InvolvedObject: v1.ObjectReference{Kind: "ReplicaSet", Namespace: "default", Name: "web-1234"},
+		Reason:         "Flapping",
+		Message:        "2 pods were deleted",
+		FirstTimestamp: metav1.NewTime(now),
+	})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	require.Len(t, s.events, 3)
+	for i, ev := range s.events {
+		require.Equal(t, "1.0", ev["specversion"])
+		require.Equal(t, "/clusters/test", ev["source"])
+		require.NotEmpty(t, ev["id"])
+		require.Equal(t, "application/cloudevents+json; charset=utf-8", s.contentTypes[i])
+	}
+	require.Equal(t, TypeDeleted, s.events[0]["type"])
+	require.Equal(t, "default/web-1", s.events[0]["subject"])
+	require.Equal(t, TypeFailed, s.events[1]["type"])
+	require.Equal(t, TypeEscalated, s.events[2]["type"])
+	require.Equal(t, "default/replicaset/web-1234", s.events[2]["subject"])
+	data := s.events[2]["data"].(map[string]interface{})
+	require.Equal(t, "Flapping", data["reason"])
+	require.Equal(t, "web-4", data["pod"])
+}
+
+// testBroker is an MQTT broker that accepts QoS 1 publishes
+type testBroker struct {
+	listener net.Listener
+
+	mu       sync.Mutex
+	topics   []string
+	payloads []string
+	users    []string
+}
+
+func newTestBroker(t *testing.T) *testBroker {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	b := &testBroker{listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go b.serve(conn)
+		}
+	}()
+	return b
+}
+
+func (b *testBroker) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+
+	for {
+		kind, body, err := readMQTTPacket(r)
+		if err != nil {
+			return
+		}
+		switch kind {
+		case mqttConnect:
+			// skip the protocol name, level, flags, keep alive, and client ID
+			rest := body[10:]
+			rest = rest[2+binary.BigEndian.Uint16(rest):]
+			var user string
+			if len(rest) > 0 {
+				user = string(rest[2 : 2+binary.BigEndian.Uint16(rest)])
+			}
+			b.mu.Lock()
+			b.users = append(b.users, user)
+			b.mu.Unlock()
+			conn.Write(mqttPacket(mqttConnAck<<4, []byte{0, 0}))
+		case mqttPublish:
+			n := binary.BigEndian.Uint16(body)
+			topic := string(body[2 : 2+n])
+			id := body[2+n : 4+n]
+			b.mu.Lock()
+			b.topics = append(b.topics, topic)
+			b.payloads = append(b.payloads, string(body[4+n:]))
+			b.mu.Unlock()
+			conn.Write(mqttPacket(mqttPubAck<<4, id))
+		case mqttDisconnect:
+			return
+		}
+	}
+}
+
+func TestMQTT(t *testing.T) {
+	broker := newTestBroker(t)
+	defer broker.listener.Close()
+
+	sender := MQTT(broker.listener.Addr().String(), "pod-deleter/events", "deleter", "secret")
+	e, err := New(sender)
+	require.NoError(t, err)
+
+	e.Audit(&controller.RunResult{
+		Deleted: []controller.Decision{
+			{Time: time.Now(), Namespace: "default", Name: "web-1", Reason: "Error", Action: "deleted"},
+			{Time: time.Now(), Namespace: "default", Name: "web-2", Reason: "Error", Action: "deleted"},
+		},
+	})
+
+	broker.mu.Lock()
+	defer broker.mu.Unlock()
+	require.Equal(t, []string{"pod-deleter/events", "pod-deleter/events"}, broker.topics)
+	require.Equal(t, []string{"deleter", "deleter"}, broker.users)
+
+	var ev Event
+	require.NoError(t, json.Unmarshal([]byte(broker.payloads[1]), &ev))
+	require.Equal(t, TypeDeleted, ev.Type)
+	require.Equal(t, DefaultSource, ev.Source)
+	require.Equal(t, "default/web-2", ev.Subject)
+}
+
+func TestMQTTPacketLength(t *testing.T) {
+	body := make([]byte, 321)
+	packet := mqttPacket(mqttPublish<<4, body)
+	// 321 needs two bytes
+	require.Equal(t, []byte{mqttPublish << 4, 0xc1, 0x02}, packet[:3])
+
+	kind, read, err := readMQTTPacket(bufio.NewReader(bytes.NewReader(packet)))
+	require.NoError(t, err)
+	require.Equal(t, byte(mqttPublish), kind)
+	require.Len(t, read, 321)
+}
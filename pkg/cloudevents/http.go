@@ -0,0 +1,48 @@
+package cloudevents
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type httpSender struct {
+	url    string
+	client *http.Client
+}
+
+// HTTP returns a Sender that posts each event to url in the structured
+// content mode, such as to a Knative broker or an Argo Events webhook.
+func HTTP(url string) Sender {
+	return &httpSender{
+		url:    url,
+		client: &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+func (h *httpSender) Send(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, h.url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/cloudevents+json; charset=utf-8")
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post event")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status posting event: %s", resp.Status)
+	}
+	return nil
+}
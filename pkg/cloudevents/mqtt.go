@@ -0,0 +1,187 @@
+package cloudevents
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"net"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// mqttTimeout limits connecting to the broker, and then sending an event
+const mqttTimeout = time.Second * 10
+
+// MQTT control packet types
+const (
+	mqttConnect    = 1
+	mqttConnAck    = 2
+	mqttPublish    = 3
+	mqttPubAck     = 4
+	mqttDisconnect = 14
+)
+
+type mqttSender struct {
+	address  string
+	topic    string
+	clientID string
+	user     string
+	password string
+
+	mu       sync.Mutex
+	packetID uint16
+}
+
+// MQTT returns a Sender that publishes each event to topic on an MQTT
+// 3.1.1 broker at address, such as mosquitto:1883, in the structured
+// content mode with QoS 1, so the broker acknowledges it. If user is set,
+// the connection is authenticated with user and password.
+func MQTT(address string, topic string, user string, password string) Sender {
+	return &mqttSender{
+		address:  address,
+		topic:    topic,
+		clientID: "k8s-pod-deleter-" + newID()[:8],
+		user:     user,
+		password: password,
+	}
+}
+
+func (m *mqttSender) Send(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+
+	conn, err := net.DialTimeout("tcp", m.address, mqttTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", m.address)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(mqttTimeout)); err != nil {
+		return err
+	}
+	r := bufio.NewReader(conn)
+
+	if _, err := conn.Write(m.connectPacket()); err != nil {
+		return errors.Wrap(err, "failed to connect")
+	}
+	kind, body, err := readMQTTPacket(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read connect acknowledgement")
+	}
+	if kind != mqttConnAck || len(body) != 2 {
+		return errors.Errorf("unexpected packet type %d", kind)
+	}
+	if body[1] != 0 {
+		return errors.Errorf("broker refused connection with code %d", body[1])
+	}
+
+	m.mu.Lock()
+	m.packetID++
+	if m.packetID == 0 {
+		m.packetID = 1
+	}
+	id := m.packetID
+	m.mu.Unlock()
+
+	var publish bytes.Buffer
+	writeMQTTString(&publish, m.topic)
+	binary.Write(&publish, binary.BigEndian, id)
+	publish.Write(data)
+	// QoS 1
+	if _, err := conn.Write(mqttPacket(mqttPublish<<4|0x02, publish.Bytes())); err != nil {
+		return errors.Wrap(err, "failed to publish")
+	}
+
+	kind, body, err = readMQTTPacket(r)
+	if err != nil {
+		return errors.Wrap(err, "failed to read publish acknowledgement")
+	}
+	if kind != mqttPubAck || len(body) != 2 || binary.BigEndian.Uint16(body) != id {
+		return errors.Errorf("unexpected packet type %d", kind)
+	}
+
+	conn.Write(mqttPacket(mqttDisconnect<<4, nil))
+	return nil
+}
+
+func (m *mqttSender) connectPacket() []byte {
+	var b bytes.Buffer
+	writeMQTTString(&b, "MQTT")
+	// protocol level 4 is MQTT 3.1.1
+	b.WriteByte(4)
+
+	// clean session
+	flags := byte(0x02)
+	if m.user != "" {
+		flags |= 0x80 | 0x40
+	}
+	b.WriteByte(flags)
+	binary.Write(&b, binary.BigEndian, uint16(60))
+
+	writeMQTTString(&b, m.clientID)
+	if m.user != "" {
+		writeMQTTString(&b, m.user)
+		writeMQTTString(&b, m.password)
+	}
+	return mqttPacket(mqttConnect<<4, b.Bytes())
+}
+
+// mqttPacket adds the fixed header to a packet body
+func mqttPacket(header byte, body []byte) []byte {
+	out := []byte{header}
+	// the remaining length is encoded 7 bits at a time
+	n := len(body)
+	for {
+		digit := byte(n % 128)
+		n /= 128
+		if n > 0 {
+			digit |= 0x80
+		}
+		out = append(out, digit)
+		if n == 0 {
+			break
+		}
+	}
+	return append(out, body...)
+}
+
+func writeMQTTString(b *bytes.Buffer, s string) {
+	binary.Write(b, binary.BigEndian, uint16(len(s)))
+	b.WriteString(s)
+}
+
+// readMQTTPacket reads a packet, returning its type and body
+func readMQTTPacket(r *bufio.Reader) (byte, []byte, error) {
+	header, err := r.ReadByte()
+	if err != nil {
+		return 0, nil, err
+	}
+
+	length, multiplier := 0, 1
+	for i := 0; ; i++ {
+		if i == 4 {
+			return 0, nil, errors.New("invalid remaining length")
+		}
+		digit, err := r.ReadByte()
+		if err != nil {
+			return 0, nil, err
+		}
+		length += int(digit&0x7f) * multiplier
+		multiplier *= 128
+		if digit&0x80 == 0 {
+			break
+		}
+	}
+
+	body := make([]byte, length)
+	if _, err := io.ReadFull(r, body); err != nil {
+		return 0, nil, err
+	}
+	return header >> 4, body, nil
+}
@@ -0,0 +1,794 @@
+// Package config loads the k8s-pod-deleter configuration file.
+package config
+
+import (
+	"io/ioutil"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+	"github.com/robfig/cron"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/yaml.v2"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Config is the contents of a configuration file. Each field mirrors a
+// command line flag; rules, actions, namespaces, and windows have no flag equivalent.
+type Config struct {
+	Kubeconfig              string                       `yaml:"kubeconfig"`
+	Context                 string                       `yaml:"context"`
+	ListChunkSize           *int64                       `yaml:"listChunkSize"`
+	KubeAPIJSON             bool                         `yaml:"kubeAPIJSON"`
+	KubeAPIQPS              float32                      `yaml:"kubeAPIQPS"`
+	KubeAPIBurst            int                          `yaml:"kubeAPIBurst"`
+	KubeAPITimeout          time.Duration                `yaml:"kubeAPITimeout"`
+	As                      string                       `yaml:"as"`
+	AsGroups                []string                     `yaml:"asGroups"`
+	ResyncPeriod            *time.Duration               `yaml:"resyncPeriod"`
+	KubeconfigReload        time.Duration                `yaml:"kubeconfigReload"`
+	Namespace               string                       `yaml:"namespace"`
+	Selector                string                       `yaml:"selector"`
+	ExcludeSelector         string                       `yaml:"excludeSelector"`
+	AnnotationSelector      string                       `yaml:"annotationSelector"`
+	LogLevel                string                       `yaml:"logLevel"`
+	LogFormat               string                       `yaml:"logFormat"`
+	LogOutput               string                       `yaml:"logOutput"`
+	LogSampling             *int                         `yaml:"logSampling"`
+	Explain                 bool                         `yaml:"explain"`
+	Reasons                 Reasons                      `yaml:"reasons"`
+	DryRun                  bool                         `yaml:"dryRun"`
+	Once                    bool                         `yaml:"once"`
+	ReportFormat            string                       `yaml:"reportFormat"`
+	ReportFile              string                       `yaml:"reportFile"`
+	SummaryFile             string                       `yaml:"summaryFile"`
+	ExitCodeOnDelete        int                          `yaml:"exitCodeOnDelete"`
+	ExitCodeOnCandidates    int                          `yaml:"exitCodeOnCandidates"`
+	GracePeriod             time.Duration                `yaml:"gracePeriod"`
+	GraceFrom               string                       `yaml:"graceFrom"`
+	MinTerminatedAge        time.Duration                `yaml:"minTerminatedAge"`
+	RestartRate             float64                      `yaml:"restartRate"`
+	RestartThreshold        int32                        `yaml:"restartThreshold"`
+	RestartWindow           time.Duration                `yaml:"restartWindow"`
+	NotReadyTimeout         time.Duration                `yaml:"notReadyTimeout"`
+	Conditions              []Condition                  `yaml:"conditions"`
+	EventReasons            []string                     `yaml:"eventReasons"`
+	EventThreshold          *int                         `yaml:"eventThreshold"`
+	EventWindow             time.Duration                `yaml:"eventWindow"`
+	MaxMemoryPercent        float64                      `yaml:"maxMemoryPercent"`
+	MaxCPUPercent           float64                      `yaml:"maxCPUPercent"`
+	Containers              []string                     `yaml:"containers"`
+	ExcludeContainers       []string                     `yaml:"excludeContainers"`
+	IncludeImages           []string                     `yaml:"includeImages"`
+	ExcludeImages           []string                     `yaml:"excludeImages"`
+	ExcludeServiceAccounts  []string                     `yaml:"excludeServiceAccounts"`
+	MinProtectedPriority    int32                        `yaml:"minProtectedPriority"`
+	OnlyPriorityClasses     []string                     `yaml:"onlyPriorityClasses"`
+	IgnoreDisruption        bool                         `yaml:"ignoreDisruptionAnnotations"`
+	Phases                  []string                     `yaml:"phases"`
+	Interval                time.Duration                `yaml:"interval"`
+	Schedule                string                       `yaml:"schedule"`
+	Budget                  *int                         `yaml:"budget"`
+	Order                   string                       `yaml:"order"`
+	BudgetWindow            time.Duration                `yaml:"budgetWindow"`
+	KeepFailing             int                          `yaml:"keepFailing"`
+	MassFailurePercent      float64                      `yaml:"massFailurePercent"`
+	MassFailureMin          *int                         `yaml:"massFailureMinCandidates"`
+	NodeHealthPercent       float64                      `yaml:"nodeHealthPercent"`
+	FlapThreshold           int                          `yaml:"flapThreshold"`
+	FlapWindow              time.Duration                `yaml:"flapWindow"`
+	FlapScaleDown           bool                         `yaml:"flapScaleDown"`
+	RetryAttempts           int                          `yaml:"retryAttempts"`
+	RetryBackoff            time.Duration                `yaml:"retryBackoff"`
+	RetryMaxBackoff         time.Duration                `yaml:"retryMaxBackoff"`
+	DeleteDelay             time.Duration                `yaml:"deleteDelay"`
+	ReplacementWindow       time.Duration                `yaml:"replacementWindow"`
+	WaitForReplacement      time.Duration                `yaml:"waitForReplacement"`
+	FailFast                bool                         `yaml:"failFast"`
+	NoEvalCache             bool                         `yaml:"noEvalCache"`
+	Tombstone               bool                         `yaml:"tombstone"`
+	AnnotateOwners          bool                         `yaml:"annotateOwners"`
+	CheckPDB                bool                         `yaml:"checkPDB"`
+	CheckRollouts           bool                         `yaml:"checkRollouts"`
+	StatefulSetMode         string                       `yaml:"statefulSetMode"`
+	AllowLastReadyReplica   bool                         `yaml:"allowLastReadyReplica"`
+	HTTPAddress             string                       `yaml:"httpAddress"`
+	AdminTokenFile          string                       `yaml:"adminTokenFile"`
+	DebugAddr               string                       `yaml:"debugAddr"`
+	CanaryNamespace         string                       `yaml:"canaryNamespace"`
+	CanaryImage             string                       `yaml:"canaryImage"`
+	CanaryInterval          time.Duration                `yaml:"canaryInterval"`
+	CanarySLO               time.Duration                `yaml:"canarySLO"`
+	AuditFile               string                       `yaml:"auditFile"`
+	AuditLevel              string                       `yaml:"auditLevel"`
+	AuditMaxSize            *int                         `yaml:"auditMaxSize"`
+	AuditMaxAge             *time.Duration               `yaml:"auditMaxAge"`
+	AuditMaxBackups         *int                         `yaml:"auditMaxBackups"`
+	LogCaptureLines         int64                        `yaml:"logCaptureLines"`
+	LogCaptureDir           string                       `yaml:"logCaptureDir"`
+	Archive                 string                       `yaml:"archive"`
+	ArchiveCluster          string                       `yaml:"archiveCluster"`
+	ArchiveEvents           bool                         `yaml:"archiveEvents"`
+	ArchiveRegion           string                       `yaml:"archiveRegion"`
+	ArchiveEndpoint         string                       `yaml:"archiveEndpoint"`
+	ArchiveAccessKey        string                       `yaml:"archiveAccessKey"`
+	ArchiveSecretFile       string                       `yaml:"archiveSecretFile"`
+	CloudEventsSink         string                       `yaml:"cloudEventsSink"`
+	CloudEventsSource       string                       `yaml:"cloudEventsSource"`
+	CloudEventsPasswordFile string                       `yaml:"cloudEventsPasswordFile"`
+	DatadogAPIKeyFile       string                       `yaml:"datadogAPIKeyFile"`
+	DatadogSite             string                       `yaml:"datadogSite"`
+	DatadogTags             []string                     `yaml:"datadogTags"`
+	DatadogRollup           bool                         `yaml:"datadogRollup"`
+	StatsDAddr              string                       `yaml:"statsdAddr"`
+	StatsDPrefix            *string                      `yaml:"statsdPrefix"`
+	StatsDNoTags            bool                         `yaml:"statsdNoTags"`
+	PushgatewayURL          string                       `yaml:"pushgatewayURL"`
+	PushgatewayJob          string                       `yaml:"pushgatewayJob"`
+	PushgatewayGrouping     []string                     `yaml:"pushgatewayGrouping"`
+	StreamNATS              string                       `yaml:"streamNATS"`
+	StreamKafkaREST         string                       `yaml:"streamKafkaREST"`
+	StreamTopic             string                       `yaml:"streamTopic"`
+	StreamUser              string                       `yaml:"streamUser"`
+	StreamPasswordFile      string                       `yaml:"streamPasswordFile"`
+	StreamLevel             string                       `yaml:"streamLevel"`
+	History                 string                       `yaml:"history"`
+	HistoryRetention        time.Duration                `yaml:"historyRetention"`
+	RedisPasswordFile       string                       `yaml:"redisPasswordFile"`
+	StatusConfigMap         string                       `yaml:"statusConfigMap"`
+	ControlConfigMap        string                       `yaml:"controlConfigMap"`
+	DrainNodes              []string                     `yaml:"drainNodes"`
+	DrainAnnotation         bool                         `yaml:"drainAnnotation"`
+	CordonedNodeDelay       time.Duration                `yaml:"cordonedNodeDelay"`
+	NodeNotReadyTimeout     time.Duration                `yaml:"nodeNotReadyTimeout"`
+	NodeNotReadyForce       bool                         `yaml:"nodeNotReadyForce"`
+	UnknownPhaseTimeout     time.Duration                `yaml:"unknownPhaseTimeout"`
+	UnknownPhaseForce       bool                         `yaml:"unknownPhaseForce"`
+	OrphanedPodGrace        time.Duration                `yaml:"orphanedPodGrace"`
+	FinishedJobTTL          time.Duration                `yaml:"finishedJobTTL"`
+	Action                  string                       `yaml:"action"`
+	Actions                 map[string]Action            `yaml:"actions"`
+	Rules                   []Rule                       `yaml:"rules"`
+	Windows                 []Window                     `yaml:"windows"`
+	Namespaces              map[string]NamespaceOverride `yaml:"namespaces"`
+}
+
+// Rule selects a set of pods to consider for deletion. Empty fields
+// are inherited from the top level configuration.
+type Rule struct {
+	Name          string        `yaml:"name"`
+	Namespace     string        `yaml:"namespace"`
+	Selector      string        `yaml:"selector"`
+	Reasons       Reasons       `yaml:"reasons"`
+	GracePeriod   time.Duration `yaml:"gracePeriod"`
+	RestartRate   float64       `yaml:"restartRate"`
+	IncludeImages []string      `yaml:"includeImages"`
+	ExcludeImages []string      `yaml:"excludeImages"`
+	Action        string        `yaml:"action"`
+	Windows       []Window      `yaml:"windows"`
+}
+
+// Reasons is a list of reasons, such as [CrashLoopBackOff, Error], or a
+// map of reasons to grace periods, such as {CrashLoopBackOff: 1h, ErrImagePull: 15m}.
+// A zero grace period uses the gracePeriod.
+type Reasons struct {
+	Names []string
+	Grace map[string]time.Duration
+}
+
+// UnmarshalYAML accepts a list or a map of reasons
+func (r *Reasons) UnmarshalYAML(unmarshal func(interface{}) error) error {
+	var names []string
+	if err := unmarshal(&names); err == nil {
+		r.Names = names
+		r.Grace = nil
+		return nil
+	}
+
+	var grace map[string]time.Duration
+	if err := unmarshal(&grace); err != nil {
+		return errors.New("reasons must be a list of reasons or a map of reasons to grace periods")
+	}
+
+	r.Names = make([]string, 0, len(grace))
+	for name := range grace {
+		r.Names = append(r.Names, name)
+	}
+	sort.Strings(r.Names)
+	r.Grace = grace
+	return nil
+}
+
+// MarshalYAML writes a map if any reason has a grace period, otherwise a list
+func (r Reasons) MarshalYAML() (interface{}, error) {
+	if len(r.Grace) == 0 {
+		return r.Names, nil
+	}
+
+	grace := make(map[string]time.Duration, len(r.Names))
+	for _, name := range r.Names {
+		grace[name] = r.Grace[name]
+	}
+	return grace, nil
+}
+
+func (r Reasons) validate() error {
+	if err := validateReasons(r.Names); err != nil {
+		return err
+	}
+	for name, d := range r.Grace {
+		if d < 0 {
+			return errors.Errorf("grace period for reason %q must not be negative: %s", name, d)
+		}
+	}
+	return nil
+}
+
+// Condition matches pods that have had a condition with the status,
+// and optionally the reason, for at least the duration.
+type Condition struct {
+	Type   string        `yaml:"type"`
+	Status string        `yaml:"status"`
+	Reason string        `yaml:"reason"`
+	For    time.Duration `yaml:"for"`
+}
+
+func (c Condition) validate() error {
+	if c.Type == "" {
+		return errors.New("type is required")
+	}
+	switch c.Status {
+	case "True", "False", "Unknown":
+	default:
+		return errors.Errorf("status must be True, False, or Unknown: %q", c.Status)
+	}
+	if c.For < 0 {
+		return errors.Errorf("for must not be negative: %s", c.For)
+	}
+	return nil
+}
+
+// Window is a time window in which pods may be acted on or, with deny,
+// may not be, such as business hours or a release freeze.
+type Window struct {
+	Name string `yaml:"name"`
+	Deny bool   `yaml:"deny"`
+	// Days are days of the week, such as Mon, Saturday, or Mon-Fri
+	Days []string `yaml:"days"`
+	// Start and End are times of day, such as 09:00 and 17:00
+	Start string `yaml:"start"`
+	End   string `yaml:"end"`
+	// From and To are dates, such as 2018-12-20, or times, such as 2018-12-20T18:00
+	From     string `yaml:"from"`
+	To       string `yaml:"to"`
+	Timezone string `yaml:"timezone"`
+}
+
+// ControllerWindows converts windows to those used by the controller
+func ControllerWindows(windows []Window) []controller.Window {
+	var out []controller.Window
+	for _, w := range windows {
+		out = append(out, controller.Window{
+			Name:     w.Name,
+			Deny:     w.Deny,
+			Days:     w.Days,
+			Start:    w.Start,
+			End:      w.End,
+			From:     w.From,
+			To:       w.To,
+			Timezone: w.Timezone,
+		})
+	}
+	return out
+}
+
+// ConfigWindows converts windows used by the controller to those in a
+// configuration file
+func ConfigWindows(windows []controller.Window) []Window {
+	var out []Window
+	for _, w := range windows {
+		out = append(out, Window{
+			Name:     w.Name,
+			Deny:     w.Deny,
+			Days:     w.Days,
+			Start:    w.Start,
+			End:      w.End,
+			From:     w.From,
+			To:       w.To,
+			Timezone: w.Timezone,
+		})
+	}
+	return out
+}
+
+func validateWindows(windows []Window) error {
+	for i, w := range ControllerWindows(windows) {
+		if err := w.Validate(); err != nil {
+			if w.Name != "" {
+				return errors.Wrapf(err, "window %q", w.Name)
+			}
+			return errors.Wrapf(err, "window %d", i)
+		}
+	}
+	return nil
+}
+
+// Action is a named remediation that rules may select instead of
+// deleting pods. The actions "delete" and "evict" are always available.
+type Action struct {
+	// Type is one of delete, evict, annotate, label, deletionCost,
+	// rolloutRestart, deleteJob, or annotateJob
+	Type        string            `yaml:"type"`
+	Annotations map[string]string `yaml:"annotations"`
+	Labels      map[string]string `yaml:"labels"`
+	// Cost is the pod deletion cost set by the deletionCost type
+	Cost int `yaml:"cost"`
+	// Cooldown is how long the rolloutRestart type waits before
+	// restarting the same workload again
+	Cooldown time.Duration `yaml:"cooldown"`
+}
+
+// BuiltinActions are the actions that do not need to be configured
+var BuiltinActions = []string{"delete", "evict", "rollout-restart", "delete-job"}
+
+// NamespaceOverride changes the reasons and/or grace period for
+// all pods in a namespace. Priority orders deletions when the budget
+// cannot cover all candidates; higher is deleted first.
+type NamespaceOverride struct {
+	Reasons     []string      `yaml:"reasons"`
+	GracePeriod time.Duration `yaml:"gracePeriod"`
+	Priority    int           `yaml:"priority"`
+}
+
+// Load reads and parses a configuration file.
+func Load(filename string) (*Config, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read %q", filename)
+	}
+
+	c, err := Parse(data)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to load %q", filename)
+	}
+	return c, nil
+}
+
+// Parse parses and validates a configuration. Unknown fields are an error.
+func Parse(data []byte) (*Config, error) {
+	var c Config
+	if err := yaml.UnmarshalStrict(data, &c); err != nil {
+		return nil, errors.Wrap(err, "failed to parse configuration")
+	}
+
+	if err := c.Validate(); err != nil {
+		return nil, errors.Wrap(err, "invalid configuration")
+	}
+	return &c, nil
+}
+
+// Validate checks the configuration for errors.
+func (c *Config) Validate() error {
+	if c.LogLevel != "" {
+		var l zapcore.Level
+		if err := l.UnmarshalText([]byte(c.LogLevel)); err != nil {
+			return errors.Wrapf(err, "invalid logLevel %q", c.LogLevel)
+		}
+	}
+
+	switch c.LogFormat {
+	case "", "json", "console":
+	default:
+		return errors.Errorf("invalid logFormat %q", c.LogFormat)
+	}
+
+	if c.LogSampling != nil && *c.LogSampling < 0 {
+		return errors.Errorf("logSampling must not be negative: %d", *c.LogSampling)
+	}
+
+	if err := validateSelector(c.Selector); err != nil {
+		return err
+	}
+
+	if err := validateSelector(c.ExcludeSelector); err != nil {
+		return errors.Wrap(err, "excludeSelector")
+	}
+
+	if err := validateSelector(c.AnnotationSelector); err != nil {
+		return errors.Wrap(err, "annotationSelector")
+	}
+
+	if err := c.Reasons.validate(); err != nil {
+		return err
+	}
+
+	if c.GracePeriod < 0 {
+		return errors.Errorf("gracePeriod must not be negative: %s", c.GracePeriod)
+	}
+
+	switch c.GraceFrom {
+	case "", "creation", "state":
+	default:
+		return errors.Errorf("invalid graceFrom %q", c.GraceFrom)
+	}
+
+	switch c.Order {
+	case "", "priority", "restarts", "oldest-failure":
+	default:
+		return errors.Errorf("invalid order %q", c.Order)
+	}
+
+	for _, phase := range c.Phases {
+		switch phase {
+		case "Pending", "Running", "Succeeded", "Failed", "Unknown":
+		default:
+			return errors.Errorf("invalid phase %q", phase)
+		}
+	}
+
+	if c.MinTerminatedAge < 0 {
+		return errors.Errorf("minTerminatedAge must not be negative: %s", c.MinTerminatedAge)
+	}
+
+	if err := validateImages(c.IncludeImages, c.ExcludeImages); err != nil {
+		return err
+	}
+
+	if c.ListChunkSize != nil && *c.ListChunkSize < 0 {
+		return errors.Errorf("listChunkSize must not be negative: %d", *c.ListChunkSize)
+	}
+
+	if c.KubeAPIQPS < 0 || c.KubeAPIBurst < 0 {
+		return errors.New("kubeAPIQPS and kubeAPIBurst must not be negative")
+	}
+
+	if c.KubeAPITimeout < 0 {
+		return errors.Errorf("kubeAPITimeout must not be negative: %s", c.KubeAPITimeout)
+	}
+
+	if c.As == "" && len(c.AsGroups) > 0 {
+		return errors.New("asGroups requires as")
+	}
+
+	if c.ResyncPeriod != nil && *c.ResyncPeriod < 0 {
+		return errors.Errorf("resyncPeriod must not be negative: %s", *c.ResyncPeriod)
+	}
+
+	if c.KubeconfigReload < 0 {
+		return errors.Errorf("kubeconfigReload must not be negative: %s", c.KubeconfigReload)
+	}
+
+	if c.RestartRate < 0 {
+		return errors.Errorf("restartRate must not be negative: %v", c.RestartRate)
+	}
+
+	if c.RestartThreshold < 0 {
+		return errors.Errorf("restartThreshold must not be negative: %d", c.RestartThreshold)
+	}
+
+	if c.RestartWindow < 0 {
+		return errors.Errorf("restartWindow must not be negative: %s", c.RestartWindow)
+	}
+
+	if c.NotReadyTimeout < 0 {
+		return errors.Errorf("notReadyTimeout must not be negative: %s", c.NotReadyTimeout)
+	}
+
+	if c.CordonedNodeDelay < 0 {
+		return errors.Errorf("cordonedNodeDelay must not be negative: %s", c.CordonedNodeDelay)
+	}
+
+	if c.NodeNotReadyTimeout < 0 {
+		return errors.Errorf("nodeNotReadyTimeout must not be negative: %s", c.NodeNotReadyTimeout)
+	}
+
+	if c.UnknownPhaseTimeout < 0 {
+		return errors.Errorf("unknownPhaseTimeout must not be negative: %s", c.UnknownPhaseTimeout)
+	}
+
+	if c.OrphanedPodGrace < 0 {
+		return errors.Errorf("orphanedPodGrace must not be negative: %s", c.OrphanedPodGrace)
+	}
+
+	if c.FinishedJobTTL < 0 {
+		return errors.Errorf("finishedJobTTL must not be negative: %s", c.FinishedJobTTL)
+	}
+
+	if c.EventThreshold != nil && *c.EventThreshold < 0 {
+		return errors.Errorf("eventThreshold must not be negative: %d", *c.EventThreshold)
+	}
+
+	if c.EventWindow < 0 {
+		return errors.Errorf("eventWindow must not be negative: %s", c.EventWindow)
+	}
+
+	if c.MaxMemoryPercent < 0 {
+		return errors.Errorf("maxMemoryPercent must not be negative: %v", c.MaxMemoryPercent)
+	}
+
+	if c.MaxCPUPercent < 0 {
+		return errors.Errorf("maxCPUPercent must not be negative: %v", c.MaxCPUPercent)
+	}
+
+	for i, cond := range c.Conditions {
+		if err := cond.validate(); err != nil {
+			return errors.Wrapf(err, "condition %d", i)
+		}
+	}
+
+	if c.Interval < 0 {
+		return errors.Errorf("interval must not be negative: %s", c.Interval)
+	}
+
+	if c.Schedule != "" {
+		if c.Interval != 0 {
+			return errors.New("interval and schedule cannot be used together")
+		}
+		if _, err := cron.ParseStandard(c.Schedule); err != nil {
+			return errors.Wrapf(err, "invalid schedule %q", c.Schedule)
+		}
+	}
+
+	switch c.ReportFormat {
+	case "", "json", "yaml":
+	default:
+		return errors.Errorf("invalid reportFormat %q", c.ReportFormat)
+	}
+
+	// 1 is the status for errors
+	if code := c.ExitCodeOnDelete; code != 0 && (code < 2 || code > 255) {
+		return errors.Errorf("exitCodeOnDelete must be between 2 and 255: %d", code)
+	}
+
+	if code := c.ExitCodeOnCandidates; code != 0 && (code < 2 || code > 255) {
+		return errors.Errorf("exitCodeOnCandidates must be between 2 and 255: %d", code)
+	}
+
+	if c.BudgetWindow < 0 {
+		return errors.Errorf("budgetWindow must not be negative: %s", c.BudgetWindow)
+	}
+
+	if c.FlapThreshold < 0 {
+		return errors.Errorf("flapThreshold must not be negative: %d", c.FlapThreshold)
+	}
+
+	if c.FlapWindow < 0 {
+		return errors.Errorf("flapWindow must not be negative: %s", c.FlapWindow)
+	}
+
+	if c.HistoryRetention < 0 {
+		return errors.Errorf("historyRetention must not be negative: %s", c.HistoryRetention)
+	}
+
+	if c.RetryAttempts < 0 {
+		return errors.Errorf("retryAttempts must not be negative: %d", c.RetryAttempts)
+	}
+
+	if c.RetryBackoff < 0 || c.RetryMaxBackoff < 0 {
+		return errors.New("retryBackoff and retryMaxBackoff must not be negative")
+	}
+
+	if c.DeleteDelay < 0 {
+		return errors.Errorf("deleteDelay must not be negative: %s", c.DeleteDelay)
+	}
+
+	if c.ReplacementWindow < 0 {
+		return errors.Errorf("replacementWindow must not be negative: %s", c.ReplacementWindow)
+	}
+
+	if c.WaitForReplacement < 0 {
+		return errors.Errorf("waitForReplacement must not be negative: %s", c.WaitForReplacement)
+	}
+
+	if c.CanaryInterval < 0 || c.CanarySLO < 0 {
+		return errors.New("canaryInterval and canarySLO must not be negative")
+	}
+
+	switch c.AuditLevel {
+	case "", "actions", "candidates", "all":
+	default:
+		return errors.Errorf("invalid auditLevel %q", c.AuditLevel)
+	}
+
+	if c.AuditMaxSize != nil && *c.AuditMaxSize < 0 {
+		return errors.Errorf("auditMaxSize must not be negative: %d", *c.AuditMaxSize)
+	}
+
+	if c.AuditMaxAge != nil && *c.AuditMaxAge < 0 {
+		return errors.Errorf("auditMaxAge must not be negative: %s", *c.AuditMaxAge)
+	}
+
+	if c.AuditMaxBackups != nil && *c.AuditMaxBackups < 0 {
+		return errors.Errorf("auditMaxBackups must not be negative: %d", *c.AuditMaxBackups)
+	}
+
+	if c.CloudEventsSink != "" {
+		u, err := url.Parse(c.CloudEventsSink)
+		if err != nil {
+			return errors.Wrapf(err, "invalid cloudEventsSink %q", c.CloudEventsSink)
+		}
+		switch u.Scheme {
+		case "http", "https", "mqtt":
+		default:
+			return errors.Errorf("invalid cloudEventsSink %q. Must be an http, https, or mqtt URL", c.CloudEventsSink)
+		}
+	}
+
+	for _, tag := range c.DatadogTags {
+		if tag == "" {
+			return errors.New("datadogTags must not be empty")
+		}
+	}
+
+	if c.HTTPAddress != "" {
+		if _, _, err := net.SplitHostPort(c.HTTPAddress); err != nil {
+			return errors.Wrapf(err, "invalid httpAddress %q", c.HTTPAddress)
+		}
+	}
+
+	if c.DebugAddr != "" {
+		if _, _, err := net.SplitHostPort(c.DebugAddr); err != nil {
+			return errors.Wrapf(err, "invalid debugAddr %q", c.DebugAddr)
+		}
+	}
+
+	if c.StatsDAddr != "" {
+		if _, _, err := net.SplitHostPort(c.StatsDAddr); err != nil {
+			return errors.Wrapf(err, "invalid statsdAddr %q", c.StatsDAddr)
+		}
+	}
+
+	for _, g := range c.PushgatewayGrouping {
+		if parts := strings.SplitN(g, "=", 2); len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return errors.Errorf("invalid pushgatewayGrouping %q. Must be name=value", g)
+		}
+	}
+
+	if c.StreamNATS != "" && c.StreamKafkaREST != "" {
+		return errors.New("streamNATS and streamKafkaREST cannot be used together")
+	}
+
+	switch c.StreamLevel {
+	case "", "actions", "candidates", "all":
+	default:
+		return errors.Errorf("invalid streamLevel %q", c.StreamLevel)
+	}
+
+	for name, a := range c.Actions {
+		if err := a.validate(); err != nil {
+			return errors.Wrapf(err, "action %q", name)
+		}
+	}
+
+	if err := c.validateActionName(c.Action); err != nil {
+		return err
+	}
+
+	names := make(map[string]bool, len(c.Rules))
+	for i, r := range c.Rules {
+		if r.Name != "" {
+			if names[r.Name] {
+				return errors.Errorf("duplicate rule name %q", r.Name)
+			}
+			names[r.Name] = true
+		}
+
+		if err := validateSelector(r.Selector); err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+
+		if err := r.Reasons.validate(); err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+
+		if r.GracePeriod < 0 {
+			return errors.Errorf("rule %d: gracePeriod must not be negative: %s", i, r.GracePeriod)
+		}
+
+		if r.RestartRate < 0 {
+			return errors.Errorf("rule %d: restartRate must not be negative: %v", i, r.RestartRate)
+		}
+
+		if err := validateImages(r.IncludeImages, r.ExcludeImages); err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+
+		if err := c.validateActionName(r.Action); err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+
+		if err := validateWindows(r.Windows); err != nil {
+			return errors.Wrapf(err, "rule %d", i)
+		}
+	}
+
+	if err := validateWindows(c.Windows); err != nil {
+		return err
+	}
+
+	for ns, o := range c.Namespaces {
+		if ns == "" {
+			return errors.New("namespace override must have a name")
+		}
+
+		if err := validateReasons(o.Reasons); err != nil {
+			return errors.Wrapf(err, "namespace %q", ns)
+		}
+
+		if o.GracePeriod < 0 {
+			return errors.Errorf("namespace %q: gracePeriod must not be negative: %s", ns, o.GracePeriod)
+		}
+	}
+
+	return nil
+}
+
+func (a Action) validate() error {
+	switch a.Type {
+	case "delete", "evict", "deletionCost", "deleteJob":
+	case "rolloutRestart":
+		if a.Cooldown < 0 {
+			return errors.Errorf("cooldown must not be negative: %s", a.Cooldown)
+		}
+	case "annotate", "annotateJob":
+		if len(a.Annotations) == 0 {
+			return errors.Errorf("%s requires annotations", a.Type)
+		}
+	case "label":
+		if len(a.Labels) == 0 {
+			return errors.New("label requires labels")
+		}
+	default:
+		return errors.Errorf("unknown type %q", a.Type)
+	}
+	return nil
+}
+
+func (c *Config) validateActionName(name string) error {
+	if name == "" {
+		return nil
+	}
+	if _, ok := c.Actions[name]; ok {
+		return nil
+	}
+	for _, b := range BuiltinActions {
+		if name == b {
+			return nil
+		}
+	}
+	return errors.Errorf("unknown action %q", name)
+}
+
+func validateSelector(selector string) error {
+	if selector == "" {
+		return nil
+	}
+	if _, err := labels.Parse(selector); err != nil {
+		return errors.Wrapf(err, "invalid selector %q", selector)
+	}
+	return nil
+}
+
+func validateImages(lists ...[]string) error {
+	for _, patterns := range lists {
+		for _, p := range patterns {
+			if _, err := controller.ImagePattern(p); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func validateReasons(reasons []string) error {
+	for _, r := range reasons {
+		if r == "" {
+			return errors.New("reasons must not be empty")
+		}
+	}
+	return nil
+}
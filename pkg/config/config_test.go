@@ -0,0 +1,322 @@
+package config
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParse(t *testing.T) {
+	c, err := Parse([]byte(`
+namespace: default
+reasons:
+  - CrashLoopBackOff
+gracePeriod: 15m
+auditFile: /var/log/pod-deleter/audit.log
+auditMaxSize: 0
+summaryFile: /results/summary.json
+noEvalCache: true
+adminTokenFile: /etc/pod-deleter/admin-token
+rules:
+  - name: web
+    selector: app=web
+    gracePeriod: 1h
+  - name: batch
+    action: mark
+actions:
+  mark:
+    type: annotate
+    annotations:
+      example.com/broken: "true"
+namespaces:
+  kube-system:
+    reasons: [Error]
+`))
+	require.NoError(t, err)
+	require.Equal(t, "default", c.Namespace)
+	require.Equal(t, []string{"CrashLoopBackOff"}, c.Reasons.Names)
+	require.Equal(t, time.Minute*15, c.GracePeriod)
+	require.Equal(t, "/var/log/pod-deleter/audit.log", c.AuditFile)
+	// zero disables rotation, so is kept apart from unset
+	require.Equal(t, 0, *c.AuditMaxSize)
+	require.Nil(t, c.AuditMaxAge)
+	require.Equal(t, "/results/summary.json", c.SummaryFile)
+	require.True(t, c.NoEvalCache)
+	require.Equal(t, "/etc/pod-deleter/admin-token", c.AdminTokenFile)
+	require.Len(t, c.Rules, 2)
+	require.Equal(t, "mark", c.Rules[1].Action)
+	require.Equal(t, "annotate", c.Actions["mark"].Type)
+	require.Equal(t, "app=web", c.Rules[0].Selector)
+	require.Equal(t, time.Hour, c.Rules[0].GracePeriod)
+	require.Equal(t, []string{"Error"}, c.Namespaces["kube-system"].Reasons)
+}
+
+func TestParseReasonGrace(t *testing.T) {
+	c, err := Parse([]byte(`
+reasons:
+  ErrImagePull: 15m
+  CrashLoopBackOff: 1h
+rules:
+  - name: web
+    reasons: [Error]
+`))
+	require.NoError(t, err)
+	require.Equal(t, []string{"CrashLoopBackOff", "ErrImagePull"}, c.Reasons.Names)
+	require.Equal(t, time.Minute*15, c.Reasons.Grace["ErrImagePull"])
+	require.Equal(t, []string{"Error"}, c.Rules[0].Reasons.Names)
+	require.Nil(t, c.Rules[0].Reasons.Grace)
+
+	data, err := yaml.Marshal(c.Reasons)
+	require.NoError(t, err)
+	require.Equal(t, "CrashLoopBackOff: 1h0m0s\nErrImagePull: 15m0s\n", string(data))
+
+	data, err = yaml.Marshal(c.Rules[0].Reasons)
+	require.NoError(t, err)
+	require.Equal(t, "- Error\n", string(data))
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		description string
+		data        string
+	}{
+		{
+			description: "unknown field",
+			data:        "namespaec: default",
+		},
+		{
+			description: "bad selector",
+			data:        "selector: 'app in (web'",
+		},
+		{
+			description: "bad log level",
+			data:        "logLevel: loud",
+		},
+		{
+			description: "bad log format",
+			data:        "logFormat: xml",
+		},
+		{
+			description: "negative log sampling",
+			data:        "logSampling: -1",
+		},
+		{
+			description: "bad schedule",
+			data:        "schedule: '* * *'",
+		},
+		{
+			description: "schedule and interval",
+			data:        "{schedule: '@hourly', interval: 1h}",
+		},
+		{
+			description: "negative grace",
+			data:        "gracePeriod: -1m",
+		},
+		{
+			description: "negative restart rate",
+			data:        "rules: [{restartRate: -1}]",
+		},
+		{
+			description: "invalid exclude selector",
+			data:        "excludeSelector: 'team in (storage'",
+		},
+		{
+			description: "invalid annotation selector",
+			data:        "annotationSelector: 'deploy-tool in (spinnaker'",
+		},
+		{
+			description: "negative restart threshold",
+			data:        "restartThreshold: -1",
+		},
+		{
+			description: "negative restart window",
+			data:        "restartWindow: -1m",
+		},
+		{
+			description: "negative not ready timeout",
+			data:        "notReadyTimeout: -1m",
+		},
+		{
+			description: "condition without type",
+			data:        "conditions: [{status: 'True'}]",
+		},
+		{
+			description: "bad condition status",
+			data:        "conditions: [{type: DisruptionTarget, status: yes}]",
+		},
+		{
+			description: "negative event threshold",
+			data:        "eventThreshold: -1",
+		},
+		{
+			description: "negative memory percent",
+			data:        "maxMemoryPercent: -1",
+		},
+		{
+			description: "negative kubeconfig reload interval",
+			data:        "kubeconfigReload: -1m",
+		},
+		{
+			description: "negative cordoned node delay",
+			data:        "cordonedNodeDelay: -1m",
+		},
+		{
+			description: "negative node not ready timeout",
+			data:        "nodeNotReadyTimeout: -1m",
+		},
+		{
+			description: "negative unknown phase timeout",
+			data:        "unknownPhaseTimeout: -1m",
+		},
+		{
+			description: "negative finished job TTL",
+			data:        "finishedJobTTL: -1m",
+		},
+		{
+			description: "negative delete delay",
+			data:        "deleteDelay: -1s",
+		},
+		{
+			description: "negative replacement window",
+			data:        "replacementWindow: -1m",
+		},
+		{
+			description: "negative wait for replacement",
+			data:        "waitForReplacement: -1m",
+		},
+		{
+			description: "bad audit level",
+			data:        "auditLevel: everything",
+		},
+		{
+			description: "negative audit max size",
+			data:        "auditMaxSize: -1",
+		},
+		{
+			description: "empty datadog tag",
+			data:        "datadogTags: ['']",
+		},
+		{
+			description: "nats and kafka",
+			data:        "{streamNATS: 'nats:4222', streamKafkaREST: 'http://kafka-rest:8082'}",
+		},
+		{
+			description: "bad stream level",
+			data:        "streamLevel: everything",
+		},
+		{
+			description: "bad cloudevents sink",
+			data:        "cloudEventsSink: 'amqp://broker:5672'",
+		},
+		{
+			description: "statsd address without port",
+			data:        "statsdAddr: statsd",
+		},
+		{
+			description: "bad pushgateway grouping",
+			data:        "pushgatewayGrouping: [production]",
+		},
+		{
+			description: "exit code for errors",
+			data:        "exitCodeOnDelete: 1",
+		},
+		{
+			description: "bad report format",
+			data:        "reportFormat: csv",
+		},
+		{
+			description: "http address without port",
+			data:        "httpAddress: localhost",
+		},
+		{
+			description: "negative canary SLO",
+			data:        "canarySLO: -1h",
+		},
+		{
+			description: "debug address without port",
+			data:        "debugAddr: 127.0.0.1",
+		},
+		{
+			description: "bad grace from",
+			data:        "graceFrom: yesterday",
+		},
+		{
+			description: "invalid order",
+			data:        "order: random",
+		},
+		{
+			description: "invalid phase",
+			data:        "phases: [running]",
+		},
+		{
+			description: "negative min terminated age",
+			data:        "minTerminatedAge: -1m",
+		},
+		{
+			description: "negative reason grace",
+			data:        "reasons: {Error: -1m}",
+		},
+		{
+			description: "reasons not a list or map",
+			data:        "reasons: Error",
+		},
+		{
+			description: "negative kube api qps",
+			data:        "kubeAPIQPS: -5",
+		},
+		{
+			description: "groups without user",
+			data:        "asGroups: [system:masters]",
+		},
+		{
+			description: "bad image pattern",
+			data:        "excludeImages: ['regex:database(']",
+		},
+		{
+			description: "unknown action",
+			data:        "rules: [{action: annotate}]",
+		},
+		{
+			description: "bad window day",
+			data:        "windows: [{days: [Someday]}]",
+		},
+		{
+			description: "bad window time zone",
+			data:        "windows: [{start: '09:00', end: '17:00', timezone: Mars/Olympus}]",
+		},
+		{
+			description: "window start without end",
+			data:        "rules: [{windows: [{start: '09:00'}]}]",
+		},
+		{
+			description: "bad action type",
+			data:        "actions: {mark: {type: paint}}",
+		},
+		{
+			description: "annotate job without annotations",
+			data:        "actions: {mark: {type: annotateJob}}",
+		},
+		{
+			description: "negative restart cooldown",
+			data:        "actions: {restart: {type: rolloutRestart, cooldown: -1m}}",
+		},
+		{
+			description: "duplicate rule",
+			data:        "rules: [{name: a}, {name: a}]",
+		},
+		{
+			description: "empty reason",
+			data:        "namespaces: {default: {reasons: ['']}}",
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			_, err := Parse([]byte(test.data))
+			require.Error(t, err)
+		})
+	}
+}
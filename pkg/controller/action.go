@@ -0,0 +1,135 @@
+package controller
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+// DeleteActionName is the name of the default action, which deletes pods
+const DeleteActionName = "delete"
+
+// DeletionCostAnnotation is the annotation used by ReplicaSets to pick
+// which pods to remove first when scaling down.
+const DeletionCostAnnotation = "controller.kubernetes.io/pod-deletion-cost"
+
+// Action remediates a candidate pod. Actions are not called in dry-run mode.
+// A not found error is ignored, as the pod may have exited.
+type Action interface {
+	Do(cand Candidate) error
+}
+
+// ActionFunc adapts a function to an Action
+type ActionFunc func(cand Candidate) error
+
+// Do calls f(cand)
+func (f ActionFunc) Do(cand Candidate) error {
+	return f(cand)
+}
+
+// PodPatcher applies a JSON merge patch to a pod
+type PodPatcher interface {
+	PatchPod(namespace string, name string, patch []byte) error
+}
+
+// PodEvicter evicts a pod using the eviction API, which respects
+// pod disruption budgets.
+type PodEvicter interface {
+	EvictPod(namespace string, name string) error
+}
+
+// DeleteAction returns an Action that deletes pods
+func DeleteAction(deleter PodDeleter) Action {
+	return ActionFunc(func(cand Candidate) error {
+		return deleter.DeletePod(cand.Pod.ObjectMeta.Namespace, cand.Pod.ObjectMeta.Name)
+	})
+}
+
+// EvictAction returns an Action that evicts pods
+func EvictAction(evicter PodEvicter) Action {
+	return ActionFunc(func(cand Candidate) error {
+		return evicter.EvictPod(cand.Pod.ObjectMeta.Namespace, cand.Pod.ObjectMeta.Name)
+	})
+}
+
+// AnnotateAction returns an Action that sets annotations on pods
+func AnnotateAction(patcher PodPatcher, annotations map[string]string) Action {
+	return patchAction(patcher, "annotations", annotations)
+}
+
+// LabelAction returns an Action that sets labels on pods
+func LabelAction(patcher PodPatcher, labels map[string]string) Action {
+	return patchAction(patcher, "labels", labels)
+}
+
+// DeletionCostAction returns an Action that sets the pod deletion cost, so
+// the pod is removed first when its ReplicaSet is scaled down.
+func DeletionCostAction(patcher PodPatcher, cost int) Action {
+	return AnnotateAction(patcher, map[string]string{
+		DeletionCostAnnotation: strconv.Itoa(cost),
+	})
+}
+
+func patchAction(patcher PodPatcher, field string, values map[string]string) Action {
+	return ActionFunc(func(cand Candidate) error {
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				field: values,
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create patch")
+		}
+		return patcher.PatchPod(cand.Pod.ObjectMeta.Namespace, cand.Pod.ObjectMeta.Name, patch)
+	})
+}
+
+// actionFor returns the named action. The delete action is always available
+// unless replaced.
+func (c *Controller) actionFor(name string) (Action, error) {
+	if a, ok := c.actions[name]; ok {
+		return a, nil
+	}
+	if name == DeleteActionName {
+		return DeleteAction(c.deleter), nil
+	}
+	return nil, errors.Errorf("unknown action %q", name)
+}
+
+// WithActions returns an Option that adds named actions that rules may
+// select. An action named "delete" replaces the default.
+// Used when creating a new Controller.
+func WithActions(actions map[string]Action) Option {
+	return func(c *Controller) error {
+		// copy so Reconfigure does not change the running controller's actions
+		merged := make(map[string]Action, len(c.actions)+len(actions))
+		for name, a := range c.actions {
+			merged[name] = a
+		}
+		for name, a := range actions {
+			merged[name] = a
+		}
+		c.actions = merged
+		return nil
+	}
+}
+
+// WithDefaultAction returns an Option that sets the name of the action used
+// by rules that do not set one. Default is "delete".
+// Used when creating a new Controller.
+func WithDefaultAction(name string) Option {
+	return func(c *Controller) error {
+		c.action = name
+		return nil
+	}
+}
+
+// actionResult is the decision action recorded for a named action:
+// "deleted" for the delete action, otherwise the action name.
+func actionResult(name string) string {
+	if name == DeleteActionName {
+		return "deleted"
+	}
+	return name
+}
@@ -0,0 +1,90 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// PodEventGetter gets the events of a single pod
+type PodEventGetter interface {
+	ListPodEvents(namespace string, name string) ([]v1.Event, error)
+}
+
+// PodRecord is the manifest of a pod, as it was before it was acted on
+type PodRecord struct {
+	Time   time.Time `json:"time"`
+	Rule   string    `json:"rule,omitempty"`
+	Reason string    `json:"reason"`
+	Action string    `json:"action"`
+	RunID  string    `json:"runID,omitempty"`
+	// Pod is the full pod, including its spec and status
+	Pod *v1.Pod `json:"pod"`
+	// Events are the pod's events, if they were archived
+	Events []v1.Event `json:"events,omitempty"`
+}
+
+// Archiver stores the manifests of pods before they are acted on
+type Archiver interface {
+	ArchivePod(record *PodRecord) error
+}
+
+type archive struct {
+	archiver Archiver
+	events   PodEventGetter
+}
+
+// WithArchive returns an Option that writes the manifest of each pod to a,
+// before acting on it, for analysis after the pod is gone. If events is
+// not nil, the pod's events are included. Failures are logged, but do not
+// stop the action. It has no effect in dry-run mode.
+// Used when creating a new Controller.
+func WithArchive(a Archiver, events PodEventGetter) Option {
+	return func(c *Controller) error {
+		if a == nil {
+			c.archive = nil
+			return nil
+		}
+		c.archive = &archive{archiver: a, events: events}
+		return nil
+	}
+}
+
+// archivePod writes the manifest of the candidate to the archive. If its
+// events cannot be listed, the manifest is archived without them.
+func (c *Controller) archivePod(ctx context.Context, cand Candidate, now time.Time) {
+	if c.archive == nil {
+		return
+	}
+
+	pod := cand.Pod.DeepCopy()
+	// pods from the API have no kind, but the manifest should stand alone
+	pod.TypeMeta.APIVersion = "v1"
+	pod.TypeMeta.Kind = "Pod"
+
+	record := &PodRecord{
+		Time:   now,
+		Rule:   cand.Rule,
+		Reason: cand.Reason,
+		Action: cand.Action,
+		RunID:  cand.RunID,
+		Pod:    pod,
+	}
+
+	if c.archive.events != nil {
+		err := c.retry.do(ctx, cand.logger, "list pod events", func() error {
+			var err error
+			record.Events, err = c.archive.events.ListPodEvents(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+			return err
+		})
+		if err != nil {
+			cand.logger.Warn("failed to list pod events for archive", zap.Error(err))
+		}
+	}
+
+	if err := c.archive.archiver.ArchivePod(record); err != nil {
+		cand.logger.Warn("failed to archive pod", zap.Error(err))
+	}
+}
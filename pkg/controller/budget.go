@@ -0,0 +1,131 @@
+package controller
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// budget limits deletions within a sliding window.
+type budget struct {
+	max    int
+	window time.Duration
+
+	mu        sync.Mutex
+	deletions []time.Time
+}
+
+// remaining returns the number of deletions allowed at now.
+// It returns -1 if there is no limit.
+func (b *budget) remaining(now time.Time) int {
+	if b.max < 0 {
+		return -1
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now)
+	if n := b.max - len(b.deletions); n > 0 {
+		return n
+	}
+	return 0
+}
+
+// record records a deletion at now. Deletions loaded from a shared
+// history may be older than those already recorded, so they are kept in
+// order.
+func (b *budget) record(now time.Time) {
+	if b.max < 0 {
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now)
+	i := sort.Search(len(b.deletions), func(i int) bool {
+		return b.deletions[i].After(now)
+	})
+	b.deletions = append(b.deletions, time.Time{})
+	copy(b.deletions[i+1:], b.deletions[i:])
+	b.deletions[i] = now
+}
+
+// expire drops deletions that are outside the window. must hold lock.
+func (b *budget) expire(now time.Time) {
+	cutoff := now.Add(-b.window)
+	i := 0
+	for ; i < len(b.deletions); i++ {
+		if b.deletions[i].After(cutoff) {
+			break
+		}
+	}
+	b.deletions = b.deletions[i:]
+}
+
+// Budget returns the current state of the deletion budget, and the
+// workloads held back by flap detection.
+func (c *Controller) Budget() BudgetState {
+	now := time.Now()
+	s := c.budget.state(now)
+	s.Cooldowns = c.flaps.cooldowns(now)
+	return s
+}
+
+// BudgetState is a snapshot of the deletion budget.
+type BudgetState struct {
+	// Limit is the maximum number of deletions within Window.
+	// Negative means there is no limit.
+	Limit  int           `json:"limit"`
+	Window time.Duration `json:"window"`
+	// Used is the number of deletions within the current window.
+	Used int `json:"used"`
+	// Remaining is the number of deletions allowed now. Negative means no limit.
+	Remaining int `json:"remaining"`
+	// NextAvailable is when the oldest deletion leaves the window.
+	// Nil if no deletions have been recorded.
+	NextAvailable *time.Time `json:"nextAvailable,omitempty"`
+	// Cooldowns are the workloads whose pods are not deleted because
+	// they are flapping.
+	Cooldowns []Cooldown `json:"cooldowns,omitempty"`
+}
+
+// Cooldown is a workload whose pods are not deleted because it is
+// flapping.
+type Cooldown struct {
+	// Owner is the workload, as namespace/kind/name.
+	Owner string `json:"owner"`
+	// Deletions is the number of its pods deleted within the flap window.
+	Deletions int `json:"deletions"`
+	// Until is when enough deletions leave the window for its pods to
+	// be deleted again.
+	Until time.Time `json:"until"`
+}
+
+// state returns a snapshot of the budget at now.
+func (b *budget) state(now time.Time) BudgetState {
+	s := BudgetState{
+		Limit:     b.max,
+		Window:    b.window,
+		Remaining: -1,
+	}
+	if b.max < 0 {
+		return s
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.expire(now)
+	s.Used = len(b.deletions)
+	s.Remaining = b.max - s.Used
+	if s.Remaining < 0 {
+		s.Remaining = 0
+	}
+	if len(b.deletions) > 0 {
+		next := b.deletions[0].Add(b.window)
+		s.NextAvailable = &next
+	}
+	return s
+}
@@ -0,0 +1,86 @@
+package controller
+
+import (
+	"sync"
+	"sync/atomic"
+)
+
+// evalResult is the result of evaluating a pod against a rule
+type evalResult struct {
+	resourceVersion string
+	reason          string
+	skip            string
+	detail          string
+}
+
+// evalCache holds the evaluation results for a single rule. An entry is
+// used only while the pod's resourceVersion is unchanged. Entries for pods
+// that were not seen in the last run are dropped by sweep.
+type evalCache struct {
+	mu      sync.Mutex
+	entries map[string]evalResult
+	next    map[string]evalResult
+}
+
+// get returns the cached result for a pod if its resourceVersion matches.
+func (e *evalCache) get(key string, resourceVersion string) (evalResult, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	result, ok := e.entries[key]
+	if !ok || result.resourceVersion != resourceVersion {
+		return evalResult{}, false
+	}
+	e.keep(key, result)
+	return result, true
+}
+
+func (e *evalCache) put(key string, result evalResult) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.keep(key, result)
+}
+
+func (e *evalCache) keep(key string, result evalResult) {
+	if e.next == nil {
+		e.next = make(map[string]evalResult)
+	}
+	e.next[key] = result
+}
+
+// sweep replaces the entries with those used or added since the last sweep.
+func (e *evalCache) sweep() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.entries = e.next
+	e.next = nil
+}
+
+// cacheStats counts evaluation cache lookups
+type cacheStats struct {
+	hits   uint64
+	misses uint64
+}
+
+func (s *cacheStats) hit() {
+	atomic.AddUint64(&s.hits, 1)
+}
+
+func (s *cacheStats) miss() {
+	atomic.AddUint64(&s.misses, 1)
+}
+
+func (s *cacheStats) get() (hits uint64, misses uint64) {
+	return atomic.LoadUint64(&s.hits), atomic.LoadUint64(&s.misses)
+}
+
+// WithEvalCache enables or disables caching of pod evaluations. Results are
+// cached until the pod's resourceVersion changes. Pods skipped because they
+// are younger than the grace period are never cached. Enabled by default.
+// Used when creating a new Controller.
+func WithEvalCache(enabled bool) Option {
+	return func(c *Controller) error {
+		c.evalCache = enabled
+		return nil
+	}
+}
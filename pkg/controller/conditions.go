@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// Condition matches pods by one of their conditions, such as
+// DisruptionTarget=True or PodScheduled=False with the reason Unschedulable.
+type Condition struct {
+	Type   string
+	Status string
+	// Reason is optional
+	Reason string
+	// For is how long the condition must have had the status, measured
+	// from its last transition time
+	For time.Duration
+}
+
+// String returns the reason used for pods that match, such as PodScheduled=False/Unschedulable
+func (m Condition) String() string {
+	s := m.Type + "=" + m.Status
+	if m.Reason != "" {
+		s += "/" + m.Reason
+	}
+	return s
+}
+
+// matches returns true if the pod has the condition and has had it for long enough
+func (m Condition) matches(pod *v1.Pod, now time.Time) bool {
+	for _, c := range pod.Status.Conditions {
+		if string(c.Type) != m.Type {
+			continue
+		}
+		if string(c.Status) != m.Status {
+			return false
+		}
+		if m.Reason != "" && c.Reason != m.Reason {
+			return false
+		}
+		return !c.LastTransitionTime.Time.Add(m.For).After(now)
+	}
+	return false
+}
+
+// WithConditions returns an Option that deletes pods with any of the
+// conditions, even if no container is in one of the reasons. Pending pods
+// are checked as well, so pods that cannot be scheduled may be matched.
+// Used when creating a new Controller.
+func WithConditions(conditions []Condition) Option {
+	return func(c *Controller) error {
+		for _, m := range conditions {
+			if m.Type == "" {
+				return errors.New("condition type is required")
+			}
+			switch v1.ConditionStatus(m.Status) {
+			case v1.ConditionTrue, v1.ConditionFalse, v1.ConditionUnknown:
+			default:
+				return errors.Errorf("invalid status %q for condition %s", m.Status, m.Type)
+			}
+			if m.For < 0 {
+				return errors.Errorf("duration for condition %s must not be negative", m.Type)
+			}
+		}
+		c.conditions = conditions
+		return nil
+	}
+}
+
+// recheckable returns true if a pod was skipped only because of its
+// container reasons, or only because it is pending.
+func (r *rule) recheckable(logger *zap.Logger, pod v1.Pod, skip string) bool {
+	switch {
+	case skip == "Reason":
+		return true
+	case skip == "PodPhase" && pod.Status.Phase == v1.PodPending:
+		// the other filters, such as excluded service accounts, must still apply.
+		// the phase filter is always first.
+		_, s, _ := r.evaluateFilters(logger, pod, r.filters[1:])
+		return s == "Reason"
+	}
+	return false
+}
+
+// checkConditions matches a pod that was skipped only because of its
+// container reasons, or because it is pending, if it has one of the rule's
+// conditions. The time changes between runs, so it is never cached.
+func (c *Controller) checkConditions(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if len(r.conditions) == 0 || !r.recheckable(logger, pod, skip) {
+		return reason, skip, detail
+	}
+
+	now := time.Now()
+	for _, m := range r.conditions {
+		if m.matches(&pod, now) {
+			logger.Debug("pod matches condition", zap.String("condition", m.String()))
+			return m.String(), "", ""
+		}
+	}
+	return reason, skip, detail
+}
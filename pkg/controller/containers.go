@@ -0,0 +1,49 @@
+package controller
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// containerFilter limits the container statuses considered when
+// checking pods
+type containerFilter struct {
+	include map[string]bool
+	exclude map[string]bool
+}
+
+// apply returns a copy of the pod with only the statuses of included
+// containers. The pod is returned as is if no containers are filtered.
+func (f containerFilter) apply(pod v1.Pod) v1.Pod {
+	if len(f.include) == 0 && len(f.exclude) == 0 {
+		return pod
+	}
+
+	// the statuses may be shared with a cache, so are not modified in place
+	statuses := make([]v1.ContainerStatus, 0, len(pod.Status.ContainerStatuses))
+	for _, status := range pod.Status.ContainerStatuses {
+		if len(f.include) > 0 && !f.include[status.Name] {
+			continue
+		}
+		if f.exclude[status.Name] {
+			continue
+		}
+		statuses = append(statuses, status)
+	}
+	pod.Status.ContainerStatuses = statuses
+	return pod
+}
+
+// WithContainers returns an Option that filters the containers considered
+// when checking pods. If include is not empty, only the statuses of
+// containers with those names are considered. The statuses of containers
+// named in exclude, such as sidecars, are ignored.
+// Used when creating a new Controller.
+func WithContainers(include []string, exclude []string) Option {
+	return func(c *Controller) error {
+		c.containers = containerFilter{
+			include: reasonsMap(include),
+			exclude: reasonsMap(exclude),
+		}
+		return nil
+	}
+}
@@ -3,12 +3,16 @@ package controller
 
 import (
 	"context"
+	"sync"
 	"time"
 
 	"github.com/pkg/errors"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
 	"k8s.io/api/core/v1"
 	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
 )
 
 // PodLister gets a list of pods.
@@ -16,6 +20,13 @@ type PodLister interface {
 	ListPods(namespace string, selector string) ([]v1.Pod, error)
 }
 
+// PodPager lists pods a page at a time, calling fn for each page. If the
+// lister passed to New implements PodPager, pods are evaluated a page at a
+// time so only the candidates are kept in memory.
+type PodPager interface {
+	ListPodPages(namespace string, selector string, fn func(pods []v1.Pod) error) error
+}
+
 // PodDeleter deletes a pod
 type PodDeleter interface {
 	DeletePod(namespace string, name string) error
@@ -23,17 +34,156 @@ type PodDeleter interface {
 
 // Controller is a struct to hold a lister, deleter, and options
 type Controller struct {
-	lister     PodLister
-	deleter    PodDeleter
-	namespace  string
-	selector   string
-	logger     *zap.Logger
-	grace      time.Duration
-	interval   time.Duration
-	dryRun     bool
-	reasons    []string
-	reasonsMap map[string]bool
-	stopChan   chan struct{}
+	lister        PodLister
+	deleter       PodDeleter
+	namespace     string
+	selector      string
+	logger        *zap.Logger
+	grace         time.Duration
+	graceFrom     string
+	minTerminated time.Duration
+	interval      time.Duration
+	schedule      Schedule
+	dryRun        bool
+	paused        int32
+	disabled      int32
+	reasons       []string
+	reasonGrace   map[string]time.Duration
+	restartRate   float64
+	notReady      time.Duration
+	conditions    []Condition
+	restarts      restartTracker
+	restartLimit  int32
+	restartWindow time.Duration
+	includeImages []string
+	excludeImages []string
+	excludeSAs    []string
+	excludeLabels labels.Selector
+	annotations   labels.Selector
+	priority      priorityFilter
+	disruption    disruptionFilter
+	phases        phaseFilter
+	containers    containerFilter
+	rules         []Rule
+	overrides     map[string]NamespaceOverride
+	budget        *budget
+	nodeLister    NodeLister
+	drain         []string
+	cordoned      *cordonTracker
+	nodeNotReady  *nodeNotReady
+	orphans       *orphanTracker
+	unknownPhase  *unknownPhase
+	finishedJobs  *finishedJobs
+	decisions     decisions
+	lastResult    lastResult
+	evalCache     bool
+	explain       bool
+	hooks         []Hooks
+	filters       []Filter
+	actions       map[string]Action
+	action        string
+	order         string
+	flaps         *flapDetector
+	history       History
+	retry         retrier
+	deleteDelay   time.Duration
+	replacements  *replacements
+	rolling       *rolling
+	failFast      bool
+	events        EventRecorder
+	cacheStats    cacheStats
+	sink          MetricsSink
+	counters      *runCounters
+	auditors      []Auditor
+	publisher     StatusPublisher
+	tombstone     *tombstone
+	owners        OwnerPatcher
+	scaler        DeploymentScaler
+	warnings      *warningDetector
+	usage         *usageDetector
+	pdbLister     PDBLister
+	deployments   DeploymentGetter
+	statefulSets  *statefulSets
+	keepFailing   int
+	logCapture    *logCapture
+	archive       *archive
+	massFailure   massFailure
+	nodeHealth    *nodeHealth
+	windows       []*window
+	allowLast     bool
+	runChan       chan struct{}
+
+	// stopMu protects cancel and stopped, so Stop can cancel the context
+	// of the run in progress.
+	stopMu  sync.Mutex
+	cancel  context.CancelFunc
+	stopped bool
+
+	// mu protects the selection settings and compiled rules,
+	// which may be changed by Reconfigure while running.
+	mu       sync.RWMutex
+	compiled []*rule
+}
+
+// Rule selects a set of pods and the reasons and grace period used to
+// decide whether to delete them. Empty fields are inherited from the
+// controller's namespace, reasons, and grace period.
+type Rule struct {
+	Name      string
+	Namespace string
+	Selector  string
+	Reasons   []string
+	Grace     time.Duration
+	// ReasonGrace replaces the grace period for pods with a container in
+	// one of its reasons. See WithReasonGrace.
+	ReasonGrace map[string]time.Duration
+	// RestartRate is the restarts per hour above which a pod is deleted.
+	// Zero disables the check.
+	RestartRate float64
+	// IncludeImages and ExcludeImages filter pods by container image.
+	// See WithImageFilters.
+	IncludeImages []string
+	ExcludeImages []string
+	// Action is the name of the action applied to matching pods.
+	// See WithActions.
+	Action string
+	// Windows are checked as well as those set with WithWindows.
+	Windows []Window
+}
+
+// NamespaceOverride replaces the reasons and/or grace period for pods in
+// a single namespace. Empty fields do not override.
+// Priority orders candidates when a deletion budget cannot cover them all:
+// pods in namespaces with higher priority are deleted first.
+type NamespaceOverride struct {
+	Reasons  []string
+	Grace    time.Duration
+	Priority int
+}
+
+// rule is a Rule with defaults and namespace overrides applied
+type rule struct {
+	Rule
+	reasons       map[string]bool
+	overrides     map[string]override
+	includeImages imageMatcher
+	excludeImages imageMatcher
+	filters       []Filter
+	action        Action
+	notReady      time.Duration
+	conditions    []Condition
+	graceFrom     string
+	minTerminated time.Duration
+	restartLimit  int32
+	restartWindow time.Duration
+	windows       []*window
+	cache         evalCache
+}
+
+type override struct {
+	reasons  map[string]bool
+	grace    time.Duration
+	priority int
 }
 
 // DefaultReasons is the reaons to delete a pod.
@@ -49,13 +199,18 @@ type Option func(*Controller) error
 // New creates a new controller
 func New(lister PodLister, deleter PodDeleter, options ...Option) (*Controller, error) {
 	c := &Controller{
-		lister:     lister,
-		deleter:    deleter,
-		grace:      time.Minute * 30,
-		interval:   time.Minute * 10,
-		reasons:    DefaultReasons,
-		reasonsMap: make(map[string]bool),
-		stopChan:   make(chan struct{}),
+		lister:    lister,
+		deleter:   deleter,
+		grace:     time.Minute * 30,
+		interval:  time.Minute * 10,
+		reasons:   DefaultReasons,
+		budget:    &budget{max: -1},
+		counters:  newRunCounters(),
+		flaps:     &flapDetector{},
+		retry:     retrier{attempts: 1},
+		evalCache: true,
+		action:    DeleteActionName,
+		runChan:   make(chan struct{}, 1),
 	}
 
 	for _, o := range options {
@@ -72,122 +227,1000 @@ func New(lister PodLister, deleter PodDeleter, options ...Option) (*Controller,
 		c.logger = l
 	}
 
-	for _, r := range c.reasons {
-		c.reasonsMap[r] = true
+	if c.restartWindow == 0 {
+		c.restartWindow = defaultRestartWindow
+	}
+
+	if c.history != nil {
+		now := time.Now()
+		c.loadHistory(now)
+		c.loadRestarts(now)
+	}
+
+	compiled, err := c.compileRules()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to compile rules")
 	}
+	c.compiled = compiled
 
 	return c, nil
 }
 
+func reasonsMap(reasons []string) map[string]bool {
+	m := make(map[string]bool, len(reasons))
+	for _, r := range reasons {
+		m[r] = true
+	}
+	return m
+}
+
+// compileRules fills in rule defaults from the controller. If no rules were
+// set, a single rule is created from the namespace, selector, reasons, and grace.
+func (c *Controller) compileRules() ([]*rule, error) {
+	rules := c.rules
+	if len(rules) == 0 {
+		rules = []Rule{{}}
+	}
+
+	overrides := make(map[string]override, len(c.overrides))
+	for ns, o := range c.overrides {
+		overrides[ns] = override{
+			reasons:  reasonsMap(o.Reasons),
+			grace:    o.Grace,
+			priority: o.Priority,
+		}
+	}
+
+	saFilter := serviceAccountFilter{names: make(map[string]bool, len(c.excludeSAs))}
+	for _, name := range c.excludeSAs {
+		saFilter.names[name] = true
+	}
+
+	compiled := make([]*rule, 0, len(rules))
+	for _, r := range rules {
+		if r.Namespace == "" {
+			r.Namespace = c.namespace
+		}
+		if r.Selector == "" {
+			r.Selector = c.selector
+		}
+		if len(r.Reasons) == 0 {
+			r.Reasons = c.reasons
+		}
+		if r.Grace == 0 {
+			r.Grace = c.grace
+		}
+		if len(r.ReasonGrace) == 0 {
+			r.ReasonGrace = c.reasonGrace
+		}
+		if r.RestartRate == 0 {
+			r.RestartRate = c.restartRate
+		}
+		if len(r.IncludeImages) == 0 {
+			r.IncludeImages = c.includeImages
+		}
+		if len(r.ExcludeImages) == 0 {
+			r.ExcludeImages = c.excludeImages
+		}
+		if r.Action == "" {
+			r.Action = c.action
+		}
+
+		action, err := c.actionFor(r.Action)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %q", r.Name)
+		}
+
+		include, err := compileImagePatterns(r.IncludeImages)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %q", r.Name)
+		}
+		exclude, err := compileImagePatterns(r.ExcludeImages)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %q", r.Name)
+		}
+		windows, err := compileWindows(r.Windows)
+		if err != nil {
+			return nil, errors.Wrapf(err, "rule %q", r.Name)
+		}
+
+		cr := &rule{
+			Rule:          r,
+			reasons:       reasonsMap(r.Reasons),
+			overrides:     overrides,
+			includeImages: include,
+			excludeImages: exclude,
+			action:        action,
+			notReady:      c.notReady,
+			conditions:    c.conditions,
+			graceFrom:     c.graceFrom,
+			minTerminated: c.minTerminated,
+			restartLimit:  c.restartLimit,
+			restartWindow: c.restartWindow,
+			windows:       windows,
+		}
+
+		cr.filters = []Filter{c.phases, selectorFilter{c.excludeLabels, c.annotations}, saFilter, c.priority, c.disruption, imageFilter{cr}, graceFilter{cr}}
+		cr.filters = append(cr.filters, c.filters...)
+		cr.filters = append(cr.filters, reasonFilter{cr})
+
+		compiled = append(compiled, cr)
+	}
+	return compiled, nil
+}
+
+// settingsFor returns the reasons and grace period to use for a pod in namespace.
+func (r *rule) settingsFor(namespace string) (map[string]bool, time.Duration) {
+	reasons, grace := r.reasons, r.Grace
+	if o, ok := r.overrides[namespace]; ok {
+		if len(o.reasons) > 0 {
+			reasons = o.reasons
+		}
+		if o.grace != 0 {
+			grace = o.grace
+		}
+	}
+	return reasons, grace
+}
+
+// priorityFor returns the priority of pods in namespace.
+func (r *rule) priorityFor(namespace string) int {
+	return r.overrides[namespace].priority
+}
+
+// Candidate is a pod that matched a rule and should be deleted
+type Candidate struct {
+	Pod v1.Pod
+	// Rule is the name of the rule that matched, if any
+	Rule string
+	// Reason is the container state reason that matched
+	Reason string
+	// Draining is true if the pod is on a node that is being drained
+	Draining bool
+	// Action is the name of the action applied to the pod
+	Action string
+	// RunID is the ID of the run that found the candidate
+	RunID string
+
+	rule   *rule
+	logger *zap.Logger
+	// action replaces the rule's action, if set
+	action Action
+	// windows are the controller's time windows when the pod was found
+	windows []*window
+}
+
 // Once will list all pods and delete those that are in certain states
-// and are at least x seconds old.
+// and are at least x seconds old. It returns an error if pods could not be
+// listed or any pod could not be deleted. A run that was aborted is not an
+// error, as the next run checks again. Use Run to get the details.
 func (c *Controller) Once(ctx context.Context) error {
-	pods, err := c.lister.ListPods(c.namespace, c.selector)
+	result, err := c.Run(ctx)
 	if err != nil {
-		return errors.Wrap(err, "failed to list pods")
+		return err
+	}
+	if result.Aborted != "" {
+		return nil
+	}
+	return result.Err()
+}
+
+// Run is like Once, but returns what was deleted and skipped. A pod that
+// cannot be deleted is recorded in the result and does not stop the run,
+// unless fail fast is set.
+// An error is returned only if pods could not be listed. If the context
+// is canceled, the result holds the pods handled so far.
+func (c *Controller) Run(ctx context.Context) (*RunResult, error) {
+	result := &RunResult{
+		ID:       newRunID(),
+		Time:     time.Now(),
+		DryRun:   c.isDryRun(),
+		Paused:   c.Paused(),
+		Disabled: c.Disabled(),
+	}
+
+	c.reloadHistory(result.Time)
+	c.checkReplacements(result.Time)
+
+	candidates, skipped, err := c.evaluatePods(ctx, result.ID)
+	if err != nil {
+		c.finish(result.ID, result.Time, nil, err)
+		return nil, err
+	}
+	result.Skipped = skipped
+	// every pod is either a candidate or skipped
+	result.Evaluated = len(candidates) + len(skipped)
+	result.Candidates = len(candidates)
+	for _, d := range skipped {
+		switch d.Skip {
+		case TerminatingSkip:
+			result.Terminating++
+		case KeepFailingSkip:
+			// kept pods matched a rule
+			result.Candidates++
+		}
 	}
 
-	for _, pod := range pods {
+	skip := NodeHealthSkip
+	reason, err := c.checkNodeHealth(result.Time)
+	if err != nil {
+		c.finish(result.ID, result.Time, nil, err)
+		return nil, err
+	}
+	if reason == "" {
+		skip, reason = MassFailureSkip, c.checkMassFailure(result)
+	}
+	if reason != "" {
+		c.abort(result, candidates, skip, reason)
+		c.finish(result.ID, result.Time, result, result.Err())
+		return result, nil
+	}
+
+	c.process(ctx, result, candidates)
+	c.finish(result.ID, result.Time, result, nil)
+
+	return result, nil
+}
+
+// process applies the action of each candidate that no check skips, in
+// order. It stops early if the context is canceled.
+func (c *Controller) process(ctx context.Context, result *RunResult, candidates []Candidate) {
+	remaining := c.budget.remaining(time.Now())
+	disruptions := c.newDisruptions()
+	replicas := c.newReadyReplicas()
+	rollouts := c.newRollouts()
+	// the StatefulSets acted on in this run
+	statefulSets := make(map[string]bool)
+	// whether a pod was acted on in this run, for the delay between them
+	acted := false
+	// the last pod acted on for each owner in this run
+	owners := make(map[string]pendingReplacement)
+
+	skip := func(cand Candidate, reason string, detail string) {
+		cand.logger.Info("skipping pod",
+			zap.String("reason", reason),
+			zap.String("detail", detail),
+		)
+		result.add(c.decide(cand, "skipped", reason, detail, nil))
+		c.onSkip(cand, reason)
+	}
+
+	for _, cand := range candidates {
 		// we only check at the beginning of loop if we are done
 		select {
 		case <-ctx.Done():
-			return nil
+			return
 		default:
 		}
 
-		logger := c.logger.With(
-			zap.String("namespace", pod.ObjectMeta.Namespace),
-			zap.String("name", pod.ObjectMeta.Name),
-		)
+		if detail := c.checkWindows(cand, time.Now()); detail != "" {
+			skip(cand, WindowSkip, detail)
+			continue
+		}
 
-		switch pod.Status.Phase {
-		case v1.PodPending, v1.PodSucceeded, v1.PodUnknown:
-			logger.Debug("skipping pod",
-				zap.String("reason", "PodPhase"),
-				zap.String("PodPhase", string(pod.Status.Phase)),
-			)
+		if remaining == 0 {
+			skip(cand, "Budget", "")
 			continue
 		}
 
-		// only look at pods that are older than the grace period
-		if pod.ObjectMeta.CreationTimestamp.Time.Add(c.grace).After(time.Now()) {
-			logger.Debug("skipping pod",
-				zap.String("reason", "CreationTimestamp"),
-				zap.Time("CreationTimestamp", pod.ObjectMeta.CreationTimestamp.Time),
-			)
+		if owner := ownerKey(cand); c.flaps.flapping(owner, time.Now()) {
+			skip(cand, "Flapping", cand.Owner())
 			continue
 		}
 
-	STATUS:
-		for _, status := range pod.Status.ContainerStatuses {
-			reason := ""
-			if status.State.Terminated != nil {
-				reason = status.State.Terminated.Reason
-			} else if status.State.Waiting != nil {
-				reason = status.State.Waiting.Reason
-			}
+		if err := c.beforeDelete(cand); err != nil {
+			skip(cand, "Vetoed", err.Error())
+			continue
+		}
 
-			if _, ok := c.reasonsMap[reason]; !ok {
-				logger.Debug("skipping pod",
-					zap.String("reason", "Reason"),
-					zap.String("Reason", reason),
-				)
-				continue STATUS
+		detail, err := c.statefulSets.check(cand, statefulSets)
+		if err != nil {
+			// without the previous pod, we cannot tell if it was replaced
+			detail = err.Error()
+		}
+		if detail != "" {
+			skip(cand, "StatefulSet", detail)
+			continue
+		}
+
+		last, err := replicas.last(&cand.Pod)
+		if last || err != nil {
+			detail = cand.Owner()
+			if err != nil {
+				// without the other pods, we cannot tell if the deletion is safe
+				detail = err.Error()
 			}
+			skip(cand, "LastReadyReplica", detail)
+			continue
+		}
 
-			logger.Info("deleting pod",
-				zap.String("Reason", reason),
-				zap.Bool("dry-run", c.dryRun),
+		deployment, err := rollouts.check(&cand.Pod)
+		if err != nil {
+			// without the deployment, we cannot tell if the deletion is safe
+			deployment = err.Error()
+		}
+		if deployment != "" {
+			skip(cand, "Rollout", deployment)
+			continue
+		}
+
+		pdb, err := disruptions.check(&cand.Pod)
+		if err != nil {
+			// without the budgets, we cannot tell if the deletion is safe
+			pdb = err.Error()
+		}
+		if pdb != "" {
+			skip(cand, "DisruptionBudget", pdb)
+			continue
+		}
+
+		if !c.waitForReplacement(ctx, cand, owners) {
+			return
+		}
+		if !c.wait(ctx, cand.logger, acted) {
+			return
+		}
+		acted = true
+
+		// replacements are looked for from before the action, as the
+		// owner may replace the pod before the action returns
+		start := time.Now()
+		err = c.act(ctx, cand)
+		result.add(c.decide(cand, actionResult(cand.Action), "", "", err))
+		if err != nil {
+			cand.logger.Error("failed to act on pod",
+				zap.String("action", cand.Action),
+				zap.Error(err),
 			)
+			c.onError(cand, err)
+			if c.failFast {
+				break
+			}
+			continue
+		}
+		c.onDelete(cand)
+		c.statefulSets.acted(cand, time.Now(), c.isDryRun(), statefulSets)
+
+		if !c.isDryRun() {
+			now := time.Now()
+			c.budget.record(now)
+			c.recordFlap(cand, now)
+			c.recordHistory(cand, now)
+			c.replacements.add(cand.deletion(start))
+			c.rolled(cand, start, owners)
+			c.annotateOwners(cand, now)
+		}
 
-			if !c.dryRun {
-				err := c.deleter.DeletePod(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
-				if err != nil {
-					// if not found is fine as pod may have exited
-					if !k8sErrors.IsNotFound(err) {
-						return errors.Wrapf(err, "failed to delete pod %s/%s", pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+		if remaining > 0 {
+			remaining--
+		}
+	}
+}
+
+// Candidates lists pods and returns those that should be deleted, in the
+// order they would be deleted. Nothing is deleted and the budget is not applied.
+func (c *Controller) Candidates() ([]Candidate, error) {
+	candidates, _, err := c.evaluatePods(context.Background(), "")
+	return candidates, err
+}
+
+// evaluatePods lists pods and checks them against the rules. It returns
+// the candidates, in the order they would be deleted, and a skipped
+// decision for each pod that did not match any rule. id is the ID of the
+// run, if any.
+func (c *Controller) evaluatePods(ctx context.Context, id string) ([]Candidate, []Decision, error) {
+	c.mu.RLock()
+	rules := c.compiled
+	windows := c.windows
+	containers := c.containers
+	window := c.restartWindow
+	order := c.order
+	c.mu.RUnlock()
+
+	// a pod may be matched by more than one rule
+	matched := make(map[string]bool)
+	var candidates []Candidate
+
+	// the first reason a pod was skipped, in the order pods were seen
+	skips := make(map[string]Decision)
+	var skipOrder []string
+
+	now := time.Now()
+	observed := make(map[string]bool)
+	state := c.newRunState(now, id)
+
+	for _, r := range rules {
+		visit := func(pods []v1.Pod) error {
+			for _, pod := range pods {
+				pod = containers.apply(pod)
+				key := pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+				if !observed[key] {
+					observed[key] = true
+					c.restarts.observe(pod, now)
+				}
+
+				if matched[key] {
+					continue
+				}
+
+				logger := state.logger.With(
+					zap.String("namespace", pod.ObjectMeta.Namespace),
+					zap.String("name", pod.ObjectMeta.Name),
+				)
+				if r.Name != "" {
+					logger = logger.With(zap.String("rule", r.Name))
+				}
+
+				reason, skip, detail := c.evaluate(r, state, logger, pod)
+				if skip != "" {
+					if c.explain {
+						c.explainSkip(r, logger, pod, skip, detail)
+					}
+					if _, ok := skips[key]; !ok {
+						skipOrder = append(skipOrder, key)
+						skips[key] = Decision{
+							Time:      now,
+							Namespace: pod.ObjectMeta.Namespace,
+							Name:      pod.ObjectMeta.Name,
+							Rule:      r.Name,
+							Owner:     podOwner(&pod),
+							Action:    "skipped",
+							Skip:      skip,
+							Detail:    detail,
+							DryRun:    c.isDryRun(),
+							RunID:     id,
+						}
 					}
+					continue
 				}
+
+				matched[key] = true
+				cand := Candidate{
+					Pod:     pod,
+					Rule:    r.Name,
+					Reason:  reason,
+					Action:  r.Action,
+					RunID:   id,
+					rule:    r,
+					logger:  logger,
+					windows: windows,
+				}
+				c.forceDelete(state, &cand)
+				candidates = append(candidates, cand)
 			}
+			return nil
+		}
+
+		err := c.retry.do(ctx, state.logger, "list pods", func() error {
+			return c.listPods(r.Namespace, r.Selector, visit)
+		})
+		if err != nil {
+			return nil, nil, errors.Wrap(err, "failed to list pods")
+		}
+
+		r.cache.sweep()
+	}
+
+	c.restarts.expire(now, window)
+	c.saveRestarts()
+	if c.orphans != nil && state.nodes != nil {
+		c.orphans.sweep()
+	}
+
+	var skipped []Decision
+	for _, key := range skipOrder {
+		if !matched[key] {
+			skipped = append(skipped, skips[key])
+		}
+	}
+
+	candidates, kept := c.keepNewest(candidates, now)
+	skipped = append(skipped, kept...)
+
+	drain, err := c.drainNodes()
+	if err != nil {
+		state.logger.Warn("failed to get nodes being drained", zap.Error(err))
+	}
+	for i := range candidates {
+		candidates[i].Draining = drain[candidates[i].Pod.Spec.NodeName]
+	}
+
+	sortCandidates(candidates, order)
+
+	return candidates, skipped, nil
+}
+
+// Owner returns the "kind/name" of the controller that owns the pod,
+// or an empty string if there is none.
+func (cand Candidate) Owner() string {
+	return podOwner(&cand.Pod)
+}
+
+// logFields returns the owner, node, matched container, restart count, and
+// age of a candidate, so the log entry for an action is enough to see what
+// was acted on and why. The owner, node, and container are left out if empty.
+func (cand Candidate) logFields(now time.Time) []zapcore.Field {
+	var fields []zapcore.Field
+	if owner := cand.Owner(); owner != "" {
+		fields = append(fields, zap.String("owner", owner))
+	}
+	if node := cand.Pod.Spec.NodeName; node != "" {
+		fields = append(fields, zap.String("node", node))
+	}
+	if container := cand.container(); container != "" {
+		fields = append(fields, zap.String("container", container))
+	}
+	return append(fields,
+		zap.Int32("restarts", restartCount(cand.Pod)),
+		zap.Duration("age", now.Sub(cand.Pod.ObjectMeta.CreationTimestamp.Time)),
+	)
+}
+
+// container returns the name of the first container in the candidate's
+// reason, or an empty string if the reason is not a container state, such
+// as RestartRate.
+func (cand Candidate) container() string {
+	for i, reason := range containerReasons(cand.Pod) {
+		if reason != "" && reason == cand.Reason {
+			return cand.Pod.Status.ContainerStatuses[i].Name
+		}
+	}
+	return ""
+}
+
+func podOwner(pod *v1.Pod) string {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil {
+		return ""
+	}
+	return ref.Kind + "/" + ref.Name
+}
+
+// listPods calls fn with the pods that match the namespace and selector,
+// a page at a time if the lister supports it.
+func (c *Controller) listPods(namespace string, selector string, fn func(pods []v1.Pod) error) error {
+	start := time.Now()
+	if pager, ok := c.lister.(PodPager); ok {
+		// each page is requested after fn returns for the previous one, so
+		// only the time outside of fn is spent listing.
+		return pager.ListPodPages(namespace, selector, func(pods []v1.Pod) error {
+			c.counters.list.Observe(time.Since(start).Seconds())
+			defer func() {
+				start = time.Now()
+			}()
+			return fn(pods)
+		})
+	}
+
+	pods, err := c.lister.ListPods(namespace, selector)
+	c.counters.list.Observe(time.Since(start).Seconds())
+	if err != nil {
+		return err
+	}
+	return fn(pods)
+}
+
+// timeSkips are the skip reasons that may change as time passes, so are not cached
+var timeSkips = map[string]bool{
+	"CreationTimestamp": true,
+	"StateTransition":   true,
+	"FinishedAt":        true,
+}
+
+// evaluate checks a single pod against a rule, using the cached result
+// if the pod has not changed since it was last evaluated.
+func (c *Controller) evaluate(r *rule, s *runState, logger *zap.Logger, pod v1.Pod) (string, string, string) {
+	if !c.evalCache {
+		reason, skip, detail := r.evaluate(logger, pod)
+		return c.recheck(r, s, logger, pod, reason, skip, detail)
+	}
+
+	key := pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+	if result, ok := r.cache.get(key, pod.ObjectMeta.ResourceVersion); ok {
+		c.cacheStats.hit()
+		logger.Debug("using cached evaluation",
+			zap.String("resourceVersion", pod.ObjectMeta.ResourceVersion),
+			zap.String("skip", result.skip),
+		)
+		return c.recheck(r, s, logger, pod, result.reason, result.skip, result.detail)
+	}
+	c.cacheStats.miss()
+
+	reason, skip, detail := r.evaluate(logger, pod)
+
+	// the pod may become old enough on a later run without changing
+	if !timeSkips[skip] {
+		r.cache.put(key, evalResult{
+			resourceVersion: pod.ObjectMeta.ResourceVersion,
+			reason:          reason,
+			skip:            skip,
+			detail:          detail,
+		})
+	}
+
+	return c.recheck(r, s, logger, pod, reason, skip, detail)
+}
+
+// recheck applies the checks that depend on time as well as the pod
+// to the result of evaluating a pod.
+func (c *Controller) recheck(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	for _, check := range c.rechecks() {
+		reason, skip, detail = check.fn(r, s, logger, pod, reason, skip, detail)
+	}
+	return reason, skip, detail
+}
+
+// recheckFunc may replace the result of evaluating a pod
+type recheckFunc func(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string)
+
+type namedRecheck struct {
+	name string
+	fn   recheckFunc
+}
+
+// rechecks returns the checks applied by recheck, in order.
+func (c *Controller) rechecks() []namedRecheck {
+	return []namedRecheck{
+		{"restarts", c.checkRestartRate},
+		{"not ready", c.checkNotReady},
+		{"conditions", c.checkConditions},
+		{"warning events", c.checkWarnings},
+		{"cordoned node", c.checkCordoned},
+		{"node not ready", c.checkNodeNotReady},
+		{"orphaned", c.checkOrphaned},
+		{"unknown phase", c.checkUnknownPhase},
+		{"finished job", c.checkFinishedJob},
+		{"resource usage", c.checkUsage},
+		{"terminating", c.checkTerminating},
+	}
+}
+
+// runState holds what is listed at most once per run for the checks
+// that are never cached.
+type runState struct {
+	now time.Time
+	// logger has the run ID, if any
+	logger   *zap.Logger
+	warnings *podWarnings
+	usage    *podUsage
+	// nodes is keyed by name, and only listed if needed
+	nodes map[string]v1.Node
+	// jobs is keyed by namespace and name, and only looked up if needed
+	jobs map[string]jobState
+}
+
+// newRunState lists the nodes needed by the node checks. Failures are
+// logged, and the checks that need the nodes are skipped. id is the ID of
+// the run, if any.
+func (c *Controller) newRunState(now time.Time, id string) *runState {
+	logger := c.runLogger(id)
+	state := &runState{
+		now:      now,
+		logger:   logger,
+		warnings: c.newPodWarnings(now, logger),
+		usage:    c.newPodUsage(logger),
+	}
+
+	if c.cordoned != nil {
+		nodes, err := listNodes(c.cordoned.lister)
+		if err != nil {
+			logger.Warn("failed to list cordoned nodes", zap.Error(err))
+		} else {
+			c.cordoned.update(nodes, now)
+		}
+	}
+
+	if c.nodeNotReady != nil {
+		nodes, err := listNodes(c.nodeNotReady.lister)
+		if err != nil {
+			logger.Warn("failed to list nodes that are not ready", zap.Error(err))
+		}
+		state.nodes = nodes
+	}
+
+	if c.orphans != nil && state.nodes == nil {
+		nodes, err := listNodes(c.orphans.lister)
+		if err != nil {
+			logger.Warn("failed to list nodes for orphaned pods", zap.Error(err))
+		}
+		state.nodes = nodes
+	}
+
+	return state
+}
+
+// checkRestartRate matches a pod that was skipped only because of its
+// container reasons if it is restarting faster than the rule allows, or
+// restarted more than the restart threshold within the window. Restarts
+// change between runs, so they are never cached.
+func (c *Controller) checkRestartRate(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if skip != "Reason" || (r.RestartRate <= 0 && r.restartLimit <= 0) {
+		return reason, skip, detail
+	}
+
+	delta, ok := c.restarts.delta(pod)
+	if !ok {
+		return reason, skip, detail
+	}
+
+	if r.restartLimit > 0 && delta > r.restartLimit {
+		logger.Debug("pod exceeds restart threshold",
+			zap.Int32("restarts", delta),
+			zap.Int32("threshold", r.restartLimit),
+			zap.Duration("window", r.restartWindow),
+		)
+		return "Restarts", "", ""
+	}
+
+	// divide by the whole window rather than the time between samples so a
+	// burst of restarts shortly after a pod is first seen is not extrapolated.
+	rate := float64(delta) / r.restartWindow.Hours()
+	if r.RestartRate <= 0 || rate <= r.RestartRate {
+		return reason, skip, detail
+	}
+
+	logger.Debug("pod exceeds restart rate",
+		zap.Float64("rate", rate),
+		zap.Float64("threshold", r.RestartRate),
+	)
+	return "RestartRate", "", ""
+}
+
+// evaluate checks a single pod against a rule's filters. It returns the
+// matching reason if the pod should be deleted. Otherwise, it returns why
+// the pod was skipped and the value that caused it.
+func (r *rule) evaluate(logger *zap.Logger, pod v1.Pod) (reason string, skip string, detail string) {
+	return r.evaluateFilters(logger, pod, r.filters)
+}
+
+// evaluateFilters is evaluate with a subset of the rule's filters
+func (r *rule) evaluateFilters(logger *zap.Logger, pod v1.Pod, filters []Filter) (reason string, skip string, detail string) {
+	for _, f := range filters {
+		verdict, reason, detail := checkFilter(f, pod)
+		switch verdict {
+		case Skip:
+			logger.Debug("skipping pod",
+				zap.String("reason", reason),
+				zap.String("detail", detail),
+			)
+			return "", reason, detail
+		case Match:
+			return reason, "", ""
 		}
 	}
 
+	detail = noReasonDetail(pod)
+	logger.Debug("skipping pod",
+		zap.String("reason", "Reason"),
+		zap.String("detail", detail),
+	)
+	return "", "Reason", detail
+}
+
+// act applies the candidate's action, unless in dry-run mode.
+func (c *Controller) act(ctx context.Context, cand Candidate) error {
+	pod := cand.Pod
+
+	msg := "deleting pod"
+	if cand.Action != DeleteActionName {
+		msg = "applying action to pod"
+	}
+	fields := []zapcore.Field{
+		zap.String("Reason", cand.Reason),
+		zap.String("action", cand.Action),
+		zap.Bool("dry-run", c.isDryRun()),
+		zap.Bool("draining", cand.Draining),
+	}
+	cand.logger.Info(msg, append(fields, cand.logFields(time.Now())...)...)
+
+	if c.isDryRun() {
+		return nil
+	}
+
+	now := time.Now()
+	c.markTombstone(ctx, cand, now)
+	c.captureLogs(ctx, cand, now)
+	c.archivePod(ctx, cand, now)
+
+	action := cand.rule.action
+	if cand.action != nil {
+		action = cand.action
+	}
+
+	err := c.retry.do(ctx, cand.logger, cand.Action, func() error {
+		start := time.Now()
+		defer func() {
+			c.counters.action.WithLabelValues(cand.Action).Observe(time.Since(start).Seconds())
+		}()
+		return action.Do(cand)
+	})
+	if err != nil {
+		// if not found is fine as pod may have exited
+		if !k8sErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to %s pod %s/%s", cand.Action, pod.ObjectMeta.Namespace, pod.ObjectMeta.Name)
+		}
+	}
 	return nil
 }
 
+// Reconfigure changes the pod selection settings of a controller, those
+// copied below; other options are ignored. It is safe to call while the
+// controller is running and takes effect at the start of the next run.
+func (c *Controller) Reconfigure(options ...Option) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	// the settings that can be changed
+	tmp := &Controller{
+		namespace:     c.namespace,
+		selector:      c.selector,
+		grace:         c.grace,
+		graceFrom:     c.graceFrom,
+		minTerminated: c.minTerminated,
+		reasons:       c.reasons,
+		reasonGrace:   c.reasonGrace,
+		rules:         c.rules,
+		overrides:     c.overrides,
+		restartRate:   c.restartRate,
+		restartLimit:  c.restartLimit,
+		restartWindow: c.restartWindow,
+		notReady:      c.notReady,
+		conditions:    c.conditions,
+		includeImages: c.includeImages,
+		excludeImages: c.excludeImages,
+		filters:       c.filters,
+		excludeSAs:    c.excludeSAs,
+		excludeLabels: c.excludeLabels,
+		annotations:   c.annotations,
+		priority:      c.priority,
+		disruption:    c.disruption,
+		phases:        c.phases,
+		containers:    c.containers,
+		deleter:       c.deleter,
+		actions:       c.actions,
+		action:        c.action,
+		order:         c.order,
+		windows:       c.windows,
+	}
+
+	for _, o := range options {
+		if err := o(tmp); err != nil {
+			return errors.Wrap(err, "option failed")
+		}
+	}
+
+	compiled, err := tmp.compileRules()
+	if err != nil {
+		return errors.Wrap(err, "failed to compile rules")
+	}
+
+	c.namespace = tmp.namespace
+	c.selector = tmp.selector
+	c.grace = tmp.grace
+	c.graceFrom = tmp.graceFrom
+	c.minTerminated = tmp.minTerminated
+	c.reasons = tmp.reasons
+	c.reasonGrace = tmp.reasonGrace
+	c.rules = tmp.rules
+	c.overrides = tmp.overrides
+	c.restartRate = tmp.restartRate
+	c.restartLimit = tmp.restartLimit
+	c.restartWindow = tmp.restartWindow
+	c.notReady = tmp.notReady
+	c.conditions = tmp.conditions
+	c.includeImages = tmp.includeImages
+	c.excludeImages = tmp.excludeImages
+	c.excludeSAs = tmp.excludeSAs
+	c.excludeLabels = tmp.excludeLabels
+	c.annotations = tmp.annotations
+	c.priority = tmp.priority
+	c.disruption = tmp.disruption
+	c.phases = tmp.phases
+	c.containers = tmp.containers
+	c.actions = tmp.actions
+	c.action = tmp.action
+	c.order = tmp.order
+	c.windows = tmp.windows
+	c.compiled = compiled
+
+	return nil
+}
+
+// Schedule returns the next time to run after the given time, such as a
+// cron schedule. A zero time means there are no more runs.
+type Schedule interface {
+	Next(time.Time) time.Time
+}
+
 // Loop will run the controller periodically until stopped
 func (c *Controller) Loop() error {
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	if err := c.Once(ctx); err != nil {
-		return errors.Wrap(err, "failed to run")
+	c.stopMu.Lock()
+	if c.stopped {
+		c.stopMu.Unlock()
+		return nil
+	}
+	c.cancel = cancel
+	c.stopMu.Unlock()
+
+	if c.schedule != nil {
+		return c.scheduleLoop(ctx)
 	}
 
+	c.loopOnce(ctx)
+
 	t := time.NewTicker(c.interval)
+	defer t.Stop()
 	for {
 		select {
 		case <-t.C:
-			if err := c.Once(ctx); err != nil {
-				return errors.Wrap(err, "failed to run")
-			}
-		case <-c.stopChan:
-			cancel()
+			c.loopOnce(ctx)
+		case <-c.runChan:
+			c.loopOnce(ctx)
+		case <-ctx.Done():
 			return nil
 		}
 	}
-	return nil
 }
 
-// Stop the loop
-func (c *Controller) Stop() {
-	// stop should only be called once, but just in case...
+// scheduleLoop runs the controller at each time given by the schedule
+// rather than every interval. Unlike Loop, it does not run at startup.
+func (c *Controller) scheduleLoop(ctx context.Context) error {
+	for {
+		now := time.Now()
+		next := c.schedule.Next(now)
+		if next.IsZero() {
+			return errors.New("schedule has no more runs")
+		}
+		c.logger.Info("waiting for next scheduled run", zap.Time("next", next))
+
+		t := time.NewTimer(next.Sub(now))
+		select {
+		case <-t.C:
+			c.loopOnce(ctx)
+		case <-c.runChan:
+			t.Stop()
+			c.loopOnce(ctx)
+		case <-ctx.Done():
+			t.Stop()
+			return nil
+		}
+	}
+}
+
+// loopOnce runs the controller for Loop. Pods that could not be acted on
+// are logged with the run, and tried again next run, rather than stopping
+// the loop as they stop Once. So are pods that could not be listed once
+// the retries are used up.
+func (c *Controller) loopOnce(ctx context.Context) {
+	// a run canceled by Stop is not a failure
+	if _, err := c.Run(ctx); err != nil && ctx.Err() == nil {
+		c.logger.Error("failed to run, trying again next run", zap.Error(err))
+	}
+}
+
+// Trigger makes the loop run now rather than waiting for the next interval
+// or scheduled time. It does nothing if a triggered run is already pending.
+func (c *Controller) Trigger() {
 	select {
-	case c.stopChan <- struct{}{}:
+	case c.runChan <- struct{}{}:
 	default:
 	}
 }
 
+// Stop the loop, canceling the run in progress so it does not wait out a
+// delay before returning.
+func (c *Controller) Stop() {
+	c.stopMu.Lock()
+	defer c.stopMu.Unlock()
+	c.stopped = true
+	if c.cancel != nil {
+		c.cancel()
+	}
+}
+
 // WithDryRun returns an Option that sets the dryrun flag.
 // When true, pods will not actually be deleted
 // Used when creating a new Controller.
@@ -246,6 +1279,16 @@ func WithInterval(d time.Duration) Option {
 	}
 }
 
+// WithSchedule returns an Option that runs the loop at the times given
+// by s instead of every interval. Nil uses the interval.
+// Used when creating a new Controller.
+func WithSchedule(s Schedule) Option {
+	return func(c *Controller) error {
+		c.schedule = s
+		return nil
+	}
+}
+
 // WithReasons returns an Option that sets the reasons to delete a pod.
 // Default is CrashLoopBackOff Error
 func WithReasons(reasons []string) Option {
@@ -254,3 +1297,67 @@ func WithReasons(reasons []string) Option {
 		return nil
 	}
 }
+
+// WithReasonGrace returns an Option that sets a grace period for each
+// reason, replacing the grace period for pods with a container in that
+// reason. If containers are in more than one reason, the shortest grace
+// period is used. The reasons must also be set with WithReasons.
+// Used when creating a new Controller.
+func WithReasonGrace(grace map[string]time.Duration) Option {
+	return func(c *Controller) error {
+		for reason, d := range grace {
+			if d < 0 {
+				return errors.Errorf("grace period for reason %q must not be negative", reason)
+			}
+		}
+		c.reasonGrace = grace
+		return nil
+	}
+}
+
+// WithRules returns an Option that sets the rules used to select pods.
+// Empty fields in a rule are inherited from the namespace, selector,
+// reasons, and grace period options. If no rules are set, a single rule
+// using those options is used.
+func WithRules(rules []Rule) Option {
+	return func(c *Controller) error {
+		c.rules = rules
+		return nil
+	}
+}
+
+// WithNamespaceOverrides returns an Option that sets per-namespace
+// reasons and grace periods. These take precedence over the values in a rule.
+func WithNamespaceOverrides(overrides map[string]NamespaceOverride) Option {
+	return func(c *Controller) error {
+		c.overrides = overrides
+		return nil
+	}
+}
+
+// WithFailFast returns an Option that stops a run at the first pod that
+// cannot be deleted. The remaining candidates are left for the next run.
+// By default, the run continues and all errors are returned together.
+// Used when creating a new Controller.
+func WithFailFast(failFast bool) Option {
+	return func(c *Controller) error {
+		c.failFast = failFast
+		return nil
+	}
+}
+
+// WithBudget returns an Option that limits the number of pods deleted
+// within a sliding time window across runs. A negative max means no limit.
+// Used when creating a new Controller.
+func WithBudget(max int, window time.Duration) Option {
+	return func(c *Controller) error {
+		if max >= 0 && window <= 0 {
+			return errors.New("budget window must be positive")
+		}
+		c.budget = &budget{
+			max:    max,
+			window: window,
+		}
+		return nil
+	}
+}
@@ -1,25 +1,61 @@
 package controller
 
 import (
+	"bytes"
 	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/bakins/k8s-pod-deleter/pkg/history"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 	"github.com/stretchr/testify/require"
 	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/apimachinery/pkg/util/intstr"
 )
 
+// testClient is safe to use from a running loop. Tests set pods directly
+// before starting one.
 type testClient struct {
+	mu   sync.Mutex
 	pods []v1.Pod
 }
 
 func (t *testClient) ListPods(namespace string, selector string) ([]v1.Pod, error) {
-	return t.pods, nil
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if namespace == "" {
+		return t.pods, nil
+	}
+	pods := make([]v1.Pod, 0, len(t.pods))
+	for _, p := range t.pods {
+		if namespace == p.ObjectMeta.Namespace {
+			pods = append(pods, p)
+		}
+	}
+	return pods, nil
 }
 
 func (t *testClient) DeletePod(namespace string, name string) error {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	// cheesy
 	pods := make([]v1.Pod, 0, len(t.pods))
 	for _, p := range t.pods {
@@ -32,10 +68,34 @@ func (t *testClient) DeletePod(namespace string, name string) error {
 	return nil
 }
 
+func (t *testClient) GetPod(namespace string, name string) (*v1.Pod, error) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for _, p := range t.pods {
+		if namespace == p.ObjectMeta.Namespace && name == p.ObjectMeta.Name {
+			return &p, nil
+		}
+	}
+	return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "pods"}, name)
+}
+
 func (t *testClient) lenPods() int {
+	t.mu.Lock()
+	defer t.mu.Unlock()
 	return len(t.pods)
 }
 
+// waitForPods waits for a running loop to leave n pods
+func (t *testClient) waitForPods(tt *testing.T, n int) {
+	deadline := time.Now().Add(time.Second)
+	for t.lenPods() != n {
+		if time.Now().After(deadline) {
+			tt.Fatalf("expected %d pods, found %d", n, t.lenPods())
+		}
+		time.Sleep(time.Millisecond * 5)
+	}
+}
+
 // useful to debug test
 func createLogger() *zap.Logger {
 	config := zap.NewProductionConfig()
@@ -136,3 +196,3917 @@ func TestController(t *testing.T) {
 		})
 	}
 }
+
+func TestControllerRules(t *testing.T) {
+	tests := []struct {
+		description string
+		options     []Option
+		expected    []string
+	}{
+		{
+			description: "rule per namespace",
+			options: []Option{
+				WithRules([]Rule{
+					{Namespace: "web", Reasons: []string{"Error"}},
+					{Namespace: "db", Reasons: []string{"CrashLoopBackOff"}},
+				}),
+			},
+			expected: []string{"web/pod0", "db/pod1"},
+		},
+		{
+			description: "rule inherits grace",
+			options: []Option{
+				WithGrace(time.Hour * 2),
+				WithRules([]Rule{
+					{Reasons: []string{"Error"}},
+				}),
+			},
+			expected: []string{"web/pod0", "db/pod0", "db/pod1"},
+		},
+		{
+			description: "namespace override",
+			options: []Option{
+				WithNamespaceOverrides(map[string]NamespaceOverride{
+					"db": {Reasons: []string{"OOMKilled"}},
+				}),
+			},
+			expected: []string{"db/pod0", "db/pod1"},
+		},
+	}
+
+	for _, test := range tests {
+		test := test
+		t.Run(test.description, func(t *testing.T) {
+			t.Parallel()
+
+			client := &testClient{}
+			client.pods = []v1.Pod{
+				makePod(time.Hour*3, "web", "pod0", v1.PodRunning, "Terminated", "CrashLoopBackOff"),
+				makePod(time.Hour*3, "web", "pod1", v1.PodRunning, "Terminated", "Error"),
+				makePod(time.Hour*3, "db", "pod0", v1.PodRunning, "Terminated", "CrashLoopBackOff"),
+				makePod(time.Hour, "db", "pod1", v1.PodRunning, "Terminated", "Error"),
+			}
+
+			options := append([]Option{
+				WithGrace(time.Duration(time.Minute * 5)),
+				WithLogger(zap.NewNop()),
+			}, test.options...)
+
+			c, err := New(client, client, options...)
+			require.NoError(t, err)
+
+			err = c.Once(context.Background())
+			require.NoError(t, err)
+
+			remaining := make([]string, 0, len(client.pods))
+			for _, p := range client.pods {
+				remaining = append(remaining, p.ObjectMeta.Namespace+"/"+p.ObjectMeta.Name)
+			}
+			require.Equal(t, test.expected, remaining)
+		})
+	}
+}
+
+func TestControllerReconfigure(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour*3, "default", "pod0", v1.PodRunning, "Terminated", "OOMKilled"),
+		makePod(time.Hour*3, "default", "pod1", v1.PodRunning, "Terminated", "CrashLoopBackOff"),
+	}
+
+	c, err := New(client, client,
+		WithReasons([]string{"CrashLoopBackOff"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+
+	require.NoError(t, c.Reconfigure(WithReasons([]string{"OOMKilled"})))
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 0, client.lenPods())
+}
+
+func TestControllerBudget(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "dev", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "prod", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "dev", "pod1", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "prod", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithBudget(3, time.Hour),
+		WithNamespaceOverrides(map[string]NamespaceOverride{
+			"prod": {Priority: 10},
+		}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+	require.Equal(t, "dev", client.pods[0].ObjectMeta.Namespace)
+	require.Equal(t, "pod1", client.pods[0].ObjectMeta.Name)
+
+	// budget is used up for the window
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+}
+
+func TestBudgetFailedAction(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	deleter := &failingDeleter{testClient: client, name: "pod0"}
+	c, err := New(client, deleter,
+		WithGrace(time.Minute*5),
+		WithBudget(1, time.Hour),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// a failed deletion does not use the budget
+	require.Error(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+
+	deleter.name = ""
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 0, client.lenPods())
+}
+
+func TestBudgetState(t *testing.T) {
+	b := &budget{max: 2, window: time.Hour}
+	now := time.Now()
+
+	s := b.state(now)
+	require.Equal(t, 2, s.Remaining)
+	require.Nil(t, s.NextAvailable)
+
+	b.record(now.Add(-time.Minute * 90))
+	b.record(now.Add(-time.Minute * 30))
+	b.record(now.Add(-time.Minute * 10))
+
+	s = b.state(now)
+	require.Equal(t, 2, s.Used)
+	require.Equal(t, 0, s.Remaining)
+	require.Equal(t, now.Add(time.Minute*30), *s.NextAvailable)
+}
+
+func TestFlapCooldowns(t *testing.T) {
+	f := &flapDetector{threshold: 2, window: time.Hour}
+	now := time.Now()
+
+	f.record("default/ReplicaSet/web", now.Add(-time.Minute*50))
+	f.record("default/ReplicaSet/web", now.Add(-time.Minute*40))
+	f.record("default/ReplicaSet/web", now.Add(-time.Minute*10))
+	f.record("default/ReplicaSet/api", now.Add(-time.Minute*10))
+
+	// web is flapping until a second deletion leaves the window
+	require.Equal(t, []Cooldown{
+		{Owner: "default/ReplicaSet/web", Deletions: 3, Until: now.Add(time.Minute * 20)},
+	}, f.cooldowns(now))
+
+	require.Empty(t, f.cooldowns(now.Add(time.Minute*25)))
+}
+
+type testNodeLister struct {
+	nodes []v1.Node
+}
+
+func (t *testNodeLister) ListNodes() ([]v1.Node, error) {
+	return t.nodes, nil
+}
+
+func TestControllerDrain(t *testing.T) {
+	onNode := func(pod v1.Pod, node string) v1.Pod {
+		pod.Spec.NodeName = node
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		onNode(makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"), "node0"),
+		onNode(makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"), "node1"),
+		onNode(makePod(time.Hour, "default", "pod2", v1.PodRunning, "Terminated", "Error"), "node2"),
+	}
+
+	nodes := &testNodeLister{
+		nodes: []v1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node1", Annotations: map[string]string{DrainAnnotation: "true"}}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithBudget(2, time.Hour),
+		WithDrainNodes([]string{"node2"}),
+		WithNodeLister(nodes),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+	require.Equal(t, "pod0", client.pods[0].ObjectMeta.Name)
+}
+
+func TestControllerCordonedNodes(t *testing.T) {
+	isController := true
+	onNode := func(name string, node string, owner string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Running", "")
+		pod.Spec.NodeName = node
+		if owner != "" {
+			pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+				{Kind: owner, Name: name, Controller: &isController},
+			}
+		}
+		return pod
+	}
+	mirror := onNode("static", "node0", "")
+	mirror.ObjectMeta.Annotations = map[string]string{mirrorPodAnnotation: "abc"}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		onNode("web", "node0", "ReplicaSet"),
+		onNode("agent", "node0", "DaemonSet"),
+		mirror,
+		onNode("recent", "node1", "ReplicaSet"),
+		onNode("schedulable", "node2", "ReplicaSet"),
+	}
+
+	nodes := &testNodeLister{
+		nodes: []v1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node0"}, Spec: v1.NodeSpec{Unschedulable: true}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node1"}, Spec: v1.NodeSpec{Unschedulable: true}},
+			{ObjectMeta: metav1.ObjectMeta{Name: "node2"}},
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithCordonedNodes(nodes, time.Minute*10),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// node0 was cordoned before node1
+	c.cordoned.since = map[string]time.Time{
+		"node0": time.Now().Add(-time.Hour),
+		"node2": time.Now().Add(-time.Hour),
+	}
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "web", result.Deleted[0].Name)
+	require.Equal(t, "Cordoned", result.Deleted[0].Reason)
+	require.Len(t, result.Skipped, 4)
+
+	// node2 is no longer cordoned, so it is forgotten
+	_, ok := c.cordoned.cordonedFor("node2", time.Now())
+	require.False(t, ok)
+	_, ok = c.cordoned.cordonedFor("node1", time.Now())
+	require.True(t, ok)
+
+	_, err = New(client, client, WithCordonedNodes(nodes, -time.Minute))
+	require.Error(t, err)
+}
+
+type testForceDeleter struct {
+	deleted []string
+}
+
+func (f *testForceDeleter) ForceDeletePod(namespace string, name string) error {
+	f.deleted = append(f.deleted, name)
+	return nil
+}
+
+func TestControllerNodeNotReady(t *testing.T) {
+	onNode := func(pod v1.Pod, node string) v1.Pod {
+		pod.Spec.NodeName = node
+		return pod
+	}
+	node := func(name string, status v1.ConditionStatus, since time.Duration) v1.Node {
+		return v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{
+					Type:               v1.NodeReady,
+					Status:             status,
+					LastTransitionTime: metav1.Time{Time: time.Now().Add(-since)},
+				}},
+			},
+		}
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		onNode(makePod(time.Hour, "default", "running", v1.PodRunning, "Running", ""), "lost"),
+		onNode(makePod(time.Hour, "default", "unknown", v1.PodUnknown, "Running", ""), "lost"),
+		onNode(makePod(time.Hour, "default", "crashing", v1.PodRunning, "Terminated", "Error"), "lost"),
+		onNode(makePod(time.Hour, "default", "recent", v1.PodRunning, "Running", ""), "flapping"),
+		onNode(makePod(time.Hour, "default", "ready", v1.PodRunning, "Running", ""), "ready"),
+	}
+
+	nodes := &testNodeLister{
+		nodes: []v1.Node{
+			node("lost", v1.ConditionUnknown, time.Hour),
+			node("flapping", v1.ConditionFalse, time.Minute),
+			node("ready", v1.ConditionTrue, time.Hour),
+		},
+	}
+	force := &testForceDeleter{}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithNodeNotReady(nodes, time.Minute*10, force),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	for _, d := range result.Deleted {
+		require.Equal(t, ForceDeleteActionName, d.Action)
+	}
+	require.Equal(t, "NodeNotReady", result.Deleted[0].Reason)
+	require.Equal(t, "NodeNotReady", result.Deleted[1].Reason)
+	require.Equal(t, "Error", result.Deleted[2].Reason)
+	require.Equal(t, []string{"running", "unknown", "crashing"}, force.deleted)
+	require.Len(t, result.Skipped, 2)
+	// nothing was deleted normally
+	require.Equal(t, 5, client.lenPods())
+
+	// without force, the rule's action is used
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithNodeNotReady(nodes, time.Minute*10, nil),
+		WithDryRun(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	require.Equal(t, "deleted", result.Deleted[0].Action)
+}
+
+func TestControllerTerminating(t *testing.T) {
+	terminating := func(pod v1.Pod, node string) v1.Pod {
+		pod.Spec.NodeName = node
+		pod.ObjectMeta.DeletionTimestamp = &metav1.Time{Time: time.Now().Add(-time.Minute)}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		terminating(makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"), "ready"),
+		terminating(makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"), "lost"),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	nodes := &testNodeLister{
+		nodes: []v1.Node{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "lost"},
+				Status: v1.NodeStatus{
+					Conditions: []v1.NodeCondition{{
+						Type:               v1.NodeReady,
+						Status:             v1.ConditionUnknown,
+						LastTransitionTime: metav1.Time{Time: time.Now().Add(-time.Hour)},
+					}},
+				},
+			},
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "pod2", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, TerminatingSkip, result.Skipped[0].Skip)
+	require.Equal(t, 2, result.Terminating)
+	require.Equal(t, 2.0, testutil.ToFloat64(c.counters.terminating.WithLabelValues("default", "true")))
+
+	// pods on lost nodes never finish terminating, so are force deleted
+	force := &testForceDeleter{}
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithNodeNotReady(nodes, time.Minute*10, force),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, 1, result.Terminating)
+	require.Equal(t, []string{"pod1"}, force.deleted)
+}
+
+func TestControllerUnknownPhase(t *testing.T) {
+	lostFor := func(pod v1.Pod, d time.Duration) v1.Pod {
+		pod.Status.Conditions = []v1.PodCondition{{
+			Type:               v1.PodReady,
+			Status:             v1.ConditionFalse,
+			LastTransitionTime: metav1.Time{Time: time.Now().Add(-d)},
+		}}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		lostFor(makePod(time.Hour*24, "default", "lost", v1.PodUnknown, "Running", ""), time.Hour),
+		lostFor(makePod(time.Hour*24, "default", "crashing", v1.PodUnknown, "Waiting", "CrashLoopBackOff"), time.Hour),
+		lostFor(makePod(time.Hour*24, "default", "recent", v1.PodUnknown, "Running", ""), time.Minute),
+		// without a Ready condition, the creation time is used
+		makePod(time.Hour, "default", "old", v1.PodUnknown, "Running", ""),
+		makePod(time.Minute*20, "default", "new", v1.PodUnknown, "Running", ""),
+		makePod(time.Hour, "default", "running", v1.PodRunning, "Running", ""),
+	}
+	excluded := lostFor(makePod(time.Hour*24, "default", "excluded", v1.PodUnknown, "Running", ""), time.Hour)
+	excluded.Spec.ServiceAccountName = "storage"
+	client.pods = append(client.pods, excluded)
+
+	force := &testForceDeleter{}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithUnknownPhase(time.Minute*30, force),
+		WithExcludeServiceAccounts([]string{"storage"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	for _, d := range result.Deleted {
+		require.Equal(t, "UnknownPhase", d.Reason)
+		require.Equal(t, ForceDeleteActionName, d.Action)
+	}
+	require.Equal(t, []string{"lost", "crashing", "old"}, force.deleted)
+	require.Equal(t, 7, client.lenPods())
+
+	// without force, the rule's action is used
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithUnknownPhase(time.Minute*30, nil),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 4)
+	require.Equal(t, "deleted", result.Deleted[0].Action)
+	require.Equal(t, 3, client.lenPods())
+
+	_, err = New(client, client, WithUnknownPhase(-time.Minute, nil))
+	require.Error(t, err)
+}
+
+func TestControllerPhases(t *testing.T) {
+	pods := []v1.Pod{
+		makePod(time.Hour, "default", "pending", v1.PodPending, "Waiting", "ImagePullBackOff"),
+		makePod(time.Hour, "default", "running", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour, "default", "failed", v1.PodFailed, "Terminated", "Error"),
+	}
+	reasons := []string{"ImagePullBackOff", "CrashLoopBackOff", "Error"}
+
+	tests := []struct {
+		name     string
+		phases   []string
+		expected []string
+	}{
+		{
+			name:     "default",
+			expected: []string{"running", "failed"},
+		},
+		{
+			name:     "pending",
+			phases:   []string{"Pending", "Running"},
+			expected: []string{"pending", "running"},
+		},
+		{
+			name:     "failed",
+			phases:   []string{"Failed"},
+			expected: []string{"failed"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			client := &testClient{pods: append([]v1.Pod(nil), pods...)}
+			c, err := New(client, client,
+				WithReasons(reasons),
+				WithPhases(test.phases),
+				WithLogger(zap.NewNop()),
+			)
+			require.NoError(t, err)
+
+			result, err := c.Run(context.Background())
+			require.NoError(t, err)
+
+			var deleted []string
+			for _, d := range result.Deleted {
+				deleted = append(deleted, d.Name)
+			}
+			require.Equal(t, test.expected, deleted)
+		})
+	}
+
+	_, err := New(&testClient{}, &testClient{}, WithPhases([]string{"running"}))
+	require.Error(t, err)
+}
+
+func TestControllerOrphanedPods(t *testing.T) {
+	onNode := func(pod v1.Pod, node string) v1.Pod {
+		pod.Spec.NodeName = node
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		onNode(makePod(time.Hour, "default", "orphan", v1.PodRunning, "Running", ""), "gone"),
+		onNode(makePod(time.Hour, "default", "new", v1.PodRunning, "Running", ""), "removed"),
+		onNode(makePod(time.Hour, "default", "ok", v1.PodRunning, "Running", ""), "node0"),
+		makePod(time.Hour, "default", "unscheduled", v1.PodPending, "", ""),
+	}
+
+	nodes := &testNodeLister{
+		nodes: []v1.Node{
+			{ObjectMeta: metav1.ObjectMeta{Name: "node0"}},
+		},
+	}
+	force := &testForceDeleter{}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithOrphanedPods(nodes, time.Minute*10, force),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// gone has been missing since before the grace period, and an old
+	// node that is no longer referenced is forgotten
+	c.orphans.missing = map[string]time.Time{
+		"gone": time.Now().Add(-time.Hour),
+		"old":  time.Now().Add(-time.Hour),
+	}
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "orphan", result.Deleted[0].Name)
+	require.Equal(t, "NodeMissing", result.Deleted[0].Reason)
+	require.Equal(t, ForceDeleteActionName, result.Deleted[0].Action)
+	require.Equal(t, []string{"orphan"}, force.deleted)
+	require.Len(t, result.Skipped, 3)
+
+	require.Contains(t, c.orphans.missing, "removed")
+	require.NotContains(t, c.orphans.missing, "old")
+
+	_, err = New(client, client, WithOrphanedPods(nodes, -time.Minute, nil))
+	require.Error(t, err)
+}
+
+func TestControllerExplain(t *testing.T) {
+	client := &testClient{}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithRules([]Rule{
+			{Name: "web", Selector: "app=web", Reasons: []string{"Error"}},
+			{Name: "default", Namespace: "default"},
+		}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	pod := makePod(time.Hour, "default", "pod0", v1.PodRunning, "Waiting", "CrashLoopBackOff")
+	e, err := c.Explain(pod)
+	require.NoError(t, err)
+	require.True(t, e.Matched())
+	require.Equal(t, "default", e.Rule)
+	require.Equal(t, "CrashLoopBackOff", e.Reason)
+	require.Equal(t, DeleteActionName, e.Action)
+	require.Len(t, e.Rules, 2)
+	require.Equal(t, "Selector", e.Rules[0].Skip)
+	require.Equal(t, "CrashLoopBackOff", e.Rules[1].Reason)
+
+	young := makePod(time.Minute, "default", "pod1", v1.PodRunning, "Waiting", "CrashLoopBackOff")
+	young.ObjectMeta.Labels = map[string]string{"app": "web"}
+	e, err = c.Explain(young)
+	require.NoError(t, err)
+	require.False(t, e.Matched())
+	require.Equal(t, "CreationTimestamp", e.Rules[0].Skip)
+	require.Equal(t, "CreationTimestamp", e.Rules[1].Skip)
+
+	var checks []string
+	for _, step := range e.Rules[0].Steps {
+		if step.Verdict != "continue" {
+			checks = append(checks, step.Check)
+		}
+	}
+	require.Equal(t, []string{"grace period"}, checks)
+
+	running := makePod(time.Hour, "default", "pod2", v1.PodRunning, "Running", "")
+	e, err = c.Explain(running)
+	require.NoError(t, err)
+	require.False(t, e.Matched())
+	steps := e.Rules[1].Steps
+	require.Equal(t, Step{Check: "reasons", Verdict: "skip", Reason: "Reason"}, steps[7])
+}
+
+func TestControllerExplainLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zap.InfoLevel,
+	))
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Minute, "default", "young", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour, "default", "running", v1.PodRunning, "Running", ""),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithExplain(true),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+
+	var skips []map[string]string
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &entry))
+		if entry["msg"] != "pod skipped by rule" {
+			continue
+		}
+		skips = append(skips, map[string]string{
+			"name":    entry["name"].(string),
+			"skip":    entry["skip"].(string),
+			"setting": entry["setting"].(string),
+		})
+	}
+
+	require.Equal(t, []map[string]string{
+		{"name": "young", "skip": "CreationTimestamp", "setting": "grace=5m0s"},
+		{"name": "running", "skip": "Reason", "setting": "reasons=CrashLoopBackOff,Error"},
+	}, skips)
+}
+
+func TestControllerSummaryLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zap.InfoLevel,
+	))
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Minute, "default", "young", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour, "default", "running", v1.PodRunning, "Running", ""),
+		makePod(time.Hour, "default", "pending", v1.PodPending, "", ""),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithBudget(1, time.Hour),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+
+	var summary map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &entry))
+		if entry["msg"] == "run finished" {
+			require.Nil(t, summary, "more than one summary")
+			summary = entry
+		}
+	}
+	require.NotNil(t, summary)
+
+	require.Equal(t, float64(5), summary["evaluated"])
+	require.Equal(t, float64(2), summary["candidates"])
+	require.Equal(t, float64(1), summary["deleted"])
+	require.Equal(t, float64(4), summary["skipped"])
+	require.Equal(t, float64(0), summary["errors"])
+	require.Equal(t, map[string]interface{}{
+		"Budget":            float64(1),
+		"CreationTimestamp": float64(1),
+		"Reason":            float64(1),
+		"PodPhase":          float64(1),
+	}, summary["skipReasons"])
+	require.Contains(t, summary, "duration")
+}
+
+func TestControllerDeletionLogging(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zap.InfoLevel,
+	))
+
+	pod := makePod(time.Hour, "default", "web-1", v1.PodRunning, "Waiting", "CrashLoopBackOff")
+	pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "web-1234", Controller: &[]bool{true}[0]},
+	}
+	pod.Spec.NodeName = "node-1"
+	pod.Status.ContainerStatuses[0].Name = "app"
+	pod.Status.ContainerStatuses[0].RestartCount = 7
+
+	client := &testClient{pods: []v1.Pod{pod}}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+
+	var deleting map[string]interface{}
+	for _, line := range bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n")) {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &entry))
+		if entry["msg"] == "deleting pod" {
+			deleting = entry
+		}
+	}
+	require.NotNil(t, deleting)
+
+	require.Equal(t, "CrashLoopBackOff", deleting["Reason"])
+	require.Equal(t, "ReplicaSet/web-1234", deleting["owner"])
+	require.Equal(t, "node-1", deleting["node"])
+	require.Equal(t, "app", deleting["container"])
+	require.Equal(t, float64(7), deleting["restarts"])
+	require.InDelta(t, time.Hour.Seconds(), deleting["age"], 60)
+}
+
+func TestControllerRunID(t *testing.T) {
+	var buf bytes.Buffer
+	logger := zap.New(zapcore.NewCore(
+		zapcore.NewJSONEncoder(zap.NewProductionEncoderConfig()),
+		zapcore.AddSync(&buf),
+		zap.InfoLevel,
+	))
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour, "default", "running", v1.PodRunning, "Running", ""),
+	}
+
+	var hooked []string
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithExplain(true),
+		WithHooks(Hooks{
+			OnDelete: func(cand Candidate) {
+				hooked = append(hooked, cand.RunID)
+			},
+		}),
+		WithLogger(logger),
+	)
+	require.NoError(t, err)
+
+	first, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.NotEmpty(t, first.ID)
+	require.Equal(t, first.ID, c.LastRun().ID)
+	require.Equal(t, []string{first.ID}, hooked)
+	require.Equal(t, first.ID, first.Deleted[0].RunID)
+	require.Equal(t, first.ID, first.Skipped[0].RunID)
+
+	// every entry logged during the run has its ID
+	lines := bytes.Split(bytes.TrimSpace(buf.Bytes()), []byte("\n"))
+	require.True(t, len(lines) >= 3)
+	for _, line := range lines {
+		var entry map[string]interface{}
+		require.NoError(t, json.Unmarshal(line, &entry))
+		require.Equal(t, first.ID, entry["runID"], string(line))
+	}
+
+	second, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.NotEqual(t, first.ID, second.ID)
+}
+
+func TestControllerPlan(t *testing.T) {
+	pod := func(name string, reason string) v1.Pod {
+		p := makePod(time.Hour, "default", name, v1.PodRunning, "Waiting", reason)
+		p.ObjectMeta.UID = types.UID(name)
+		return p
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		pod("pod0", "CrashLoopBackOff"),
+		pod("pod1", "CrashLoopBackOff"),
+		pod("pod2", "CrashLoopBackOff"),
+		pod("pod3", "ContainerCreating"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	plan, err := c.Plan()
+	require.NoError(t, err)
+	require.Len(t, plan.Items, 3)
+	require.Equal(t, types.UID("pod0"), plan.Items[0].UID)
+	require.Equal(t, "CrashLoopBackOff", plan.Items[0].Reason)
+	require.Equal(t, DeleteActionName, plan.Items[0].Action)
+
+	// pod1 is replaced and pod2 is deleted after planning, and pod3 is
+	// failing now but was not planned
+	client.pods[1].ObjectMeta.UID = "new"
+	require.NoError(t, client.DeletePod("default", "pod2"))
+	client.pods = append(client.pods, pod("pod4", "CrashLoopBackOff"))
+
+	result, err := c.Apply(context.Background(), plan, client)
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "pod0", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "UIDChanged", result.Skipped[0].Skip)
+	require.Equal(t, "NotFound", result.Skipped[1].Skip)
+
+	var names []string
+	for _, p := range client.pods {
+		names = append(names, p.ObjectMeta.Name)
+	}
+	require.Equal(t, []string{"pod1", "pod3", "pod4"}, names)
+
+	plan.Items[0].Rule = "missing"
+	_, err = c.Apply(context.Background(), plan, client)
+	require.Error(t, err)
+}
+
+func TestControllerCandidates(t *testing.T) {
+	isController := true
+	owned := makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error")
+	owned.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "web-1234", Controller: &isController},
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned,
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Running", ""),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	candidates, err := c.Candidates()
+	require.NoError(t, err)
+	require.Len(t, candidates, 2)
+	require.Equal(t, "Error", candidates[0].Reason)
+	require.Equal(t, "ReplicaSet/web-1234", candidates[0].Owner())
+	require.Equal(t, "CrashLoopBackOff", candidates[1].Reason)
+	require.Equal(t, "", candidates[1].Owner())
+
+	// nothing is deleted
+	require.Equal(t, 3, client.lenPods())
+}
+
+func TestRunResult(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Running", ""),
+		makePod(time.Hour, "default", "pod2", v1.PodPending, "Waiting", "ContainerCreating"),
+		makePod(time.Minute, "default", "pod3", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+	require.Nil(t, c.LastResult())
+
+	report, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, report, c.LastResult())
+	require.True(t, report.DryRun)
+	require.Len(t, report.Deleted, 1)
+	require.Equal(t, "pod0", report.Deleted[0].Name)
+	require.Equal(t, "Error", report.Deleted[0].Reason)
+
+	require.Len(t, report.Skipped, 3)
+	require.Equal(t, "Reason", report.Skipped[0].Skip)
+	require.Equal(t, "PodPhase", report.Skipped[1].Skip)
+	require.Equal(t, "Pending", report.Skipped[1].Detail)
+	require.Equal(t, "CreationTimestamp", report.Skipped[2].Skip)
+
+	// nothing is deleted
+	require.Equal(t, 4, client.lenPods())
+}
+
+type testSink struct {
+	counts  map[string]int64
+	timings int
+}
+
+func (s *testSink) Count(name string, value int64, tags map[string]string) {
+	key := name
+	for _, k := range []string{"namespace", "action", "reason", "owner_kind", "dry_run"} {
+		if v, ok := tags[k]; ok {
+			key += "," + k + "=" + v
+		}
+	}
+	s.counts[key] += value
+}
+
+func (s *testSink) Timing(name string, d time.Duration, tags map[string]string) {
+	s.timings++
+}
+
+func TestMetricsSink(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Running", ""),
+		makePod(time.Minute, "default", "pod3", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	sink := &testSink{counts: make(map[string]int64)}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithMetricsSink(sink),
+	)
+	require.NoError(t, err)
+
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+
+	require.Equal(t, 1, sink.timings)
+	require.Equal(t, map[string]int64{
+		"deleted,namespace=default,action=deleted,reason=Error,dry_run=false":            1,
+		"deleted,namespace=default,action=deleted,reason=CrashLoopBackOff,dry_run=false": 1,
+		"skipped,namespace=default,reason=Reason,dry_run=false":                          1,
+		"skipped,namespace=default,reason=CreationTimestamp,dry_run=false":               1,
+	}, sink.counts)
+}
+
+type testPublisher struct {
+	statuses []RunStatus
+}
+
+func (p *testPublisher) Publish(s RunStatus) error {
+	p.statuses = append(p.statuses, s)
+	return nil
+}
+
+func TestControllerStatusPublisher(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Running", ""),
+	}
+
+	p := &testPublisher{}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithStatusPublisher(p),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Len(t, p.statuses, 1)
+	require.Equal(t, 2, p.statuses[0].Evaluated)
+	require.Equal(t, 1, p.statuses[0].Deleted)
+	require.Equal(t, 1, p.statuses[0].Skipped)
+}
+
+func TestControllerCounters(t *testing.T) {
+	owned := func(name string, reason string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", reason)
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: "web-1234", Controller: &[]bool{true}[0]},
+		}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned("pod0", "Error"),
+		owned("pod1", "Error"),
+		makePod(time.Hour, "batch", "pod2", v1.PodRunning, "Terminated", "OOMKilled"),
+		makePod(time.Hour, "batch", "pod3", v1.PodRunning, "Running", ""),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithReasons([]string{"Error", "OOMKilled"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+
+	require.Equal(t, 2.0, testutil.ToFloat64(c.counters.deleted.WithLabelValues("default", "Error", "ReplicaSet", "deleted", "false")))
+	require.Equal(t, 1.0, testutil.ToFloat64(c.counters.deleted.WithLabelValues("batch", "OOMKilled", "", "deleted", "false")))
+	require.Equal(t, 1.0, testutil.ToFloat64(c.counters.skipped.WithLabelValues("batch", "Reason", "false")))
+
+	require.Equal(t, uint64(1), sampleCount(t, c, "pod_deleter_run_duration_seconds"))
+	require.Equal(t, uint64(1), sampleCount(t, c, "pod_deleter_list_duration_seconds"))
+	require.Equal(t, uint64(3), sampleCount(t, c, "pod_deleter_delete_duration_seconds"))
+
+	report := c.LastResult()
+	require.Equal(t, "ReplicaSet/web-1234", report.Deleted[0].Owner)
+}
+
+// sampleCount returns the number of observations of the named histogram
+func sampleCount(t *testing.T, c prometheus.Collector, name string) uint64 {
+	reg := prometheus.NewRegistry()
+	require.NoError(t, reg.Register(c))
+	families, err := reg.Gather()
+	require.NoError(t, err)
+
+	var n uint64
+	for _, f := range families {
+		if f.GetName() != name {
+			continue
+		}
+		for _, m := range f.GetMetric() {
+			n += m.GetHistogram().GetSampleCount()
+		}
+	}
+	return n
+}
+
+// everySchedule runs every d and counts how many times it was asked
+type everySchedule struct {
+	d     time.Duration
+	calls int32
+}
+
+func (s *everySchedule) Next(t time.Time) time.Time {
+	atomic.AddInt32(&s.calls, 1)
+	return t.Add(s.d)
+}
+
+func TestControllerSchedule(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	s := &everySchedule{d: time.Millisecond * 10}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithSchedule(s),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Loop()
+	}()
+
+	// the schedule is asked for the next run after each run
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&s.calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	require.True(t, atomic.LoadInt32(&s.calls) >= 3)
+
+	stopLoop(t, c, done)
+	require.Equal(t, 0, client.lenPods())
+}
+
+func TestControllerLoopErrors(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	s := &everySchedule{d: time.Millisecond * 10}
+	c, err := New(client, &failingDeleter{testClient: client, name: "pod0"},
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithSchedule(s),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Loop()
+	}()
+
+	// a pod that cannot be deleted does not stop the loop
+	deadline := time.Now().Add(time.Second)
+	for atomic.LoadInt32(&s.calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	require.True(t, atomic.LoadInt32(&s.calls) >= 3)
+	require.Equal(t, 1, c.LastRun().Errors)
+	stopLoop(t, c, done)
+
+	// nor do pods that cannot be listed
+	s = &everySchedule{d: time.Millisecond * 10}
+	c, err = New(&flakyLister{testClient: client, failures: 1000}, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithRetry(1, time.Millisecond, time.Millisecond),
+		WithSchedule(s),
+	)
+	require.NoError(t, err)
+
+	go func() {
+		done <- c.Loop()
+	}()
+
+	deadline = time.Now().Add(time.Second)
+	for atomic.LoadInt32(&s.calls) < 3 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	require.True(t, atomic.LoadInt32(&s.calls) >= 3)
+	require.NotEmpty(t, c.LastRun().Error)
+	stopLoop(t, c, done)
+}
+
+// stopLoop stops the loop and waits for it to return
+func stopLoop(t *testing.T, c *Controller, done chan error) {
+	c.Stop()
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(time.Second):
+		t.Fatal("loop did not stop")
+	}
+}
+
+func TestControllerPause(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	c.Pause()
+	require.True(t, c.Paused())
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.True(t, result.Paused)
+	require.True(t, result.DryRun)
+	require.Len(t, result.Deleted, 1)
+	require.True(t, result.Deleted[0].DryRun)
+	require.Equal(t, 1, client.lenPods())
+
+	c.Resume()
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.False(t, result.Paused)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, 0, client.lenPods())
+}
+
+func TestControllerKillSwitch(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	control := func(data map[string]string) *v1.ConfigMap {
+		return &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{Namespace: "pod-deleter", Name: "pod-deleter-control"},
+			Data:       data,
+		}
+	}
+
+	c.SetControl(control(map[string]string{ControlEnabledKey: "false"}))
+	require.True(t, c.Disabled())
+
+	// resuming a paused controller does not override the kill switch
+	c.Resume()
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.True(t, result.Disabled)
+	require.True(t, result.DryRun)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, 1, client.lenPods())
+
+	// values that are not booleans keep it disabled
+	c.SetControl(control(map[string]string{ControlEnabledKey: "nope"}))
+	require.True(t, c.Disabled())
+
+	c.SetControl(control(map[string]string{ControlEnabledKey: "true"}))
+	require.False(t, c.Disabled())
+
+	c.SetControl(control(map[string]string{ControlEnabledKey: "false"}))
+	require.True(t, c.Disabled())
+
+	// deleting the ConfigMap enables it
+	c.SetControl(nil)
+	require.False(t, c.Disabled())
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.False(t, result.Disabled)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, 0, client.lenPods())
+}
+
+func TestControllerTrigger(t *testing.T) {
+	client := &testClient{}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithInterval(time.Hour),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Loop()
+	}()
+
+	// wait for the first run
+	deadline := time.Now().Add(time.Second)
+	for c.LastRun().Time.IsZero() && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	first := c.LastRun().Time
+	require.False(t, first.IsZero())
+
+	c.Trigger()
+	for c.LastRun().Time.Equal(first) && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 5)
+	}
+	require.True(t, c.LastRun().Time.After(first))
+	stopLoop(t, c, done)
+}
+
+func TestControllerSharedHistory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "history.json")
+
+	// two replicas share one history and a budget of one deletion
+	newReplica := func(client *testClient) *Controller {
+		store, err := history.New(history.FileBackend(path), time.Hour)
+		require.NoError(t, err)
+		c, err := New(client, client,
+			WithGrace(time.Minute*5),
+			WithLogger(zap.NewNop()),
+			WithBudget(1, time.Hour),
+			WithHistory(store),
+		)
+		require.NoError(t, err)
+		return c
+	}
+
+	client1 := &testClient{pods: []v1.Pod{makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error")}}
+	client2 := &testClient{pods: []v1.Pod{makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error")}}
+	c1, c2 := newReplica(client1), newReplica(client2)
+
+	result, err := c1.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+
+	// the second replica sees the deletion of the first
+	result, err = c2.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Deleted)
+	require.Equal(t, "Budget", result.Skipped[0].Skip)
+	require.Equal(t, 1, client2.lenPods())
+}
+
+func TestControllerHistory(t *testing.T) {
+	store, err := history.New(nil, time.Hour)
+	require.NoError(t, err)
+
+	// a previous process deleted two pods of the same workload
+	now := time.Now()
+	for i := 0; i < 2; i++ {
+		require.NoError(t, store.Record(history.Deletion{
+			Time:      now.Add(-time.Minute),
+			Namespace: "default",
+			Name:      fmt.Sprintf("old%d", i),
+			Owner:     "ReplicaSet/web",
+		}))
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+	isController := true
+	client.pods[0].ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "web", Controller: &isController},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithBudget(3, time.Hour),
+		WithFlapDetection(2, time.Hour),
+		WithHistory(store),
+	)
+	require.NoError(t, err)
+	require.Equal(t, 2, c.Budget().Used)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+
+	// pod0 is skipped as its workload is flapping
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "pod1", result.Deleted[0].Name)
+	require.Equal(t, "Flapping", result.Skipped[0].Skip)
+
+	deletions := c.History(now)
+	require.Len(t, deletions, 1)
+	require.Equal(t, "pod1", deletions[0].Name)
+}
+
+type failingDeleter struct {
+	*testClient
+	name string
+}
+
+func (f *failingDeleter) DeletePod(namespace string, name string) error {
+	if name == f.name {
+		return fmt.Errorf("failed to delete %s", name)
+	}
+	return f.testClient.DeletePod(namespace, name)
+}
+
+func TestRunErrors(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, &failingDeleter{testClient: client, name: "pod0"},
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// a failed deletion does not stop the run
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "pod1", result.Deleted[0].Name)
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, "pod0", result.Errors[0].Name)
+	require.Error(t, result.Err())
+
+	run := c.LastRun()
+	require.Equal(t, 1, run.Deleted)
+	require.Equal(t, 1, run.Errors)
+	require.Empty(t, run.Error)
+
+	require.Error(t, c.Once(context.Background()))
+
+	// the second failure is not reached
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+	c, err = New(client, &failingDeleter{testClient: client, name: "pod0"},
+		WithGrace(time.Minute*5),
+		WithFailFast(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Errors, 1)
+	require.Len(t, result.Deleted, 0)
+	require.Equal(t, 2, client.lenPods())
+}
+
+func TestHooks(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	var deleted, skipped, failed []string
+	c, err := New(client, &failingDeleter{testClient: client, name: "pod2"},
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithHooks(Hooks{
+			BeforeDelete: func(cand Candidate) error {
+				if cand.Pod.ObjectMeta.Name == "pod0" {
+					return fmt.Errorf("not today")
+				}
+				return nil
+			},
+			OnDelete: func(cand Candidate) {
+				deleted = append(deleted, cand.Pod.ObjectMeta.Name)
+			},
+			OnSkip: func(cand Candidate, reason string) {
+				skipped = append(skipped, cand.Pod.ObjectMeta.Name+":"+reason)
+			},
+			OnError: func(cand Candidate, err error) {
+				failed = append(failed, cand.Pod.ObjectMeta.Name)
+			},
+		}),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"pod1"}, deleted)
+	require.Equal(t, []string{"pod0:Vetoed"}, skipped)
+	require.Equal(t, []string{"pod2"}, failed)
+	require.Equal(t, "not today", result.Skipped[0].Detail)
+	require.Equal(t, 2, client.lenPods())
+}
+
+func TestEvalCache(t *testing.T) {
+	pod := makePod(time.Hour, "default", "pod0", v1.PodRunning, "Running", "")
+	pod.ObjectMeta.ResourceVersion = "1"
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		pod,
+		makePod(time.Minute, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.NoError(t, c.Once(context.Background()))
+
+	// pod1 is too young to be cached
+	hits, misses := c.cacheStats.get()
+	require.Equal(t, uint64(1), hits)
+	require.Equal(t, uint64(3), misses)
+
+	// a new resourceVersion invalidates the entry
+	pod = makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error")
+	pod.ObjectMeta.ResourceVersion = "2"
+	client.pods[0] = pod
+
+	require.NoError(t, c.Once(context.Background()))
+	hits, misses = c.cacheStats.get()
+	require.Equal(t, uint64(1), hits)
+	require.Equal(t, uint64(5), misses)
+	require.Equal(t, 1, client.lenPods())
+
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithEvalCache(false),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	hits, misses = c.cacheStats.get()
+	require.Equal(t, uint64(0), hits)
+	require.Equal(t, uint64(0), misses)
+}
+
+func TestControllerRestartRate(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Running", ""),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Running", ""),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithRestartRate(6),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// the first run has nothing to compare against
+	client.pods[0].Status.ContainerStatuses[0].RestartCount = 3
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 2, client.lenPods())
+
+	client.pods[0].Status.ContainerStatuses[0].RestartCount = 10
+	client.pods[1].Status.ContainerStatuses[0].RestartCount = 2
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+	require.Equal(t, "pod1", client.pods[0].ObjectMeta.Name)
+
+	report := c.LastResult()
+	require.Len(t, report.Deleted, 1)
+	require.Equal(t, "RestartRate", report.Deleted[0].Reason)
+
+	_, err = New(client, client, WithRestartRate(-1))
+	require.Error(t, err)
+}
+
+func TestControllerRestartThreshold(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Running", ""),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Running", ""),
+	}
+
+	store, err := history.New(nil, time.Hour)
+	require.NoError(t, err)
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithRestartThreshold(5, time.Minute*30),
+		WithHistory(store),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// many restarts before the controller first saw the pod do not count
+	client.pods[0].Status.ContainerStatuses[0].RestartCount = 100
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 2, client.lenPods())
+
+	client.pods[0].Status.ContainerStatuses[0].RestartCount = 102
+	client.pods[1].Status.ContainerStatuses[0].RestartCount = 1
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 2, client.lenPods())
+	require.NotEmpty(t, store.Restarts())
+
+	// a new controller continues from the restart counts in the history
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithRestartThreshold(5, time.Minute*30),
+		WithHistory(store),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	client.pods[0].Status.ContainerStatuses[0].RestartCount = 106
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 1, client.lenPods())
+	require.Equal(t, "pod1", client.pods[0].ObjectMeta.Name)
+
+	report := c.LastResult()
+	require.Len(t, report.Deleted, 1)
+	require.Equal(t, "Restarts", report.Deleted[0].Reason)
+
+	_, err = New(client, client, WithRestartThreshold(-1, time.Minute))
+	require.Error(t, err)
+	_, err = New(client, client, WithRestartThreshold(5, 0))
+	require.Error(t, err)
+}
+
+func TestControllerOrder(t *testing.T) {
+	failed := func(name string, restarts int32, finished time.Duration) v1.Pod {
+		pod := makePod(time.Hour*2, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.Status.ContainerStatuses[0].RestartCount = restarts
+		pod.Status.ContainerStatuses[0].State.Terminated.FinishedAt = metav1.Time{Time: time.Now().Add(-finished)}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		failed("pod0", 1, time.Minute*10),
+		failed("pod1", 5, time.Minute*30),
+		failed("pod2", 5, time.Minute*90),
+		failed("pod3", 2, time.Minute*60),
+	}
+
+	tests := []struct {
+		order    string
+		expected []string
+	}{
+		{"", []string{"pod0", "pod1", "pod2", "pod3"}},
+		{OrderRestarts, []string{"pod1", "pod2", "pod3", "pod0"}},
+		{OrderOldestFailure, []string{"pod2", "pod3", "pod1", "pod0"}},
+	}
+
+	for _, test := range tests {
+		c, err := New(client, client,
+			WithGrace(time.Minute*5),
+			WithOrder(test.order),
+			WithLogger(zap.NewNop()),
+		)
+		require.NoError(t, err)
+
+		candidates, err := c.Candidates()
+		require.NoError(t, err)
+
+		var names []string
+		for _, cand := range candidates {
+			names = append(names, cand.Pod.ObjectMeta.Name)
+		}
+		require.Equal(t, test.expected, names, test.order)
+	}
+
+	_, err := New(client, client, WithOrder("random"))
+	require.Error(t, err)
+}
+
+func TestImagePattern(t *testing.T) {
+	tests := []struct {
+		pattern string
+		image   string
+		match   bool
+	}{
+		{"*/database:*", "registry.example.com/team/database:1.2", true},
+		{"*/database:*", "registry.example.com/team/web:1.2", false},
+		{"registry.example.com/*", "registry.example.com/team/web:1.2", true},
+		{"registry.example.com/*", "docker.io/library/busybox", false},
+		{"registry.example.com/payments/*", "registry.example.com/payments/api:1.2", true},
+		{"registry.example.com/payments/*", "registry.example.com/payments-legacy/api:1.2", false},
+		{"busybox:1.?", "busybox:1.2", true},
+		{"regex:.*/(web|api):.*", "registry.example.com/team/api:1.2", true},
+		{"regex:.*/(web|api):.*", "registry.example.com/team/database:1.2", false},
+	}
+
+	for _, test := range tests {
+		re, err := ImagePattern(test.pattern)
+		require.NoError(t, err)
+		require.Equal(t, test.match, re.MatchString(test.image), "%s %s", test.pattern, test.image)
+	}
+
+	_, err := ImagePattern("regex:(")
+	require.Error(t, err)
+}
+
+func TestControllerImageFilters(t *testing.T) {
+	withImage := func(name string, image string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.Spec.Containers = []v1.Container{{Image: image}}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withImage("pod0", "registry.example.com/team/database:1.2"),
+		withImage("pod1", "registry.example.com/team/web:1.2"),
+		withImage("pod2", "docker.io/library/busybox"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithImageFilters([]string{"registry.example.com/*"}, []string{"*/database:*"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "pod1", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "ExcludedImage", result.Skipped[0].Skip)
+	require.Equal(t, "Image", result.Skipped[1].Skip)
+
+	_, err = New(client, client, WithImageFilters(nil, []string{"regex:("}))
+	require.Error(t, err)
+}
+
+func TestControllerFilters(t *testing.T) {
+	annotated := makePod(time.Hour, "default", "pod0", v1.PodRunning, "Running", "")
+	annotated.ObjectMeta.Annotations = map[string]string{"delete-me": "true"}
+	protected := makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error")
+	protected.ObjectMeta.Annotations = map[string]string{"protected": "true"}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		annotated,
+		protected,
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod3", v1.PodPending, "Waiting", "ContainerCreating"),
+	}
+	// built-in filters run first, so pending pods are never matched
+	client.pods[3].ObjectMeta.Annotations = map[string]string{"delete-me": "true"}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithFilters(
+			FilterFunc(func(pod v1.Pod) (Verdict, string) {
+				if pod.ObjectMeta.Annotations["protected"] == "true" {
+					return Skip, "Protected"
+				}
+				return Continue, ""
+			}),
+			FilterFunc(func(pod v1.Pod) (Verdict, string) {
+				if pod.ObjectMeta.Annotations["delete-me"] == "true" {
+					return Match, "Annotated"
+				}
+				return Continue, ""
+			}),
+		),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "Annotated", result.Deleted[0].Reason)
+	require.Equal(t, "Error", result.Deleted[1].Reason)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "Protected", result.Skipped[0].Skip)
+	require.Equal(t, "PodPhase", result.Skipped[1].Skip)
+}
+
+func TestControllerExcludeServiceAccounts(t *testing.T) {
+	withSA := func(namespace string, name string, sa string) v1.Pod {
+		pod := makePod(time.Hour, namespace, name, v1.PodRunning, "Terminated", "Error")
+		pod.Spec.ServiceAccountName = sa
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withSA("vault", "pod0", "vault"),
+		withSA("kube-system", "pod1", "cluster-autoscaler"),
+		withSA("default", "pod2", "cluster-autoscaler"),
+		withSA("default", "pod3", ""),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithExcludeServiceAccounts([]string{"vault", "kube-system/cluster-autoscaler"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "ServiceAccount", result.Skipped[0].Skip)
+	require.Equal(t, "vault/vault", result.Skipped[0].Detail)
+	require.Equal(t, "kube-system/cluster-autoscaler", result.Skipped[1].Detail)
+}
+
+func TestControllerExcludeSelector(t *testing.T) {
+	withTeam := func(name string, team string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.Labels = map[string]string{"team": team}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withTeam("pod0", "storage"),
+		withTeam("pod1", "web"),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithExcludeSelector("team=storage"),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "ExcludeSelector", result.Skipped[0].Skip)
+	require.Equal(t, "pod0", result.Skipped[0].Name)
+
+	_, err = New(client, client, WithExcludeSelector("team in (storage"))
+	require.Error(t, err)
+}
+
+func TestControllerAnnotationSelector(t *testing.T) {
+	withAnnotations := func(name string, annotations map[string]string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.Annotations = annotations
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withAnnotations("pod0", map[string]string{"deploy-tool": "spinnaker"}),
+		withAnnotations("pod1", map[string]string{"deploy-tool": "spinnaker", "debug": "true"}),
+		withAnnotations("pod2", map[string]string{"deploy-tool": "helm"}),
+		withAnnotations("pod3", nil),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithAnnotationSelector("deploy-tool=spinnaker,!debug"),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "pod0", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 3)
+	for _, d := range result.Skipped {
+		require.Equal(t, "AnnotationSelector", d.Skip)
+	}
+
+	_, err = New(client, client, WithAnnotationSelector("deploy-tool in (spinnaker"))
+	require.Error(t, err)
+}
+
+func TestControllerPriority(t *testing.T) {
+	withPriority := func(name string, class string, priority int32) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.Spec.PriorityClassName = class
+		pod.Spec.Priority = &priority
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withPriority("pod0", "system-cluster-critical", 2000000000),
+		withPriority("pod1", "batch", 100),
+		withPriority("pod2", "", 0),
+		withPriority("pod3", "web", 1000),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithMinProtectedPriority(2000000000),
+		WithPriorityClasses([]string{"batch", "web"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "pod1", result.Deleted[0].Name)
+	require.Equal(t, "pod3", result.Deleted[1].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "Priority", result.Skipped[0].Skip)
+	require.Equal(t, "2000000000", result.Skipped[0].Detail)
+	require.Equal(t, "PriorityClass", result.Skipped[1].Skip)
+}
+
+func TestControllerDisruptionAnnotations(t *testing.T) {
+	annotated := func(name string, annotations map[string]string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.Annotations = annotations
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		annotated("pod0", map[string]string{SafeToEvictAnnotation: "false"}),
+		annotated("pod1", map[string]string{SafeToEvictAnnotation: "true"}),
+		annotated("pod2", map[string]string{DoNotDisruptAnnotation: "true"}),
+		annotated("pod3", map[string]string{DoNotEvictAnnotation: "true"}),
+		annotated("pod4", nil),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "pod1", result.Deleted[0].Name)
+	require.Equal(t, "pod4", result.Deleted[1].Name)
+	require.Len(t, result.Skipped, 3)
+	require.Equal(t, "SafeToEvict", result.Skipped[0].Skip)
+	require.Equal(t, "DoNotDisrupt", result.Skipped[1].Skip)
+	require.Equal(t, DoNotDisruptAnnotation+"=true", result.Skipped[1].Detail)
+	require.Equal(t, DoNotEvictAnnotation+"=true", result.Skipped[2].Detail)
+
+	require.NoError(t, c.Reconfigure(WithIgnoreDisruptionAnnotations(true)))
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 5)
+}
+
+func TestControllerNotReady(t *testing.T) {
+	notReady := func(name string, since time.Duration) v1.Pod {
+		pod := makePod(time.Hour*3, "default", name, v1.PodRunning, "Running", "")
+		pod.Status.Conditions = []v1.PodCondition{{
+			Type:               v1.PodReady,
+			Status:             v1.ConditionFalse,
+			LastTransitionTime: metav1.Time{Time: time.Now().Add(-since)},
+		}}
+		return pod
+	}
+
+	ready := makePod(time.Hour*3, "default", "ready", v1.PodRunning, "Running", "")
+	ready.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		notReady("wedged", time.Hour*2),
+		notReady("recent", time.Minute*10),
+		// no conditions, so measured from creation
+		makePod(time.Hour*3, "default", "missing", v1.PodRunning, "Running", ""),
+		ready,
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithNotReadyTimeout(time.Hour),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "wedged", result.Deleted[0].Name)
+	require.Equal(t, "NotReady", result.Deleted[0].Reason)
+	require.Equal(t, "missing", result.Deleted[1].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "Reason", result.Skipped[0].Skip)
+
+	_, err = New(client, client, WithNotReadyTimeout(-time.Minute))
+	require.Error(t, err)
+}
+
+func TestControllerConditions(t *testing.T) {
+	withCondition := func(name string, phase v1.PodPhase, cond v1.PodCondition) v1.Pod {
+		pod := makePod(time.Hour*3, "default", name, phase, "Running", "")
+		pod.Status.Conditions = []v1.PodCondition{cond}
+		return pod
+	}
+
+	unschedulable := func(since time.Duration) v1.PodCondition {
+		return v1.PodCondition{
+			Type:               v1.PodScheduled,
+			Status:             v1.ConditionFalse,
+			Reason:             "Unschedulable",
+			LastTransitionTime: metav1.Time{Time: time.Now().Add(-since)},
+		}
+	}
+
+	excluded := withCondition("excluded", v1.PodPending, unschedulable(time.Hour*2))
+	excluded.Spec.ServiceAccountName = "vault"
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withCondition("stuck", v1.PodPending, unschedulable(time.Hour*2)),
+		withCondition("waiting", v1.PodPending, unschedulable(time.Minute)),
+		withCondition("target", v1.PodRunning, v1.PodCondition{Type: "DisruptionTarget", Status: v1.ConditionTrue}),
+		excluded,
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithExcludeServiceAccounts([]string{"vault"}),
+		WithConditions([]Condition{
+			{Type: "DisruptionTarget", Status: "True"},
+			{Type: "PodScheduled", Status: "False", Reason: "Unschedulable", For: time.Hour},
+		}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "stuck", result.Deleted[0].Name)
+	require.Equal(t, "PodScheduled=False/Unschedulable", result.Deleted[0].Reason)
+	require.Equal(t, "target", result.Deleted[1].Name)
+	require.Equal(t, "DisruptionTarget=True", result.Deleted[1].Reason)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "PodPhase", result.Skipped[0].Skip)
+	require.Equal(t, "PodPhase", result.Skipped[1].Skip)
+
+	_, err = New(client, client, WithConditions([]Condition{{Type: "Ready", Status: "maybe"}}))
+	require.Error(t, err)
+}
+
+type testEventLister struct {
+	events []v1.Event
+}
+
+func (l *testEventLister) ListPodWarnings(namespace string) ([]v1.Event, error) {
+	return l.events, nil
+}
+
+func TestControllerWarningEvents(t *testing.T) {
+	pod := func(name string, phase v1.PodPhase) v1.Pod {
+		p := makePod(time.Hour, "default", name, phase, "Running", "")
+		p.ObjectMeta.UID = types.UID(name)
+		return p
+	}
+	event := func(name string, reason string, count int32, age time.Duration) v1.Event {
+		return v1.Event{
+			InvolvedObject: v1.ObjectReference{Kind: "Pod", Namespace: "default", Name: name, UID: types.UID(name)},
+			Reason:         reason,
+			Type:           v1.EventTypeWarning,
+			Count:          count,
+			LastTimestamp:  metav1.Time{Time: time.Now().Add(-age)},
+		}
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		pod("mount", v1.PodPending),
+		pod("backoff", v1.PodRunning),
+		pod("old", v1.PodRunning),
+		pod("other", v1.PodRunning),
+	}
+
+	lister := &testEventLister{
+		events: []v1.Event{
+			event("mount", "FailedMount", 4, time.Minute),
+			event("mount", "FailedMount", 2, time.Minute*2),
+			event("backoff", "BackOff", 6, time.Minute),
+			event("backoff", "FailedMount", 1, time.Minute),
+			event("old", "BackOff", 10, time.Hour),
+			event("other", "Unhealthy", 10, time.Minute),
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithWarningEvents(lister, []string{"BackOff", "FailedMount"}, 5, time.Minute*10),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "mount", result.Deleted[0].Name)
+	require.Equal(t, "FailedMount", result.Deleted[0].Reason)
+	require.Equal(t, "backoff", result.Deleted[1].Name)
+	require.Equal(t, "BackOff", result.Deleted[1].Reason)
+	require.Len(t, result.Skipped, 2)
+
+	_, err = New(client, client, WithWarningEvents(lister, []string{"BackOff"}, 5, 0))
+	require.Error(t, err)
+}
+
+type testUsageLister struct {
+	usage map[string]map[string]v1.ResourceList
+	calls int
+}
+
+func (l *testUsageLister) ListPodUsage(namespace string) (map[string]map[string]v1.ResourceList, error) {
+	l.calls++
+	return l.usage, nil
+}
+
+func TestControllerResourceUsage(t *testing.T) {
+	pod := func(name string, limits v1.ResourceList) v1.Pod {
+		p := makePod(time.Hour, "default", name, v1.PodRunning, "Running", "")
+		p.Spec.Containers = []v1.Container{{
+			Name:      "app",
+			Resources: v1.ResourceRequirements{Limits: limits},
+		}}
+		return p
+	}
+	limits := v1.ResourceList{
+		v1.ResourceMemory: resource.MustParse("100Mi"),
+		v1.ResourceCPU:    resource.MustParse("500m"),
+	}
+	usage := func(memory, cpu string) map[string]v1.ResourceList {
+		return map[string]v1.ResourceList{
+			"app": {
+				v1.ResourceMemory: resource.MustParse(memory),
+				v1.ResourceCPU:    resource.MustParse(cpu),
+			},
+		}
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		pod("leaking", limits),
+		pod("busy", limits),
+		pod("fine", limits),
+		pod("unlimited", nil),
+	}
+
+	lister := &testUsageLister{
+		usage: map[string]map[string]v1.ResourceList{
+			"leaking":   usage("95Mi", "100m"),
+			"busy":      usage("10Mi", "490m"),
+			"fine":      usage("50Mi", "100m"),
+			"unlimited": usage("1Gi", "2"),
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithResourceUsage(lister, 90, 95),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "leaking", result.Deleted[0].Name)
+	require.Equal(t, "MemoryUsage", result.Deleted[0].Reason)
+	require.Equal(t, "busy", result.Deleted[1].Name)
+	require.Equal(t, "CPUUsage", result.Deleted[1].Reason)
+	require.Len(t, result.Skipped, 2)
+	// listed once for the namespace
+	require.Equal(t, 1, lister.calls)
+
+	_, err = New(client, client, WithResourceUsage(lister, -1, 0))
+	require.Error(t, err)
+}
+
+func TestControllerGraceFromState(t *testing.T) {
+	failing := func(name string, since time.Duration) v1.Pod {
+		pod := makePod(time.Hour*24*7, "default", name, v1.PodRunning, "Waiting", "CrashLoopBackOff")
+		pod.Status.Conditions = []v1.PodCondition{{
+			Type:               v1.PodReady,
+			Status:             v1.ConditionFalse,
+			LastTransitionTime: metav1.Time{Time: time.Now().Add(-since)},
+		}}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		failing("recent", time.Minute*10),
+		failing("old", time.Hour*2),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Hour),
+		WithGraceFrom(GraceFromState),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "old", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "StateTransition", result.Skipped[0].Skip)
+
+	// without a ready condition, the time the container last stopped is used
+	pod := makePod(time.Hour*24, "default", "stopped", v1.PodRunning, "Waiting", "CrashLoopBackOff")
+	pod.Status.ContainerStatuses[0].LastTerminationState.Terminated = &v1.ContainerStateTerminated{
+		FinishedAt: metav1.Time{Time: time.Now().Add(-time.Minute)},
+	}
+	require.WithinDuration(t, time.Now().Add(-time.Minute), stateSince(&pod), time.Second)
+
+	_, err = New(client, client, WithGraceFrom("yesterday"))
+	require.Error(t, err)
+}
+
+func TestControllerMinTerminatedAge(t *testing.T) {
+	terminated := func(name string, ago time.Duration) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.Status.ContainerStatuses[0].State.Terminated.FinishedAt = metav1.Time{Time: time.Now().Add(-ago)}
+		return pod
+	}
+
+	waiting := makePod(time.Hour, "default", "waiting", v1.PodRunning, "Waiting", "CrashLoopBackOff")
+	waiting.Status.ContainerStatuses[0].LastTerminationState.Terminated = &v1.ContainerStateTerminated{
+		FinishedAt: metav1.Time{Time: time.Now().Add(-time.Second * 10)},
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		terminated("recent", time.Second*10),
+		terminated("old", time.Minute*5),
+		waiting,
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithMinTerminatedAge(time.Minute),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "old", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "FinishedAt", result.Skipped[0].Skip)
+	require.Equal(t, "FinishedAt", result.Skipped[1].Skip)
+}
+
+func TestControllerContainers(t *testing.T) {
+	withSidecar := func(name string, app string, sidecar string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Running", "")
+		pod.Status.ContainerStatuses = []v1.ContainerStatus{
+			{Name: "app", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: app}}},
+			{Name: "istio-proxy", State: v1.ContainerState{Waiting: &v1.ContainerStateWaiting{Reason: sidecar}}},
+		}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		withSidecar("sidecar", "", "CrashLoopBackOff"),
+		withSidecar("app", "CrashLoopBackOff", ""),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithReasons([]string{"CrashLoopBackOff"}),
+		WithContainers(nil, []string{"istio-proxy"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "app", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "Reason", result.Skipped[0].Skip)
+
+	// the statuses returned by the lister are not changed
+	require.Len(t, client.pods[0].Status.ContainerStatuses, 2)
+
+	client.pods = []v1.Pod{
+		withSidecar("sidecar", "", "CrashLoopBackOff"),
+		withSidecar("app", "CrashLoopBackOff", ""),
+	}
+	require.NoError(t, c.Reconfigure(WithContainers([]string{"istio-proxy"}, nil)))
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "sidecar", result.Deleted[0].Name)
+}
+
+func TestControllerReasonGrace(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Minute*20, "default", "pull", v1.PodRunning, "Waiting", "ErrImagePull"),
+		makePod(time.Minute*20, "default", "crash", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Hour*2, "default", "old-crash", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+		makePod(time.Minute*45, "default", "error", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*30),
+		WithReasons([]string{"ErrImagePull", "CrashLoopBackOff", "Error"}),
+		WithReasonGrace(map[string]time.Duration{
+			"ErrImagePull":     time.Minute * 15,
+			"CrashLoopBackOff": time.Hour,
+		}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	require.Equal(t, "pull", result.Deleted[0].Name)
+	require.Equal(t, "old-crash", result.Deleted[1].Name)
+	require.Equal(t, "error", result.Deleted[2].Name)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "crash", result.Skipped[0].Name)
+	require.Equal(t, "CreationTimestamp", result.Skipped[0].Skip)
+}
+
+type testPatcher struct {
+	patches map[string]string
+}
+
+func (p *testPatcher) PatchPod(namespace string, name string, patch []byte) error {
+	p.patches[namespace+"/"+name] = string(patch)
+	return nil
+}
+
+func TestControllerTombstone(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	patcher := &testPatcher{patches: make(map[string]string)}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithTombstone(patcher, "k8s-pod-deleter/test"),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 0, client.lenPods())
+
+	var patch struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(patcher.patches["default/pod0"]), &patch))
+	annotations := patch.Metadata.Annotations
+	require.Equal(t, "k8s-pod-deleter/test", annotations[TombstoneByAnnotation])
+	require.Equal(t, "delete", annotations[TombstoneActionAnnotation])
+	require.Equal(t, "Error", annotations[TombstoneReasonAnnotation])
+	require.NotContains(t, annotations, TombstoneRuleAnnotation)
+	require.NotEmpty(t, annotations[TombstoneTimeAnnotation])
+}
+
+type testOwners struct {
+	owners  map[string]*metav1.ObjectMeta
+	patches map[string][]string
+}
+
+func (o *testOwners) GetOwner(namespace string, kind string, name string) (*metav1.ObjectMeta, error) {
+	meta, ok := o.owners[namespace+"/"+kind+"/"+name]
+	if !ok {
+		return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: kind}, name)
+	}
+	return meta, nil
+}
+
+func (o *testOwners) PatchOwner(namespace string, kind string, name string, patch []byte) error {
+	key := namespace + "/" + kind + "/" + name
+	o.patches[key] = append(o.patches[key], string(patch))
+	return nil
+}
+
+func TestControllerOwnerAnnotations(t *testing.T) {
+	isController := true
+	pod := makePod(time.Hour, "default", "web-1234-abcd", v1.PodRunning, "Terminated", "Error")
+	pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+		{Kind: "ReplicaSet", Name: "web-1234", Controller: &isController},
+	}
+	bare := makePod(time.Hour, "default", "bare", v1.PodRunning, "Terminated", "Error")
+
+	client := &testClient{}
+	client.pods = []v1.Pod{pod, bare}
+
+	owners := &testOwners{
+		owners: map[string]*metav1.ObjectMeta{
+			"default/ReplicaSet/web-1234": {
+				Name: "web-1234",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Deployment", Name: "web", Controller: &isController},
+				},
+			},
+			"default/Deployment/web": {
+				Name:        "web",
+				Annotations: map[string]string{DeletionsAnnotation: "2"},
+			},
+		},
+		patches: make(map[string][]string),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithOwnerAnnotations(owners),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.Once(context.Background()))
+	require.Len(t, owners.patches, 2)
+
+	annotations := func(patch string) map[string]string {
+		var p struct {
+			Metadata struct {
+				Annotations map[string]string `json:"annotations"`
+			} `json:"metadata"`
+		}
+		require.NoError(t, json.Unmarshal([]byte(patch), &p))
+		return p.Metadata.Annotations
+	}
+
+	rs := annotations(owners.patches["default/ReplicaSet/web-1234"][0])
+	require.Equal(t, "1", rs[DeletionsAnnotation])
+	require.NotEmpty(t, rs[LastDeletionAnnotation])
+
+	deploy := annotations(owners.patches["default/Deployment/web"][0])
+	require.Equal(t, "3", deploy[DeletionsAnnotation])
+
+	// nothing is annotated in dry run
+	client.pods = []v1.Pod{pod}
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithOwnerAnnotations(owners),
+		WithDryRun(true),
+	)
+	require.NoError(t, err)
+	require.NoError(t, c.Once(context.Background()))
+	require.Len(t, owners.patches["default/ReplicaSet/web-1234"], 1)
+}
+
+func TestRolloutRestartAction(t *testing.T) {
+	isController := true
+	owned := func(name string, kind string, owner string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: kind, Name: owner, Controller: &isController},
+		}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned("web-1234-a", "ReplicaSet", "web-1234"),
+		owned("web-1234-b", "ReplicaSet", "web-1234"),
+		owned("db-0", "StatefulSet", "db"),
+		makePod(time.Hour, "default", "bare", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	owners := &testOwners{
+		owners: map[string]*metav1.ObjectMeta{
+			"default/ReplicaSet/web-1234": {
+				Name: "web-1234",
+				OwnerReferences: []metav1.OwnerReference{
+					{Kind: "Deployment", Name: "web", Controller: &isController},
+				},
+			},
+		},
+		patches: make(map[string][]string),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithActions(map[string]Action{"restart": RolloutRestartAction(owners, time.Hour)}),
+		WithDefaultAction("restart"),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	require.Len(t, result.Errors, 1)
+	require.Equal(t, "bare", result.Errors[0].Name)
+
+	// each workload is restarted once, and the pods are left to the rollout
+	require.Len(t, owners.patches, 2)
+	require.Len(t, owners.patches["default/Deployment/web"], 1)
+	require.Len(t, owners.patches["default/StatefulSet/db"], 1)
+	require.Equal(t, 4, client.lenPods())
+
+	var patch struct {
+		Spec struct {
+			Template struct {
+				Metadata struct {
+					Annotations map[string]string `json:"annotations"`
+				} `json:"metadata"`
+			} `json:"template"`
+		} `json:"spec"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(owners.patches["default/Deployment/web"][0]), &patch))
+	require.NotEmpty(t, patch.Spec.Template.Metadata.Annotations[RestartedAtAnnotation])
+
+	// not again within the cooldown
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, owners.patches["default/Deployment/web"], 1)
+}
+
+type testJobs struct {
+	jobs    map[string]*batchv1.Job
+	deleted []string
+	patches map[string][]string
+}
+
+func (j *testJobs) GetJob(namespace string, name string) (*batchv1.Job, error) {
+	job, ok := j.jobs[namespace+"/"+name]
+	if !ok {
+		return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "jobs"}, name)
+	}
+	return job, nil
+}
+
+func (j *testJobs) DeleteJob(namespace string, name string) error {
+	j.deleted = append(j.deleted, namespace+"/"+name)
+	return nil
+}
+
+func (j *testJobs) PatchJob(namespace string, name string, patch []byte) error {
+	key := namespace + "/" + name
+	j.patches[key] = append(j.patches[key], string(patch))
+	return nil
+}
+
+func TestJobActions(t *testing.T) {
+	isController := true
+	owned := func(name string, job string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodFailed, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "Job", Name: job, Controller: &isController},
+		}
+		return pod
+	}
+	limit := int32(2)
+
+	jobs := &testJobs{
+		jobs: map[string]*batchv1.Job{
+			"default/failed": {
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "failed"},
+				Status: batchv1.JobStatus{
+					Conditions: []batchv1.JobCondition{
+						{Type: batchv1.JobFailed, Status: v1.ConditionTrue},
+					},
+				},
+			},
+			// the controller has not set the condition yet
+			"default/exhausted": {
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "exhausted"},
+				Spec:       batchv1.JobSpec{BackoffLimit: &limit},
+				Status:     batchv1.JobStatus{Failed: 3},
+			},
+			"default/retrying": {
+				ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "retrying"},
+				Spec:       batchv1.JobSpec{BackoffLimit: &limit},
+				Status:     batchv1.JobStatus{Active: 1, Failed: 1},
+			},
+		},
+		patches: make(map[string][]string),
+	}
+	pods := func() []v1.Pod {
+		return []v1.Pod{
+			owned("failed-a", "failed"),
+			owned("exhausted-a", "exhausted"),
+			owned("retrying-a", "retrying"),
+			makePod(time.Hour, "default", "bare", v1.PodFailed, "Terminated", "Error"),
+		}
+	}
+	run := func(action func(client *testClient) Action) *testClient {
+		client := &testClient{}
+		client.pods = pods()
+		c, err := New(client, client,
+			WithGrace(time.Minute*5),
+			WithPhases([]string{"Failed"}),
+			WithActions(map[string]Action{"job": action(client)}),
+			WithDefaultAction("job"),
+			WithLogger(zap.NewNop()),
+		)
+		require.NoError(t, err)
+
+		result, err := c.Run(context.Background())
+		require.NoError(t, err)
+		require.Len(t, result.Deleted, 4)
+		require.Empty(t, result.Errors)
+		return client
+	}
+
+	client := run(func(client *testClient) Action {
+		return DeleteJobAction(jobs, DeleteAction(client))
+	})
+	require.Equal(t, []string{"default/failed", "default/exhausted"}, jobs.deleted)
+	// pods of failed jobs are left to the job's deletion
+	require.Equal(t, 2, client.lenPods())
+
+	annotations := map[string]string{"example.com/failed": "true"}
+	client = run(func(client *testClient) Action {
+		return AnnotateJobAction(jobs, annotations, DeleteAction(client))
+	})
+	require.Len(t, jobs.patches, 2)
+	require.Len(t, jobs.patches["default/failed"], 1)
+	require.Len(t, jobs.patches["default/exhausted"], 1)
+	require.JSONEq(t, `{"metadata":{"annotations":{"example.com/failed":"true"}}}`, jobs.patches["default/failed"][0])
+	require.Equal(t, 2, client.lenPods())
+}
+
+func TestControllerFinishedJobPods(t *testing.T) {
+	isController := true
+	owned := func(name string, job string, phase v1.PodPhase, state string, reason string) v1.Pod {
+		pod := makePod(time.Hour*24, "default", name, phase, state, reason)
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "Job", Name: job, Controller: &isController},
+		}
+		return pod
+	}
+	finished := func(d time.Duration, cond batchv1.JobConditionType) *batchv1.Job {
+		return &batchv1.Job{
+			Status: batchv1.JobStatus{
+				Conditions: []batchv1.JobCondition{{
+					Type:               cond,
+					Status:             v1.ConditionTrue,
+					LastTransitionTime: metav1.Time{Time: time.Now().Add(-d)},
+				}},
+			},
+		}
+	}
+
+	jobs := &testJobs{
+		jobs: map[string]*batchv1.Job{
+			"default/complete": finished(time.Hour*2, batchv1.JobComplete),
+			"default/failed":   finished(time.Hour*2, batchv1.JobFailed),
+			"default/recent":   finished(time.Minute, batchv1.JobComplete),
+			"default/running":  {Status: batchv1.JobStatus{Active: 1}},
+		},
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned("complete-a", "complete", v1.PodSucceeded, "Terminated", "Completed"),
+		owned("failed-a", "failed", v1.PodFailed, "Terminated", "Error"),
+		owned("recent-a", "recent", v1.PodSucceeded, "Terminated", "Completed"),
+		owned("running-a", "running", v1.PodSucceeded, "Terminated", "Completed"),
+		owned("running-b", "running", v1.PodRunning, "Running", ""),
+		// the job is gone and the pod was created long ago
+		owned("missing-a", "missing", v1.PodSucceeded, "Terminated", "Completed"),
+		makePod(time.Hour*24, "default", "bare", v1.PodSucceeded, "Terminated", "Completed"),
+	}
+	excluded := owned("excluded", "complete", v1.PodSucceeded, "Terminated", "Completed")
+	excluded.Spec.ServiceAccountName = "storage"
+	// a new pod of a finished job is not protected by the grace period
+	young := owned("young", "complete", v1.PodSucceeded, "Terminated", "Completed")
+	young.ObjectMeta.CreationTimestamp = metav1.Time{Time: time.Now().Add(-time.Minute)}
+	client.pods = append(client.pods, excluded, young)
+
+	c, err := New(client, client,
+		WithGrace(time.Hour*48),
+		WithFinishedJobPods(jobs, time.Hour),
+		WithExcludeServiceAccounts([]string{"storage"}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 4)
+	var names []string
+	for _, d := range result.Deleted {
+		require.Equal(t, "JobFinished", d.Reason)
+		names = append(names, d.Name)
+	}
+	require.ElementsMatch(t, []string{"complete-a", "failed-a", "missing-a", "young"}, names)
+	require.Equal(t, 5, client.lenPods())
+
+	_, err = New(client, client, WithFinishedJobPods(jobs, -time.Minute))
+	require.Error(t, err)
+}
+
+type testPDBLister struct {
+	pdbs []policy.PodDisruptionBudget
+}
+
+func (l *testPDBLister) ListPodDisruptionBudgets(namespace string) ([]policy.PodDisruptionBudget, error) {
+	return l.pdbs, nil
+}
+
+func TestControllerDisruptionBudget(t *testing.T) {
+	pod := func(name string, ready v1.ConditionStatus) v1.Pod {
+		p := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		p.ObjectMeta.Labels = map[string]string{"app": "web"}
+		p.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: ready}}
+		return p
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		pod("web-0", v1.ConditionTrue),
+		pod("web-1", v1.ConditionTrue),
+		pod("web-2", v1.ConditionFalse),
+	}
+
+	lister := &testPDBLister{
+		pdbs: []policy.PodDisruptionBudget{
+			{
+				ObjectMeta: metav1.ObjectMeta{Name: "web"},
+				Spec: policy.PodDisruptionBudgetSpec{
+					Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"app": "web"}},
+				},
+				Status: policy.PodDisruptionBudgetStatus{PodDisruptionsAllowed: 1},
+			},
+			{
+				// matches no pods
+				ObjectMeta: metav1.ObjectMeta{Name: "empty"},
+				Spec: policy.PodDisruptionBudgetSpec{
+					Selector: &metav1.LabelSelector{},
+				},
+			},
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithDisruptionBudgetCheck(lister),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+
+	// one ready pod uses the only disruption, the pod that is not ready is always deleted
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "web-0", result.Deleted[0].Name)
+	require.Equal(t, "web-2", result.Deleted[1].Name)
+
+	var skipped []Decision
+	for _, d := range result.Skipped {
+		if d.Skip == "DisruptionBudget" {
+			skipped = append(skipped, d)
+		}
+	}
+	require.Len(t, skipped, 1)
+	require.Equal(t, "web-1", skipped[0].Name)
+	require.Equal(t, "web", skipped[0].Detail)
+}
+
+func TestControllerReplacements(t *testing.T) {
+	owned := func(p v1.Pod, owner string) v1.Pod {
+		p.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: owner, Controller: &[]bool{true}[0]},
+		}
+		return p
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned(makePod(time.Hour, "default", "web-0", v1.PodRunning, "Terminated", "Error"), "web-1234"),
+		owned(makePod(time.Hour, "default", "api-0", v1.PodRunning, "Terminated", "Error"), "api-1234"),
+		makePod(time.Hour, "default", "bare", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithReplacementCheck(time.Minute),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	// the pod without an owner is not replaced
+	require.Equal(t, 2, c.replacements.len())
+
+	now := time.Now()
+	client.pods = []v1.Pod{
+		owned(v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace:         "default",
+				Name:              "web-1",
+				CreationTimestamp: metav1.Time{Time: now},
+			},
+			Status: v1.PodStatus{
+				Phase: v1.PodRunning,
+				Conditions: []v1.PodCondition{
+					{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: metav1.Time{Time: now.Add(time.Second)}},
+				},
+			},
+		}, "web-1234"),
+	}
+
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1.0, testutil.ToFloat64(c.counters.replacements.WithLabelValues("default", "ReplicaSet", ReplacementReady)))
+	require.Equal(t, 1, c.replacements.len())
+
+	c.checkReplacements(now.Add(time.Minute * 2))
+	require.Equal(t, 1.0, testutil.ToFloat64(c.counters.replacements.WithLabelValues("default", "ReplicaSet", ReplacementFailed)))
+	require.Equal(t, 0, c.replacements.len())
+
+	// a pod an action did not remove is not counted
+	pod := owned(makePod(time.Hour, "default", "web-2", v1.PodRunning, "Terminated", "Error"), "web-1234")
+	p := pendingReplacement{namespace: "default", name: "web-2", owner: "ReplicaSet/web-1234", time: now}
+	replaced, _, done := p.check([]v1.Pod{pod}, now, time.Minute)
+	require.False(t, done)
+	replaced, _, done = p.check([]v1.Pod{pod}, now.Add(time.Minute), time.Minute)
+	require.True(t, done)
+	require.Equal(t, "", replaced)
+
+	_, err = New(client, client, WithReplacementCheck(-time.Minute))
+	require.Error(t, err)
+}
+
+// replacingClient replaces each pod it deletes with a ready pod of the same owner
+type replacingClient struct {
+	*testClient
+}
+
+func (r *replacingClient) DeletePod(namespace string, name string) error {
+	pod, err := r.GetPod(namespace, name)
+	if err != nil {
+		return err
+	}
+	if err := r.testClient.DeletePod(namespace, name); err != nil {
+		return err
+	}
+
+	now := metav1.Now()
+	r.pods = append(r.pods, v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace:         namespace,
+			Name:              name + "-replacement",
+			CreationTimestamp: now,
+			OwnerReferences:   pod.ObjectMeta.OwnerReferences,
+		},
+		Status: v1.PodStatus{
+			Phase:      v1.PodRunning,
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue, LastTransitionTime: now}},
+		},
+	})
+	return nil
+}
+
+func TestControllerWaitForReplacement(t *testing.T) {
+	pods := func() []v1.Pod {
+		var pods []v1.Pod
+		for _, name := range []string{"web-0", "web-1"} {
+			p := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+			p.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+				{Kind: "ReplicaSet", Name: "web-1234", Controller: &[]bool{true}[0]},
+			}
+			pods = append(pods, p)
+		}
+		return pods
+	}
+
+	client := &testClient{pods: pods()}
+	c, err := New(client, &replacingClient{client},
+		WithGrace(time.Minute*5),
+		WithWaitForReplacement(time.Minute),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+	c.rolling.poll = time.Millisecond * 10
+
+	// the replacement of web-0 is ready, so there is no wait for web-1,
+	// which would outlast the context
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	result, err := c.Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+
+	client = &testClient{pods: pods()}
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithWaitForReplacement(time.Millisecond*100),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+	c.rolling.poll = time.Millisecond * 10
+
+	// without a replacement, web-1 is acted on after the timeout
+	start := time.Now()
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.True(t, time.Since(start) >= time.Millisecond*100)
+	require.Equal(t, 0, client.lenPods())
+
+	// the run stops if canceled while waiting
+	client = &testClient{pods: pods()}
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithWaitForReplacement(time.Minute),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	ctx, cancel = context.WithTimeout(context.Background(), time.Millisecond*50)
+	defer cancel()
+	result, err = c.Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, 1, client.lenPods())
+
+	// as does the loop, if stopped while waiting
+	client = &testClient{pods: pods()}
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithWaitForReplacement(time.Hour),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Loop()
+	}()
+
+	// the first pod is deleted, then the loop waits for its replacement
+	client.waitForPods(t, 1)
+	stopLoop(t, c, done)
+	require.Equal(t, 1, client.lenPods())
+
+	_, err = New(client, client, WithWaitForReplacement(-time.Minute))
+	require.Error(t, err)
+}
+
+func TestControllerLastReadyReplica(t *testing.T) {
+	pod := func(name string, owner string, ready v1.ConditionStatus) v1.Pod {
+		p := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		p.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: owner, Controller: &[]bool{true}[0]},
+		}
+		p.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: ready}}
+		return p
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		pod("web-0", "web-1234", v1.ConditionTrue),
+		pod("web-1", "web-1234", v1.ConditionTrue),
+		pod("web-2", "web-1234", v1.ConditionFalse),
+		pod("api-0", "api-1234", v1.ConditionTrue),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+
+	// the pod that is not ready is always deleted
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "web-0", result.Deleted[0].Name)
+	require.Equal(t, "web-2", result.Deleted[1].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "web-1", result.Skipped[0].Name)
+	require.Equal(t, "LastReadyReplica", result.Skipped[0].Skip)
+	require.Equal(t, "ReplicaSet/web-1234", result.Skipped[0].Detail)
+	require.Equal(t, "api-0", result.Skipped[1].Name)
+
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithAllowLastReadyReplica(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 4)
+}
+
+// testDeployments gets Deployments, and the ReplicaSets that own pods
+type testDeployments struct {
+	*testOwners
+	deployments map[string]*appsv1.Deployment
+}
+
+func (d *testDeployments) GetDeployment(namespace string, name string) (*appsv1.Deployment, error) {
+	deployment, ok := d.deployments[namespace+"/"+name]
+	if !ok {
+		return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "deployments"}, name)
+	}
+	return deployment, nil
+}
+
+func TestControllerRolloutCheck(t *testing.T) {
+	isController := true
+	owned := func(name string, rs string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: rs, Controller: &isController},
+		}
+		pod.Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+		return pod
+	}
+	ownedBy := func(deployment string) *metav1.ObjectMeta {
+		return &metav1.ObjectMeta{
+			OwnerReferences: []metav1.OwnerReference{
+				{Kind: "Deployment", Name: deployment, Controller: &isController},
+			},
+		}
+	}
+	rolling := func(maxUnavailable int, available int32) *appsv1.Deployment {
+		replicas := int32(4)
+		n := intstr.FromInt(maxUnavailable)
+		return &appsv1.Deployment{
+			Spec: appsv1.DeploymentSpec{
+				Replicas: &replicas,
+				Strategy: appsv1.DeploymentStrategy{
+					Type:          appsv1.RollingUpdateDeploymentStrategyType,
+					RollingUpdate: &appsv1.RollingUpdateDeployment{MaxUnavailable: &n},
+				},
+			},
+			Status: appsv1.DeploymentStatus{
+				Replicas:          5,
+				UpdatedReplicas:   2,
+				AvailableReplicas: available,
+			},
+		}
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned("web-0", "web-1234"),
+		owned("api-0", "api-1234"),
+		owned("api-1", "api-1234"),
+		owned("batch-0", "batch-1234"),
+	}
+
+	deployments := &testDeployments{
+		testOwners: &testOwners{
+			owners: map[string]*metav1.ObjectMeta{
+				"default/ReplicaSet/web-1234":   ownedBy("web"),
+				"default/ReplicaSet/api-1234":   ownedBy("api"),
+				"default/ReplicaSet/batch-1234": {},
+			},
+		},
+		deployments: map[string]*appsv1.Deployment{
+			// already at maxUnavailable
+			"default/web": rolling(1, 3),
+			// one more may be unavailable
+			"default/api": rolling(2, 3),
+		},
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithAllowLastReadyReplica(true),
+		WithRolloutCheck(deployments),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "api-0", result.Deleted[0].Name)
+	require.Equal(t, "batch-0", result.Deleted[1].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "web-0", result.Skipped[0].Name)
+	require.Equal(t, "Rollout", result.Skipped[0].Skip)
+	require.Equal(t, "web", result.Skipped[0].Detail)
+	require.Equal(t, "api-1", result.Skipped[1].Name)
+
+	// a Deployment that finished rolling out is not checked
+	done := rolling(1, 3)
+	done.Status = appsv1.DeploymentStatus{Replicas: 4, UpdatedReplicas: 4, AvailableReplicas: 3}
+	deployments.deployments["default/web"] = done
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "web-0", result.Deleted[0].Name)
+}
+
+func TestControllerStatefulSets(t *testing.T) {
+	isController := true
+	member := func(name string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "StatefulSet", Name: "db", Controller: &isController},
+		}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		member("db-0"),
+		member("db-1"),
+		makePod(time.Hour, "default", "web-0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithStatefulSets(StatefulSetSkip, nil),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "web-0", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, "StatefulSet", result.Skipped[0].Skip)
+	require.Equal(t, "default/db", result.Skipped[0].Detail)
+
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithStatefulSets(StatefulSetSerial, client),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// one pod per run
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "db-0", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "db-1", result.Skipped[0].Name)
+
+	// the previous pod has not been replaced
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Deleted)
+	require.Equal(t, "waiting for db-0 to be replaced", result.Skipped[0].Detail)
+
+	replaced := makePod(0, "default", "db-0", v1.PodRunning, "Running", "")
+	client.pods = append(client.pods, replaced)
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Deleted)
+	// the replacement is skipped as it is too young
+	require.Equal(t, "db-1", result.Skipped[1].Name)
+	require.Equal(t, "waiting for db-0 to be ready", result.Skipped[1].Detail)
+
+	client.pods[len(client.pods)-1].Status.Conditions = []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionTrue}}
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "db-1", result.Deleted[0].Name)
+
+	_, err = New(client, client, WithStatefulSets("parallel", client))
+	require.Error(t, err)
+}
+
+func TestControllerKeepFailing(t *testing.T) {
+	isController := true
+	owned := func(name string, rs string, age time.Duration) v1.Pod {
+		pod := makePod(age, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: rs, Controller: &isController},
+		}
+		return pod
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		owned("web-0", "web-1234", time.Hour*3),
+		owned("web-1", "web-1234", time.Hour),
+		owned("web-2", "web-1234", time.Hour*2),
+		owned("api-0", "api-1234", time.Hour),
+		makePod(time.Hour, "default", "bare", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithKeepFailing(1),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 5, result.Candidates)
+
+	var deleted []string
+	for _, d := range result.Deleted {
+		deleted = append(deleted, d.Name)
+	}
+	require.Equal(t, []string{"web-0", "web-2", "bare"}, deleted)
+
+	require.Len(t, result.Skipped, 2)
+	require.Equal(t, KeepFailingSkip, result.Skipped[0].Skip)
+	require.Equal(t, "web-1", result.Skipped[0].Name)
+	require.Equal(t, "api-0", result.Skipped[1].Name)
+
+	_, err = New(client, client, WithKeepFailing(-1))
+	require.Error(t, err)
+}
+
+type testLogs struct {
+	requests []string
+	captured []*CapturedLogs
+}
+
+func (l *testLogs) GetPodLogs(namespace string, name string, container string, previous bool, lines int64) ([]byte, error) {
+	l.requests = append(l.requests, fmt.Sprintf("%s/%s/%s/%t/%d", namespace, name, container, previous, lines))
+	if container == "sidecar" {
+		return nil, fmt.Errorf("container not found")
+	}
+	return []byte(container + " logs\n"), nil
+}
+
+func (l *testLogs) WriteLogs(logs *CapturedLogs) error {
+	l.captured = append(l.captured, logs)
+	return nil
+}
+
+func TestControllerLogCapture(t *testing.T) {
+	pod := makePod(time.Hour, "default", "pod0", v1.PodRunning, "Waiting", "CrashLoopBackOff")
+	pod.Status.ContainerStatuses[0].Name = "app"
+	pod.Status.ContainerStatuses[0].RestartCount = 3
+	pod.Status.ContainerStatuses = append(pod.Status.ContainerStatuses, v1.ContainerStatus{
+		Name:  "sidecar",
+		State: v1.ContainerState{Running: &v1.ContainerStateRunning{}},
+	})
+
+	client := &testClient{}
+	client.pods = []v1.Pod{pod}
+	logs := &testLogs{}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithLogCapture(logs, 50, logs),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// logs are not captured in dry-run mode
+	_, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, logs.requests)
+
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogCapture(logs, 50, logs),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+
+	// a waiting container has no current logs
+	require.Equal(t, []string{"default/pod0/app/true/50", "default/pod0/sidecar/false/50"}, logs.requests)
+	require.Len(t, logs.captured, 1)
+	captured := logs.captured[0]
+	require.Equal(t, "pod0", captured.Name)
+	require.Equal(t, "CrashLoopBackOff", captured.Reason)
+	require.Equal(t, []ContainerLogs{
+		{Container: "app", Previous: true, Logs: "app logs\n"},
+		{Container: "sidecar", Error: "container not found"},
+	}, captured.Containers)
+
+	_, err = New(client, client, WithLogCapture(logs, 50, nil))
+	require.Error(t, err)
+}
+
+type testArchiver struct {
+	records []*PodRecord
+}
+
+func (a *testArchiver) ArchivePod(r *PodRecord) error {
+	a.records = append(a.records, r)
+	return nil
+}
+
+func (a *testArchiver) ListPodEvents(namespace string, name string) ([]v1.Event, error) {
+	return []v1.Event{{Reason: "BackOff"}}, nil
+}
+
+func TestControllerArchive(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+	}
+	archiver := &testArchiver{}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithArchive(archiver, archiver),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+
+	require.Len(t, archiver.records, 1)
+	record := archiver.records[0]
+	require.Equal(t, "Pod", record.Pod.TypeMeta.Kind)
+	require.Equal(t, "pod0", record.Pod.ObjectMeta.Name)
+	require.Equal(t, "CrashLoopBackOff", record.Reason)
+	require.Equal(t, "BackOff", record.Events[0].Reason)
+}
+
+func TestControllerMassFailure(t *testing.T) {
+	client := &testClient{}
+	for i := 0; i < 4; i++ {
+		client.pods = append(client.pods, makePod(time.Hour, "default", fmt.Sprintf("failing%d", i), v1.PodRunning, "Waiting", "ImagePullBackOff"))
+	}
+	client.pods = append(client.pods, makePod(time.Hour, "default", "healthy", v1.PodRunning, "Running", ""))
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithReasons([]string{"ImagePullBackOff"}),
+		WithMassFailureThreshold(50, 3),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "4 of 5 evaluated pods (80%) are candidates, more than the mass failure threshold of 50%", result.Aborted)
+	require.Empty(t, result.Deleted)
+
+	var skips []string
+	for _, d := range result.Skipped {
+		skips = append(skips, d.Skip)
+	}
+	require.Equal(t, []string{"Reason", MassFailureSkip, MassFailureSkip, MassFailureSkip, MassFailureSkip}, skips)
+	require.EqualError(t, result.Err(), "run aborted: "+result.Aborted)
+	require.Contains(t, c.LastRun().Error, "run aborted")
+	// the loop keeps running, so the next run checks again
+	require.NoError(t, c.Once(context.Background()))
+
+	// too few candidates to be a cluster problem
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithReasons([]string{"ImagePullBackOff"}),
+		WithMassFailureThreshold(50, 5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Aborted)
+	require.Len(t, result.Deleted, 4)
+
+	_, err = New(client, client, WithMassFailureThreshold(101, 0))
+	require.Error(t, err)
+}
+
+func TestControllerNodeHealth(t *testing.T) {
+	node := func(name string, status v1.ConditionStatus) v1.Node {
+		return v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{
+				Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: status}},
+			},
+		}
+	}
+
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+	nodes := &testNodeLister{nodes: []v1.Node{
+		node("node0", v1.ConditionTrue),
+		node("node1", v1.ConditionUnknown),
+		node("node2", v1.ConditionFalse),
+		node("node3", v1.ConditionTrue),
+	}}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithNodeHealth(nodes, 25),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, "2 of 4 nodes (50%) are not ready, more than the node health threshold of 25%", result.Aborted)
+	require.Empty(t, result.Deleted)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, NodeHealthSkip, result.Skipped[0].Skip)
+	require.Error(t, result.Err())
+
+	nodes.nodes[1] = node("node1", v1.ConditionTrue)
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Aborted)
+	require.Len(t, result.Deleted, 1)
+}
+
+func TestWindowContains(t *testing.T) {
+	// 2018-04-20 is a Friday
+	at := func(s string) time.Time {
+		ts, err := time.Parse(time.RFC3339, s)
+		require.NoError(t, err)
+		return ts
+	}
+
+	tests := []struct {
+		description string
+		window      Window
+		times       map[string]bool
+	}{
+		{
+			description: "business hours",
+			window:      Window{Days: []string{"Mon-Fri"}, Start: "09:00", End: "17:00"},
+			times: map[string]bool{
+				"2018-04-20T09:00:00Z": true,
+				"2018-04-20T16:59:00Z": true,
+				"2018-04-20T17:00:00Z": false,
+				"2018-04-21T12:00:00Z": false,
+			},
+		},
+		{
+			description: "overnight",
+			window:      Window{Days: []string{"Fri"}, Start: "22:00", End: "06:00"},
+			times: map[string]bool{
+				"2018-04-20T23:00:00Z": true,
+				"2018-04-21T05:00:00Z": true,
+				"2018-04-20T05:00:00Z": false,
+				"2018-04-21T23:00:00Z": false,
+			},
+		},
+		{
+			description: "time zone",
+			window:      Window{Start: "09:00", End: "17:00", Timezone: "America/New_York"},
+			times: map[string]bool{
+				"2018-04-20T13:00:00Z": true,
+				"2018-04-20T12:00:00Z": false,
+			},
+		},
+		{
+			description: "daylight saving time starts",
+			window:      Window{Start: "09:00", End: "17:00", Timezone: "America/New_York"},
+			times: map[string]bool{
+				"2018-03-11T13:30:00Z": true,
+				"2018-03-11T12:30:00Z": false,
+				"2018-03-11T20:30:00Z": true,
+				"2018-03-11T21:00:00Z": false,
+			},
+		},
+		{
+			description: "dates",
+			window:      Window{From: "2018-04-20", To: "2018-04-23T09:00"},
+			times: map[string]bool{
+				"2018-04-19T23:59:00Z": false,
+				"2018-04-20T00:00:00Z": true,
+				"2018-04-23T08:59:00Z": true,
+				"2018-04-23T09:00:00Z": false,
+			},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.description, func(t *testing.T) {
+			w, err := test.window.compile()
+			require.NoError(t, err)
+			for s, expected := range test.times {
+				require.Equal(t, expected, w.contains(at(s)), s)
+			}
+		})
+	}
+}
+
+func TestControllerWindows(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	// a freeze that is always in effect
+	freeze := Window{Name: "freeze", Deny: true, From: "2000-01-01"}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDryRun(true),
+		WithWindows([]Window{freeze}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Empty(t, result.Deleted)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, WindowSkip, result.Skipped[0].Skip)
+	require.Equal(t, "in blackout window freeze", result.Skipped[0].Detail)
+
+	// a window that has closed
+	require.NoError(t, c.Reconfigure(
+		WithWindows(nil),
+		WithRules([]Rule{{Name: "web", Windows: []Window{{To: "2000-01-01"}}}}),
+	))
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "outside the allowed windows of rule web", result.Skipped[0].Detail)
+
+	require.NoError(t, c.Reconfigure(WithRules(nil)))
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 1)
+
+	_, err = New(client, client, WithWindows([]Window{{Start: "25:00", End: "26:00"}}))
+	require.Error(t, err)
+}
+
+func TestControllerActions(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "web", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	patcher := &testPatcher{patches: make(map[string]string)}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+		WithActions(map[string]Action{
+			"cheap": DeletionCostAction(patcher, -100),
+		}),
+		WithRules([]Rule{
+			{Name: "web", Namespace: "web", Action: "cheap"},
+			{Name: "default", Namespace: "default"},
+		}),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 2)
+	require.Equal(t, "cheap", result.Deleted[0].Action)
+	require.Equal(t, "deleted", result.Deleted[1].Action)
+
+	// the web pod was annotated, not deleted
+	require.Equal(t, 1, client.lenPods())
+	require.Equal(t, "pod1", client.pods[0].ObjectMeta.Name)
+	require.Equal(t,
+		`{"metadata":{"annotations":{"controller.kubernetes.io/pod-deletion-cost":"-100"}}}`,
+		patcher.patches["web/pod1"],
+	)
+
+	_, err = New(client, client, WithDefaultAction("paint"))
+	require.Error(t, err)
+}
+
+type testRecorder struct {
+	events []*v1.Event
+}
+
+func (r *testRecorder) CreateEvent(event *v1.Event) error {
+	r.events = append(r.events, event)
+	return nil
+}
+
+func TestControllerFlapDetection(t *testing.T) {
+	isController := true
+	owned := func(name string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: "web-1234", Controller: &isController},
+		}
+		return pod
+	}
+
+	client := &testClient{}
+	recorder := &testRecorder{}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithFlapDetection(2, time.Hour),
+		WithEventRecorder(recorder),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// pods are replaced run after run
+	for i := 0; i < 3; i++ {
+		client.pods = append(client.pods,
+			owned(fmt.Sprintf("web-%d", i)),
+			makePod(time.Hour, "default", fmt.Sprintf("bare-%d", i), v1.PodRunning, "Terminated", "Error"),
+		)
+		_, err := c.Run(context.Background())
+		require.NoError(t, err)
+	}
+
+	result := c.LastResult()
+	require.Len(t, result.Deleted, 1)
+	require.Equal(t, "bare-2", result.Deleted[0].Name)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, "Flapping", result.Skipped[0].Skip)
+	require.Equal(t, "ReplicaSet/web-1234", result.Skipped[0].Detail)
+
+	require.Len(t, recorder.events, 1)
+	require.Equal(t, "Flapping", recorder.events[0].Reason)
+	require.Equal(t, "web-1234", recorder.events[0].InvolvedObject.Name)
+	require.NotEmpty(t, recorder.events[0].Annotations[RunIDAnnotation])
+
+	require.Equal(t, []string{"default/ReplicaSet/web-1234"}, c.flaps.list(time.Now()))
+	cooldowns := c.Budget().Cooldowns
+	require.Len(t, cooldowns, 1)
+	require.Equal(t, "default/ReplicaSet/web-1234", cooldowns[0].Owner)
+	require.Equal(t, 2, cooldowns[0].Deletions)
+
+	// escalation hooks are called without an event recorder
+	var escalated []string
+	client.pods = nil
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithFlapDetection(2, time.Hour),
+		WithHooks(Hooks{
+			OnEscalate: func(cand Candidate, event *v1.Event) {
+				escalated = append(escalated, cand.Pod.ObjectMeta.Name+" "+event.Reason)
+			},
+		}),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		client.pods = append(client.pods, owned(fmt.Sprintf("web-%d", i)))
+		_, err := c.Run(context.Background())
+		require.NoError(t, err)
+	}
+	require.Equal(t, []string{"web-1 Flapping"}, escalated)
+}
+
+// testScaler scales Deployments that have replicas
+type testScaler struct {
+	*testOwners
+	replicas map[string]int32
+}
+
+func (s *testScaler) ScaleDeployment(namespace string, name string, replicas int32) (int32, error) {
+	key := namespace + "/" + name
+	previous, ok := s.replicas[key]
+	if !ok {
+		return 0, k8sErrors.NewNotFound(schema.GroupResource{Resource: "deployments"}, name)
+	}
+	s.replicas[key] = replicas
+	return previous, nil
+}
+
+func TestControllerFlapScaleDown(t *testing.T) {
+	isController := true
+	owned := func(name string, rs string) v1.Pod {
+		pod := makePod(time.Hour, "default", name, v1.PodRunning, "Terminated", "Error")
+		pod.ObjectMeta.OwnerReferences = []metav1.OwnerReference{
+			{Kind: "ReplicaSet", Name: rs, Controller: &isController},
+		}
+		return pod
+	}
+
+	scaler := &testScaler{
+		testOwners: &testOwners{
+			owners: map[string]*metav1.ObjectMeta{
+				"default/ReplicaSet/web-1234": {
+					Name: "web-1234",
+					OwnerReferences: []metav1.OwnerReference{
+						{Kind: "Deployment", Name: "web", Controller: &isController},
+					},
+				},
+				// not owned by a deployment
+				"default/ReplicaSet/bare-1234": {Name: "bare-1234"},
+			},
+			patches: make(map[string][]string),
+		},
+		replicas: map[string]int32{"default/web": 3},
+	}
+
+	client := &testClient{}
+	recorder := &testRecorder{}
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithFlapDetection(2, time.Hour),
+		WithFlapScaleDown(scaler),
+		WithEventRecorder(recorder),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		client.pods = append(client.pods,
+			owned(fmt.Sprintf("web-%d", i), "web-1234"),
+			owned(fmt.Sprintf("bare-%d", i), "bare-1234"),
+		)
+		_, err := c.Run(context.Background())
+		require.NoError(t, err)
+	}
+
+	require.Equal(t, map[string]int32{"default/web": 0}, scaler.replicas)
+
+	var patch struct {
+		Metadata struct {
+			Annotations map[string]string `json:"annotations"`
+		} `json:"metadata"`
+	}
+	require.Len(t, scaler.patches["default/Deployment/web"], 1)
+	require.NoError(t, json.Unmarshal([]byte(scaler.patches["default/Deployment/web"][0]), &patch))
+	require.Equal(t, "3", patch.Metadata.Annotations[PreviousReplicasAnnotation])
+	require.NotEmpty(t, patch.Metadata.Annotations[ScaledDownAnnotation])
+
+	var reasons []string
+	for _, e := range recorder.events {
+		reasons = append(reasons, e.Reason+"/"+e.InvolvedObject.Name)
+	}
+	require.Equal(t, []string{"ScaledDown/web", "Flapping/web-1234", "Flapping/bare-1234"}, reasons)
+}
+
+type flakyLister struct {
+	*testClient
+	failures int
+}
+
+func (f *flakyLister) ListPods(namespace string, selector string) ([]v1.Pod, error) {
+	if f.failures > 0 {
+		f.failures--
+		return nil, fmt.Errorf("connection refused")
+	}
+	return f.testClient.ListPods(namespace, selector)
+}
+
+func TestControllerRetry(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	lister := &flakyLister{testClient: client, failures: 2}
+	c, err := New(lister, client,
+		WithGrace(time.Minute*5),
+		WithRetry(3, time.Millisecond, time.Millisecond*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	require.NoError(t, c.Once(context.Background()))
+	require.Equal(t, 0, client.lenPods())
+
+	// retries are used up
+	lister.failures = 3
+	require.Error(t, c.Once(context.Background()))
+
+	// not found is not retried
+	calls := 0
+	r := retrier{attempts: 3, initial: time.Millisecond, max: time.Millisecond}
+	err = r.do(context.Background(), zap.NewNop(), "test", func() error {
+		calls++
+		return k8sErrors.NewNotFound(schema.GroupResource{Resource: "pods"}, "pod0")
+	})
+	require.Error(t, err)
+	require.Equal(t, 1, calls)
+
+	_, err = New(client, client, WithRetry(0, time.Second, time.Second))
+	require.Error(t, err)
+}
+
+func TestControllerDeleteDelay(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Terminated", "Error"),
+	}
+
+	c, err := New(client, client,
+		WithGrace(time.Minute*5),
+		WithDeleteDelay(time.Hour),
+		WithDryRun(true),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// dry-run does not wait, so the run is not canceled during a delay
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	result, err := c.Run(ctx)
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithDeleteDelay(time.Millisecond*50),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	// no wait before the first pod, so two waits for three pods
+	start := time.Now()
+	result, err = c.Run(context.Background())
+	require.NoError(t, err)
+	require.Len(t, result.Deleted, 3)
+	require.True(t, time.Since(start) >= time.Millisecond*100)
+	require.Equal(t, 0, client.lenPods())
+
+	// stopping the loop interrupts the delay
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Terminated", "Error"),
+	}
+	c, err = New(client, client,
+		WithGrace(time.Minute*5),
+		WithDeleteDelay(time.Hour),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	done := make(chan error)
+	go func() {
+		done <- c.Loop()
+	}()
+
+	// the first pod is deleted, then the loop waits
+	client.waitForPods(t, 1)
+	stopLoop(t, c, done)
+	require.Equal(t, 1, client.lenPods())
+
+	_, err = New(client, client, WithDeleteDelay(-time.Second))
+	require.Error(t, err)
+}
+
+func TestRetryBackoff(t *testing.T) {
+	r := retrier{attempts: 10, initial: time.Second, max: time.Second * 5}
+	for attempt, max := range []time.Duration{time.Second, time.Second * 2, time.Second * 4, time.Second * 5, time.Second * 5} {
+		d := r.backoff(attempt + 1)
+		require.True(t, d >= max/2 && d <= max, "attempt %d: %s", attempt+1, d)
+	}
+}
+
+type pagingLister struct {
+	*testClient
+	pages int
+}
+
+func (p *pagingLister) ListPodPages(namespace string, selector string, fn func(pods []v1.Pod) error) error {
+	pods, err := p.testClient.ListPods(namespace, selector)
+	if err != nil {
+		return err
+	}
+	for i := range pods {
+		p.pages++
+		if err := fn(pods[i : i+1]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestControllerPages(t *testing.T) {
+	client := &testClient{}
+	client.pods = []v1.Pod{
+		makePod(time.Hour, "default", "pod0", v1.PodRunning, "Terminated", "Error"),
+		makePod(time.Hour, "default", "pod1", v1.PodRunning, "Running", ""),
+		makePod(time.Hour, "default", "pod2", v1.PodRunning, "Waiting", "CrashLoopBackOff"),
+	}
+
+	lister := &pagingLister{testClient: client}
+	c, err := New(lister, client,
+		WithGrace(time.Minute*5),
+		WithLogger(zap.NewNop()),
+	)
+	require.NoError(t, err)
+
+	result, err := c.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 3, lister.pages)
+	// each page is timed
+	require.Equal(t, uint64(3), sampleCount(t, c, "pod_deleter_list_duration_seconds"))
+	require.Len(t, result.Deleted, 2)
+	require.Len(t, result.Skipped, 1)
+	require.Equal(t, 1, client.lenPods())
+}
+
+func TestDecisions(t *testing.T) {
+	var d decisions
+	for i := 0; i < maxDecisions+5; i++ {
+		d.add(Decision{Name: fmt.Sprintf("pod%d", i)})
+	}
+
+	list := d.list()
+	require.Len(t, list, maxDecisions)
+	require.Equal(t, "pod5", list[0].Name)
+	require.Equal(t, fmt.Sprintf("pod%d", maxDecisions+4), list[maxDecisions-1].Name)
+}
@@ -0,0 +1,118 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// mirrorPodAnnotation is set by the kubelet on pods it creates for static
+// pods. Deleting them does nothing.
+const mirrorPodAnnotation = "kubernetes.io/config.mirror"
+
+// cordonTracker remembers when nodes were first seen to be cordoned, as
+// nodes do not record when they were made unschedulable.
+type cordonTracker struct {
+	lister NodeLister
+	delay  time.Duration
+
+	mu    sync.Mutex
+	since map[string]time.Time
+}
+
+// WithCordonedNodes returns an Option that deletes pods on cordoned nodes
+// once the node has been cordoned for longer than delay, even if no
+// container is in one of the reasons. This finishes drains that stalled.
+// DaemonSet and static pods are never matched, as they would be recreated
+// on the same node. The delay is measured from when the controller first
+// saw the node cordoned. Nodes are listed each run. Zero disables.
+// Used when creating a new Controller.
+func WithCordonedNodes(lister NodeLister, delay time.Duration) Option {
+	return func(c *Controller) error {
+		if delay < 0 {
+			return errors.New("cordoned node delay must not be negative")
+		}
+		if delay == 0 {
+			c.cordoned = nil
+			return nil
+		}
+		c.cordoned = &cordonTracker{lister: lister, delay: delay}
+		return nil
+	}
+}
+
+// update records the nodes that are cordoned. Nodes that are no longer
+// cordoned, or no longer exist, are forgotten.
+func (t *cordonTracker) update(nodes map[string]v1.Node, now time.Time) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since := make(map[string]time.Time)
+	for name, node := range nodes {
+		if !node.Spec.Unschedulable {
+			continue
+		}
+		if s, ok := t.since[name]; ok {
+			since[name] = s
+		} else {
+			since[name] = now
+		}
+	}
+	t.since = since
+}
+
+// cordonedFor returns how long a node has been cordoned. It returns false
+// if the node is not cordoned.
+func (t *cordonTracker) cordonedFor(node string, now time.Time) (time.Duration, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since, ok := t.since[node]
+	if !ok {
+		return 0, false
+	}
+	return now.Sub(since), true
+}
+
+// listNodes returns the nodes keyed by name.
+func listNodes(lister NodeLister) (map[string]v1.Node, error) {
+	list, err := lister.ListNodes()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	nodes := make(map[string]v1.Node, len(list))
+	for _, n := range list {
+		nodes[n.ObjectMeta.Name] = n
+	}
+	return nodes, nil
+}
+
+// checkCordoned matches a pod that was skipped only because of its
+// container reasons if its node has been cordoned for longer than the
+// delay. The node may be cordoned between runs, so it is never cached.
+func (c *Controller) checkCordoned(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if c.cordoned == nil || pod.Spec.NodeName == "" || !r.recheckable(logger, pod, skip) {
+		return reason, skip, detail
+	}
+
+	if _, ok := pod.ObjectMeta.Annotations[mirrorPodAnnotation]; ok {
+		return reason, skip, detail
+	}
+	if ref := metav1.GetControllerOf(&pod); ref != nil && ref.Kind == "DaemonSet" {
+		return reason, skip, detail
+	}
+
+	if d, ok := c.cordoned.cordonedFor(pod.Spec.NodeName, s.now); ok && d > c.cordoned.delay {
+		logger.Debug("pod is on a cordoned node",
+			zap.String("node", pod.Spec.NodeName),
+			zap.Duration("cordoned", d),
+		)
+		return "Cordoned", "", ""
+	}
+	return reason, skip, detail
+}
@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+// maxDecisions is the number of recent decisions kept
+const maxDecisions = 100
+
+// Decision records what the controller did with a candidate.
+type Decision struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	Rule      string    `json:"rule,omitempty"`
+	// Owner is the kind and name of the pod's controller, such as ReplicaSet/web-1234
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason"`
+	// Action is "deleted", "skipped", or the name of the action
+	// applied to the pod if it was not deleted
+	Action string `json:"action"`
+	// Skip is why the candidate was skipped
+	Skip string `json:"skip,omitempty"`
+	// Detail is the value that caused the skip, such as the pod phase
+	Detail string `json:"detail,omitempty"`
+	DryRun bool   `json:"dryRun,omitempty"`
+	Error  string `json:"error,omitempty"`
+	// RunID is the ID of the run that made the decision
+	RunID string `json:"runID,omitempty"`
+}
+
+// decisions is a ring buffer of recent decisions
+type decisions struct {
+	mu    sync.Mutex
+	items []Decision
+	next  int
+}
+
+func (d *decisions) add(item Decision) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	if len(d.items) < maxDecisions {
+		d.items = append(d.items, item)
+		return
+	}
+	d.items[d.next] = item
+	d.next = (d.next + 1) % maxDecisions
+}
+
+// list returns the decisions, oldest first
+func (d *decisions) list() []Decision {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	out := make([]Decision, 0, len(d.items))
+	out = append(out, d.items[d.next:]...)
+	out = append(out, d.items[:d.next]...)
+	return out
+}
+
+func (c *Controller) decide(cand Candidate, action string, skip string, detail string, err error) Decision {
+	d := Decision{
+		Time:      time.Now(),
+		Namespace: cand.Pod.ObjectMeta.Namespace,
+		Name:      cand.Pod.ObjectMeta.Name,
+		Rule:      cand.Rule,
+		Owner:     cand.Owner(),
+		Reason:    cand.Reason,
+		Action:    action,
+		Skip:      skip,
+		Detail:    detail,
+		DryRun:    c.isDryRun(),
+		RunID:     cand.RunID,
+	}
+	if err != nil {
+		d.Error = err.Error()
+	}
+	c.decisions.add(d)
+	return d
+}
+
+// OwnerKind returns the kind of the pod's controller, such as ReplicaSet,
+// or an empty string if it has none.
+func (d Decision) OwnerKind() string {
+	return strings.SplitN(d.Owner, "/", 2)[0]
+}
+
+// RecentDecisions returns the most recent decisions made by the controller, oldest first.
+func (c *Controller) RecentDecisions() []Decision {
+	return c.decisions.list()
+}
@@ -0,0 +1,44 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// wait blocks for the delay between deletions, unless this is the first
+// pod acted on in the run or pods are not being changed. It returns false
+// if the context was canceled while waiting.
+func (c *Controller) wait(ctx context.Context, logger *zap.Logger, acted bool) bool {
+	if !acted || c.deleteDelay <= 0 || c.isDryRun() {
+		return true
+	}
+
+	logger.Debug("waiting before acting on pod", zap.Duration("delay", c.deleteDelay))
+
+	t := time.NewTimer(c.deleteDelay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// WithDeleteDelay returns an Option that sets how long to wait between
+// acting on consecutive pods in a run, so the pods are not all replaced
+// at once. Retries of a single pod do not wait for it, and it is skipped
+// in dry-run mode. Zero disables. Default is zero.
+// Used when creating a new Controller.
+func WithDeleteDelay(d time.Duration) Option {
+	return func(c *Controller) error {
+		if d < 0 {
+			return errors.New("delete delay must not be negative")
+		}
+		c.deleteDelay = d
+		return nil
+	}
+}
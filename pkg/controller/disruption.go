@@ -0,0 +1,59 @@
+package controller
+
+import (
+	"k8s.io/api/core/v1"
+)
+
+// Annotations used by node autoscalers to mark pods that must not be
+// disrupted. Pods with any of them are skipped unless
+// WithIgnoreDisruptionAnnotations is used.
+const (
+	// SafeToEvictAnnotation set to "false" stops the cluster-autoscaler
+	// from evicting a pod to scale down its node.
+	SafeToEvictAnnotation = "cluster-autoscaler.kubernetes.io/safe-to-evict"
+	// DoNotDisruptAnnotation set to "true" stops Karpenter from
+	// disrupting a pod.
+	DoNotDisruptAnnotation = "karpenter.sh/do-not-disrupt"
+	// DoNotEvictAnnotation is the annotation used by Karpenter before
+	// v0.32, in place of DoNotDisruptAnnotation.
+	DoNotEvictAnnotation = "karpenter.sh/do-not-evict"
+)
+
+// disruptionFilter skips pods that an autoscaler would not disrupt,
+// unless ignore is set.
+type disruptionFilter struct {
+	ignore bool
+}
+
+func (f disruptionFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f disruptionFilter) check(pod v1.Pod) (Verdict, string, string) {
+	if f.ignore {
+		return Continue, "", ""
+	}
+
+	annotations := pod.ObjectMeta.Annotations
+	if annotations[SafeToEvictAnnotation] == "false" {
+		return Skip, "SafeToEvict", SafeToEvictAnnotation + "=false"
+	}
+	for _, name := range []string{DoNotDisruptAnnotation, DoNotEvictAnnotation} {
+		if annotations[name] == "true" {
+			return Skip, "DoNotDisrupt", name + "=true"
+		}
+	}
+	return Continue, "", ""
+}
+
+// WithIgnoreDisruptionAnnotations returns an Option that sets whether to
+// ignore the cluster-autoscaler and Karpenter annotations that mark pods
+// that must not be disrupted. By default, pods with them are skipped.
+// Used when creating a new Controller.
+func WithIgnoreDisruptionAnnotations(ignore bool) Option {
+	return func(c *Controller) error {
+		c.disruption = disruptionFilter{ignore: ignore}
+		return nil
+	}
+}
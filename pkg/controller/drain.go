@@ -0,0 +1,61 @@
+package controller
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+// DrainAnnotation marks a node as being drained. Candidates on nodes
+// with this annotation set to "true" are deleted before any others.
+const DrainAnnotation = "pod-deleter.bakins.io/drain"
+
+// NodeLister gets a list of nodes.
+type NodeLister interface {
+	ListNodes() ([]v1.Node, error)
+}
+
+// drainNodes returns the names of nodes that are being drained: those
+// set with WithDrainNodes and, if a node lister is set, those with the drain annotation.
+func (c *Controller) drainNodes() (map[string]bool, error) {
+	nodes := make(map[string]bool, len(c.drain))
+	for _, n := range c.drain {
+		nodes[n] = true
+	}
+
+	if c.nodeLister == nil {
+		return nodes, nil
+	}
+
+	list, err := c.nodeLister.ListNodes()
+	if err != nil {
+		return nodes, errors.Wrap(err, "failed to list nodes")
+	}
+
+	for _, n := range list {
+		if n.ObjectMeta.Annotations[DrainAnnotation] == "true" {
+			nodes[n.ObjectMeta.Name] = true
+		}
+	}
+
+	return nodes, nil
+}
+
+// WithNodeLister returns an Option that sets the node lister. Nodes are
+// listed each run to find those with the drain annotation.
+// Used when creating a new Controller.
+func WithNodeLister(l NodeLister) Option {
+	return func(c *Controller) error {
+		c.nodeLister = l
+		return nil
+	}
+}
+
+// WithDrainNodes returns an Option that sets nodes that are being drained.
+// Candidates on these nodes are deleted before any others.
+// Used when creating a new Controller.
+func WithDrainNodes(nodes []string) Option {
+	return func(c *Controller) error {
+		c.drain = nodes
+		return nil
+	}
+}
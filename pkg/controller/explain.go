@@ -0,0 +1,233 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Step is the result of one filter or check in an explanation.
+type Step struct {
+	// Check is what was checked, such as "grace period"
+	Check string `json:"check"`
+	// Verdict is continue, skip, or match
+	Verdict string `json:"verdict"`
+	Reason  string `json:"reason,omitempty"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// RuleExplanation is how a single rule evaluated a pod.
+type RuleExplanation struct {
+	Rule  string `json:"rule,omitempty"`
+	Steps []Step `json:"steps"`
+	// Reason is set if the rule matched the pod, otherwise Skip is.
+	Reason string `json:"reason,omitempty"`
+	Skip   string `json:"skip,omitempty"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Explanation is how the controller would decide what to do with a pod.
+// The deletion budget, flap detection, and disruption budgets are not
+// considered.
+type Explanation struct {
+	Namespace string            `json:"namespace"`
+	Name      string            `json:"name"`
+	Rules     []RuleExplanation `json:"rules"`
+	// Rule, Reason, and Action are set if a rule matched the pod
+	Rule   string `json:"rule,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	Action string `json:"action,omitempty"`
+}
+
+// Matched returns true if a rule matched the pod
+func (e Explanation) Matched() bool {
+	return e.Reason != ""
+}
+
+// Explain evaluates a pod against every rule, recording each filter and
+// check, without acting on it. The evaluation cache is not used. Checks
+// that compare against earlier runs, such as the restart rate, only have
+// the samples this controller has seen.
+func (c *Controller) Explain(pod v1.Pod) (Explanation, error) {
+	c.mu.RLock()
+	rules := c.compiled
+	containers := c.containers
+	c.mu.RUnlock()
+
+	pod = containers.apply(pod)
+	logger := c.logger.With(
+		zap.String("namespace", pod.ObjectMeta.Namespace),
+		zap.String("name", pod.ObjectMeta.Name),
+	)
+
+	e := Explanation{
+		Namespace: pod.ObjectMeta.Namespace,
+		Name:      pod.ObjectMeta.Name,
+	}
+	state := c.newRunState(time.Now(), "")
+
+	for _, r := range rules {
+		re := RuleExplanation{Rule: r.Name}
+
+		if r.Namespace != "" && r.Namespace != pod.ObjectMeta.Namespace {
+			re.Steps = append(re.Steps, Step{Check: "namespace", Verdict: "skip", Reason: "Namespace", Detail: r.Namespace})
+			re.Skip, re.Detail = "Namespace", r.Namespace
+			e.Rules = append(e.Rules, re)
+			continue
+		}
+		selector, err := labels.Parse(r.Selector)
+		if err != nil {
+			return e, errors.Wrapf(err, "invalid selector %q", r.Selector)
+		}
+		if !selector.Matches(labels.Set(pod.ObjectMeta.Labels)) {
+			re.Steps = append(re.Steps, Step{Check: "selector", Verdict: "skip", Reason: "Selector", Detail: r.Selector})
+			re.Skip, re.Detail = "Selector", r.Selector
+			e.Rules = append(e.Rules, re)
+			continue
+		}
+
+		var reason, skip, detail string
+		for _, f := range r.filters {
+			verdict, why, d := checkFilter(f, pod)
+			re.Steps = append(re.Steps, Step{Check: filterName(f), Verdict: verdictName(verdict), Reason: why, Detail: d})
+			if verdict == Skip {
+				skip, detail = why, d
+				break
+			}
+			if verdict == Match {
+				reason = why
+				break
+			}
+		}
+		if reason == "" && skip == "" {
+			// the reason filter is always last
+			skip, detail = "Reason", noReasonDetail(pod)
+			re.Steps[len(re.Steps)-1] = Step{Check: "reasons", Verdict: "skip", Reason: skip, Detail: detail}
+		}
+
+		for _, check := range c.rechecks() {
+			step := Step{Check: check.name, Verdict: "continue"}
+			r2, s2, d2 := check.fn(r, state, logger, pod, reason, skip, detail)
+			if r2 != reason || s2 != skip {
+				step.Verdict, step.Reason, step.Detail = "match", r2, d2
+				if s2 != "" {
+					step.Verdict, step.Reason = "skip", s2
+				}
+			}
+			re.Steps = append(re.Steps, step)
+			reason, skip, detail = r2, s2, d2
+		}
+
+		re.Reason, re.Skip, re.Detail = reason, skip, detail
+		e.Rules = append(e.Rules, re)
+
+		if skip == "" && !e.Matched() {
+			cand := Candidate{Pod: pod, Rule: r.Name, Reason: reason, Action: r.Action, rule: r}
+			c.forceDelete(state, &cand)
+			e.Rule, e.Reason, e.Action = r.Name, reason, cand.Action
+		}
+	}
+
+	return e, nil
+}
+
+// WithExplain returns an Option that logs why each pod was skipped by each
+// rule at Info, rather than Debug, with the setting of the rule that the
+// pod was compared with, so skips can be understood without debug logging.
+// Used when creating a new Controller.
+func WithExplain(explain bool) Option {
+	return func(c *Controller) error {
+		c.explain = explain
+		return nil
+	}
+}
+
+// explainSkip logs why a rule skipped a pod
+func (c *Controller) explainSkip(r *rule, logger *zap.Logger, pod v1.Pod, skip, detail string) {
+	fields := []zapcore.Field{
+		zap.String("skip", skip),
+		zap.String("value", detail),
+	}
+	if setting := r.setting(skip, pod.ObjectMeta.Namespace); setting != "" {
+		fields = append(fields, zap.String("setting", setting))
+	}
+	if r.Name == "" {
+		// named rules are already in the logger
+		fields = append(fields, zap.String("rule", "default"))
+	}
+	logger.Info("pod skipped by rule", fields...)
+}
+
+// setting returns the rule's setting that caused a skip, such as the
+// grace period, or an empty string if the skip value explains itself.
+func (r *rule) setting(skip, namespace string) string {
+	reasons, grace := r.settingsFor(namespace)
+	switch skip {
+	case "CreationTimestamp", "StateTransition":
+		return "grace=" + grace.String()
+	case "FinishedAt":
+		return "minTerminatedAge=" + r.minTerminated.String()
+	case "Reason":
+		names := make([]string, 0, len(reasons))
+		for name := range reasons {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return "reasons=" + strings.Join(names, ",")
+	case "Image":
+		return "includeImages=" + strings.Join(r.IncludeImages, ",")
+	case "ExcludedImage":
+		return "excludeImages=" + strings.Join(r.ExcludeImages, ",")
+	case "PodPhase":
+		// the phase filter is always first
+		if f, ok := r.filters[0].(phaseFilter); ok && len(f.phases) > 0 {
+			names := make([]string, 0, len(f.phases))
+			for phase := range f.phases {
+				names = append(names, string(phase))
+			}
+			sort.Strings(names)
+			return "phases=" + strings.Join(names, ",")
+		}
+	}
+	return ""
+}
+
+func verdictName(v Verdict) string {
+	switch v {
+	case Skip:
+		return "skip"
+	case Match:
+		return "match"
+	}
+	return "continue"
+}
+
+// filterName describes a filter for explanations
+func filterName(f Filter) string {
+	switch f.(type) {
+	case phaseFilter:
+		return "phase"
+	case selectorFilter:
+		return "exclude and annotation selectors"
+	case serviceAccountFilter:
+		return "service account"
+	case priorityFilter:
+		return "priority"
+	case disruptionFilter:
+		return "disruption annotations"
+	case imageFilter:
+		return "images"
+	case graceFilter:
+		return "grace period"
+	case reasonFilter:
+		return "reasons"
+	}
+	return fmt.Sprintf("filter %T", f)
+}
@@ -0,0 +1,477 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// Verdict is the result of a Filter
+type Verdict int
+
+const (
+	// Continue means the filter has no opinion and the next filter is checked.
+	Continue Verdict = iota
+	// Skip means the pod must not be deleted.
+	Skip
+	// Match means the pod should be deleted.
+	Match
+)
+
+// Filter decides whether a pod should be deleted. Filters are checked in
+// order and the first Skip or Match wins. The string is the reason
+// for the verdict, such as the skip reason or the container state that matched.
+// Results are cached until the pod's resourceVersion changes, so a filter
+// should depend only on the pod. See WithEvalCache.
+type Filter interface {
+	Matches(pod v1.Pod) (Verdict, string)
+}
+
+// FilterFunc adapts a function to a Filter
+type FilterFunc func(pod v1.Pod) (Verdict, string)
+
+// Matches calls f(pod)
+func (f FilterFunc) Matches(pod v1.Pod) (Verdict, string) {
+	return f(pod)
+}
+
+// detailFilter is implemented by the built-in filters to report the
+// value that caused a skip.
+type detailFilter interface {
+	check(pod v1.Pod) (Verdict, string, string)
+}
+
+func checkFilter(f Filter, pod v1.Pod) (Verdict, string, string) {
+	if d, ok := f.(detailFilter); ok {
+		return d.check(pod)
+	}
+	verdict, reason := f.Matches(pod)
+	return verdict, reason, ""
+}
+
+// PhaseFilter skips pods that are pending, succeeded, or in an unknown phase.
+var PhaseFilter Filter = phaseFilter{}
+
+// phaseFilter skips pods that are not in one of the phases. If phases is
+// empty, pods that are pending, succeeded, or in an unknown phase are
+// skipped.
+type phaseFilter struct {
+	phases map[v1.PodPhase]bool
+}
+
+func (f phaseFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f phaseFilter) check(pod v1.Pod) (Verdict, string, string) {
+	if len(f.phases) > 0 {
+		if !f.phases[pod.Status.Phase] {
+			return Skip, "PodPhase", string(pod.Status.Phase)
+		}
+		return Continue, "", ""
+	}
+	switch pod.Status.Phase {
+	case v1.PodPending, v1.PodSucceeded, v1.PodUnknown:
+		return Skip, "PodPhase", string(pod.Status.Phase)
+	}
+	return Continue, "", ""
+}
+
+// WithPhases returns an Option that only evaluates pods in one of the
+// phases, such as Running and Failed. Pods in other phases are skipped.
+// Empty means pods that are running or failed, which is the default.
+// Used when creating a new Controller.
+func WithPhases(phases []string) Option {
+	return func(c *Controller) error {
+		c.phases.phases = make(map[v1.PodPhase]bool, len(phases))
+		for _, phase := range phases {
+			switch p := v1.PodPhase(phase); p {
+			case v1.PodPending, v1.PodRunning, v1.PodSucceeded, v1.PodFailed, v1.PodUnknown:
+				c.phases.phases[p] = true
+			default:
+				return errors.Errorf("invalid pod phase %q", phase)
+			}
+		}
+		return nil
+	}
+}
+
+// imageFilter skips pods by container image, using the rule's patterns
+type imageFilter struct {
+	r *rule
+}
+
+func (f imageFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f imageFilter) check(pod v1.Pod) (Verdict, string, string) {
+	if skip, image := f.r.checkImages(pod); skip != "" {
+		return Skip, skip, image
+	}
+	return Continue, "", ""
+}
+
+// graceFilter skips pods younger than the rule's grace period
+type graceFilter struct {
+	r *rule
+}
+
+func (f graceFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f graceFilter) check(pod v1.Pod) (Verdict, string, string) {
+	reasons, grace := f.r.settingsFor(pod.ObjectMeta.Namespace)
+	if len(f.r.ReasonGrace) > 0 {
+		grace = f.r.reasonGraceFor(pod, reasons, grace)
+	}
+	if f.r.graceFrom == GraceFromState {
+		since := stateSince(&pod)
+		if since.Add(grace).After(time.Now()) {
+			return Skip, "StateTransition", since.Format(time.RFC3339)
+		}
+		return Continue, "", ""
+	}
+
+	created := pod.ObjectMeta.CreationTimestamp.Time
+	if created.Add(grace).After(time.Now()) {
+		return Skip, "CreationTimestamp", created.Format(time.RFC3339)
+	}
+	return Continue, "", ""
+}
+
+// reasonGraceFor returns the shortest grace period of the reasons the
+// pod's containers are in. Reasons without a grace period use grace, as
+// do pods with no container in a reason.
+func (r *rule) reasonGraceFor(pod v1.Pod, reasons map[string]bool, grace time.Duration) time.Duration {
+	shortest := time.Duration(-1)
+	for _, reason := range containerReasons(pod) {
+		if !reasons[reason] {
+			continue
+		}
+		g := r.ReasonGrace[reason]
+		if g == 0 {
+			g = grace
+		}
+		if shortest < 0 || g < shortest {
+			shortest = g
+		}
+	}
+	if shortest < 0 {
+		return grace
+	}
+	return shortest
+}
+
+// Where the grace period is measured from. See WithGraceFrom.
+const (
+	GraceFromCreation = "creation"
+	GraceFromState    = "state"
+)
+
+// WithGraceFrom returns an Option that sets where the grace period is
+// measured from. GraceFromCreation, the default, uses the pod's creation
+// time. GraceFromState uses when the pod became unhealthy, so a pod that
+// ran fine for a week and just started failing is not deleted at once.
+// Used when creating a new Controller.
+func WithGraceFrom(from string) Option {
+	return func(c *Controller) error {
+		switch from {
+		case "":
+			from = GraceFromCreation
+		case GraceFromCreation, GraceFromState:
+		default:
+			return errors.Errorf("invalid grace period start %q", from)
+		}
+		c.graceFrom = from
+		return nil
+	}
+}
+
+// stateSince returns when the pod became unhealthy: when its Ready
+// condition became false or, if it has none, the earliest time a
+// container that is not running stopped. If neither is known, it is the
+// pod's creation time.
+func stateSince(pod *v1.Pod) time.Time {
+	if since, ok := notReadySince(pod); ok && since.After(pod.ObjectMeta.CreationTimestamp.Time) {
+		return since
+	}
+
+	var since time.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		var t time.Time
+		switch {
+		case status.State.Terminated != nil:
+			t = status.State.Terminated.FinishedAt.Time
+		case status.State.Waiting != nil && status.LastTerminationState.Terminated != nil:
+			t = status.LastTerminationState.Terminated.FinishedAt.Time
+		}
+		if !t.IsZero() && (since.IsZero() || t.Before(since)) {
+			since = t
+		}
+	}
+	if since.IsZero() {
+		return pod.ObjectMeta.CreationTimestamp.Time
+	}
+	return since
+}
+
+// reasonFilter matches pods with a container in one of the rule's reasons
+type reasonFilter struct {
+	r *rule
+}
+
+func (f reasonFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+// check matches the first container in one of the reasons. If the rule
+// has a minimum terminated age, a container that stopped more recently is
+// skipped, and the pod is skipped if no other container matches.
+func (f reasonFilter) check(pod v1.Pod) (Verdict, string, string) {
+	reasons, _ := f.r.settingsFor(pod.ObjectMeta.Namespace)
+	var recent time.Time
+	for i, reason := range containerReasons(pod) {
+		if !reasons[reason] {
+			continue
+		}
+		if f.r.minTerminated > 0 {
+			finished := finishedAt(pod.Status.ContainerStatuses[i])
+			if !finished.IsZero() && finished.Add(f.r.minTerminated).After(time.Now()) {
+				if finished.After(recent) {
+					recent = finished
+				}
+				continue
+			}
+		}
+		return Match, reason, ""
+	}
+	if !recent.IsZero() {
+		return Skip, "FinishedAt", recent.Format(time.RFC3339)
+	}
+	return Continue, "", ""
+}
+
+// finishedAt returns when a container last terminated: the current state
+// if it is terminated, otherwise the last termination state. It is zero
+// if the container has not terminated.
+func finishedAt(status v1.ContainerStatus) time.Time {
+	if status.State.Terminated != nil {
+		return status.State.Terminated.FinishedAt.Time
+	}
+	if status.LastTerminationState.Terminated != nil {
+		return status.LastTerminationState.Terminated.FinishedAt.Time
+	}
+	return time.Time{}
+}
+
+// WithMinTerminatedAge returns an Option that only matches a container's
+// reason if the container terminated at least this long ago, so the
+// kubelet has a chance to restart it first.
+// Zero disables the check, which is the default.
+// Used when creating a new Controller.
+func WithMinTerminatedAge(age time.Duration) Option {
+	return func(c *Controller) error {
+		if age < 0 {
+			return errors.New("minimum terminated age must not be negative")
+		}
+		c.minTerminated = age
+		return nil
+	}
+}
+
+// containerReasons returns the terminated or waiting reason of each
+// container, or an empty string for running containers.
+func containerReasons(pod v1.Pod) []string {
+	reasons := make([]string, 0, len(pod.Status.ContainerStatuses))
+	for _, status := range pod.Status.ContainerStatuses {
+		reason := ""
+		if status.State.Terminated != nil {
+			reason = status.State.Terminated.Reason
+		} else if status.State.Waiting != nil {
+			reason = status.State.Waiting.Reason
+		}
+		reasons = append(reasons, reason)
+	}
+	return reasons
+}
+
+// noReasonDetail lists the non-empty container reasons of a pod
+// that did not match any reason.
+func noReasonDetail(pod v1.Pod) string {
+	var seen []string
+	for _, reason := range containerReasons(pod) {
+		if reason != "" {
+			seen = append(seen, reason)
+		}
+	}
+	return strings.Join(seen, ",")
+}
+
+// WithFilters returns an Option that adds filters to every rule. They are
+// checked after the built-in phase, selector, service account, image, and grace period filters, and
+// before the container reasons, so they may skip pods or match pods that
+// are not in one of the reasons. It may be used more than once.
+// Used when creating a new Controller.
+func WithFilters(filters ...Filter) Option {
+	return func(c *Controller) error {
+		c.filters = append(c.filters, filters...)
+		return nil
+	}
+}
+
+// serviceAccountFilter skips pods running as excluded service accounts
+type serviceAccountFilter struct {
+	// names holds "name" for any namespace and "namespace/name"
+	names map[string]bool
+}
+
+func (f serviceAccountFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f serviceAccountFilter) check(pod v1.Pod) (Verdict, string, string) {
+	name := pod.Spec.ServiceAccountName
+	if name == "" {
+		name = "default"
+	}
+	if f.names[name] || f.names[pod.ObjectMeta.Namespace+"/"+name] {
+		return Skip, "ServiceAccount", pod.ObjectMeta.Namespace + "/" + name
+	}
+	return Continue, "", ""
+}
+
+// WithExcludeServiceAccounts returns an Option that skips pods running as
+// any of the service accounts. A name without a namespace matches service
+// accounts with that name in all namespaces; "namespace/name" matches one.
+// Used when creating a new Controller.
+func WithExcludeServiceAccounts(names []string) Option {
+	return func(c *Controller) error {
+		c.excludeSAs = names
+		return nil
+	}
+}
+
+// selectorFilter skips pods whose labels match the exclude selector, or
+// whose annotations do not match the annotation selector. Nil selectors
+// are not checked.
+type selectorFilter struct {
+	exclude     labels.Selector
+	annotations labels.Selector
+}
+
+func (f selectorFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f selectorFilter) check(pod v1.Pod) (Verdict, string, string) {
+	if f.exclude != nil && f.exclude.Matches(labels.Set(pod.ObjectMeta.Labels)) {
+		return Skip, "ExcludeSelector", f.exclude.String()
+	}
+	if f.annotations != nil && !f.annotations.Matches(labels.Set(pod.ObjectMeta.Annotations)) {
+		return Skip, "AnnotationSelector", f.annotations.String()
+	}
+	return Continue, "", ""
+}
+
+// WithExcludeSelector returns an Option that skips pods that match the
+// label selector, such as team=storage. It applies on top of the selector
+// used to list pods, and to every rule. Empty excludes nothing.
+// Used when creating a new Controller.
+func WithExcludeSelector(selector string) Option {
+	return func(c *Controller) error {
+		if selector == "" {
+			c.excludeLabels = nil
+			return nil
+		}
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return errors.Wrapf(err, "invalid exclude selector %q", selector)
+		}
+		c.excludeLabels = s
+		return nil
+	}
+}
+
+// WithAnnotationSelector returns an Option that only considers pods whose
+// annotations match the selector, such as "deploy-tool=spinnaker,!debug".
+// It uses the label selector syntax, but is checked by the controller
+// after listing pods, as the API cannot select by annotation. Empty
+// matches all pods.
+// Used when creating a new Controller.
+func WithAnnotationSelector(selector string) Option {
+	return func(c *Controller) error {
+		if selector == "" {
+			c.annotations = nil
+			return nil
+		}
+		s, err := labels.Parse(selector)
+		if err != nil {
+			return errors.Wrapf(err, "invalid annotation selector %q", selector)
+		}
+		c.annotations = s
+		return nil
+	}
+}
+
+// priorityFilter skips pods at or above a priority, or not in one of
+// the priority classes. Zero min disables the priority check.
+type priorityFilter struct {
+	min     int32
+	classes map[string]bool
+}
+
+func (f priorityFilter) Matches(pod v1.Pod) (Verdict, string) {
+	verdict, reason, _ := f.check(pod)
+	return verdict, reason
+}
+
+func (f priorityFilter) check(pod v1.Pod) (Verdict, string, string) {
+	// the priority is only set when the priority admission controller is enabled
+	var priority int32
+	if pod.Spec.Priority != nil {
+		priority = *pod.Spec.Priority
+	}
+	if f.min != 0 && priority >= f.min {
+		return Skip, "Priority", strconv.Itoa(int(priority))
+	}
+	if len(f.classes) > 0 && !f.classes[pod.Spec.PriorityClassName] {
+		return Skip, "PriorityClass", pod.Spec.PriorityClassName
+	}
+	return Continue, "", ""
+}
+
+// WithMinProtectedPriority returns an Option that skips pods with a
+// priority at or above min, such as 2000000000 for system-cluster-critical.
+// Zero disables the check.
+// Used when creating a new Controller.
+func WithMinProtectedPriority(min int32) Option {
+	return func(c *Controller) error {
+		c.priority.min = min
+		return nil
+	}
+}
+
+// WithPriorityClasses returns an Option that skips pods that are not
+// in one of the priority classes. Empty means pods in any class.
+// Used when creating a new Controller.
+func WithPriorityClasses(classes []string) Option {
+	return func(c *Controller) error {
+		c.priority.classes = make(map[string]bool, len(classes))
+		for _, class := range classes {
+			c.priority.classes[class] = true
+		}
+		return nil
+	}
+}
@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// finishedJobs matches the pods of Jobs that finished longer ago than the
+// TTL
+type finishedJobs struct {
+	jobs JobClient
+	ttl  time.Duration
+}
+
+// jobState is when a Job finished, looked up at most once per run
+type jobState struct {
+	finished time.Time
+	// missing is true if the Job no longer exists
+	missing bool
+}
+
+// WithFinishedJobPods returns an Option that deletes the pods of Jobs that
+// completed or failed longer than ttl ago, with the reason JobFinished, for
+// clusters without the TTL-after-finished controller. Only pods that are
+// Succeeded or Failed are deleted, so a Job that is still running does not
+// replace them. If the Job no longer exists, the time is measured from when
+// the pod's containers finished. This is separate from the crash loop
+// reasons and grace period. Zero disables.
+// Used when creating a new Controller.
+func WithFinishedJobPods(jobs JobClient, ttl time.Duration) Option {
+	return func(c *Controller) error {
+		if ttl < 0 {
+			return errors.New("finished job TTL must not be negative")
+		}
+		if ttl == 0 {
+			c.finishedJobs = nil
+			return nil
+		}
+		c.finishedJobs = &finishedJobs{jobs: jobs, ttl: ttl}
+		return nil
+	}
+}
+
+// jobFinishedAt returns when a Job completed or failed. It returns false
+// if the Job has not finished.
+func jobFinishedAt(job *batchv1.Job) (time.Time, bool) {
+	for _, cond := range job.Status.Conditions {
+		if cond.Status != v1.ConditionTrue {
+			continue
+		}
+		switch cond.Type {
+		case batchv1.JobComplete:
+			if job.Status.CompletionTime != nil {
+				return job.Status.CompletionTime.Time, true
+			}
+			return cond.LastTransitionTime.Time, true
+		case batchv1.JobFailed:
+			return cond.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// podFinishedAt returns when the last of a pod's containers terminated,
+// or its creation time if none have.
+func podFinishedAt(pod *v1.Pod) time.Time {
+	finished := pod.ObjectMeta.CreationTimestamp.Time
+	for _, status := range pod.Status.ContainerStatuses {
+		if t := status.State.Terminated; t != nil && t.FinishedAt.After(finished) {
+			finished = t.FinishedAt.Time
+		}
+	}
+	return finished
+}
+
+// job returns the state of the named Job, looking it up if this is the
+// first time in the run. Failures are logged and the Job is treated as not
+// finished.
+func (f *finishedJobs) job(s *runState, logger *zap.Logger, namespace, name string) jobState {
+	key := namespace + "/" + name
+	if state, ok := s.jobs[key]; ok {
+		return state
+	}
+
+	var state jobState
+	job, err := f.jobs.GetJob(namespace, name)
+	switch {
+	case k8sErrors.IsNotFound(err):
+		state.missing = true
+	case err != nil:
+		logger.Warn("failed to get job", zap.String("job", name), zap.Error(err))
+	default:
+		state.finished, _ = jobFinishedAt(job)
+	}
+
+	if s.jobs == nil {
+		s.jobs = make(map[string]jobState)
+	}
+	s.jobs[key] = state
+	return state
+}
+
+// checkFinishedJob matches a skipped pod if it belongs to a Job that
+// finished longer than the TTL ago. The filters are evaluated again
+// without the phase, grace period, and reasons, which the TTL replaces, so
+// the other filters, such as excluded service accounts, must still pass.
+// Jobs change between runs, so it is never cached.
+func (c *Controller) checkFinishedJob(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if c.finishedJobs == nil || skip == "" {
+		return reason, skip, detail
+	}
+	if pod.Status.Phase != v1.PodSucceeded && pod.Status.Phase != v1.PodFailed {
+		return reason, skip, detail
+	}
+	ref := metav1.GetControllerOf(&pod)
+	if ref == nil || ref.Kind != "Job" {
+		return reason, skip, detail
+	}
+
+	// the phase filter is always first
+	filters := make([]Filter, 0, len(r.filters)-1)
+	for _, f := range r.filters[1:] {
+		if _, ok := f.(graceFilter); !ok {
+			filters = append(filters, f)
+		}
+	}
+	if _, filtered, _ := r.evaluateFilters(logger, pod, filters); filtered != "" && filtered != "Reason" {
+		return reason, skip, detail
+	}
+
+	state := c.finishedJobs.job(s, logger, pod.ObjectMeta.Namespace, ref.Name)
+	finished := state.finished
+	if state.missing {
+		finished = podFinishedAt(&pod)
+	}
+	if finished.IsZero() {
+		return reason, skip, detail
+	}
+
+	if d := s.now.Sub(finished); d > c.finishedJobs.ttl {
+		logger.Debug("pod belongs to a finished job", zap.String("job", ref.Name), zap.Duration("finished", d))
+		return "JobFinished", "", ""
+	}
+	return reason, skip, detail
+}
@@ -0,0 +1,222 @@
+package controller
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RunIDAnnotation is set on events to the ID of the run that created them
+const RunIDAnnotation = "pod-deleter.bakins.io/run-id"
+
+// EventRecorder creates Kubernetes events
+type EventRecorder interface {
+	CreateEvent(event *v1.Event) error
+}
+
+// flapDetector tracks deletions per workload. A workload whose pods are
+// deleted threshold times within the window is flapping: deleting its pods
+// is not fixing it, so they are skipped until enough deletions leave the window.
+type flapDetector struct {
+	threshold int
+	window    time.Duration
+
+	mu        sync.Mutex
+	deletions map[string][]time.Time
+}
+
+// expire drops deletions older than the window. Must be called with mu held.
+func (f *flapDetector) expire(key string, now time.Time) []time.Time {
+	cutoff := now.Add(-f.window)
+	times := f.deletions[key]
+	i := 0
+	for i < len(times) && !times[i].After(cutoff) {
+		i++
+	}
+	times = times[i:]
+	if len(times) == 0 {
+		delete(f.deletions, key)
+	} else {
+		f.deletions[key] = times
+	}
+	return times
+}
+
+// flapping returns true if the workload is flapping
+func (f *flapDetector) flapping(key string, now time.Time) bool {
+	if f.threshold <= 0 || key == "" {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return len(f.expire(key, now)) >= f.threshold
+}
+
+// record adds a deletion for a workload. It returns true if the
+// workload started flapping.
+func (f *flapDetector) record(key string, now time.Time) bool {
+	if f.threshold <= 0 || key == "" {
+		return false
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.deletions == nil {
+		f.deletions = make(map[string][]time.Time)
+	}
+
+	times := append(f.expire(key, now), now)
+	// deletions loaded from a shared history may be out of order
+	sort.Slice(times, func(i, j int) bool { return times[i].Before(times[j]) })
+	f.deletions[key] = times
+	return len(times) == f.threshold
+}
+
+// list returns the keys of the flapping workloads
+func (f *flapDetector) list(now time.Time) []string {
+	if f.threshold <= 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var keys []string
+	for key := range f.deletions {
+		if len(f.expire(key, now)) >= f.threshold {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// cooldowns returns the flapping workloads, and when each stops flapping
+func (f *flapDetector) cooldowns(now time.Time) []Cooldown {
+	if f.threshold <= 0 {
+		return nil
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var cooldowns []Cooldown
+	for key := range f.deletions {
+		times := f.expire(key, now)
+		if len(times) < f.threshold {
+			continue
+		}
+		cooldowns = append(cooldowns, Cooldown{
+			Owner:     key,
+			Deletions: len(times),
+			// once this deletion leaves the window, there are fewer than
+			// threshold
+			Until: times[len(times)-f.threshold].Add(f.window),
+		})
+	}
+	sort.Slice(cooldowns, func(i, j int) bool { return cooldowns[i].Owner < cooldowns[j].Owner })
+	return cooldowns
+}
+
+// ownerKey identifies the workload that owns a candidate as
+// "namespace/kind/name", or an empty string if it has no owner.
+func ownerKey(cand Candidate) string {
+	owner := cand.Owner()
+	if owner == "" {
+		return ""
+	}
+	return cand.Pod.ObjectMeta.Namespace + "/" + owner
+}
+
+// recordFlap records a deletion for the candidate's owner and, if the
+// owner started flapping, logs it, creates an event, calls the escalation
+// hooks, and scales down its Deployment if enabled.
+func (c *Controller) recordFlap(cand Candidate, now time.Time) {
+	key := ownerKey(cand)
+	if !c.flaps.record(key, now) {
+		return
+	}
+
+	cand.logger.Warn("workload is flapping. Its pods will not be deleted until deletions leave the window",
+		zap.String("owner", cand.Owner()),
+		zap.Int("deletions", c.flaps.threshold),
+		zap.Duration("window", c.flaps.window),
+	)
+	c.scaleDown(cand, now)
+
+	event := flapEvent(cand, c.flaps.threshold, c.flaps.window, now)
+	c.onEscalate(cand, event)
+	if c.events == nil {
+		return
+	}
+
+	if err := c.events.CreateEvent(event); err != nil {
+		cand.logger.Warn("failed to create event", zap.Error(errors.Wrap(err, "flapping")))
+	}
+}
+
+// flapEvent creates a warning event for the owner of a flapping candidate
+func flapEvent(cand Candidate, deletions int, window time.Duration, now time.Time) *v1.Event {
+	ref := metav1.GetControllerOf(&cand.Pod)
+	ts := metav1.NewTime(now)
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    cand.Pod.ObjectMeta.Namespace,
+			Annotations: map[string]string{
+				RunIDAnnotation: cand.RunID,
+			},
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			Namespace:  cand.Pod.ObjectMeta.Namespace,
+			UID:        ref.UID,
+		},
+		Reason: "Flapping",
+		Message: fmt.Sprintf("%d pods were deleted by k8s-pod-deleter within %s; deletions are paused",
+			deletions, window),
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: "k8s-pod-deleter"},
+		FirstTimestamp: ts,
+		LastTimestamp:  ts,
+		Count:          1,
+	}
+}
+
+// WithFlapDetection returns an Option that stops deleting pods owned by a
+// workload once threshold of its pods have been deleted within the window.
+// Deletions resume once enough deletions leave the window. Zero
+// disables flap detection, which is the default.
+// Used when creating a new Controller.
+func WithFlapDetection(threshold int, window time.Duration) Option {
+	return func(c *Controller) error {
+		if threshold > 0 && window <= 0 {
+			return errors.New("flap window must be positive")
+		}
+		c.flaps = &flapDetector{
+			threshold: threshold,
+			window:    window,
+		}
+		return nil
+	}
+}
+
+// WithEventRecorder returns an Option that sets the recorder used to
+// create events, such as when a workload is flapping.
+// Used when creating a new Controller.
+func WithEventRecorder(r EventRecorder) Option {
+	return func(c *Controller) error {
+		c.events = r
+		return nil
+	}
+}
@@ -0,0 +1,141 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/history"
+	"go.uber.org/zap"
+)
+
+// History persists the pods deleted by the controller, so the budget and
+// flap detection survive restarts. *history.Store implements History.
+type History interface {
+	Record(d history.Deletion) error
+	Since(t time.Time) []history.Deletion
+}
+
+// RestartHistory is implemented by histories that also keep the restart
+// counts observed by the controller, so restart deltas survive restarts.
+// *history.Store implements RestartHistory.
+type RestartHistory interface {
+	Restarts() []history.Restart
+	SaveRestarts(restarts []history.Restart) error
+}
+
+// SharedHistory is implemented by histories that other replicas of the
+// controller record deletions in as well. Reload returns the deletions
+// recorded by others since the last call. *history.Store implements
+// SharedHistory.
+type SharedHistory interface {
+	Reload() ([]history.Deletion, error)
+}
+
+// WithHistory returns an Option that records deletions in h. Past
+// deletions in h count towards the budget and flap detection. If h is a
+// RestartHistory, restart counts are kept in it as well.
+// Used when creating a new Controller.
+func WithHistory(h History) Option {
+	return func(c *Controller) error {
+		c.history = h
+		return nil
+	}
+}
+
+// History returns the deletions recorded since t, oldest first. It
+// returns nil if the controller does not have a history.
+func (c *Controller) History(since time.Time) []history.Deletion {
+	if c.history == nil {
+		return nil
+	}
+	return c.history.Since(since)
+}
+
+// loadHistory adds past deletions to the budget, flap detector, and
+// replacement checks
+func (c *Controller) loadHistory(now time.Time) {
+	window := c.budget.window
+	if c.flaps.window > window {
+		window = c.flaps.window
+	}
+	if r := c.replacements; r != nil && r.window > window {
+		window = r.window
+	}
+
+	for _, d := range c.history.Since(now.Add(-window)) {
+		if d.Time.After(now.Add(-c.budget.window)) {
+			c.budget.record(d.Time)
+		}
+		if d.Owner != "" && d.Time.After(now.Add(-c.flaps.window)) {
+			c.flaps.record(d.Namespace+"/"+d.Owner, d.Time)
+		}
+		if r := c.replacements; r != nil && d.Time.After(now.Add(-r.window)) {
+			r.add(d)
+		}
+	}
+}
+
+// reloadHistory adds the deletions recorded by other replicas to the
+// budget and flap detector, so they are shared. Errors are logged, as the
+// run can go on with what is already known.
+func (c *Controller) reloadHistory(now time.Time) {
+	sh, ok := c.history.(SharedHistory)
+	if !ok {
+		return
+	}
+
+	added, err := sh.Reload()
+	if err != nil {
+		c.logger.Warn("failed to reload history", zap.Error(err))
+		return
+	}
+	for _, d := range added {
+		if d.Time.After(now.Add(-c.budget.window)) {
+			c.budget.record(d.Time)
+		}
+		if d.Owner != "" && d.Time.After(now.Add(-c.flaps.window)) {
+			c.flaps.record(d.Namespace+"/"+d.Owner, d.Time)
+		}
+	}
+}
+
+// loadRestarts adds past restart counts to the restart tracker
+func (c *Controller) loadRestarts(now time.Time) {
+	if rh, ok := c.history.(RestartHistory); ok {
+		c.restarts.load(rh.Restarts())
+		c.restarts.expire(now, c.restartWindow)
+	}
+}
+
+// saveRestarts saves the restart counts of pods that are restarting
+func (c *Controller) saveRestarts() {
+	rh, ok := c.history.(RestartHistory)
+	if !ok {
+		return
+	}
+	if err := rh.SaveRestarts(c.restarts.restarting()); err != nil {
+		c.logger.Warn("failed to save restarts in history", zap.Error(err))
+	}
+}
+
+// deletion returns the history record of acting on a candidate
+func (cand Candidate) deletion(now time.Time) history.Deletion {
+	return history.Deletion{
+		Time:      now,
+		Namespace: cand.Pod.ObjectMeta.Namespace,
+		Name:      cand.Pod.ObjectMeta.Name,
+		Owner:     cand.Owner(),
+		Reason:    cand.Reason,
+		Action:    cand.Action,
+	}
+}
+
+// recordHistory records the deletion of a candidate
+func (c *Controller) recordHistory(cand Candidate, now time.Time) {
+	if c.history == nil {
+		return
+	}
+
+	if err := c.history.Record(cand.deletion(now)); err != nil {
+		cand.logger.Warn("failed to record deletion in history", zap.Error(err))
+	}
+}
@@ -0,0 +1,79 @@
+package controller
+
+import "k8s.io/api/core/v1"
+
+// Hooks are functions called as the controller handles candidates.
+// Any of them may be nil.
+type Hooks struct {
+	// BeforeDelete is called before a candidate is deleted. Returning an
+	// error vetoes the deletion and the candidate is skipped with the reason "Vetoed".
+	BeforeDelete func(cand Candidate) error
+	// OnDelete is called after a candidate is deleted, or would have been
+	// in dry-run mode.
+	OnDelete func(cand Candidate)
+	// OnSkip is called when a candidate is not deleted, with the reason,
+	// such as "Budget" or "Vetoed".
+	OnSkip func(cand Candidate, reason string)
+	// OnError is called when a candidate could not be deleted.
+	OnError func(cand Candidate, err error)
+	// OnEscalate is called when the controller goes beyond deleting a
+	// candidate, such as when its workload starts flapping or is scaled
+	// down, with the warning event that describes it. It is called whether
+	// or not events are recorded.
+	OnEscalate func(cand Candidate, event *v1.Event)
+}
+
+// WithHooks returns an Option that adds hooks. It may be used more than
+// once; hooks are called in the order they were added, and the first
+// BeforeDelete to return an error vetoes the deletion.
+// Used when creating a new Controller.
+func WithHooks(hooks Hooks) Option {
+	return func(c *Controller) error {
+		c.hooks = append(c.hooks, hooks)
+		return nil
+	}
+}
+
+func (c *Controller) beforeDelete(cand Candidate) error {
+	for _, h := range c.hooks {
+		if h.BeforeDelete == nil {
+			continue
+		}
+		if err := h.BeforeDelete(cand); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *Controller) onDelete(cand Candidate) {
+	for _, h := range c.hooks {
+		if h.OnDelete != nil {
+			h.OnDelete(cand)
+		}
+	}
+}
+
+func (c *Controller) onSkip(cand Candidate, reason string) {
+	for _, h := range c.hooks {
+		if h.OnSkip != nil {
+			h.OnSkip(cand, reason)
+		}
+	}
+}
+
+func (c *Controller) onError(cand Candidate, err error) {
+	for _, h := range c.hooks {
+		if h.OnError != nil {
+			h.OnError(cand, err)
+		}
+	}
+}
+
+func (c *Controller) onEscalate(cand Candidate, event *v1.Event) {
+	for _, h := range c.hooks {
+		if h.OnEscalate != nil {
+			h.OnEscalate(cand, event)
+		}
+	}
+}
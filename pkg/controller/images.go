@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+// RegexPrefix marks an image pattern as a regular expression. Other
+// patterns are globs where * matches any characters, including /.
+const RegexPrefix = "regex:"
+
+// imageMatcher matches container images against a set of patterns
+type imageMatcher []*regexp.Regexp
+
+// ImagePattern compiles an image pattern into a regular expression
+// that matches the whole image.
+func ImagePattern(pattern string) (*regexp.Regexp, error) {
+	var expr string
+	if strings.HasPrefix(pattern, RegexPrefix) {
+		expr = "^(?:" + strings.TrimPrefix(pattern, RegexPrefix) + ")$"
+	} else {
+		expr = regexp.QuoteMeta(pattern)
+		expr = strings.Replace(expr, `\*`, ".*", -1)
+		expr = strings.Replace(expr, `\?`, ".", -1)
+		expr = "^" + expr + "$"
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid image pattern %q", pattern)
+	}
+	return re, nil
+}
+
+func compileImagePatterns(patterns []string) (imageMatcher, error) {
+	m := make(imageMatcher, 0, len(patterns))
+	for _, p := range patterns {
+		re, err := ImagePattern(p)
+		if err != nil {
+			return nil, err
+		}
+		m = append(m, re)
+	}
+	return m, nil
+}
+
+// match returns the first image in the pod that matches any pattern.
+func (m imageMatcher) match(pod v1.Pod) (string, bool) {
+	for _, image := range podImages(pod) {
+		for _, re := range m {
+			if re.MatchString(image) {
+				return image, true
+			}
+		}
+	}
+	return "", false
+}
+
+func podImages(pod v1.Pod) []string {
+	images := make([]string, 0, len(pod.Spec.InitContainers)+len(pod.Spec.Containers))
+	for _, c := range pod.Spec.InitContainers {
+		images = append(images, c.Image)
+	}
+	for _, c := range pod.Spec.Containers {
+		images = append(images, c.Image)
+	}
+	return images
+}
+
+// checkImages returns why a pod should be skipped because of its images,
+// or an empty string if it should not.
+func (r *rule) checkImages(pod v1.Pod) (string, string) {
+	if image, ok := r.excludeImages.match(pod); ok {
+		return "ExcludedImage", image
+	}
+
+	if len(r.includeImages) > 0 {
+		if _, ok := r.includeImages.match(pod); !ok {
+			return "Image", strings.Join(podImages(pod), ",")
+		}
+	}
+
+	return "", ""
+}
+
+// WithImageFilters returns an Option that sets the container images to
+// include and exclude. If include is not empty, only pods with at least one
+// container image matching a pattern are considered. Pods with any container
+// image matching an exclude pattern are never deleted. Patterns are globs
+// where * matches any characters, or regular expressions if prefixed
+// with "regex:".
+// Used when creating a new Controller.
+func WithImageFilters(include []string, exclude []string) Option {
+	return func(c *Controller) error {
+		for _, p := range append(append([]string{}, include...), exclude...) {
+			if _, err := ImagePattern(p); err != nil {
+				return err
+			}
+		}
+		c.includeImages = include
+		c.excludeImages = exclude
+		return nil
+	}
+}
@@ -0,0 +1,95 @@
+package controller
+
+import (
+	"encoding/json"
+
+	"github.com/pkg/errors"
+	batchv1 "k8s.io/api/batch/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// JobClient gets, deletes, and patches the Jobs that own pods
+type JobClient interface {
+	GetJob(namespace string, name string) (*batchv1.Job, error)
+	// DeleteJob deletes a Job and its pods
+	DeleteJob(namespace string, name string) error
+	// PatchJob applies a JSON merge patch to a Job
+	PatchJob(namespace string, name string, patch []byte) error
+}
+
+// DeleteJobAction returns an Action that deletes the Job that owns a pod,
+// and with it all of its pods, if the Job has failed and will never
+// succeed. Pods of Jobs that may still succeed, and pods not owned by a
+// Job, are passed to fallback, such as DeleteAction.
+func DeleteJobAction(jobs JobClient, fallback Action) Action {
+	return ActionFunc(func(cand Candidate) error {
+		job, err := failedJob(jobs, &cand.Pod)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return fallback.Do(cand)
+		}
+		return jobs.DeleteJob(job.ObjectMeta.Namespace, job.ObjectMeta.Name)
+	})
+}
+
+// AnnotateJobAction returns an Action that sets annotations on the Job
+// that owns a pod, if the Job has failed and will never succeed, so it can
+// be found and cleaned up by its owner. The pod is left alone. Pods of
+// Jobs that may still succeed, and pods not owned by a Job, are passed to
+// fallback, such as DeleteAction.
+func AnnotateJobAction(jobs JobClient, annotations map[string]string, fallback Action) Action {
+	return ActionFunc(func(cand Candidate) error {
+		job, err := failedJob(jobs, &cand.Pod)
+		if err != nil {
+			return err
+		}
+		if job == nil {
+			return fallback.Do(cand)
+		}
+
+		patch, err := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"annotations": annotations,
+			},
+		})
+		if err != nil {
+			return errors.Wrap(err, "failed to create patch")
+		}
+		return jobs.PatchJob(job.ObjectMeta.Namespace, job.ObjectMeta.Name, patch)
+	})
+}
+
+// failedJob returns the Job that owns a pod if the Job has failed, or nil
+// if the pod is not owned by a Job or the Job may still succeed.
+func failedJob(jobs JobClient, pod *v1.Pod) (*batchv1.Job, error) {
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil || ref.Kind != "Job" {
+		return nil, nil
+	}
+
+	// errors are not wrapped so the caller can check for not found
+	job, err := jobs.GetJob(pod.ObjectMeta.Namespace, ref.Name)
+	if err != nil {
+		return nil, err
+	}
+	if !jobFailed(job) {
+		return nil, nil
+	}
+	return job, nil
+}
+
+// jobFailed returns true if a Job has failed, such as by exceeding its
+// backoff limit or active deadline, so it will not create more pods.
+func jobFailed(job *batchv1.Job) bool {
+	for _, cond := range job.Status.Conditions {
+		if cond.Type == batchv1.JobFailed && cond.Status == v1.ConditionTrue {
+			return true
+		}
+	}
+	// the condition is set by the Job controller, which may not have caught up
+	limit := job.Spec.BackoffLimit
+	return limit != nil && job.Status.Active == 0 && job.Status.Failed > *limit
+}
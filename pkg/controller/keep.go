@@ -0,0 +1,85 @@
+package controller
+
+import (
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// KeepFailingSkip is the skip reason of failing pods kept for debugging
+const KeepFailingSkip = "KeepFailing"
+
+// WithKeepFailing returns an Option that keeps the newest n candidates
+// of each workload, so there are failing pods to debug with kubectl logs
+// or exec, and only acts on older ones. Pods without an owner, and pods
+// that would be force deleted, are not kept. Zero keeps none, which is
+// the default.
+// Used when creating a new Controller.
+func WithKeepFailing(n int) Option {
+	return func(c *Controller) error {
+		if n < 0 {
+			return errors.New("number of failing pods to keep must not be negative")
+		}
+		c.keepFailing = n
+		return nil
+	}
+}
+
+// keepNewest removes the newest candidates of each owner from
+// candidates, and returns them as skipped decisions.
+func (c *Controller) keepNewest(candidates []Candidate, now time.Time) ([]Candidate, []Decision) {
+	if c.keepFailing == 0 {
+		return candidates, nil
+	}
+
+	owners := make(map[string][]int)
+	for i, cand := range candidates {
+		key := ownerKey(cand)
+		if key == "" || cand.Action == ForceDeleteActionName {
+			continue
+		}
+		owners[key] = append(owners[key], i)
+	}
+
+	keep := make(map[int]bool)
+	for _, indexes := range owners {
+		sort.SliceStable(indexes, func(i, j int) bool {
+			a := candidates[indexes[i]].Pod.ObjectMeta.CreationTimestamp
+			b := candidates[indexes[j]].Pod.ObjectMeta.CreationTimestamp
+			return b.Before(&a)
+		})
+		if len(indexes) > c.keepFailing {
+			indexes = indexes[:c.keepFailing]
+		}
+		for _, i := range indexes {
+			keep[i] = true
+		}
+	}
+
+	var kept []Decision
+	remaining := candidates[:0]
+	for i, cand := range candidates {
+		if !keep[i] {
+			remaining = append(remaining, cand)
+			continue
+		}
+		cand.logger.Debug("keeping failing pod for debugging", zap.String("Reason", cand.Reason))
+		kept = append(kept, Decision{
+			Time:      now,
+			Namespace: cand.Pod.ObjectMeta.Namespace,
+			Name:      cand.Pod.ObjectMeta.Name,
+			Rule:      cand.Rule,
+			Owner:     cand.Owner(),
+			Reason:    cand.Reason,
+			Action:    "skipped",
+			Skip:      KeepFailingSkip,
+			Detail:    "newest " + strconv.Itoa(c.keepFailing),
+			DryRun:    c.isDryRun(),
+			RunID:     cand.RunID,
+		})
+	}
+	return remaining, kept
+}
@@ -0,0 +1,65 @@
+package controller
+
+import (
+	"strconv"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// ControlEnabledKey is the key of a control ConfigMap that turns the
+// controller off when set to "false".
+const ControlEnabledKey = "enabled"
+
+// Disable stops the controller from deleting pods, or applying any other
+// action, until Enable is called. It behaves as Pause, but is kept apart
+// so resuming a paused controller does not override the kill switch.
+func (c *Controller) Disable() {
+	if atomic.SwapInt32(&c.disabled, 1) == 0 {
+		c.logger.Warn("disabled by kill switch")
+	}
+}
+
+// Enable undoes Disable.
+func (c *Controller) Enable() {
+	if atomic.SwapInt32(&c.disabled, 0) == 1 {
+		c.logger.Info("enabled by kill switch")
+	}
+}
+
+// Disabled returns true if the controller was disabled by the kill switch.
+func (c *Controller) Disabled() bool {
+	return atomic.LoadInt32(&c.disabled) == 1
+}
+
+// SetControl enables or disables the controller from the data of a
+// control ConfigMap. The controller is disabled if ControlEnabledKey is
+// false, or is not a boolean, so a typo does not turn deletions back on.
+// A nil or missing ConfigMap, or one without the key, enables it.
+func (c *Controller) SetControl(cm *v1.ConfigMap) {
+	if cm == nil {
+		c.Enable()
+		return
+	}
+
+	value, ok := cm.Data[ControlEnabledKey]
+	if !ok {
+		c.Enable()
+		return
+	}
+
+	enabled, err := strconv.ParseBool(value)
+	if err != nil {
+		c.logger.Error("invalid value in control ConfigMap",
+			zap.String("namespace", cm.ObjectMeta.Namespace),
+			zap.String("name", cm.ObjectMeta.Name),
+			zap.String(ControlEnabledKey, value),
+		)
+	}
+	if enabled {
+		c.Enable()
+	} else {
+		c.Disable()
+	}
+}
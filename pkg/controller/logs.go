@@ -0,0 +1,120 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// LogGetter gets the logs of a container. If previous is set, it gets
+// the logs of the container's previous instance, such as before a crash.
+type LogGetter interface {
+	GetPodLogs(namespace string, name string, container string, previous bool, lines int64) ([]byte, error)
+}
+
+// ContainerLogs holds the logs captured from one container
+type ContainerLogs struct {
+	Container string `json:"container"`
+	// Previous is set for the logs of the container's previous instance
+	Previous bool   `json:"previous,omitempty"`
+	Logs     string `json:"logs,omitempty"`
+	// Error is why the logs could not be captured, if they were not
+	Error string `json:"error,omitempty"`
+}
+
+// CapturedLogs holds the logs captured from a pod before it was acted on
+type CapturedLogs struct {
+	Time       time.Time       `json:"time"`
+	Namespace  string          `json:"namespace"`
+	Name       string          `json:"name"`
+	Reason     string          `json:"reason"`
+	Action     string          `json:"action"`
+	RunID      string          `json:"runID,omitempty"`
+	Containers []ContainerLogs `json:"containers"`
+}
+
+// LogSink stores the logs captured from pods
+type LogSink interface {
+	WriteLogs(logs *CapturedLogs) error
+}
+
+type logCapture struct {
+	getter LogGetter
+	lines  int64
+	sink   LogSink
+}
+
+// WithLogCapture returns an Option that captures the last lines of the
+// logs of each container of a pod, and of the container's previous
+// instance if it restarted, before acting on it, and writes them to sink.
+// Only the containers selected by WithContainers are captured. Failures
+// are logged, but do not stop the action. It has no effect in dry-run
+// mode. Zero lines disables, which is the default.
+// Used when creating a new Controller.
+func WithLogCapture(getter LogGetter, lines int64, sink LogSink) Option {
+	return func(c *Controller) error {
+		if lines < 0 {
+			return errors.New("log lines must not be negative")
+		}
+		if lines == 0 {
+			c.logCapture = nil
+			return nil
+		}
+		if getter == nil || sink == nil {
+			return errors.New("log capture requires a log getter and sink")
+		}
+		c.logCapture = &logCapture{getter: getter, lines: lines, sink: sink}
+		return nil
+	}
+}
+
+// captureLogs captures the logs of the candidate and writes them to the
+// sink. A container whose logs cannot be read is recorded with the error,
+// as the other containers may still explain the failure.
+func (c *Controller) captureLogs(ctx context.Context, cand Candidate, now time.Time) {
+	if c.logCapture == nil {
+		return
+	}
+
+	pod := cand.Pod
+	captured := &CapturedLogs{
+		Time:      now,
+		Namespace: pod.ObjectMeta.Namespace,
+		Name:      pod.ObjectMeta.Name,
+		Reason:    cand.Reason,
+		Action:    cand.Action,
+		RunID:     cand.RunID,
+	}
+
+	get := func(container string, previous bool) {
+		var logs []byte
+		err := c.retry.do(ctx, cand.logger, "capture logs", func() error {
+			var err error
+			logs, err = c.logCapture.getter.GetPodLogs(pod.ObjectMeta.Namespace, pod.ObjectMeta.Name, container, previous, c.logCapture.lines)
+			return err
+		})
+		l := ContainerLogs{Container: container, Previous: previous, Logs: string(logs)}
+		if err != nil {
+			l.Error = err.Error()
+		}
+		captured.Containers = append(captured.Containers, l)
+	}
+
+	for _, status := range pod.Status.ContainerStatuses {
+		if status.State.Running != nil || status.State.Terminated != nil {
+			get(status.Name, false)
+		}
+		if status.RestartCount > 0 || status.LastTerminationState.Terminated != nil {
+			get(status.Name, true)
+		}
+	}
+
+	if len(captured.Containers) == 0 {
+		return
+	}
+	if err := c.logCapture.sink.WriteLogs(captured); err != nil {
+		cand.logger.Warn("failed to write captured logs", zap.Error(err))
+	}
+}
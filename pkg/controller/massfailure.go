@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// MassFailureSkip is the skip reason of candidates of a run that was
+// aborted because too many of the pods it evaluated were candidates.
+const MassFailureSkip = "MassFailure"
+
+type massFailure struct {
+	percent float64
+	min     int
+}
+
+// WithMassFailureThreshold returns an Option that aborts a run, acting on
+// no pods, if more than percent of the pods it evaluated are candidates
+// and there are at least min candidates. So many failing pods almost
+// always mean a problem with the cluster, such as a registry or DNS
+// outage, that deleting them would only make worse. Zero percent
+// disables, which is the default.
+// Used when creating a new Controller.
+func WithMassFailureThreshold(percent float64, min int) Option {
+	return func(c *Controller) error {
+		if percent < 0 || percent > 100 {
+			return errors.New("mass failure percent must be between 0 and 100")
+		}
+		if min < 0 {
+			return errors.New("mass failure minimum candidates must not be negative")
+		}
+		c.massFailure = massFailure{percent: percent, min: min}
+		return nil
+	}
+}
+
+// checkMassFailure returns why the run should be aborted, or an empty
+// string if it should not be.
+func (c *Controller) checkMassFailure(result *RunResult) string {
+	m := c.massFailure
+	if m.percent == 0 || result.Evaluated == 0 || result.Candidates < m.min {
+		return ""
+	}
+
+	percent := float64(result.Candidates) * 100 / float64(result.Evaluated)
+	if percent <= m.percent {
+		return ""
+	}
+	return fmt.Sprintf("%d of %d evaluated pods (%.0f%%) are candidates, more than the mass failure threshold of %g%%",
+		result.Candidates, result.Evaluated, percent, m.percent)
+}
+
+// abort skips every candidate with skip, because the run was aborted for
+// reason
+func (c *Controller) abort(result *RunResult, candidates []Candidate, skip string, reason string) {
+	result.Aborted = reason
+	result.abortSkip = skip
+	c.runLogger(result.ID).Error("aborting run, as the cluster is unhealthy",
+		zap.String("reason", skip),
+		zap.String("detail", reason),
+	)
+
+	for _, cand := range candidates {
+		result.add(c.decide(cand, "skipped", skip, reason, nil))
+		c.onSkip(cand, skip)
+	}
+}
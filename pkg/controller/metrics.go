@@ -0,0 +1,322 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	budgetLimitDesc = prometheus.NewDesc(
+		"pod_deleter_budget_limit",
+		"Maximum number of deletions allowed within the budget window. Negative means no limit.",
+		nil, nil,
+	)
+	budgetRemainingDesc = prometheus.NewDesc(
+		"pod_deleter_budget_remaining",
+		"Number of deletions currently allowed by the budget. Negative means no limit.",
+		nil, nil,
+	)
+	budgetUsedDesc = prometheus.NewDesc(
+		"pod_deleter_budget_used",
+		"Number of deletions within the current budget window.",
+		nil, nil,
+	)
+	evalCacheHitsDesc = prometheus.NewDesc(
+		"pod_deleter_eval_cache_hits_total",
+		"Number of pod evaluations served from the evaluation cache.",
+		nil, nil,
+	)
+	evalCacheMissesDesc = prometheus.NewDesc(
+		"pod_deleter_eval_cache_misses_total",
+		"Number of pod evaluations not found in the evaluation cache.",
+		nil, nil,
+	)
+	pausedDesc = prometheus.NewDesc(
+		"pod_deleter_paused",
+		"1 if the controller is paused and not deleting pods, otherwise 0.",
+		nil, nil,
+	)
+	disabledDesc = prometheus.NewDesc(
+		"pod_deleter_disabled",
+		"1 if the controller is disabled by the kill switch and not deleting pods, otherwise 0.",
+		nil, nil,
+	)
+	massFailureDesc = prometheus.NewDesc(
+		"pod_deleter_mass_failure",
+		"1 if the most recent run was aborted because too many pods were candidates, otherwise 0.",
+		nil, nil,
+	)
+	replacementsPendingDesc = prometheus.NewDesc(
+		"pod_deleter_replacements_pending",
+		"Number of deleted pods whose replacement has not yet been checked.",
+		nil, nil,
+	)
+	nodeHealthDesc = prometheus.NewDesc(
+		"pod_deleter_node_health_aborted",
+		"1 if the most recent run was aborted because too many nodes were not ready, otherwise 0.",
+		nil, nil,
+	)
+	flappingDesc = prometheus.NewDesc(
+		"pod_deleter_flapping",
+		"Workloads whose pods are not deleted because they are flapping. Always 1.",
+		[]string{"namespace", "owner"}, nil,
+	)
+)
+
+// runCounters counts the pods acted on, that failed, and that were
+// skipped across runs, and times runs and the requests made during them.
+type runCounters struct {
+	deleted     *prometheus.CounterVec
+	errors      *prometheus.CounterVec
+	skipped     *prometheus.CounterVec
+	terminating *prometheus.CounterVec
+	duration    *prometheus.HistogramVec
+	list        prometheus.Histogram
+	action      *prometheus.HistogramVec
+	// replacements counts deleted pods by whether they were replaced
+	replacements     *prometheus.CounterVec
+	replacementReady prometheus.Histogram
+}
+
+func newRunCounters() *runCounters {
+	return &runCounters{
+		deleted: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pod_deleter_deleted_total",
+				Help: "Number of pods deleted, or acted on, by namespace, matched reason, owner kind, and action.",
+			},
+			[]string{"namespace", "reason", "owner_kind", "action", "dry_run"},
+		),
+		errors: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pod_deleter_errors_total",
+				Help: "Number of pods that could not be deleted, by namespace, matched reason, owner kind, and action.",
+			},
+			[]string{"namespace", "reason", "owner_kind", "action", "dry_run"},
+		),
+		skipped: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pod_deleter_skipped_total",
+				Help: "Number of pods skipped, by namespace and the reason they were skipped.",
+			},
+			[]string{"namespace", "reason", "dry_run"},
+		),
+		terminating: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pod_deleter_terminating_total",
+				Help: "Number of pods skipped because they were already being deleted, by namespace. Also counted in pod_deleter_skipped_total.",
+			},
+			[]string{"namespace", "dry_run"},
+		),
+		duration: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name: "pod_deleter_run_duration_seconds",
+				Help: "Time taken by each run, by whether it succeeded or failed.",
+				// runs of large clusters may take minutes
+				Buckets: prometheus.ExponentialBuckets(0.1, 2, 12),
+			},
+			[]string{"result"},
+		),
+		list: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "pod_deleter_list_duration_seconds",
+				Help:    "Time taken by each request to list pods, or a page of pods.",
+				Buckets: prometheus.ExponentialBuckets(0.01, 2, 12),
+			},
+		),
+		action: prometheus.NewHistogramVec(
+			prometheus.HistogramOpts{
+				Name:    "pod_deleter_delete_duration_seconds",
+				Help:    "Time taken by each request to delete, or act on, a pod, by action. Retries are timed separately.",
+				Buckets: prometheus.DefBuckets,
+			},
+			[]string{"action"},
+		),
+		replacements: prometheus.NewCounterVec(
+			prometheus.CounterOpts{
+				Name: "pod_deleter_replacements_total",
+				Help: "Number of deleted pods whose owner created a replacement that became ready within the replacement window, or did not, by namespace, owner kind, and result.",
+			},
+			[]string{"namespace", "owner_kind", "result"},
+		),
+		replacementReady: prometheus.NewHistogram(
+			prometheus.HistogramOpts{
+				Name:    "pod_deleter_replacement_ready_seconds",
+				Help:    "Time from deleting a pod until its replacement became ready.",
+				Buckets: prometheus.ExponentialBuckets(1, 2, 12),
+			},
+		),
+	}
+}
+
+func (r *runCounters) add(result *RunResult) {
+	dryRun := strconv.FormatBool(result.DryRun)
+	for _, d := range result.Deleted {
+		r.deleted.WithLabelValues(d.Namespace, d.Reason, d.OwnerKind(), d.Action, dryRun).Inc()
+	}
+	for _, d := range result.Errors {
+		r.errors.WithLabelValues(d.Namespace, d.Reason, d.OwnerKind(), d.Action, dryRun).Inc()
+	}
+	for _, d := range result.Skipped {
+		r.skipped.WithLabelValues(d.Namespace, d.Skip, dryRun).Inc()
+		if d.Skip == TerminatingSkip {
+			r.terminating.WithLabelValues(d.Namespace, dryRun).Inc()
+		}
+	}
+}
+
+// observeRun records the duration of a run
+func (r *runCounters) observeRun(status RunStatus) {
+	result := "success"
+	if status.Error != "" {
+		result = "error"
+	}
+	r.duration.WithLabelValues(result).Observe(status.Duration.Seconds())
+}
+
+// MetricsSink receives counts and timings at the end of each run, for
+// metrics systems that are pushed to rather than scraped.
+type MetricsSink interface {
+	Count(name string, value int64, tags map[string]string)
+	Timing(name string, d time.Duration, tags map[string]string)
+}
+
+// WithMetricsSink returns an Option that sends the number of pods
+// deleted, skipped, and that failed, and the duration of each run, to s.
+// Used when creating a new Controller.
+func WithMetricsSink(s MetricsSink) Option {
+	return func(c *Controller) error {
+		c.sink = s
+		return nil
+	}
+}
+
+// emit sends the outcome of a run to the sink. Pods are counted by
+// namespace, matched reason, owner kind, and action, or by namespace and
+// skip reason.
+func (c *Controller) emit(status RunStatus, r *RunResult) {
+	result := "success"
+	if status.Error != "" {
+		result = "error"
+	}
+	c.sink.Timing("run.duration", status.Duration, map[string]string{"result": result})
+
+	if r == nil {
+		return
+	}
+
+	dryRun := strconv.FormatBool(r.DryRun)
+
+	type key struct {
+		name      string
+		namespace string
+		action    string
+		reason    string
+		ownerKind string
+	}
+	counts := make(map[key]int64)
+	for _, d := range r.Deleted {
+		counts[key{name: "deleted", namespace: d.Namespace, action: d.Action, reason: d.Reason, ownerKind: d.OwnerKind()}]++
+	}
+	for _, d := range r.Errors {
+		counts[key{name: "errors", namespace: d.Namespace, action: d.Action, reason: d.Reason, ownerKind: d.OwnerKind()}]++
+	}
+	for _, d := range r.Skipped {
+		counts[key{name: "skipped", namespace: d.Namespace, reason: d.Skip}]++
+	}
+
+	for k, n := range counts {
+		tags := map[string]string{
+			"dry_run":   dryRun,
+			"namespace": k.namespace,
+			"reason":    k.reason,
+		}
+		if k.name != "skipped" {
+			tags["action"] = k.action
+			if k.ownerKind != "" {
+				tags["owner_kind"] = k.ownerKind
+			}
+		}
+		c.sink.Count(k.name, n, tags)
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Controller) Describe(ch chan<- *prometheus.Desc) {
+	ch <- budgetLimitDesc
+	ch <- budgetRemainingDesc
+	ch <- budgetUsedDesc
+	ch <- evalCacheHitsDesc
+	ch <- evalCacheMissesDesc
+	ch <- pausedDesc
+	ch <- disabledDesc
+	ch <- massFailureDesc
+	ch <- nodeHealthDesc
+	ch <- replacementsPendingDesc
+	ch <- flappingDesc
+	c.counters.deleted.Describe(ch)
+	c.counters.errors.Describe(ch)
+	c.counters.skipped.Describe(ch)
+	c.counters.terminating.Describe(ch)
+	c.counters.duration.Describe(ch)
+	c.counters.list.Describe(ch)
+	c.counters.action.Describe(ch)
+	c.counters.replacements.Describe(ch)
+	c.counters.replacementReady.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Controller) Collect(ch chan<- prometheus.Metric) {
+	s := c.Budget()
+	ch <- prometheus.MustNewConstMetric(budgetLimitDesc, prometheus.GaugeValue, float64(s.Limit))
+	ch <- prometheus.MustNewConstMetric(budgetRemainingDesc, prometheus.GaugeValue, float64(s.Remaining))
+	ch <- prometheus.MustNewConstMetric(budgetUsedDesc, prometheus.GaugeValue, float64(s.Used))
+
+	hits, misses := c.cacheStats.get()
+	ch <- prometheus.MustNewConstMetric(evalCacheHitsDesc, prometheus.CounterValue, float64(hits))
+	ch <- prometheus.MustNewConstMetric(evalCacheMissesDesc, prometheus.CounterValue, float64(misses))
+
+	paused := 0.0
+	if c.Paused() {
+		paused = 1
+	}
+	ch <- prometheus.MustNewConstMetric(pausedDesc, prometheus.GaugeValue, paused)
+
+	disabled := 0.0
+	if c.Disabled() {
+		disabled = 1
+	}
+	ch <- prometheus.MustNewConstMetric(disabledDesc, prometheus.GaugeValue, disabled)
+
+	massFailure, nodeHealth := 0.0, 0.0
+	if r := c.lastResult.get(); r != nil {
+		switch r.abortSkip {
+		case MassFailureSkip:
+			massFailure = 1
+		case NodeHealthSkip:
+			nodeHealth = 1
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(massFailureDesc, prometheus.GaugeValue, massFailure)
+	ch <- prometheus.MustNewConstMetric(nodeHealthDesc, prometheus.GaugeValue, nodeHealth)
+	ch <- prometheus.MustNewConstMetric(replacementsPendingDesc, prometheus.GaugeValue, float64(c.replacements.len()))
+
+	for _, key := range c.flaps.list(time.Now()) {
+		// key is namespace/kind/name
+		parts := strings.SplitN(key, "/", 2)
+		ch <- prometheus.MustNewConstMetric(flappingDesc, prometheus.GaugeValue, 1, parts[0], parts[1])
+	}
+
+	c.counters.deleted.Collect(ch)
+	c.counters.errors.Collect(ch)
+	c.counters.skipped.Collect(ch)
+	c.counters.terminating.Collect(ch)
+	c.counters.duration.Collect(ch)
+	c.counters.list.Collect(ch)
+	c.counters.action.Collect(ch)
+	c.counters.replacements.Collect(ch)
+	c.counters.replacementReady.Collect(ch)
+}
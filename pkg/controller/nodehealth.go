@@ -0,0 +1,67 @@
+package controller
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// NodeHealthSkip is the skip reason of candidates of a run that was
+// aborted because too many nodes were not ready.
+const NodeHealthSkip = "NodeHealth"
+
+type nodeHealth struct {
+	lister  NodeLister
+	percent float64
+}
+
+// WithNodeHealth returns an Option that aborts a run, acting on no pods,
+// if more than percent of the nodes in the cluster are not ready. Pods
+// fail when their nodes do, and deleting them during a node outage only
+// moves them to the nodes that are left. Nodes are listed each run. Zero
+// disables, which is the default.
+// Used when creating a new Controller.
+func WithNodeHealth(lister NodeLister, percent float64) Option {
+	return func(c *Controller) error {
+		if percent < 0 || percent > 100 {
+			return errors.New("node health percent must be between 0 and 100")
+		}
+		if percent == 0 {
+			c.nodeHealth = nil
+			return nil
+		}
+		c.nodeHealth = &nodeHealth{lister: lister, percent: percent}
+		return nil
+	}
+}
+
+// checkNodeHealth returns why the run should be aborted, or an empty
+// string if it should not be.
+func (c *Controller) checkNodeHealth(now time.Time) (string, error) {
+	if c.nodeHealth == nil {
+		return "", nil
+	}
+
+	nodes, err := c.nodeHealth.lister.ListNodes()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to list nodes")
+	}
+	if len(nodes) == 0 {
+		return "", nil
+	}
+
+	var notReady int
+	for i := range nodes {
+		if _, ok := notReadyFor(&nodes[i], now); ok {
+			notReady++
+		}
+	}
+
+	percent := float64(notReady) * 100 / float64(len(nodes))
+	if percent <= c.nodeHealth.percent {
+		return "", nil
+	}
+	return fmt.Sprintf("%d of %d nodes (%.0f%%) are not ready, more than the node health threshold of %g%%",
+		notReady, len(nodes), percent, c.nodeHealth.percent), nil
+}
@@ -0,0 +1,69 @@
+package controller
+
+import (
+	"sort"
+
+	"github.com/pkg/errors"
+)
+
+// The order candidates are deleted in when a run cannot delete them all.
+// See WithOrder.
+const (
+	OrderPriority      = "priority"
+	OrderRestarts      = "restarts"
+	OrderOldestFailure = "oldest-failure"
+)
+
+// WithOrder returns an Option that sets the order candidates are deleted
+// in, which decides which pods are deleted when the budget cannot cover
+// them all. Pods on nodes being drained are always first.
+// OrderPriority, the default, deletes pods in namespaces with a higher
+// priority first, and otherwise in rule order and the order they were
+// listed. OrderRestarts deletes pods with the most container restarts
+// first. OrderOldestFailure deletes pods that became unhealthy the longest
+// ago first. Both break ties by namespace and name, so the order does not
+// depend on the order pods are listed in.
+// Used when creating a new Controller.
+func WithOrder(order string) Option {
+	return func(c *Controller) error {
+		switch order {
+		case "":
+			order = OrderPriority
+		case OrderPriority, OrderRestarts, OrderOldestFailure:
+		default:
+			return errors.Errorf("invalid order %q", order)
+		}
+		c.order = order
+		return nil
+	}
+}
+
+// sortCandidates sorts candidates in the order they should be deleted
+func sortCandidates(candidates []Candidate, order string) {
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := &candidates[i], &candidates[j]
+		if a.Draining != b.Draining {
+			return a.Draining
+		}
+
+		switch order {
+		case OrderRestarts:
+			if ra, rb := restartCount(a.Pod), restartCount(b.Pod); ra != rb {
+				return ra > rb
+			}
+		case OrderOldestFailure:
+			if sa, sb := stateSince(&a.Pod), stateSince(&b.Pod); !sa.Equal(sb) {
+				return sa.Before(sb)
+			}
+		default:
+			// stable to preserve the order returned by the API within a priority
+			return a.rule.priorityFor(a.Pod.ObjectMeta.Namespace) >
+				b.rule.priorityFor(b.Pod.ObjectMeta.Namespace)
+		}
+
+		if a.Pod.ObjectMeta.Namespace != b.Pod.ObjectMeta.Namespace {
+			return a.Pod.ObjectMeta.Namespace < b.Pod.ObjectMeta.Namespace
+		}
+		return a.Pod.ObjectMeta.Name < b.Pod.ObjectMeta.Name
+	})
+}
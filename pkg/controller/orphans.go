@@ -0,0 +1,107 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// orphanTracker remembers when pods were first seen on nodes that do not
+// exist, as nothing records when a node was deleted.
+type orphanTracker struct {
+	lister NodeLister
+	grace  time.Duration
+	force  Action
+
+	mu      sync.Mutex
+	missing map[string]time.Time
+	next    map[string]time.Time
+}
+
+// WithOrphanedPods returns an Option that deletes pods bound to nodes that
+// no longer exist, once the node has been missing for longer than grace,
+// with the reason NodeMissing. This cleans up after nodes that were removed
+// abruptly, such as by an autoscaler. The grace period is measured from when
+// the controller first saw the node missing. There is no kubelet to confirm
+// the deletion, so if force is not nil these pods are force deleted instead
+// of having the rule's action applied. Nodes are listed each run. Zero
+// disables.
+// Used when creating a new Controller.
+func WithOrphanedPods(lister NodeLister, grace time.Duration, force PodForceDeleter) Option {
+	return func(c *Controller) error {
+		if grace < 0 {
+			return errors.New("orphaned pod grace must not be negative")
+		}
+		if grace == 0 {
+			c.orphans = nil
+			return nil
+		}
+		t := &orphanTracker{lister: lister, grace: grace}
+		if force != nil {
+			t.force = ForceDeleteAction(force)
+		}
+		c.orphans = t
+		return nil
+	}
+}
+
+// missingFor returns how long a node has been seen missing, recording now
+// if this is the first time.
+func (t *orphanTracker) missingFor(node string, now time.Time) time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	since, ok := t.next[node]
+	if !ok {
+		since, ok = t.missing[node]
+		if !ok {
+			since = now
+		}
+	}
+
+	if t.next == nil {
+		t.next = make(map[string]time.Time)
+	}
+	t.next[node] = since
+	return now.Sub(since)
+}
+
+// sweep forgets nodes that were not seen missing since the last sweep.
+func (t *orphanTracker) sweep() {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.missing = t.next
+	t.next = nil
+}
+
+// onMissingNode returns true if the pod's node has been missing for longer
+// than the grace period.
+func (c *Controller) onMissingNode(s *runState, pod *v1.Pod) bool {
+	// nodes is nil if they could not be listed
+	if c.orphans == nil || s.nodes == nil || pod.Spec.NodeName == "" {
+		return false
+	}
+	if _, ok := s.nodes[pod.Spec.NodeName]; ok {
+		return false
+	}
+	return c.orphans.missingFor(pod.Spec.NodeName, s.now) > c.orphans.grace
+}
+
+// checkOrphaned matches a pod that was skipped only because of its
+// container reasons, or because its phase is unknown, if its node has been
+// missing for longer than the grace period. Nodes change between runs, so
+// it is never cached.
+func (c *Controller) checkOrphaned(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if c.orphans == nil || !r.recheckableOnNode(logger, pod, skip) {
+		return reason, skip, detail
+	}
+
+	if c.onMissingNode(s, &pod) {
+		logger.Debug("pod is on a node that does not exist", zap.String("node", pod.Spec.NodeName))
+		return "NodeMissing", "", ""
+	}
+	return reason, skip, detail
+}
@@ -0,0 +1,106 @@
+package controller
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Owner annotations are set on the workload that owns a pod after the
+// pod is deleted, or acted on, when using WithOwnerAnnotations.
+const (
+	LastDeletionAnnotation = "pod-deleter.bakins.io/last-deletion"
+	DeletionsAnnotation    = "pod-deleter.bakins.io/deletions"
+)
+
+// ownerKinds are the kinds of owners that are annotated
+var ownerKinds = map[string]bool{
+	"Deployment":  true,
+	"ReplicaSet":  true,
+	"StatefulSet": true,
+	"DaemonSet":   true,
+	"Job":         true,
+}
+
+// OwnerPatcher gets and patches the workloads that own pods, such as
+// ReplicaSets and StatefulSets.
+type OwnerPatcher interface {
+	GetOwner(namespace string, kind string, name string) (*metav1.ObjectMeta, error)
+	PatchOwner(namespace string, kind string, name string, patch []byte) error
+}
+
+// WithOwnerAnnotations returns an Option that annotates the workload that
+// owns each pod with the time of the last deletion and a count of
+// deletions. If the owner is a ReplicaSet, its Deployment is annotated too.
+// Used when creating a new Controller.
+func WithOwnerAnnotations(p OwnerPatcher) Option {
+	return func(c *Controller) error {
+		c.owners = p
+		return nil
+	}
+}
+
+// annotateOwners annotates the owners of a candidate. Failures are
+// logged and otherwise ignored.
+func (c *Controller) annotateOwners(cand Candidate, now time.Time) {
+	if c.owners == nil {
+		return
+	}
+
+	ref := metav1.GetControllerOf(&cand.Pod)
+	if ref == nil || !ownerKinds[ref.Kind] {
+		return
+	}
+
+	namespace := cand.Pod.ObjectMeta.Namespace
+	meta, err := c.annotateOwner(namespace, ref.Kind, ref.Name, now)
+	if err != nil {
+		cand.logger.Warn("failed to annotate owner", zap.String("owner", ref.Kind+"/"+ref.Name), zap.Error(err))
+		return
+	}
+
+	if ref.Kind != "ReplicaSet" {
+		return
+	}
+
+	if parent := metav1.GetControllerOf(meta); parent != nil && parent.Kind == "Deployment" {
+		if _, err := c.annotateOwner(namespace, parent.Kind, parent.Name, now); err != nil {
+			cand.logger.Warn("failed to annotate owner", zap.String("owner", parent.Kind+"/"+parent.Name), zap.Error(err))
+		}
+	}
+}
+
+// annotateOwner increments the deletion count of a workload and returns its metadata
+func (c *Controller) annotateOwner(namespace string, kind string, name string, now time.Time) (*metav1.ObjectMeta, error) {
+	meta, err := c.owners.GetOwner(namespace, kind, name)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return &metav1.ObjectMeta{}, nil
+		}
+		return nil, err
+	}
+
+	// an invalid count is reset
+	count, _ := strconv.Atoi(meta.Annotations[DeletionsAnnotation])
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				LastDeletionAnnotation: now.UTC().Format(time.RFC3339),
+				DeletionsAnnotation:    strconv.Itoa(count + 1),
+			},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if err := c.owners.PatchOwner(namespace, kind, name, patch); err != nil && !k8sErrors.IsNotFound(err) {
+		return nil, err
+	}
+	return meta, nil
+}
@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"sync/atomic"
+)
+
+// Pause stops the controller from deleting pods, or applying any other
+// action, until Resume is called. While paused, runs behave as if in
+// dry-run mode, so candidates are still evaluated and reported.
+func (c *Controller) Pause() {
+	atomic.StoreInt32(&c.paused, 1)
+	c.logger.Info("paused")
+}
+
+// Resume undoes Pause.
+func (c *Controller) Resume() {
+	atomic.StoreInt32(&c.paused, 0)
+	c.logger.Info("resumed")
+}
+
+// Paused returns true if the controller is paused.
+func (c *Controller) Paused() bool {
+	return atomic.LoadInt32(&c.paused) == 1
+}
+
+// isDryRun returns true if pods should not be changed, either
+// because of dry-run mode or because the controller is paused or
+// disabled.
+func (c *Controller) isDryRun() bool {
+	return c.dryRun || c.Paused() || c.Disabled()
+}
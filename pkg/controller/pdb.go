@@ -0,0 +1,104 @@
+package controller
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+// PDBLister gets a list of pod disruption budgets.
+type PDBLister interface {
+	ListPodDisruptionBudgets(namespace string) ([]policy.PodDisruptionBudget, error)
+}
+
+// WithDisruptionBudgetCheck returns an Option that checks the pod
+// disruption budgets covering each candidate before it is deleted, even
+// when not using the eviction API. A ready pod is skipped if a budget
+// covering it allows no more disruptions.
+// Used when creating a new Controller.
+func WithDisruptionBudgetCheck(l PDBLister) Option {
+	return func(c *Controller) error {
+		c.pdbLister = l
+		return nil
+	}
+}
+
+// disruptions tracks the disruptions allowed by pod disruption budgets
+// during a single run. Budgets are listed once per namespace, and each
+// deletion uses one of the disruptions allowed, as the budget status is
+// not updated until the pod is gone.
+type disruptions struct {
+	lister  PDBLister
+	budgets map[string][]policy.PodDisruptionBudget
+	allowed map[string]int32
+}
+
+func (c *Controller) newDisruptions() *disruptions {
+	return &disruptions{
+		lister:  c.pdbLister,
+		budgets: make(map[string][]policy.PodDisruptionBudget),
+		allowed: make(map[string]int32),
+	}
+}
+
+// check returns the name of a budget that would be violated by deleting
+// the pod, or empty string if the pod can be deleted. If the pod can be
+// deleted, a disruption is used from each budget covering it.
+func (d *disruptions) check(pod *v1.Pod) (string, error) {
+	if d.lister == nil {
+		return "", nil
+	}
+
+	// a pod that is not ready is not counted as healthy by the budget,
+	// so deleting it does not disrupt the workload.
+	if !podReady(pod) {
+		return "", nil
+	}
+
+	namespace := pod.ObjectMeta.Namespace
+	budgets, ok := d.budgets[namespace]
+	if !ok {
+		var err error
+		budgets, err = d.lister.ListPodDisruptionBudgets(namespace)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to list pod disruption budgets")
+		}
+		d.budgets[namespace] = budgets
+	}
+
+	var covering []string
+	for i := range budgets {
+		pdb := &budgets[i]
+		s := pdb.Spec.Selector
+		// an empty selector matches no pods
+		if s == nil || (len(s.MatchLabels) == 0 && len(s.MatchExpressions) == 0) {
+			continue
+		}
+
+		selector, err := metav1.LabelSelectorAsSelector(s)
+		if err != nil {
+			return "", errors.Wrapf(err, "invalid selector in pod disruption budget %s", pdb.ObjectMeta.Name)
+		}
+		if !selector.Matches(labels.Set(pod.ObjectMeta.Labels)) {
+			continue
+		}
+
+		key := namespace + "/" + pdb.ObjectMeta.Name
+		allowed, ok := d.allowed[key]
+		if !ok {
+			allowed = pdb.Status.PodDisruptionsAllowed
+			d.allowed[key] = allowed
+		}
+		if allowed <= 0 {
+			return pdb.ObjectMeta.Name, nil
+		}
+		covering = append(covering, key)
+	}
+
+	for _, key := range covering {
+		d.allowed[key]--
+	}
+	return "", nil
+}
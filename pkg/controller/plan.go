@@ -0,0 +1,190 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// Plan records the candidates of a run so they can be reviewed, and then
+// acted on with Apply.
+type Plan struct {
+	Created time.Time  `json:"created"`
+	Items   []PlanItem `json:"items"`
+}
+
+// PlanItem is a pod that would be acted on
+type PlanItem struct {
+	Namespace       string    `json:"namespace"`
+	Name            string    `json:"name"`
+	UID             types.UID `json:"uid"`
+	ResourceVersion string    `json:"resourceVersion"`
+	Rule            string    `json:"rule,omitempty"`
+	Reason          string    `json:"reason"`
+	Action          string    `json:"action"`
+	Owner           string    `json:"owner,omitempty"`
+}
+
+// PodGetter gets a single pod
+type PodGetter interface {
+	GetPod(namespace string, name string) (*v1.Pod, error)
+}
+
+// Plan lists pods and records the candidates, in the order they would be
+// acted on. Nothing is deleted.
+func (c *Controller) Plan() (*Plan, error) {
+	candidates, err := c.Candidates()
+	if err != nil {
+		return nil, err
+	}
+
+	plan := &Plan{
+		Created: time.Now(),
+		Items:   make([]PlanItem, 0, len(candidates)),
+	}
+	for _, cand := range candidates {
+		plan.Items = append(plan.Items, PlanItem{
+			Namespace:       cand.Pod.ObjectMeta.Namespace,
+			Name:            cand.Pod.ObjectMeta.Name,
+			UID:             cand.Pod.ObjectMeta.UID,
+			ResourceVersion: cand.Pod.ObjectMeta.ResourceVersion,
+			Rule:            cand.Rule,
+			Reason:          cand.Reason,
+			Action:          cand.Action,
+			Owner:           cand.Owner(),
+		})
+	}
+	return plan, nil
+}
+
+// Apply acts on the pods in a plan, and only those pods. Each pod is
+// fetched again, and skipped with NotFound if it no longer exists or
+// UIDChanged if it was replaced by a pod with the same name. The pods are
+// not evaluated again, as the plan is assumed to have been reviewed, but
+// the deletion budget, flap detection, hooks, and pod disruption budgets
+// still apply.
+func (c *Controller) Apply(ctx context.Context, plan *Plan, getter PodGetter) (*RunResult, error) {
+	result := &RunResult{
+		ID:       newRunID(),
+		Time:     time.Now(),
+		DryRun:   c.isDryRun(),
+		Paused:   c.Paused(),
+		Disabled: c.Disabled(),
+	}
+
+	c.reloadHistory(result.Time)
+
+	c.mu.RLock()
+	rules := c.compiled
+	windows := c.windows
+	c.mu.RUnlock()
+
+	var candidates []Candidate
+	for _, item := range plan.Items {
+		logger := c.runLogger(result.ID).With(
+			zap.String("namespace", item.Namespace),
+			zap.String("name", item.Name),
+		)
+		if item.Rule != "" {
+			logger = logger.With(zap.String("rule", item.Rule))
+		}
+
+		skip := func(reason, detail string) {
+			logger.Info("skipping pod", zap.String("reason", reason), zap.String("detail", detail))
+			result.add(Decision{
+				Time:      result.Time,
+				Namespace: item.Namespace,
+				Name:      item.Name,
+				Rule:      item.Rule,
+				Reason:    item.Reason,
+				Owner:     item.Owner,
+				Action:    "skipped",
+				Skip:      reason,
+				Detail:    detail,
+				DryRun:    result.DryRun,
+				RunID:     result.ID,
+			})
+		}
+
+		// nothing is acted on until every item has been checked
+		r := findRule(rules, item.Rule)
+		if r == nil {
+			return nil, errors.Errorf("plan for pod %s/%s has unknown rule %q", item.Namespace, item.Name, item.Rule)
+		}
+		var action Action
+		if item.Action != r.Action {
+			a, err := c.planAction(item.Action)
+			if err != nil {
+				return nil, errors.Wrapf(err, "plan for pod %s/%s", item.Namespace, item.Name)
+			}
+			action = a
+		}
+
+		pod, err := getter.GetPod(item.Namespace, item.Name)
+		if err != nil {
+			if k8sErrors.IsNotFound(err) {
+				skip("NotFound", "")
+				continue
+			}
+			return nil, errors.Wrapf(err, "failed to get pod %s/%s", item.Namespace, item.Name)
+		}
+		if pod.ObjectMeta.UID != item.UID {
+			skip("UIDChanged", string(pod.ObjectMeta.UID))
+			continue
+		}
+		if pod.ObjectMeta.ResourceVersion != item.ResourceVersion {
+			logger.Info("pod has changed since it was planned",
+				zap.String("plannedVersion", item.ResourceVersion),
+				zap.String("resourceVersion", pod.ObjectMeta.ResourceVersion),
+			)
+		}
+
+		candidates = append(candidates, Candidate{
+			Pod:     *pod,
+			Rule:    item.Rule,
+			Reason:  item.Reason,
+			Action:  item.Action,
+			RunID:   result.ID,
+			rule:    r,
+			logger:  logger,
+			action:  action,
+			windows: windows,
+		})
+	}
+	result.Evaluated = len(plan.Items)
+	result.Candidates = len(candidates)
+
+	c.process(ctx, result, candidates)
+	c.finish(result.ID, result.Time, result, nil)
+
+	return result, nil
+}
+
+func findRule(rules []*rule, name string) *rule {
+	for _, r := range rules {
+		if r.Name == name {
+			return r
+		}
+	}
+	return nil
+}
+
+// planAction returns the action for a planned candidate whose action is
+// not its rule's, such as a force deletion.
+func (c *Controller) planAction(name string) (Action, error) {
+	if name != ForceDeleteActionName {
+		return c.actionFor(name)
+	}
+	if c.nodeNotReady != nil && c.nodeNotReady.force != nil {
+		return c.nodeNotReady.force, nil
+	}
+	if c.orphans != nil && c.orphans.force != nil {
+		return c.orphans.force, nil
+	}
+	return nil, errors.New("force deletion is not enabled")
+}
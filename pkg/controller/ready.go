@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// podReady returns true if the pod's Ready condition is true
+func podReady(pod *v1.Pod) bool {
+	for _, c := range pod.Status.Conditions {
+		if c.Type == v1.PodReady {
+			return c.Status == v1.ConditionTrue
+		}
+	}
+	return false
+}
+
+// notReadySince returns when the pod's Ready condition last became false,
+// or when the pod was created if it has never been ready. ok is false if
+// the pod is ready.
+func notReadySince(pod *v1.Pod) (since time.Time, ok bool) {
+	for _, c := range pod.Status.Conditions {
+		if c.Type != v1.PodReady {
+			continue
+		}
+		if c.Status == v1.ConditionTrue {
+			return time.Time{}, false
+		}
+		if !c.LastTransitionTime.IsZero() {
+			return c.LastTransitionTime.Time, true
+		}
+	}
+	return pod.ObjectMeta.CreationTimestamp.Time, true
+}
+
+// checkNotReady matches a pod that was skipped only because of its
+// container reasons if it has not been ready for longer than the timeout.
+// The time changes between runs, so it is never cached.
+func (c *Controller) checkNotReady(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if skip != "Reason" || r.notReady <= 0 {
+		return reason, skip, detail
+	}
+
+	since, ok := notReadySince(&pod)
+	if !ok || time.Since(since) <= r.notReady {
+		return reason, skip, detail
+	}
+
+	logger.Debug("pod is not ready",
+		zap.Time("since", since),
+		zap.Duration("timeout", r.notReady),
+	)
+	return "NotReady", "", ""
+}
+
+// WithNotReadyTimeout returns an Option that deletes pods whose Ready
+// condition has been false, or missing, for longer than the timeout, even
+// if no container is in one of the reasons.
+// Zero disables the check, which is the default.
+// Used when creating a new Controller.
+func WithNotReadyTimeout(timeout time.Duration) Option {
+	return func(c *Controller) error {
+		if timeout < 0 {
+			return errors.New("not ready timeout must not be negative")
+		}
+		c.notReady = timeout
+		return nil
+	}
+}
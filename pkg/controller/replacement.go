@@ -0,0 +1,232 @@
+package controller
+
+import (
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/history"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// Results of replacement checks, as the result label of
+// pod_deleter_replacements_total
+const (
+	// ReplacementReady is a pod whose owner created a replacement that
+	// became ready within the window.
+	ReplacementReady = "ready"
+	// ReplacementFailed is a pod whose owner did not.
+	ReplacementFailed = "failed"
+)
+
+// WithReplacementCheck returns an Option that checks, at the start of
+// each run, whether the owner of each pod deleted by the controller
+// created a replacement that became ready within window. Pods of a Job
+// count as replaced when a replacement succeeds. The results are counted
+// in pod_deleter_replacements_total. Deletions in the history are checked
+// as well, so a restart does not lose them. Pods without an owner, and
+// pods that an action did not remove, are not counted. Zero disables,
+// which is the default.
+// Used when creating a new Controller.
+func WithReplacementCheck(window time.Duration) Option {
+	return func(c *Controller) error {
+		if window < 0 {
+			return errors.New("replacement window must not be negative")
+		}
+		if window == 0 {
+			c.replacements = nil
+			return nil
+		}
+		c.replacements = &replacements{
+			window:  window,
+			pending: make(map[string]pendingReplacement),
+		}
+		return nil
+	}
+}
+
+// replacements holds the deletions whose replacement has not yet been
+// checked.
+type replacements struct {
+	window time.Duration
+
+	mu sync.Mutex
+	// pending is keyed by namespace and pod name
+	pending map[string]pendingReplacement
+}
+
+type pendingReplacement struct {
+	namespace string
+	name      string
+	owner     string
+	time      time.Time
+}
+
+// add records a deletion to check for a replacement. Pods without an
+// owner are not replaced, so are ignored.
+func (r *replacements) add(d history.Deletion) {
+	if r == nil || d.Owner == "" {
+		return
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.pending[d.Namespace+"/"+d.Name] = pendingReplacement{
+		namespace: d.Namespace,
+		name:      d.Name,
+		owner:     d.Owner,
+		time:      d.Time,
+	}
+}
+
+// len returns the number of deletions waiting for a replacement
+func (r *replacements) len() int {
+	if r == nil {
+		return 0
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return len(r.pending)
+}
+
+// checkReplacements counts the pending deletions that were replaced by a
+// ready pod, or whose window has passed without one.
+func (c *Controller) checkReplacements(now time.Time) {
+	r := c.replacements
+	if r == nil {
+		return
+	}
+
+	r.mu.Lock()
+	pending := make([]pendingReplacement, 0, len(r.pending))
+	for _, p := range r.pending {
+		pending = append(pending, p)
+	}
+	r.mu.Unlock()
+
+	// pods are listed once per namespace
+	namespaces := make(map[string][]v1.Pod)
+	for _, p := range pending {
+		pods, ok := namespaces[p.namespace]
+		if !ok {
+			var err error
+			pods, err = c.lister.ListPods(p.namespace, "")
+			if err != nil {
+				// try again next run
+				c.logger.Warn("failed to list pods to check replacements",
+					zap.String("namespace", p.namespace),
+					zap.Error(err),
+				)
+				continue
+			}
+			namespaces[p.namespace] = pods
+		}
+
+		result, ready, done := p.check(pods, now, r.window)
+		if !done {
+			continue
+		}
+
+		r.mu.Lock()
+		delete(r.pending, p.namespace+"/"+p.name)
+		r.mu.Unlock()
+
+		logger := c.logger.With(
+			zap.String("namespace", p.namespace),
+			zap.String("pod", p.name),
+			zap.String("owner", p.owner),
+		)
+		switch result {
+		case "":
+			logger.Debug("pod was not removed, so not checking for a replacement")
+			continue
+		case ReplacementReady:
+			logger.Info("replacement pod is ready", zap.Duration("after", ready))
+			c.counters.replacementReady.Observe(ready.Seconds())
+		case ReplacementFailed:
+			logger.Warn("no replacement pod became ready", zap.Duration("window", r.window))
+		}
+
+		kind := strings.SplitN(p.owner, "/", 2)[0]
+		c.counters.replacements.WithLabelValues(p.namespace, kind, result).Inc()
+		if c.sink != nil {
+			c.sink.Count("replacements", 1, map[string]string{
+				"namespace":  p.namespace,
+				"owner_kind": kind,
+				"result":     result,
+			})
+		}
+	}
+}
+
+// check returns whether the deleted pod was replaced, and how long after
+// the deletion the replacement became ready. done is false if it is too
+// soon to tell. An empty result means the pod was not removed, such as by
+// an action that only annotates it.
+func (p pendingReplacement) check(pods []v1.Pod, now time.Time, window time.Duration) (result string, ready time.Duration, done bool) {
+	at, replaced, exists := p.find(pods, window)
+	switch {
+	case replaced:
+		return ReplacementReady, at.Sub(p.time), true
+	case now.Sub(p.time) < window:
+		return "", 0, false
+	case exists:
+		return "", 0, true
+	}
+	return ReplacementFailed, 0, true
+}
+
+// find returns when the first replacement of the deleted pod became
+// ready, if one did within window, and whether the deleted pod still
+// exists and is not being deleted.
+func (p pendingReplacement) find(pods []v1.Pod, window time.Duration) (ready time.Time, replaced bool, exists bool) {
+	// creation timestamps only have seconds
+	deleted := p.time.Truncate(time.Second)
+
+	for i := range pods {
+		pod := &pods[i]
+		if podOwner(pod) != p.owner {
+			continue
+		}
+		if pod.ObjectMeta.CreationTimestamp.Time.Before(deleted) {
+			if pod.ObjectMeta.Name == p.name && pod.ObjectMeta.DeletionTimestamp == nil {
+				exists = true
+			}
+			continue
+		}
+
+		at, ok := replacedAt(pod)
+		if !ok || at.Sub(p.time) > window {
+			continue
+		}
+		if at.Before(p.time) {
+			at = p.time
+		}
+		return at, true, exists
+	}
+	return time.Time{}, false, exists
+}
+
+// replacedAt returns when a replacement pod became ready, or succeeded
+func replacedAt(pod *v1.Pod) (time.Time, bool) {
+	if pod.Status.Phase == v1.PodSucceeded {
+		for _, s := range pod.Status.ContainerStatuses {
+			if t := s.State.Terminated; t != nil {
+				return t.FinishedAt.Time, true
+			}
+		}
+		return pod.ObjectMeta.CreationTimestamp.Time, true
+	}
+
+	if !podReady(pod) {
+		return time.Time{}, false
+	}
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodReady {
+			return cond.LastTransitionTime.Time, true
+		}
+	}
+	return time.Time{}, false
+}
@@ -0,0 +1,72 @@
+package controller
+
+import (
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+)
+
+// WithAllowLastReadyReplica returns an Option that sets whether a pod
+// may be deleted if it is the only ready pod of its owner. By default,
+// such pods are skipped, so a degraded workload keeps the one pod that
+// is still serving.
+// Used when creating a new Controller.
+func WithAllowLastReadyReplica(allow bool) Option {
+	return func(c *Controller) error {
+		c.allowLast = allow
+		return nil
+	}
+}
+
+// readyReplicas counts the ready pods of each owner during a single run.
+// Pods are listed once per namespace, and each deletion of a ready pod
+// lowers the count of its owner, as the pod is not gone until later.
+type readyReplicas struct {
+	lister PodLister
+	// counts is keyed by namespace, then owner
+	counts map[string]map[string]int
+}
+
+func (c *Controller) newReadyReplicas() *readyReplicas {
+	if c.allowLast {
+		return nil
+	}
+	return &readyReplicas{
+		lister: c.lister,
+		counts: make(map[string]map[string]int),
+	}
+}
+
+// last returns true if the pod is the only ready pod of its owner. If it
+// is not, the pod is counted as deleted.
+func (r *readyReplicas) last(pod *v1.Pod) (bool, error) {
+	if r == nil || !podReady(pod) {
+		return false, nil
+	}
+	owner := podOwner(pod)
+	if owner == "" {
+		return false, nil
+	}
+
+	namespace := pod.ObjectMeta.Namespace
+	counts, ok := r.counts[namespace]
+	if !ok {
+		pods, err := r.lister.ListPods(namespace, "")
+		if err != nil {
+			return false, errors.Wrap(err, "failed to list pods")
+		}
+		counts = make(map[string]int)
+		for i := range pods {
+			p := &pods[i]
+			if p.ObjectMeta.DeletionTimestamp == nil && podReady(p) {
+				counts[podOwner(p)]++
+			}
+		}
+		r.counts[namespace] = counts
+	}
+
+	if counts[owner] <= 1 {
+		return true, nil
+	}
+	counts[owner]--
+	return false, nil
+}
@@ -0,0 +1,105 @@
+package controller
+
+import (
+	"encoding/json"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// RestartedAtAnnotation is set on the pod template of a workload to roll
+// out a restart, the same as kubectl rollout restart.
+const RestartedAtAnnotation = "kubectl.kubernetes.io/restartedAt"
+
+// DefaultRestartCooldown is how long the rollout restart action waits
+// before restarting the same workload again.
+const DefaultRestartCooldown = time.Minute * 10
+
+// rolloutRestarter restarts the workloads that own pods, at most once per
+// cooldown each.
+type rolloutRestarter struct {
+	patcher  OwnerPatcher
+	cooldown time.Duration
+	now      func() time.Time
+
+	mu        sync.Mutex
+	restarted map[string]time.Time
+}
+
+// RolloutRestartAction returns an Action that restarts the Deployment,
+// StatefulSet, or DaemonSet that owns a pod by setting the restartedAt
+// annotation on its pod template, so all of its pods are replaced by a
+// rollout rather than deleted one at a time. Other pods of a workload that
+// was restarted within the cooldown are left alone, as the rollout replaces
+// them. It fails for pods without one of these owners.
+func RolloutRestartAction(patcher OwnerPatcher, cooldown time.Duration) Action {
+	r := &rolloutRestarter{
+		patcher:   patcher,
+		cooldown:  cooldown,
+		now:       time.Now,
+		restarted: make(map[string]time.Time),
+	}
+	return ActionFunc(r.restart)
+}
+
+func (r *rolloutRestarter) restart(cand Candidate) error {
+	namespace := cand.Pod.ObjectMeta.Namespace
+	kind, name, err := r.workload(namespace, metav1.GetControllerOf(&cand.Pod))
+	if err != nil {
+		return err
+	}
+
+	key := namespace + "/" + kind + "/" + name
+	now := r.now()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if last, ok := r.restarted[key]; ok && now.Sub(last) < r.cooldown {
+		return nil
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"spec": map[string]interface{}{
+			"template": map[string]interface{}{
+				"metadata": map[string]interface{}{
+					"annotations": map[string]string{
+						RestartedAtAnnotation: now.UTC().Format(time.RFC3339),
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to create patch")
+	}
+
+	if err := r.patcher.PatchOwner(namespace, kind, name, patch); err != nil {
+		return err
+	}
+	r.restarted[key] = now
+	return nil
+}
+
+// workload returns the kind and name of the workload to restart for a pod
+// owned by ref. Pods of a Deployment are owned by one of its ReplicaSets.
+func (r *rolloutRestarter) workload(namespace string, ref *metav1.OwnerReference) (string, string, error) {
+	if ref == nil {
+		return "", "", errors.New("pod has no owner to restart")
+	}
+
+	switch ref.Kind {
+	case "StatefulSet", "DaemonSet":
+		return ref.Kind, ref.Name, nil
+	case "ReplicaSet":
+		meta, err := r.patcher.GetOwner(namespace, ref.Kind, ref.Name)
+		if err != nil {
+			return "", "", errors.Wrapf(err, "failed to get replica set %s", ref.Name)
+		}
+		if parent := metav1.GetControllerOf(meta); parent != nil && parent.Kind == "Deployment" {
+			return parent.Kind, parent.Name, nil
+		}
+	}
+	return "", "", errors.Errorf("pod owner %s/%s cannot be restarted", ref.Kind, ref.Name)
+}
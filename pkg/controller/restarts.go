@@ -0,0 +1,192 @@
+package controller
+
+import (
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/history"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/types"
+)
+
+// defaultRestartWindow is how long restart count samples are kept unless
+// set by WithRestartThreshold.
+const defaultRestartWindow = time.Hour
+
+type restartSample struct {
+	time  time.Time
+	count int32
+}
+
+type restartHistory struct {
+	uid     types.UID
+	samples []restartSample
+}
+
+// restartTracker records the restart counts of pods across runs
+type restartTracker struct {
+	mu   sync.Mutex
+	pods map[string]*restartHistory
+}
+
+// restartCount returns the total restarts of all containers in a pod
+func restartCount(pod v1.Pod) int32 {
+	var count int32
+	for _, status := range pod.Status.ContainerStatuses {
+		count += status.RestartCount
+	}
+	return count
+}
+
+// observe records the current restart count of a pod. A pod with the same
+// name but a different UID replaces the previous history.
+func (r *restartTracker) observe(pod v1.Pod, now time.Time) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pods == nil {
+		r.pods = make(map[string]*restartHistory)
+	}
+
+	key := pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+	h, ok := r.pods[key]
+	if !ok || h.uid != pod.ObjectMeta.UID {
+		h = &restartHistory{uid: pod.ObjectMeta.UID}
+		r.pods[key] = h
+	}
+
+	h.samples = append(h.samples, restartSample{time: now, count: restartCount(pod)})
+}
+
+// delta returns the restarts of a pod over the samples within the
+// window. It returns false if there are not enough samples.
+func (r *restartTracker) delta(pod v1.Pod) (int32, bool) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+	h, ok := r.pods[key]
+	if !ok || h.uid != pod.ObjectMeta.UID || len(h.samples) < 2 {
+		return 0, false
+	}
+
+	delta := h.samples[len(h.samples)-1].count - h.samples[0].count
+	if delta < 0 {
+		// counts should only go up, but the kubelet may reset them
+		return 0, false
+	}
+	return delta, true
+}
+
+// expire drops samples older than the window, and pods with no samples left.
+func (r *restartTracker) expire(now time.Time, window time.Duration) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	cutoff := now.Add(-window)
+	for key, h := range r.pods {
+		i := 0
+		for i < len(h.samples) && h.samples[i].time.Before(cutoff) {
+			i++
+		}
+		h.samples = h.samples[i:]
+		if len(h.samples) == 0 {
+			delete(r.pods, key)
+		}
+	}
+}
+
+// WithRestartRate returns an Option that sets the restart rate threshold,
+// in restarts per hour. Pods whose containers restart faster than this are
+// deleted even if no container is in one of the reasons. The rate is
+// computed from restart counts observed across runs over the restart
+// window, which is an hour unless set by WithRestartThreshold.
+// Zero disables the check, which is the default.
+// Used when creating a new Controller.
+func WithRestartRate(rate float64) Option {
+	return func(c *Controller) error {
+		if rate < 0 {
+			return errors.New("restart rate must not be negative")
+		}
+		c.restartRate = rate
+		return nil
+	}
+}
+
+// WithRestartThreshold returns an Option that deletes pods whose containers
+// restarted more than threshold times within window, even if no container
+// is in one of the reasons. Restarts are the difference between the
+// restart counts observed across runs, so a pod that restarted many times
+// long ago is not deleted. The window is also used for the restart rate.
+// Zero threshold disables the check, which is the default.
+// Used when creating a new Controller.
+func WithRestartThreshold(threshold int32, window time.Duration) Option {
+	return func(c *Controller) error {
+		if threshold < 0 {
+			return errors.New("restart threshold must not be negative")
+		}
+		if window <= 0 {
+			return errors.New("restart window must be positive")
+		}
+		c.restartLimit = threshold
+		c.restartWindow = window
+		return nil
+	}
+}
+
+// load adds restart samples saved in the history to the tracker
+func (r *restartTracker) load(samples []history.Restart) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.pods == nil {
+		r.pods = make(map[string]*restartHistory)
+	}
+
+	for _, s := range samples {
+		key := s.Namespace + "/" + s.Name
+		h, ok := r.pods[key]
+		if !ok || h.uid != types.UID(s.UID) {
+			h = &restartHistory{uid: types.UID(s.UID)}
+			r.pods[key] = h
+		}
+		h.samples = append(h.samples, restartSample{time: s.Time, count: s.Count})
+	}
+}
+
+// restarting returns the samples of pods whose restart count went up
+// within the window. Only these are saved, as the history may be kept
+// in a ConfigMap, which is limited in size.
+func (r *restartTracker) restarting() []history.Restart {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var out []history.Restart
+	for key, h := range r.pods {
+		if len(h.samples) < 2 || h.samples[len(h.samples)-1].count <= h.samples[0].count {
+			continue
+		}
+		parts := strings.SplitN(key, "/", 2)
+		for _, s := range h.samples {
+			out = append(out, history.Restart{
+				Time:      s.time,
+				Namespace: parts[0],
+				Name:      parts[1],
+				UID:       string(h.uid),
+				Count:     s.count,
+			})
+		}
+	}
+
+	// samples of a pod stay oldest first
+	sort.SliceStable(out, func(i, j int) bool {
+		if out[i].Namespace != out[j].Namespace {
+			return out[i].Namespace < out[j].Namespace
+		}
+		return out[i].Name < out[j].Name
+	})
+	return out
+}
@@ -0,0 +1,248 @@
+package controller
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RunResult describes what a single run of the controller did. Deleted
+// holds the pods that were deleted, or had another action applied. In
+// dry-run mode, it holds the pods that would have been. A paused or
+// disabled controller runs in dry-run mode.
+type RunResult struct {
+	// ID identifies the run in logs, events, and decisions
+	ID     string    `json:"id"`
+	Time   time.Time `json:"time"`
+	DryRun bool      `json:"dryRun"`
+	Paused bool      `json:"paused,omitempty"`
+	// Disabled is true if the kill switch was off when the run started
+	Disabled bool       `json:"disabled,omitempty"`
+	Deleted  []Decision `json:"deleted"`
+	// Skipped holds candidates skipped because of the budget and pods that
+	// did not match any rule, with the reason they were skipped.
+	Skipped []Decision `json:"skipped"`
+	// Errors holds candidates that could not be deleted.
+	Errors []Decision `json:"errors,omitempty"`
+	// Evaluated is the number of pods checked against the rules.
+	Evaluated int `json:"evaluated"`
+	// Candidates is the number of pods that matched a rule, whether or
+	// not they were then deleted.
+	Candidates int `json:"candidates"`
+	// Terminating is the number of pods skipped because they were
+	// already being deleted. They are also in Skipped.
+	Terminating int `json:"terminating"`
+	// Aborted is why the run acted on no pods, if it was aborted, such as
+	// by WithMassFailureThreshold or WithNodeHealth. Its candidates are in Skipped.
+	Aborted string `json:"aborted,omitempty"`
+	// abortSkip is the skip reason of the check that aborted the run
+	abortSkip string
+}
+
+// Err returns an error describing why the run was aborted, or every
+// candidate that could not be deleted, or nil if there were none.
+func (r *RunResult) Err() error {
+	if r.Aborted != "" {
+		return errors.Errorf("run aborted: %s", r.Aborted)
+	}
+	if len(r.Errors) == 0 {
+		return nil
+	}
+
+	msgs := make([]string, 0, len(r.Errors))
+	for _, d := range r.Errors {
+		msgs = append(msgs, d.Error)
+	}
+
+	if len(msgs) == 1 {
+		return errors.New(msgs[0])
+	}
+	return errors.Errorf("failed to act on %d pods: %s", len(msgs), strings.Join(msgs, "; "))
+}
+
+func (r *RunResult) add(d Decision) {
+	switch {
+	case d.Error != "":
+		r.Errors = append(r.Errors, d)
+	case d.Action == "skipped":
+		r.Skipped = append(r.Skipped, d)
+	default:
+		r.Deleted = append(r.Deleted, d)
+	}
+}
+
+// RunStatus summarizes the most recent run, including runs that failed
+// to list pods.
+type RunStatus struct {
+	ID        string        `json:"id,omitempty"`
+	Time      time.Time     `json:"time"`
+	Duration  time.Duration `json:"duration"`
+	Evaluated int           `json:"evaluated"`
+	Deleted   int           `json:"deleted"`
+	Skipped   int           `json:"skipped"`
+	Errors    int           `json:"errors"`
+	// Error is why the run failed, if it did
+	Error string `json:"error,omitempty"`
+}
+
+// lastResult holds the result and status of the most recent run
+type lastResult struct {
+	mu     sync.Mutex
+	result *RunResult
+	status RunStatus
+}
+
+// finish records the result and status of the run id that started at start,
+// counts it, and sends it to the metrics sink, auditors, and status publisher, if any. The result is nil if the run failed.
+func (c *Controller) finish(id string, start time.Time, r *RunResult, err error) {
+	status := c.lastResult.finish(id, start, r, err)
+	logger := c.runLogger(id)
+	c.logSummary(logger, status, r)
+	c.counters.observeRun(status)
+	if r != nil {
+		c.counters.add(r)
+	}
+	if c.sink != nil {
+		c.emit(status, r)
+	}
+	if r != nil {
+		for _, a := range c.auditors {
+			a.Audit(r)
+		}
+	}
+	if c.publisher != nil {
+		if err := c.publisher.Publish(status); err != nil {
+			logger.Warn("failed to publish run status", zap.Error(err))
+		}
+	}
+}
+
+// logSummary logs a single line describing what a run did, with the
+// number of pods skipped for each skip reason.
+func (c *Controller) logSummary(logger *zap.Logger, status RunStatus, r *RunResult) {
+	fields := []zapcore.Field{
+		zap.Int("evaluated", status.Evaluated),
+		zap.Int("deleted", status.Deleted),
+		zap.Int("skipped", status.Skipped),
+		zap.Int("errors", status.Errors),
+		zap.Duration("duration", status.Duration),
+	}
+	if status.Error != "" {
+		fields = append(fields, zap.String("error", status.Error))
+		logger.Warn("run failed", fields...)
+		return
+	}
+
+	skips := make(map[string]int)
+	for _, d := range r.Skipped {
+		skips[d.Skip]++
+	}
+	fields = append(fields,
+		zap.Int("candidates", r.Candidates),
+		zap.Int("terminating", r.Terminating),
+		zap.Any("skipReasons", skips),
+		zap.Bool("dryRun", r.DryRun),
+	)
+	logger.Info("run finished", fields...)
+}
+
+// newRunID returns a random ID for a run
+func newRunID() string {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return strconv.FormatInt(time.Now().UnixNano(), 16)
+	}
+	return hex.EncodeToString(b)
+}
+
+// runLogger returns the logger for the run id, or the controller's
+// logger if id is empty.
+func (c *Controller) runLogger(id string) *zap.Logger {
+	if id == "" {
+		return c.logger
+	}
+	return c.logger.With(zap.String("runID", id))
+}
+
+// StatusPublisher makes the status of each run available outside the
+// controller, such as in a ConfigMap.
+type StatusPublisher interface {
+	Publish(s RunStatus) error
+}
+
+// WithStatusPublisher returns an Option that publishes the status of
+// each run, including runs that failed, to p. Failures to publish are logged.
+// Used when creating a new Controller.
+func WithStatusPublisher(p StatusPublisher) Option {
+	return func(c *Controller) error {
+		c.publisher = p
+		return nil
+	}
+}
+
+// Auditor records the decisions made in each run, such as to an audit log.
+type Auditor interface {
+	Audit(r *RunResult)
+}
+
+// WithAuditor returns an Option that passes the result of each run to a.
+// It may be used more than once.
+// Used when creating a new Controller.
+func WithAuditor(a Auditor) Option {
+	return func(c *Controller) error {
+		c.auditors = append(c.auditors, a)
+		return nil
+	}
+}
+
+func (l *lastResult) finish(id string, start time.Time, r *RunResult, err error) RunStatus {
+	status := RunStatus{
+		ID:       id,
+		Time:     start,
+		Duration: time.Since(start),
+	}
+	if r != nil {
+		status.Evaluated = r.Evaluated
+		status.Deleted = len(r.Deleted)
+		status.Skipped = len(r.Skipped)
+		status.Errors = len(r.Errors)
+	}
+	if err != nil {
+		status.Error = err.Error()
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.status = status
+	if r != nil {
+		l.result = r
+	}
+	return status
+}
+
+func (l *lastResult) get() *RunResult {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.result
+}
+
+// LastRun returns the status of the most recent run. The time is zero
+// if the controller has not run yet.
+func (c *Controller) LastRun() RunStatus {
+	c.lastResult.mu.Lock()
+	defer c.lastResult.mu.Unlock()
+	return c.lastResult.status
+}
+
+// LastResult returns the result of the most recent run, or nil
+// if the controller has not run yet.
+func (c *Controller) LastResult() *RunResult {
+	return c.lastResult.get()
+}
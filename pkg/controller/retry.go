@@ -0,0 +1,100 @@
+package controller
+
+import (
+	"context"
+	"math/rand"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// retrier retries failed API calls with exponential backoff and jitter
+type retrier struct {
+	attempts int
+	initial  time.Duration
+	max      time.Duration
+}
+
+// do calls fn until it succeeds, returns an error that will not go away
+// by retrying, or the attempts are used up. The last error is returned.
+func (r retrier) do(ctx context.Context, logger *zap.Logger, op string, fn func() error) error {
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || !retriable(err) || attempt >= r.attempts {
+			return err
+		}
+
+		d := r.backoff(attempt)
+		logger.Warn("retrying after error",
+			zap.String("operation", op),
+			zap.Int("attempt", attempt),
+			zap.Duration("backoff", d),
+			zap.Error(err),
+		)
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return err
+		}
+	}
+}
+
+// backoff returns how long to wait after the given attempt: the initial
+// backoff doubled for each attempt, up to the max, with up to half of it random.
+func (r retrier) backoff(attempt int) time.Duration {
+	d := r.initial
+	for i := 1; i < attempt && d < r.max; i++ {
+		d *= 2
+	}
+	if d > r.max {
+		d = r.max
+	}
+	if d <= 0 {
+		return 0
+	}
+	half := d / 2
+	return half + time.Duration(rand.Int63n(int64(half)+1))
+}
+
+// retriable returns false for errors that retrying will not fix
+func retriable(err error) bool {
+	err = errors.Cause(err)
+	switch {
+	case k8sErrors.IsNotFound(err),
+		k8sErrors.IsForbidden(err),
+		k8sErrors.IsUnauthorized(err),
+		k8sErrors.IsBadRequest(err),
+		k8sErrors.IsInvalid(err),
+		k8sErrors.IsMethodNotSupported(err):
+		return false
+	}
+	return true
+}
+
+// WithRetry returns an Option that retries failed list and delete calls
+// up to attempts times in total, waiting an exponentially increasing time
+// starting at initial and capped at max between attempts. Errors such as
+// not found or forbidden are not retried. Default is a single attempt.
+// Used when creating a new Controller.
+func WithRetry(attempts int, initial time.Duration, max time.Duration) Option {
+	return func(c *Controller) error {
+		if attempts < 1 {
+			return errors.New("retry attempts must be at least 1")
+		}
+		if initial < 0 || max < initial {
+			return errors.New("retry backoff must not be negative or greater than the max")
+		}
+		c.retry = retrier{
+			attempts: attempts,
+			initial:  initial,
+			max:      max,
+		}
+		return nil
+	}
+}
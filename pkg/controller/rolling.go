@@ -0,0 +1,121 @@
+package controller
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// defaultRollingPoll is how often pods are listed while waiting for a
+// replacement to become ready.
+const defaultRollingPoll = time.Second * 5
+
+// WithWaitForReplacement returns an Option that, when a run acts on more
+// than one pod of the same owner, waits after each one until its owner
+// has a replacement that is ready, or until timeout, before acting on the
+// next. This replaces the pods of a workload one at a time rather than all
+// at once. Other pods in the run wait as well. Zero disables, which is the
+// default.
+// Used when creating a new Controller.
+func WithWaitForReplacement(timeout time.Duration) Option {
+	return func(c *Controller) error {
+		if timeout < 0 {
+			return errors.New("replacement timeout must not be negative")
+		}
+		if timeout == 0 {
+			c.rolling = nil
+			return nil
+		}
+		c.rolling = &rolling{
+			timeout: timeout,
+			poll:    defaultRollingPoll,
+		}
+		return nil
+	}
+}
+
+type rolling struct {
+	timeout time.Duration
+	poll    time.Duration
+}
+
+// rollingKey returns the namespace and owner of the candidate, or empty
+// string if it has no owner.
+func rollingKey(cand Candidate) string {
+	owner := cand.Owner()
+	if owner == "" {
+		return ""
+	}
+	return cand.Pod.ObjectMeta.Namespace + "/" + owner
+}
+
+// waitForReplacement blocks until the owner of the candidate has a ready
+// replacement for the pod acted on before it in this run, if any, or the
+// timeout has passed. acted holds the last pod acted on for each owner in
+// this run. It returns false if the context was canceled while waiting.
+func (c *Controller) waitForReplacement(ctx context.Context, cand Candidate, acted map[string]pendingReplacement) bool {
+	r := c.rolling
+	if r == nil || c.isDryRun() {
+		return true
+	}
+	prev, ok := acted[rollingKey(cand)]
+	if !ok {
+		return true
+	}
+
+	logger := cand.logger.With(zap.String("previous", prev.name))
+	deadline := prev.time.Add(r.timeout)
+	for {
+		pods, err := c.lister.ListPods(prev.namespace, "")
+		if err != nil {
+			logger.Warn("failed to list pods to check for a replacement", zap.Error(err))
+		} else {
+			_, replaced, exists := prev.find(pods, r.timeout)
+			if replaced {
+				return true
+			}
+			// a pod an action did not remove is never replaced. Give the
+			// lister a poll to see a deletion before deciding that.
+			if exists && time.Since(prev.time) >= r.poll {
+				return true
+			}
+		}
+
+		now := time.Now()
+		if !now.Before(deadline) {
+			logger.Warn("timed out waiting for a replacement pod to be ready", zap.Duration("timeout", r.timeout))
+			return true
+		}
+
+		d := r.poll
+		if left := deadline.Sub(now); left < d {
+			d = left
+		}
+		logger.Debug("waiting for a replacement pod to be ready", zap.Duration("wait", d))
+
+		t := time.NewTimer(d)
+		select {
+		case <-t.C:
+		case <-ctx.Done():
+			t.Stop()
+			return false
+		}
+	}
+}
+
+// rolled records that the candidate was acted on, so the next pod of its
+// owner in this run waits for it to be replaced.
+func (c *Controller) rolled(cand Candidate, now time.Time, acted map[string]pendingReplacement) {
+	key := rollingKey(cand)
+	if c.rolling == nil || key == "" {
+		return
+	}
+	acted[key] = pendingReplacement{
+		namespace: cand.Pod.ObjectMeta.Namespace,
+		name:      cand.Pod.ObjectMeta.Name,
+		owner:     cand.Owner(),
+		time:      now,
+	}
+}
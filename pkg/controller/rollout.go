@@ -0,0 +1,144 @@
+package controller
+
+import (
+	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/intstr"
+)
+
+// DeploymentGetter gets the Deployment that owns a pod, through the
+// pod's ReplicaSet.
+type DeploymentGetter interface {
+	GetOwner(namespace string, kind string, name string) (*metav1.ObjectMeta, error)
+	GetDeployment(namespace string, name string) (*appsv1.Deployment, error)
+}
+
+// WithRolloutCheck returns an Option that skips candidates owned by a
+// Deployment that is rolling out and already has as many unavailable
+// replicas as its strategy allows, so deletions do not add to the pods
+// the Deployment controller is replacing. Nil disables, which is the
+// default.
+// Used when creating a new Controller.
+func WithRolloutCheck(g DeploymentGetter) Option {
+	return func(c *Controller) error {
+		c.deployments = g
+		return nil
+	}
+}
+
+// rollouts tracks the Deployments that own candidates during a single
+// run. Each is read once, and each deletion of a ready pod adds to its
+// unavailable replicas, as the status is not updated until later.
+type rollouts struct {
+	getter DeploymentGetter
+	// owners maps a ReplicaSet to its Deployment, or empty string if it
+	// has none
+	owners      map[string]string
+	deployments map[string]*rolloutState
+}
+
+type rolloutState struct {
+	rolling        bool
+	unavailable    int
+	maxUnavailable int
+}
+
+func (c *Controller) newRollouts() *rollouts {
+	if c.deployments == nil {
+		return nil
+	}
+	return &rollouts{
+		getter:      c.deployments,
+		owners:      make(map[string]string),
+		deployments: make(map[string]*rolloutState),
+	}
+}
+
+// check returns the name of the Deployment that owns the pod if it is
+// rolling out with no more replicas allowed to be unavailable, or empty
+// string if the pod can be deleted. If it can, and is ready, it is
+// counted as unavailable.
+func (r *rollouts) check(pod *v1.Pod) (string, error) {
+	if r == nil {
+		return "", nil
+	}
+	ref := metav1.GetControllerOf(pod)
+	if ref == nil || ref.Kind != "ReplicaSet" {
+		return "", nil
+	}
+
+	namespace := pod.ObjectMeta.Namespace
+	rsKey := namespace + "/" + ref.Name
+	name, ok := r.owners[rsKey]
+	if !ok {
+		rs, err := r.getter.GetOwner(namespace, ref.Kind, ref.Name)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get replica set")
+		}
+		if d := metav1.GetControllerOf(rs); d != nil && d.Kind == "Deployment" {
+			name = d.Name
+		}
+		r.owners[rsKey] = name
+	}
+	if name == "" {
+		return "", nil
+	}
+
+	key := namespace + "/" + name
+	state, ok := r.deployments[key]
+	if !ok {
+		d, err := r.getter.GetDeployment(namespace, name)
+		if err != nil {
+			return "", errors.Wrap(err, "failed to get deployment")
+		}
+		state, err = newRolloutState(d)
+		if err != nil {
+			return "", err
+		}
+		r.deployments[key] = state
+	}
+
+	if state.rolling && state.unavailable >= state.maxUnavailable {
+		return name, nil
+	}
+	if podReady(pod) {
+		state.unavailable++
+	}
+	return "", nil
+}
+
+// newRolloutState returns whether a Deployment is rolling out, and how
+// many of its replicas are and may be unavailable.
+func newRolloutState(d *appsv1.Deployment) (*rolloutState, error) {
+	desired := int32(1)
+	if d.Spec.Replicas != nil {
+		desired = *d.Spec.Replicas
+	}
+
+	s := &rolloutState{
+		rolling: d.ObjectMeta.Generation > d.Status.ObservedGeneration ||
+			d.Status.UpdatedReplicas < desired ||
+			d.Status.Replicas > d.Status.UpdatedReplicas,
+		unavailable: int(desired - d.Status.AvailableReplicas),
+	}
+
+	// a Recreate rollout takes every replica down, so none may be
+	if d.Spec.Strategy.Type == appsv1.RecreateDeploymentStrategyType {
+		return s, nil
+	}
+
+	// the API server defaults maxUnavailable to 25%
+	maxUnavailable := intstr.FromString("25%")
+	if ru := d.Spec.Strategy.RollingUpdate; ru != nil && ru.MaxUnavailable != nil {
+		maxUnavailable = *ru.MaxUnavailable
+	}
+	// rounded down, as the Deployment controller does
+	n, err := intstr.GetValueFromIntOrPercent(&maxUnavailable, int(desired), false)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid maxUnavailable in deployment %s", d.ObjectMeta.Name)
+	}
+	s.maxUnavailable = n
+	return s, nil
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Scale down annotations are set on a Deployment scaled to zero because
+// its pods were flapping, so it can be restored by hand.
+const (
+	ScaledDownAnnotation       = "pod-deleter.bakins.io/scaled-down"
+	PreviousReplicasAnnotation = "pod-deleter.bakins.io/previous-replicas"
+)
+
+// DeploymentScaler scales the Deployments that own flapping pods. It
+// gets and annotates them as an OwnerPatcher.
+type DeploymentScaler interface {
+	OwnerPatcher
+	// ScaleDeployment sets the replicas of a Deployment and returns the
+	// previous number of replicas.
+	ScaleDeployment(namespace string, name string, replicas int32) (int32, error)
+}
+
+// WithFlapScaleDown returns an Option that scales the Deployment that owns
+// a workload to zero when the workload starts flapping, rather than only
+// skipping its pods until deletions leave the flap window. A warning event
+// is created on the Deployment. Only pods owned by a ReplicaSet of a
+// Deployment are scaled down. It has no effect without flap detection or
+// in dry-run mode. Nil disables, which is the default.
+// Used when creating a new Controller.
+func WithFlapScaleDown(s DeploymentScaler) Option {
+	return func(c *Controller) error {
+		c.scaler = s
+		return nil
+	}
+}
+
+// scaleDown scales the Deployment that owns a flapping candidate to zero.
+// Failures are logged and otherwise ignored; the workload's pods are still
+// skipped while it is flapping.
+func (c *Controller) scaleDown(cand Candidate, now time.Time) {
+	if c.scaler == nil {
+		return
+	}
+
+	ref := metav1.GetControllerOf(&cand.Pod)
+	if ref == nil || ref.Kind != "ReplicaSet" {
+		return
+	}
+
+	namespace := cand.Pod.ObjectMeta.Namespace
+	rs, err := c.scaler.GetOwner(namespace, ref.Kind, ref.Name)
+	if err != nil {
+		cand.logger.Warn("failed to scale down deployment", zap.Error(errors.Wrap(err, "failed to get replica set")))
+		return
+	}
+	deployment := metav1.GetControllerOf(rs)
+	if deployment == nil || deployment.Kind != "Deployment" {
+		return
+	}
+	logger := cand.logger.With(zap.String("deployment", deployment.Name))
+
+	previous, err := c.scaler.ScaleDeployment(namespace, deployment.Name, 0)
+	if err != nil {
+		logger.Warn("failed to scale down deployment", zap.Error(err))
+		return
+	}
+	logger.Warn("scaled down flapping deployment", zap.Int32("previousReplicas", previous))
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": map[string]string{
+				ScaledDownAnnotation:       now.UTC().Format(time.RFC3339),
+				PreviousReplicasAnnotation: strconv.Itoa(int(previous)),
+			},
+		},
+	})
+	if err == nil {
+		err = c.scaler.PatchOwner(namespace, deployment.Kind, deployment.Name, patch)
+	}
+	if err != nil {
+		logger.Warn("failed to annotate deployment", zap.Error(err))
+	}
+
+	event := scaleDownEvent(cand, deployment, previous, c.flaps.threshold, c.flaps.window, now)
+	c.onEscalate(cand, event)
+	if c.events == nil {
+		return
+	}
+	if err := c.events.CreateEvent(event); err != nil {
+		logger.Warn("failed to create event", zap.Error(errors.Wrap(err, "scaled down")))
+	}
+}
+
+// scaleDownEvent creates a warning event for a Deployment that was scaled
+// down from previous replicas
+func scaleDownEvent(cand Candidate, ref *metav1.OwnerReference, previous int32, deletions int, window time.Duration, now time.Time) *v1.Event {
+	ts := metav1.NewTime(now)
+	return &v1.Event{
+		ObjectMeta: metav1.ObjectMeta{
+			GenerateName: ref.Name + ".",
+			Namespace:    cand.Pod.ObjectMeta.Namespace,
+			Annotations: map[string]string{
+				RunIDAnnotation: cand.RunID,
+			},
+		},
+		InvolvedObject: v1.ObjectReference{
+			APIVersion: ref.APIVersion,
+			Kind:       ref.Kind,
+			Name:       ref.Name,
+			Namespace:  cand.Pod.ObjectMeta.Namespace,
+			UID:        ref.UID,
+		},
+		Reason: "ScaledDown",
+		Message: fmt.Sprintf("%d pods were deleted by k8s-pod-deleter within %s; scaled down from %d replicas",
+			deletions, window, previous),
+		Type:           v1.EventTypeWarning,
+		Source:         v1.EventSource{Component: "k8s-pod-deleter"},
+		FirstTimestamp: ts,
+		LastTimestamp:  ts,
+		Count:          1,
+	}
+}
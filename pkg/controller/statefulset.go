@@ -0,0 +1,138 @@
+package controller
+
+import (
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// StatefulSet modes for WithStatefulSets
+const (
+	// StatefulSetSkip skips every pod owned by a StatefulSet
+	StatefulSetSkip = "skip"
+	// StatefulSetSerial acts on at most one pod of each StatefulSet per
+	// run, and only after the pod acted on before it was replaced by a
+	// ready pod.
+	StatefulSetSerial = "serial"
+)
+
+// WithStatefulSets returns an Option that changes how pods owned by a
+// StatefulSet are handled, to avoid the loss of quorum of a stateful
+// workload. mode is one of StatefulSetSkip or StatefulSetSerial. With
+// StatefulSetSerial, pods are read with getter to check whether the
+// previous pod was replaced. Empty mode handles them as any other pod,
+// which is the default.
+// Used when creating a new Controller.
+func WithStatefulSets(mode string, getter PodGetter) Option {
+	return func(c *Controller) error {
+		switch mode {
+		case "":
+			c.statefulSets = nil
+			return nil
+		case StatefulSetSkip:
+		case StatefulSetSerial:
+			if getter == nil {
+				return errors.New("serial StatefulSet mode requires a pod getter")
+			}
+		default:
+			return errors.Errorf("invalid StatefulSet mode %q. Must be %s or %s", mode, StatefulSetSkip, StatefulSetSerial)
+		}
+		c.statefulSets = &statefulSets{
+			mode:    mode,
+			getter:  getter,
+			pending: make(map[string]replacement),
+		}
+		return nil
+	}
+}
+
+// statefulSets remembers the last pod acted on for each StatefulSet, so
+// no other pod is acted on until it is replaced.
+type statefulSets struct {
+	mode   string
+	getter PodGetter
+
+	mu sync.Mutex
+	// pending is keyed by namespace and StatefulSet name
+	pending map[string]replacement
+}
+
+type replacement struct {
+	name string
+	time time.Time
+}
+
+// statefulSetKey returns the namespace and name of the StatefulSet that
+// owns the candidate, or empty string if there is none.
+func statefulSetKey(cand Candidate) string {
+	ref := metav1.GetControllerOf(&cand.Pod)
+	if ref == nil || ref.Kind != "StatefulSet" {
+		return ""
+	}
+	return cand.Pod.ObjectMeta.Namespace + "/" + ref.Name
+}
+
+// check returns why the candidate should be skipped, or empty string if
+// it may be acted on. run holds the StatefulSets acted on in this run.
+func (s *statefulSets) check(cand Candidate, run map[string]bool) (string, error) {
+	if s == nil {
+		return "", nil
+	}
+	key := statefulSetKey(cand)
+	if key == "" {
+		return "", nil
+	}
+	if s.mode == StatefulSetSkip {
+		return key, nil
+	}
+	if run[key] {
+		return "another pod of " + key + " was acted on in this run", nil
+	}
+
+	s.mu.Lock()
+	prev, ok := s.pending[key]
+	s.mu.Unlock()
+	// acting on the same pod again disrupts no other ordinal
+	if !ok || prev.name == cand.Pod.ObjectMeta.Name {
+		return "", nil
+	}
+
+	pod, err := s.getter.GetPod(cand.Pod.ObjectMeta.Namespace, prev.name)
+	switch {
+	case k8sErrors.IsNotFound(err):
+		return "waiting for " + prev.name + " to be replaced", nil
+	case err != nil:
+		return "", errors.Wrapf(err, "failed to get pod %s", prev.name)
+	}
+	if pod.ObjectMeta.CreationTimestamp.Time.Before(prev.time) || !podReady(pod) {
+		return "waiting for " + prev.name + " to be ready", nil
+	}
+
+	s.mu.Lock()
+	delete(s.pending, key)
+	s.mu.Unlock()
+	return "", nil
+}
+
+// acted records that the candidate was acted on. Unless in dry-run mode,
+// no other pod of its StatefulSet is acted on until it is replaced.
+func (s *statefulSets) acted(cand Candidate, now time.Time, dryRun bool, run map[string]bool) {
+	if s == nil {
+		return
+	}
+	key := statefulSetKey(cand)
+	if key == "" {
+		return
+	}
+	run[key] = true
+	if dryRun {
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[key] = replacement{name: cand.Pod.ObjectMeta.Name, time: now}
+}
@@ -0,0 +1,33 @@
+package controller
+
+import (
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// TerminatingSkip is the skip reason of pods that are already being
+// deleted. Deleting them again only adds requests to the API server, and
+// does not hurry the kubelet.
+const TerminatingSkip = "Terminating"
+
+// checkTerminating skips a pod that matched if it already has a deletion
+// timestamp, unless it is on a lost node or in the Unknown phase and
+// would be force deleted, as those never finish terminating on their own.
+// It is checked last, so it applies whatever the pod matched.
+func (c *Controller) checkTerminating(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if skip != "" || pod.ObjectMeta.DeletionTimestamp == nil {
+		return reason, skip, detail
+	}
+
+	if c.forceAction(s, &pod) != nil {
+		return reason, skip, detail
+	}
+
+	logger.Debug("skipping pod that is already terminating",
+		zap.String("reason", reason),
+		zap.Time("deletionTimestamp", pod.ObjectMeta.DeletionTimestamp.Time),
+	)
+	return "", TerminatingSkip, pod.ObjectMeta.DeletionTimestamp.UTC().Format(time.RFC3339)
+}
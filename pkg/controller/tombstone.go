@@ -0,0 +1,76 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+)
+
+// Tombstone annotations are set on a pod before it is deleted, or another
+// action is applied, when using WithTombstone.
+const (
+	TombstoneByAnnotation     = "pod-deleter.bakins.io/by"
+	TombstoneActionAnnotation = "pod-deleter.bakins.io/action"
+	TombstoneReasonAnnotation = "pod-deleter.bakins.io/reason"
+	TombstoneRuleAnnotation   = "pod-deleter.bakins.io/rule"
+	TombstoneTimeAnnotation   = "pod-deleter.bakins.io/time"
+)
+
+type tombstone struct {
+	patcher  PodPatcher
+	identity string
+}
+
+// WithTombstone returns an Option that annotates each pod with identity,
+// the action, the reason and rule that matched, and the time, before
+// acting on it. This leaves a trail, in the pod's final state and in the
+// API server's audit log, even if the deleter's logs are lost.
+// Used when creating a new Controller.
+func WithTombstone(patcher PodPatcher, identity string) Option {
+	return func(c *Controller) error {
+		c.tombstone = &tombstone{
+			patcher:  patcher,
+			identity: identity,
+		}
+		return nil
+	}
+}
+
+// markTombstone annotates the candidate. Failures are logged, but do not
+// stop the action.
+func (c *Controller) markTombstone(ctx context.Context, cand Candidate, now time.Time) {
+	if c.tombstone == nil {
+		return
+	}
+
+	annotations := map[string]string{
+		TombstoneByAnnotation:     c.tombstone.identity,
+		TombstoneActionAnnotation: cand.Action,
+		TombstoneReasonAnnotation: cand.Reason,
+		TombstoneTimeAnnotation:   now.UTC().Format(time.RFC3339),
+	}
+	if cand.Rule != "" {
+		annotations[TombstoneRuleAnnotation] = cand.Rule
+	}
+
+	patch, err := json.Marshal(map[string]interface{}{
+		"metadata": map[string]interface{}{
+			"annotations": annotations,
+		},
+	})
+	if err != nil {
+		cand.logger.Warn("failed to create tombstone", zap.Error(err))
+		return
+	}
+
+	err = c.retry.do(ctx, cand.logger, "tombstone", func() error {
+		return c.tombstone.patcher.PatchPod(cand.Pod.ObjectMeta.Namespace, cand.Pod.ObjectMeta.Name, patch)
+	})
+	if err != nil && !k8sErrors.IsNotFound(err) {
+		cand.logger.Warn("failed to annotate pod with tombstone", zap.Error(errors.Wrap(err, "tombstone")))
+	}
+}
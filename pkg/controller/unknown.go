@@ -0,0 +1,94 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// unknownPhase matches pods that have been in the Unknown phase for
+// longer than the timeout
+type unknownPhase struct {
+	timeout time.Duration
+	force   Action
+}
+
+// WithUnknownPhase returns an Option that deletes pods that have been in
+// the Unknown phase for longer than timeout, with the reason UnknownPhase.
+// These pods are otherwise always skipped. The phase is Unknown when the
+// pod's kubelet cannot be reached, so it may never confirm the deletion.
+// If force is not nil, these pods are force deleted instead of having the
+// rule's action applied. Zero disables.
+// Used when creating a new Controller.
+func WithUnknownPhase(timeout time.Duration, force PodForceDeleter) Option {
+	return func(c *Controller) error {
+		if timeout < 0 {
+			return errors.New("unknown phase timeout must not be negative")
+		}
+		if timeout == 0 {
+			c.unknownPhase = nil
+			return nil
+		}
+		u := &unknownPhase{timeout: timeout}
+		if force != nil {
+			u.force = ForceDeleteAction(force)
+		}
+		c.unknownPhase = u
+		return nil
+	}
+}
+
+// unknownFor returns how long a pod has been in the Unknown phase. The
+// phase has no transition time, so the last transition of the Ready
+// condition, which changes when the kubelet is lost, is used, or the
+// creation time if the pod has no Ready condition. It returns false if the
+// phase is not Unknown.
+func unknownFor(pod *v1.Pod, now time.Time) (time.Duration, bool) {
+	if pod.Status.Phase != v1.PodUnknown {
+		return 0, false
+	}
+
+	since := pod.ObjectMeta.CreationTimestamp.Time
+	for _, cond := range pod.Status.Conditions {
+		if cond.Type == v1.PodReady && !cond.LastTransitionTime.IsZero() {
+			since = cond.LastTransitionTime.Time
+		}
+	}
+	return now.Sub(since), true
+}
+
+// inUnknownPhase returns how long the pod has been in the Unknown phase.
+// It returns false if that is not longer than the timeout.
+func (c *Controller) inUnknownPhase(s *runState, pod *v1.Pod) (time.Duration, bool) {
+	if c.unknownPhase == nil {
+		return 0, false
+	}
+
+	d, ok := unknownFor(pod, s.now)
+	return d, ok && d > c.unknownPhase.timeout
+}
+
+// checkUnknownPhase matches a pod that was skipped only because its phase
+// is Unknown, or because no container matched the reasons when Unknown is
+// one of the phases evaluated, if it has been for longer than the timeout.
+// The other filters, such as excluded service accounts, must still pass.
+// The time changes between runs, so it is never cached.
+func (c *Controller) checkUnknownPhase(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if c.unknownPhase == nil || (skip != "PodPhase" && skip != "Reason") || pod.Status.Phase != v1.PodUnknown {
+		return reason, skip, detail
+	}
+
+	// the phase filter is always first. The container statuses are stale,
+	// so it does not matter whether they match the reasons.
+	if _, filtered, _ := r.evaluateFilters(logger, pod, r.filters[1:]); filtered != "" && filtered != "Reason" {
+		return reason, skip, detail
+	}
+
+	if d, ok := c.inUnknownPhase(s, &pod); ok {
+		logger.Debug("pod is in the unknown phase", zap.Duration("unknown", d))
+		return "UnknownPhase", "", ""
+	}
+	return reason, skip, detail
+}
@@ -0,0 +1,152 @@
+package controller
+
+import (
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// ForceDeleteActionName is the action recorded for pods that are force
+// deleted because their node is not ready or missing, or they are in the
+// Unknown phase.
+const ForceDeleteActionName = "force-delete"
+
+// PodForceDeleter deletes a pod without waiting for the kubelet to
+// confirm that its containers have stopped.
+type PodForceDeleter interface {
+	ForceDeletePod(namespace string, name string) error
+}
+
+// ForceDeleteAction returns an Action that force deletes pods
+func ForceDeleteAction(deleter PodForceDeleter) Action {
+	return ActionFunc(func(cand Candidate) error {
+		return deleter.ForceDeletePod(cand.Pod.ObjectMeta.Namespace, cand.Pod.ObjectMeta.Name)
+	})
+}
+
+// nodeNotReady matches pods on nodes that have not been ready for
+// longer than the timeout
+type nodeNotReady struct {
+	lister  NodeLister
+	timeout time.Duration
+	force   Action
+}
+
+// WithNodeNotReady returns an Option that deletes pods on nodes whose Ready
+// condition has not been True for longer than timeout, with the reason
+// NodeNotReady, even if no container is in one of the reasons. A kubelet
+// that cannot be reached never confirms the deletion, so the pods stay
+// Terminating. If force is not nil, these pods are force deleted instead of
+// having the rule's action applied, as the pod garbage collector would.
+// Nodes are listed each run. Zero disables.
+// Used when creating a new Controller.
+func WithNodeNotReady(lister NodeLister, timeout time.Duration, force PodForceDeleter) Option {
+	return func(c *Controller) error {
+		if timeout < 0 {
+			return errors.New("node not ready timeout must not be negative")
+		}
+		if timeout == 0 {
+			c.nodeNotReady = nil
+			return nil
+		}
+		n := &nodeNotReady{lister: lister, timeout: timeout}
+		if force != nil {
+			n.force = ForceDeleteAction(force)
+		}
+		c.nodeNotReady = n
+		return nil
+	}
+}
+
+// notReadyFor returns how long a node's Ready condition has not been
+// True. It returns false if the node is ready or has no Ready condition.
+func notReadyFor(node *v1.Node, now time.Time) (time.Duration, bool) {
+	for _, cond := range node.Status.Conditions {
+		if cond.Type != v1.NodeReady {
+			continue
+		}
+		if cond.Status == v1.ConditionTrue {
+			return 0, false
+		}
+		return now.Sub(cond.LastTransitionTime.Time), true
+	}
+	return 0, false
+}
+
+// recheckableOnNode is recheckable, but also allows pods in the Unknown
+// phase, which the node controller may set on pods on lost nodes.
+func (r *rule) recheckableOnNode(logger *zap.Logger, pod v1.Pod, skip string) bool {
+	if skip == "PodPhase" && pod.Status.Phase == v1.PodUnknown {
+		// the phase filter is always first.
+		_, s, _ := r.evaluateFilters(logger, pod, r.filters[1:])
+		return s == "Reason"
+	}
+	return r.recheckable(logger, pod, skip)
+}
+
+// onNotReadyNode returns how long the pod's node has not been ready. It
+// returns false if that is not longer than the timeout.
+func (c *Controller) onNotReadyNode(s *runState, pod *v1.Pod) (time.Duration, bool) {
+	if c.nodeNotReady == nil {
+		return 0, false
+	}
+
+	node, ok := s.nodes[pod.Spec.NodeName]
+	if !ok {
+		return 0, false
+	}
+
+	d, ok := notReadyFor(&node, s.now)
+	return d, ok && d > c.nodeNotReady.timeout
+}
+
+// forceDelete replaces the action of a candidate on a node that has not
+// been ready for longer than the timeout, or no longer exists, or that has
+// been in the Unknown phase for longer than the timeout, whatever it
+// matched, as a normal deletion would never complete.
+func (c *Controller) forceDelete(s *runState, cand *Candidate) {
+	if force := c.forceAction(s, &cand.Pod); force != nil {
+		cand.Action = ForceDeleteActionName
+		cand.action = force
+	}
+}
+
+// forceAction returns the action to force delete pod with, or nil if it
+// should not be force deleted.
+func (c *Controller) forceAction(s *runState, pod *v1.Pod) Action {
+	if c.nodeNotReady != nil && c.nodeNotReady.force != nil {
+		if _, ok := c.onNotReadyNode(s, pod); ok {
+			return c.nodeNotReady.force
+		}
+	}
+	if c.orphans != nil && c.orphans.force != nil && c.onMissingNode(s, pod) {
+		return c.orphans.force
+	}
+	if c.unknownPhase != nil && c.unknownPhase.force != nil {
+		if _, ok := c.inUnknownPhase(s, pod); ok {
+			return c.unknownPhase.force
+		}
+	}
+	return nil
+}
+
+// checkNodeNotReady matches a pod that was skipped only because of its
+// container reasons, or because its phase is unknown, if its node has not
+// been ready for longer than the timeout. Node status changes between
+// runs, so it is never cached.
+func (c *Controller) checkNodeNotReady(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	if c.nodeNotReady == nil || pod.Spec.NodeName == "" || !r.recheckableOnNode(logger, pod, skip) {
+		return reason, skip, detail
+	}
+
+	if d, ok := c.onNotReadyNode(s, &pod); ok {
+		logger.Debug("pod is on a node that is not ready",
+			zap.String("node", pod.Spec.NodeName),
+			zap.Duration("notReady", d),
+		)
+		return "NodeNotReady", "", ""
+	}
+	return reason, skip, detail
+}
@@ -0,0 +1,130 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// UsageLister gets the resource usage of pods, such as from metrics-server.
+type UsageLister interface {
+	// ListPodUsage returns the usage of each container of the pods in a
+	// namespace, keyed by pod name, then container name.
+	ListPodUsage(namespace string) (map[string]map[string]v1.ResourceList, error)
+}
+
+// usageDetector matches pods with a container using more than a
+// percentage of its limits
+type usageDetector struct {
+	lister UsageLister
+	memory float64
+	cpu    float64
+}
+
+// WithResourceUsage returns an Option that deletes pods with a container
+// using more than a percentage of its memory or CPU limit, such as 90,
+// even if no container is in one of the reasons. This catches workloads
+// that leak memory but are never quite OOMKilled. Usage is listed each
+// run. Containers without a limit are not checked. Zero disables each
+// check.
+// Used when creating a new Controller.
+func WithResourceUsage(lister UsageLister, memory float64, cpu float64) Option {
+	return func(c *Controller) error {
+		if memory < 0 || cpu < 0 {
+			return errors.New("usage thresholds must not be negative")
+		}
+		if memory == 0 && cpu == 0 {
+			return nil
+		}
+		c.usage = &usageDetector{
+			lister: lister,
+			memory: memory,
+			cpu:    cpu,
+		}
+		return nil
+	}
+}
+
+// podUsage holds the resource usage of pods during a single run. Usage
+// is listed once per namespace.
+type podUsage struct {
+	detector *usageDetector
+	logger   *zap.Logger
+	// usage is keyed by namespace, then pod name, then container name
+	usage map[string]map[string]map[string]v1.ResourceList
+}
+
+func (c *Controller) newPodUsage(logger *zap.Logger) *podUsage {
+	return &podUsage{
+		detector: c.usage,
+		logger:   logger,
+		usage:    make(map[string]map[string]map[string]v1.ResourceList),
+	}
+}
+
+// reason returns MemoryUsage or CPUUsage, and the container and its
+// usage, if a container of the pod is over the threshold.
+func (u *podUsage) reason(pod *v1.Pod) (string, string) {
+	if u == nil || u.detector == nil {
+		return "", ""
+	}
+
+	namespace := pod.ObjectMeta.Namespace
+	usage, ok := u.usage[namespace]
+	if !ok {
+		var err error
+		usage, err = u.detector.lister.ListPodUsage(namespace)
+		if err != nil {
+			// treated as no usage, so it is not listed again this run
+			u.logger.Warn("failed to list pod usage", zap.String("namespace", namespace), zap.Error(err))
+		}
+		u.usage[namespace] = usage
+	}
+
+	containers := usage[pod.ObjectMeta.Name]
+	for _, container := range pod.Spec.Containers {
+		used, ok := containers[container.Name]
+		if !ok {
+			continue
+		}
+		if pct := percentOf(used, container.Resources.Limits, v1.ResourceMemory); pct > u.detector.memory && u.detector.memory > 0 {
+			return "MemoryUsage", fmt.Sprintf("%s=%.0f%%", container.Name, pct)
+		}
+		if pct := percentOf(used, container.Resources.Limits, v1.ResourceCPU); pct > u.detector.cpu && u.detector.cpu > 0 {
+			return "CPUUsage", fmt.Sprintf("%s=%.0f%%", container.Name, pct)
+		}
+	}
+	return "", ""
+}
+
+// percentOf returns the usage of a resource as a percentage of its
+// limit, or zero if there is no limit.
+func percentOf(used v1.ResourceList, limits v1.ResourceList, name v1.ResourceName) float64 {
+	limit, ok := limits[name]
+	if !ok || limit.IsZero() {
+		return 0
+	}
+	u := used[name]
+	return float64(u.MilliValue()) / float64(limit.MilliValue()) * 100
+}
+
+// checkUsage matches a pod that was skipped only because of its container
+// reasons if a container is using too much of its limits. Usage changes
+// between runs, so it is never cached.
+func (c *Controller) checkUsage(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	u := s.usage
+	if u == nil || u.detector == nil || skip != "Reason" {
+		return reason, skip, detail
+	}
+
+	if usage, container := u.reason(&pod); usage != "" {
+		logger.Debug("pod is using too much of its limits",
+			zap.String("reason", usage),
+			zap.String("container", container),
+		)
+		return usage, "", ""
+	}
+	return reason, skip, detail
+}
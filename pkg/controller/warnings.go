@@ -0,0 +1,151 @@
+package controller
+
+import (
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+)
+
+// EventLister gets a list of warning events for pods.
+type EventLister interface {
+	ListPodWarnings(namespace string) ([]v1.Event, error)
+}
+
+// warningDetector matches pods with too many warning events
+type warningDetector struct {
+	lister    EventLister
+	reasons   map[string]bool
+	threshold int32
+	window    time.Duration
+}
+
+// WithWarningEvents returns an Option that deletes pods with more than
+// threshold warning events with any of the reasons, such as BackOff or
+// FailedMount, within the window, even if no container is in one of the
+// reasons. Events are listed each run. Pending pods are checked as well.
+// Used when creating a new Controller.
+func WithWarningEvents(lister EventLister, reasons []string, threshold int, window time.Duration) Option {
+	return func(c *Controller) error {
+		if len(reasons) == 0 {
+			return nil
+		}
+		if threshold < 0 {
+			return errors.New("event threshold must not be negative")
+		}
+		if window <= 0 {
+			return errors.New("event window must be positive")
+		}
+		c.warnings = &warningDetector{
+			lister:    lister,
+			reasons:   reasonsMap(reasons),
+			threshold: int32(threshold),
+			window:    window,
+		}
+		return nil
+	}
+}
+
+// podWarnings counts the warning events of pods during a single run.
+// Events are listed once per namespace.
+type podWarnings struct {
+	detector *warningDetector
+	logger   *zap.Logger
+	now      time.Time
+	// counts are keyed by namespace, then pod UID, then event reason
+	counts map[string]map[string]map[string]int32
+}
+
+func (c *Controller) newPodWarnings(now time.Time, logger *zap.Logger) *podWarnings {
+	return &podWarnings{
+		detector: c.warnings,
+		logger:   logger,
+		now:      now,
+		counts:   make(map[string]map[string]map[string]int32),
+	}
+}
+
+// reason returns the reason with the most events for the pod if it has
+// more than the threshold, or empty string.
+func (w *podWarnings) reason(pod *v1.Pod) string {
+	if w == nil || w.detector == nil {
+		return ""
+	}
+
+	namespace := pod.ObjectMeta.Namespace
+	counts, ok := w.counts[namespace]
+	if !ok {
+		counts = w.list(namespace)
+		w.counts[namespace] = counts
+	}
+
+	var (
+		reason string
+		max    int32
+	)
+	byReason := counts[string(pod.ObjectMeta.UID)]
+	// sorted so the reason is the same when counts are equal
+	reasons := make([]string, 0, len(byReason))
+	for r := range byReason {
+		reasons = append(reasons, r)
+	}
+	sort.Strings(reasons)
+	for _, r := range reasons {
+		if byReason[r] > max {
+			reason, max = r, byReason[r]
+		}
+	}
+
+	if max > w.detector.threshold {
+		return reason
+	}
+	return ""
+}
+
+// list counts the events in the window for each pod in a namespace. A
+// failure to list is logged and treated as no events.
+func (w *podWarnings) list(namespace string) map[string]map[string]int32 {
+	counts := make(map[string]map[string]int32)
+
+	events, err := w.detector.lister.ListPodWarnings(namespace)
+	if err != nil {
+		w.logger.Warn("failed to list warning events", zap.String("namespace", namespace), zap.Error(err))
+		return counts
+	}
+
+	cutoff := w.now.Add(-w.detector.window)
+	for _, e := range events {
+		if !w.detector.reasons[e.Reason] || e.LastTimestamp.Time.Before(cutoff) {
+			continue
+		}
+		uid := string(e.InvolvedObject.UID)
+		if counts[uid] == nil {
+			counts[uid] = make(map[string]int32)
+		}
+		// repeated events are combined into one with a count
+		n := e.Count
+		if n < 1 {
+			n = 1
+		}
+		counts[uid][e.Reason] += n
+	}
+	return counts
+}
+
+// checkWarnings matches a pod that was skipped only because of its
+// container reasons, or because it is pending, if it has too many
+// warning events. Events change between runs, so it is never cached.
+func (c *Controller) checkWarnings(r *rule, s *runState, logger *zap.Logger, pod v1.Pod, reason, skip, detail string) (string, string, string) {
+	w := s.warnings
+	if w == nil || w.detector == nil || !r.recheckable(logger, pod, skip) {
+		return reason, skip, detail
+	}
+
+	if event := w.reason(&pod); event != "" {
+		logger.Debug("pod has too many warning events", zap.String("event", event))
+		return event, "", ""
+	}
+	return reason, skip, detail
+}
@@ -0,0 +1,252 @@
+package controller
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// WindowSkip is the skip reason of candidates found outside the windows in
+// which pods may be acted on, or inside a blackout window.
+const WindowSkip = "Window"
+
+// Window is a time window in which pods may be acted on or, if Deny is
+// set, may not be, such as business hours or a release freeze.
+type Window struct {
+	Name string
+	// Deny makes the window a blackout, in which no pods are acted on
+	Deny bool
+	// Days are the days of the week the window is open, such as Mon,
+	// Saturday, or Mon-Fri. Empty means every day.
+	Days []string
+	// Start and End are the times of day the window opens and closes,
+	// such as 09:00 and 17:00. Empty means all day. If End is not after
+	// Start, the window closes the next day.
+	Start string
+	End   string
+	// From and To limit the window to a range of dates, or times, such as
+	// 2018-12-20 or 2018-12-20T18:00. Either may be empty.
+	From string
+	To   string
+	// Timezone is the name of the time zone the window is in, such as
+	// America/New_York. Default is UTC.
+	Timezone string
+}
+
+// window is a compiled Window
+type window struct {
+	name     string
+	deny     bool
+	days     map[time.Weekday]bool
+	start    time.Duration
+	end      time.Duration
+	from     time.Time
+	to       time.Time
+	location *time.Location
+}
+
+var weekdays = map[string]time.Weekday{
+	"sun": time.Sunday, "sunday": time.Sunday,
+	"mon": time.Monday, "monday": time.Monday,
+	"tue": time.Tuesday, "tuesday": time.Tuesday,
+	"wed": time.Wednesday, "wednesday": time.Wednesday,
+	"thu": time.Thursday, "thursday": time.Thursday,
+	"fri": time.Friday, "friday": time.Friday,
+	"sat": time.Saturday, "saturday": time.Saturday,
+}
+
+// Validate returns an error if the window is not valid
+func (w Window) Validate() error {
+	_, err := w.compile()
+	return err
+}
+
+func (w Window) compile() (*window, error) {
+	cw := &window{
+		name:     w.Name,
+		deny:     w.Deny,
+		location: time.UTC,
+		end:      time.Hour * 24,
+	}
+
+	if w.Timezone != "" {
+		loc, err := time.LoadLocation(w.Timezone)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid timezone %q", w.Timezone)
+		}
+		cw.location = loc
+	}
+
+	if len(w.Days) > 0 {
+		cw.days = make(map[time.Weekday]bool)
+	}
+	for _, d := range w.Days {
+		parts := strings.SplitN(strings.ToLower(d), "-", 2)
+		first, ok := weekdays[parts[0]]
+		if !ok {
+			return nil, errors.Errorf("invalid day %q", d)
+		}
+		last := first
+		if len(parts) == 2 {
+			if last, ok = weekdays[parts[1]]; !ok {
+				return nil, errors.Errorf("invalid day %q", d)
+			}
+		}
+		// ranges may wrap around the end of the week, such as Fri-Mon
+		for day := first; ; day = (day + 1) % 7 {
+			cw.days[day] = true
+			if day == last {
+				break
+			}
+		}
+	}
+
+	if (w.Start == "") != (w.End == "") {
+		return nil, errors.New("start and end must both be set, or neither")
+	}
+	if w.Start != "" {
+		var err error
+		if cw.start, err = parseTimeOfDay(w.Start); err != nil {
+			return nil, err
+		}
+		if cw.end, err = parseTimeOfDay(w.End); err != nil {
+			return nil, err
+		}
+	}
+
+	for _, t := range []struct {
+		value string
+		dest  *time.Time
+	}{{w.From, &cw.from}, {w.To, &cw.to}} {
+		if t.value == "" {
+			continue
+		}
+		var err error
+		if *t.dest, err = time.ParseInLocation("2006-01-02T15:04", t.value, cw.location); err != nil {
+			if *t.dest, err = time.ParseInLocation("2006-01-02", t.value, cw.location); err != nil {
+				return nil, errors.Errorf("invalid date %q. Must be 2006-01-02 or 2006-01-02T15:04", t.value)
+			}
+		}
+	}
+	if !cw.from.IsZero() && !cw.to.IsZero() && !cw.to.After(cw.from) {
+		return nil, errors.New("to must be after from")
+	}
+
+	return cw, nil
+}
+
+// parseTimeOfDay parses a time of day, such as 09:30, as the time since
+// midnight. 24:00 is the end of the day.
+func parseTimeOfDay(s string) (time.Duration, error) {
+	parts := strings.SplitN(s, ":", 2)
+	if len(parts) == 2 && len(parts[1]) == 2 {
+		h, herr := strconv.Atoi(parts[0])
+		m, merr := strconv.Atoi(parts[1])
+		if herr == nil && merr == nil && h >= 0 && m >= 0 && m < 60 && (h < 24 || h == 24 && m == 0) {
+			return time.Duration(h)*time.Hour + time.Duration(m)*time.Minute, nil
+		}
+	}
+	return 0, errors.Errorf("invalid time of day %q. Must be 15:04", s)
+}
+
+// contains returns true if the window is open at t
+func (w *window) contains(t time.Time) bool {
+	t = t.In(w.location)
+	if !w.from.IsZero() && t.Before(w.from) {
+		return false
+	}
+	if !w.to.IsZero() && !t.Before(w.to) {
+		return false
+	}
+
+	// the time of day, rather than the time since midnight, which is an
+	// hour off on the day daylight saving time starts or ends
+	since := time.Duration(t.Hour())*time.Hour + time.Duration(t.Minute())*time.Minute
+	day := t.Weekday()
+
+	if w.start < w.end {
+		return w.openOn(day) && since >= w.start && since < w.end
+	}
+	// the window closes the next day
+	return (w.openOn(day) && since >= w.start) || (w.openOn((day+6)%7) && since < w.end)
+}
+
+func (w *window) openOn(day time.Weekday) bool {
+	return w.days == nil || w.days[day]
+}
+
+func compileWindows(windows []Window) ([]*window, error) {
+	compiled := make([]*window, 0, len(windows))
+	for i, w := range windows {
+		cw, err := w.compile()
+		if err != nil {
+			name := w.Name
+			if name == "" {
+				name = strconv.Itoa(i)
+			}
+			return nil, errors.Wrapf(err, "window %s", name)
+		}
+		compiled = append(compiled, cw)
+	}
+	return compiled, nil
+}
+
+// blockedBy returns why pods may not be acted on at t, or an empty string
+// if they may be. Blackout windows take precedence. If there are any other
+// windows, t must be in one of them.
+func blockedBy(windows []*window, t time.Time) string {
+	var allowed, open bool
+	for _, w := range windows {
+		if !w.deny {
+			allowed = true
+			open = open || w.contains(t)
+			continue
+		}
+		if w.contains(t) {
+			if w.name == "" {
+				return "in a blackout window"
+			}
+			return "in blackout window " + w.name
+		}
+	}
+	if allowed && !open {
+		return "outside the allowed windows"
+	}
+	return ""
+}
+
+// WithWindows returns an Option that sets the time windows in which pods
+// may be acted on, or not. Candidates found inside a blackout window, or
+// outside all of the other windows if there are any, are skipped with the
+// reason Window. The windows of a rule are checked as well as these.
+// Used when creating a new Controller.
+func WithWindows(windows []Window) Option {
+	return func(c *Controller) error {
+		compiled, err := compileWindows(windows)
+		if err != nil {
+			return err
+		}
+		c.windows = compiled
+		return nil
+	}
+}
+
+// checkWindows returns why the candidate may not be acted on at now, or
+// an empty string if it may be. The controller's windows are those in
+// effect when the candidate was found, so Reconfigure does not race a run.
+func (c *Controller) checkWindows(cand Candidate, now time.Time) string {
+	if detail := blockedBy(cand.windows, now); detail != "" {
+		return detail
+	}
+	if cand.rule != nil {
+		if detail := blockedBy(cand.rule.windows, now); detail != "" {
+			if cand.Rule != "" {
+				detail += " of rule " + cand.Rule
+			}
+			return detail
+		}
+	}
+	return ""
+}
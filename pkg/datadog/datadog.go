@@ -0,0 +1,238 @@
+// Package datadog posts the controller's deletions as Datadog events, so
+// they show up on dashboards next to deploy markers.
+package datadog
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// Event is a Datadog event, as accepted by the events API
+type Event struct {
+	Title          string   `json:"title"`
+	Text           string   `json:"text"`
+	DateHappened   int64    `json:"date_happened,omitempty"`
+	AlertType      string   `json:"alert_type,omitempty"`
+	AggregationKey string   `json:"aggregation_key,omitempty"`
+	SourceTypeName string   `json:"source_type_name,omitempty"`
+	Tags           []string `json:"tags,omitempty"`
+}
+
+// Client posts events to the Datadog API. It implements
+// controller.Auditor.
+type Client struct {
+	apiKey string
+	url    string
+	tags   []string
+	rollup bool
+	client *http.Client
+	logger *zap.Logger
+}
+
+// Option sets options when creating a new Client
+type Option func(*Client) error
+
+// New creates a client that posts events with the API key.
+func New(apiKey string, options ...Option) (*Client, error) {
+	if apiKey == "" {
+		return nil, errors.New("API key is required")
+	}
+
+	c := &Client{
+		apiKey: apiKey,
+		url:    "https://api.datadoghq.com/api/v1/events",
+		client: &http.Client{Timeout: time.Second * 10},
+		logger: zap.NewNop(),
+	}
+
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	return c, nil
+}
+
+// WithSite returns an Option that sets the Datadog site, such as
+// datadoghq.eu. Default is datadoghq.com.
+func WithSite(site string) Option {
+	return func(c *Client) error {
+		if site == "" {
+			return errors.New("site must not be empty")
+		}
+		c.url = "https://api." + site + "/api/v1/events"
+		return nil
+	}
+}
+
+// WithURL returns an Option that sets the URL events are posted to,
+// replacing the site.
+func WithURL(url string) Option {
+	return func(c *Client) error {
+		c.url = url
+		return nil
+	}
+}
+
+// WithTags returns an Option that adds tags, such as cluster:production,
+// to every event.
+func WithTags(tags []string) Option {
+	return func(c *Client) error {
+		c.tags = tags
+		return nil
+	}
+}
+
+// WithRollup returns an Option that posts a single event per run that
+// deleted pods, rather than an event per deletion.
+func WithRollup(enabled bool) Option {
+	return func(c *Client) error {
+		c.rollup = enabled
+		return nil
+	}
+}
+
+// WithLogger returns an Option that sets the logger used to report
+// errors posting events.
+func WithLogger(logger *zap.Logger) Option {
+	return func(c *Client) error {
+		c.logger = logger
+		return nil
+	}
+}
+
+// Audit posts the pods deleted, or acted on, in a run. Runs that did
+// not delete any pods are not posted.
+func (c *Client) Audit(r *controller.RunResult) {
+	if len(r.Deleted) == 0 {
+		return
+	}
+
+	var events []Event
+	if c.rollup {
+		events = append(events, c.rollupEvent(r))
+	} else {
+		for _, d := range r.Deleted {
+			events = append(events, c.deletionEvent(d))
+		}
+	}
+
+	for _, e := range events {
+		if err := c.Post(e); err != nil {
+			c.logger.Error("failed to post Datadog event", zap.Error(err))
+		}
+	}
+}
+
+func (c *Client) deletionEvent(d controller.Decision) Event {
+	title := fmt.Sprintf("Pod %s/%s %s: %s", d.Namespace, d.Name, d.Action, d.Reason)
+	if d.DryRun {
+		title += " (dry run)"
+	}
+
+	tags := append([]string{}, c.tags...)
+	tags = append(tags,
+		"kube_namespace:"+d.Namespace,
+		"pod_name:"+d.Name,
+		"reason:"+d.Reason,
+		"action:"+d.Action,
+	)
+	key := d.Namespace + "/" + d.Name
+	if d.Owner != "" {
+		parts := strings.SplitN(d.Owner, "/", 2)
+		tags = append(tags, "kube_ownerref_kind:"+strings.ToLower(parts[0]))
+		if len(parts) == 2 {
+			tags = append(tags, "kube_ownerref_name:"+parts[1])
+		}
+		key = d.Namespace + "/" + d.Owner
+	}
+	if d.Rule != "" {
+		tags = append(tags, "rule:"+d.Rule)
+	}
+	if d.RunID != "" {
+		tags = append(tags, "run_id:"+d.RunID)
+	}
+
+	return Event{
+		Title:          title,
+		Text:           fmt.Sprintf("k8s-pod-deleter %s pod %s/%s because of %s.", d.Action, d.Namespace, d.Name, d.Reason),
+		DateHappened:   d.Time.Unix(),
+		AlertType:      "info",
+		AggregationKey: key,
+		SourceTypeName: "kubernetes",
+		Tags:           tags,
+	}
+}
+
+func (c *Client) rollupEvent(r *controller.RunResult) Event {
+	title := fmt.Sprintf("Deleted %d pods", len(r.Deleted))
+	if r.DryRun {
+		title += " (dry run)"
+	}
+
+	var text bytes.Buffer
+	namespaces := make(map[string]bool)
+	for _, d := range r.Deleted {
+		fmt.Fprintf(&text, "%s/%s %s: %s\n", d.Namespace, d.Name, d.Action, d.Reason)
+		namespaces[d.Namespace] = true
+	}
+
+	tags := append([]string{}, c.tags...)
+	names := make([]string, 0, len(namespaces))
+	for ns := range namespaces {
+		names = append(names, ns)
+	}
+	sort.Strings(names)
+	for _, ns := range names {
+		tags = append(tags, "kube_namespace:"+ns)
+	}
+	if r.ID != "" {
+		tags = append(tags, "run_id:"+r.ID)
+	}
+
+	return Event{
+		Title:          title,
+		Text:           text.String(),
+		DateHappened:   r.Time.Unix(),
+		AlertType:      "info",
+		AggregationKey: "k8s-pod-deleter",
+		SourceTypeName: "kubernetes",
+		Tags:           tags,
+	}
+}
+
+// Post sends a single event
+func (c *Client) Post(e Event) error {
+	data, err := json.Marshal(e)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode event")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, c.url, bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("DD-API-KEY", c.apiKey)
+
+	resp, err := c.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to post event")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status posting event: %s", resp.Status)
+	}
+	return nil
+}
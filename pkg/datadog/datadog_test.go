@@ -0,0 +1,110 @@
+package datadog
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+)
+
+type testServer struct {
+	mu     sync.Mutex
+	events []Event
+	keys   []string
+}
+
+func (s *testServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	var e Event
+	if err := json.NewDecoder(r.Body).Decode(&e); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.events = append(s.events, e)
+	s.keys = append(s.keys, r.Header.Get("DD-API-KEY"))
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func testResult() *controller.RunResult {
+	now := time.Now()
+	return &controller.RunResult{
+		ID:   "f00d",
+		Time: now,
+		Deleted: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-1", Owner: "ReplicaSet/web-1234", Reason: "CrashLoopBackOff", Action: "deleted", RunID: "f00d"},
+			{Time: now, Namespace: "batch", Name: "job-1", Reason: "Error", Action: "deleted", RunID: "f00d"},
+		},
+		Skipped: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-2", Action: "skipped", Skip: "Budget"},
+		},
+	}
+}
+
+func TestClient(t *testing.T) {
+	s := &testServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c, err := New("secret",
+		WithURL(server.URL),
+		WithTags([]string{"cluster:test"}),
+	)
+	require.NoError(t, err)
+
+	c.Audit(testResult())
+	require.Len(t, s.events, 2)
+	require.Equal(t, []string{"secret", "secret"}, s.keys)
+	require.Equal(t, "Pod default/web-1 deleted: CrashLoopBackOff", s.events[0].Title)
+	require.Equal(t, []string{
+		"cluster:test",
+		"kube_namespace:default",
+		"pod_name:web-1",
+		"reason:CrashLoopBackOff",
+		"action:deleted",
+		"kube_ownerref_kind:replicaset",
+		"kube_ownerref_name:web-1234",
+		"run_id:f00d",
+	}, s.events[0].Tags)
+	require.Equal(t, "default/ReplicaSet/web-1234", s.events[0].AggregationKey)
+
+	// nothing deleted, nothing posted
+	c.Audit(&controller.RunResult{Time: time.Now()})
+	require.Len(t, s.events, 2)
+
+	_, err = New("")
+	require.Error(t, err)
+}
+
+func TestClientRollup(t *testing.T) {
+	s := &testServer{}
+	server := httptest.NewServer(s)
+	defer server.Close()
+
+	c, err := New("secret", WithURL(server.URL), WithRollup(true))
+	require.NoError(t, err)
+
+	r := testResult()
+	r.DryRun = true
+	c.Audit(r)
+	require.Len(t, s.events, 1)
+	require.Equal(t, "Deleted 2 pods (dry run)", s.events[0].Title)
+	require.Equal(t, []string{"kube_namespace:batch", "kube_namespace:default", "run_id:f00d"}, s.events[0].Tags)
+}
+
+func TestClientError(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	c, err := New("secret", WithURL(server.URL))
+	require.NoError(t, err)
+	require.Error(t, c.Post(Event{Title: "test"}))
+}
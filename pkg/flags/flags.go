@@ -0,0 +1,182 @@
+// Package flags groups command line flags for help output and
+// supports deprecated aliases, so flags can be reorganized without
+// breaking existing deployments.
+package flags
+
+import (
+	"bytes"
+	"fmt"
+
+	"github.com/pkg/errors"
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+)
+
+// Registry holds flag groups
+type Registry struct {
+	groups []*group
+	member map[string]*group
+}
+
+type group struct {
+	name  string
+	flags []string
+}
+
+// New creates an empty registry
+func New() *Registry {
+	return &Registry{
+		member: make(map[string]*group),
+	}
+}
+
+// Group adds flags to a named group. Groups are shown in help output in
+// the order they are created. A flag can only be in one group; adding it
+// again moves it.
+func (r *Registry) Group(name string, flags ...string) {
+	var g *group
+	for _, existing := range r.groups {
+		if existing.name == name {
+			g = existing
+			break
+		}
+	}
+	if g == nil {
+		g = &group{name: name}
+		r.groups = append(r.groups, g)
+	}
+
+	for _, f := range flags {
+		if old, ok := r.member[f]; ok {
+			old.remove(f)
+		}
+		g.flags = append(g.flags, f)
+		r.member[f] = g
+	}
+}
+
+func (g *group) remove(name string) {
+	for i, f := range g.flags {
+		if f == name {
+			g.flags = append(g.flags[:i], g.flags[i+1:]...)
+			return
+		}
+	}
+}
+
+// Alias adds a deprecated flag named old to fs that sets the flag named
+// current, and marks it as changed. Using the old name prints a warning.
+// Deprecated flags are not shown in help output.
+func Alias(fs *pflag.FlagSet, old string, current string) error {
+	f := fs.Lookup(current)
+	if f == nil {
+		return errors.Errorf("flag %q not found", current)
+	}
+
+	fs.AddFlag(&pflag.Flag{
+		Name:        old,
+		Usage:       f.Usage,
+		Value:       &alias{Value: f.Value, flag: f},
+		DefValue:    f.DefValue,
+		NoOptDefVal: f.NoOptDefVal,
+	})
+
+	return fs.MarkDeprecated(old, fmt.Sprintf("use --%s instead", current))
+}
+
+// alias sets the value of another flag
+type alias struct {
+	pflag.Value
+	flag *pflag.Flag
+}
+
+func (a *alias) Set(value string) error {
+	if err := a.Value.Set(value); err != nil {
+		return err
+	}
+	a.flag.Changed = true
+	return nil
+}
+
+// FlagUsages returns the usage for the flags in fs, grouped. Flags that
+// are not in a group are listed under title.
+func (r *Registry) FlagUsages(fs *pflag.FlagSet, title string) string {
+	sets := make(map[*group]*pflag.FlagSet, len(r.groups))
+	other := pflag.NewFlagSet(title, pflag.ContinueOnError)
+
+	fs.VisitAll(func(f *pflag.Flag) {
+		g, ok := r.member[f.Name]
+		if !ok {
+			other.AddFlag(f)
+			return
+		}
+		set, ok := sets[g]
+		if !ok {
+			set = pflag.NewFlagSet(g.name, pflag.ContinueOnError)
+			sets[g] = set
+		}
+		set.AddFlag(f)
+	})
+
+	var buf bytes.Buffer
+	write := func(name string, set *pflag.FlagSet) {
+		usages := set.FlagUsages()
+		if usages == "" {
+			return
+		}
+		if buf.Len() > 0 {
+			buf.WriteString("\n")
+		}
+		fmt.Fprintf(&buf, "%s:\n%s", name, usages)
+	}
+
+	for _, g := range r.groups {
+		if set, ok := sets[g]; ok {
+			write(g.name+" Flags", set)
+		}
+	}
+	write(title, other)
+
+	return buf.String()
+}
+
+// UsageFunc returns a cobra usage function that prints flags in groups.
+// Ungrouped flags are listed as "Flags" or "Global Flags" if inherited
+// from a parent command.
+func (r *Registry) UsageFunc() func(*cobra.Command) error {
+	return func(c *cobra.Command) error {
+		var buf bytes.Buffer
+
+		buf.WriteString("Usage:\n")
+		if c.Runnable() {
+			fmt.Fprintf(&buf, "  %s\n", c.UseLine())
+		}
+		if c.HasAvailableSubCommands() {
+			fmt.Fprintf(&buf, "  %s [command]\n", c.CommandPath())
+		}
+
+		if c.HasAvailableSubCommands() {
+			buf.WriteString("\nAvailable Commands:\n")
+			for _, sub := range c.Commands() {
+				if sub.IsAvailableCommand() || sub.Name() == "help" {
+					fmt.Fprintf(&buf, "  %-*s %s\n", sub.NamePadding(), sub.Name(), sub.Short)
+				}
+			}
+		}
+
+		if usages := r.FlagUsages(c.LocalFlags(), "Flags"); usages != "" {
+			fmt.Fprintf(&buf, "\n%s", usages)
+		}
+
+		if usages := r.FlagUsages(c.InheritedFlags(), "Global Flags"); usages != "" {
+			fmt.Fprintf(&buf, "\n%s", usages)
+		}
+
+		if c.HasAvailableSubCommands() {
+			fmt.Fprintf(&buf, "\nUse \"%s [command] --help\" for more information about a command.\n", c.CommandPath())
+		}
+
+		_, err := c.OutOrStderr().Write(buf.Bytes())
+		return err
+	}
+}
@@ -0,0 +1,56 @@
+package flags
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/spf13/pflag"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAlias(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	var out bytes.Buffer
+	fs.SetOutput(&out)
+	var grace string
+	fs.StringVar(&grace, "grace-period", "1h", "grace period")
+
+	require.NoError(t, Alias(fs, "grace", "grace-period"))
+	require.Error(t, Alias(fs, "old", "missing"))
+
+	require.NoError(t, fs.Parse([]string{"--grace", "5m"}))
+	require.Equal(t, "5m", grace)
+	require.True(t, fs.Changed("grace-period"))
+	require.Contains(t, out.String(), "use --grace-period instead")
+
+	// deprecated aliases are not shown
+	require.NotContains(t, fs.FlagUsages(), "--grace ")
+}
+
+func TestFlagUsages(t *testing.T) {
+	fs := pflag.NewFlagSet("test", pflag.ContinueOnError)
+	fs.String("kubeconfig", "", "Kubernetes client config")
+	fs.String("namespace", "", "namespace")
+	fs.String("selector", "", "selector")
+	fs.Bool("once", false, "run once")
+	fs.Bool("secret", false, "hidden flag")
+	require.NoError(t, fs.MarkHidden("secret"))
+
+	r := New()
+	r.Group("Kubernetes", "kubeconfig", "namespace")
+	r.Group("Selection", "selector")
+	// moves namespace from Kubernetes to Selection
+	r.Group("Selection", "namespace")
+
+	usages := r.FlagUsages(fs, "Flags")
+	require.Equal(t, `Kubernetes Flags:
+      --kubeconfig string   Kubernetes client config
+
+Selection Flags:
+      --namespace string   namespace
+      --selector string    selector
+
+Flags:
+      --once   run once
+`, usages)
+}
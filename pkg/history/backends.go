@@ -0,0 +1,260 @@
+package history
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapKey is the key in the ConfigMap that holds the history
+const ConfigMapKey = "history.json"
+
+// RestartsConfigMapKey is the key in the ConfigMap that holds restart counts
+const RestartsConfigMapKey = "restarts.json"
+
+// updateAttempts is how many times an update that lost a race with
+// another replica is tried
+const updateAttempts = 5
+
+type fileBackend struct {
+	path string
+}
+
+// FileBackend returns a Backend that saves deletions as JSON in a local file.
+// Restart counts are saved next to it, in a file with a .restarts suffix.
+func FileBackend(path string) Backend {
+	return &fileBackend{path: path}
+}
+
+func (f *fileBackend) Load() ([]Deletion, error) {
+	var deletions []Deletion
+	if err := readFile(f.path, &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (f *fileBackend) Save(deletions []Deletion) error {
+	return writeFile(f.path, deletions)
+}
+
+// Update loads and saves the file. A file is only shared by the replicas
+// of a single process, so it does not guard against other writers.
+func (f *fileBackend) Update(fn func(saved []Deletion) []Deletion) error {
+	saved, err := f.Load()
+	if err != nil {
+		return err
+	}
+	return f.Save(fn(saved))
+}
+
+func (f *fileBackend) LoadRestarts() ([]Restart, error) {
+	var restarts []Restart
+	if err := readFile(f.path+".restarts", &restarts); err != nil {
+		return nil, err
+	}
+	return restarts, nil
+}
+
+func (f *fileBackend) SaveRestarts(restarts []Restart) error {
+	return writeFile(f.path+".restarts", restarts)
+}
+
+// readFile decodes the JSON in path into v. A missing file leaves v unchanged.
+func readFile(path string, v interface{}) error {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to read %q", path)
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrapf(err, "failed to parse %q", path)
+	}
+	return nil
+}
+
+func writeFile(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode history")
+	}
+
+	// write to a temporary file and rename it, so a crash does not leave a partial file
+	tmp, err := ioutil.TempFile(filepath.Dir(path), filepath.Base(path)+".")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary file")
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return errors.Wrapf(err, "failed to write %q", tmp.Name())
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Wrapf(err, "failed to write %q", tmp.Name())
+	}
+
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return errors.Wrapf(err, "failed to rename to %q", path)
+	}
+	return nil
+}
+
+// ConfigMapClient gets, creates, and updates ConfigMaps
+type ConfigMapClient interface {
+	GetConfigMap(namespace string, name string) (*v1.ConfigMap, error)
+	CreateConfigMap(cm *v1.ConfigMap) error
+	UpdateConfigMap(cm *v1.ConfigMap) error
+}
+
+type configMapBackend struct {
+	client    ConfigMapClient
+	namespace string
+	name      string
+}
+
+// ConfigMapBackend returns a Backend that saves deletions as JSON in a
+// ConfigMap. The ConfigMap is created if it does not exist. As ConfigMaps
+// are limited in size, keep the retention period short. Restart counts
+// are saved under a separate key in the same ConfigMap.
+func ConfigMapBackend(client ConfigMapClient, namespace string, name string) Backend {
+	return &configMapBackend{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+func (c *configMapBackend) Load() ([]Deletion, error) {
+	var deletions []Deletion
+	if err := c.load(ConfigMapKey, &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (c *configMapBackend) Save(deletions []Deletion) error {
+	return c.save(ConfigMapKey, deletions)
+}
+
+// Update retries when another replica updated or created the ConfigMap
+// between reading and writing it. The update is rejected by the API
+// server in that case, as it is made with the resource version read.
+func (c *configMapBackend) Update(fn func(saved []Deletion) []Deletion) error {
+	for attempt := 1; ; attempt++ {
+		err := c.update(fn)
+		cause := errors.Cause(err)
+		if err == nil || attempt >= updateAttempts || !(k8sErrors.IsConflict(cause) || k8sErrors.IsAlreadyExists(cause)) {
+			return err
+		}
+	}
+}
+
+func (c *configMapBackend) update(fn func(saved []Deletion) []Deletion) error {
+	cm, err := c.client.GetConfigMap(c.namespace, c.name)
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get configmap %s/%s", c.namespace, c.name)
+		}
+		cm = &v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: c.namespace,
+				Name:      c.name,
+			},
+		}
+	}
+
+	var saved []Deletion
+	if data := cm.Data[ConfigMapKey]; data != "" {
+		if err := json.Unmarshal([]byte(data), &saved); err != nil {
+			return errors.Wrapf(err, "failed to parse configmap %s/%s", c.namespace, c.name)
+		}
+	}
+
+	data, err := json.Marshal(fn(saved))
+	if err != nil {
+		return errors.Wrap(err, "failed to encode history")
+	}
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[ConfigMapKey] = string(data)
+
+	if cm.ObjectMeta.ResourceVersion == "" {
+		return c.client.CreateConfigMap(cm)
+	}
+	return c.client.UpdateConfigMap(cm)
+}
+
+func (c *configMapBackend) LoadRestarts() ([]Restart, error) {
+	var restarts []Restart
+	if err := c.load(RestartsConfigMapKey, &restarts); err != nil {
+		return nil, err
+	}
+	return restarts, nil
+}
+
+func (c *configMapBackend) SaveRestarts(restarts []Restart) error {
+	return c.save(RestartsConfigMapKey, restarts)
+}
+
+// load decodes the JSON in key into v. A missing ConfigMap or key leaves
+// v unchanged.
+func (c *configMapBackend) load(key string, v interface{}) error {
+	cm, err := c.client.GetConfigMap(c.namespace, c.name)
+	if err != nil {
+		if k8sErrors.IsNotFound(err) {
+			return nil
+		}
+		return errors.Wrapf(err, "failed to get configmap %s/%s", c.namespace, c.name)
+	}
+
+	data := cm.Data[key]
+	if data == "" {
+		return nil
+	}
+
+	if err := json.Unmarshal([]byte(data), v); err != nil {
+		return errors.Wrapf(err, "failed to parse configmap %s/%s", c.namespace, c.name)
+	}
+	return nil
+}
+
+// save sets key to v as JSON, leaving other keys unchanged.
+func (c *configMapBackend) save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode history")
+	}
+
+	cm, err := c.client.GetConfigMap(c.namespace, c.name)
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get configmap %s/%s", c.namespace, c.name)
+		}
+		return c.client.CreateConfigMap(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: c.namespace,
+				Name:      c.name,
+			},
+			Data: map[string]string{
+				key: string(data),
+			},
+		})
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[key] = string(data)
+	return c.client.UpdateConfigMap(cm)
+}
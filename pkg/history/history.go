@@ -0,0 +1,195 @@
+// Package history keeps a record of the pods deleted by the controller
+// that survives restarts.
+package history
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Deletion is a record of a pod deleted, or acted on, by the controller.
+type Deletion struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	// Owner is the kind and name of the pod's controller, such as ReplicaSet/web-1234
+	Owner  string `json:"owner,omitempty"`
+	Reason string `json:"reason"`
+	Action string `json:"action"`
+}
+
+// Backend persists deletions.
+type Backend interface {
+	// Load returns the saved deletions. It returns no deletions, rather than
+	// an error, if nothing has been saved.
+	Load() ([]Deletion, error)
+	// Save replaces the saved deletions.
+	Save(deletions []Deletion) error
+}
+
+// Updater is implemented by backends that can change the saved deletions
+// atomically, so several stores can share a backend without losing each
+// other's deletions. fn is called with the saved deletions and returns
+// those to save. It may be called more than once if another store saved
+// in between. Every backend in this package implements it.
+type Updater interface {
+	Update(fn func(saved []Deletion) []Deletion) error
+}
+
+// Store keeps deletions in memory, dropping those older than the retention
+// period, and saves them to a backend each time one is recorded.
+type Store struct {
+	backend   Backend
+	retention time.Duration
+
+	mu        sync.Mutex
+	deletions []Deletion
+	restarts  []Restart
+}
+
+// New creates a store and loads any deletions saved in the backend.
+// If backend is nil, deletions are only kept in memory.
+func New(backend Backend, retention time.Duration) (*Store, error) {
+	if retention <= 0 {
+		return nil, errors.New("retention must be positive")
+	}
+
+	s := &Store{
+		backend:   backend,
+		retention: retention,
+	}
+
+	if backend != nil {
+		deletions, err := backend.Load()
+		if err != nil {
+			return nil, errors.Wrap(err, "failed to load history")
+		}
+		sort.SliceStable(deletions, func(i, j int) bool {
+			return deletions[i].Time.Before(deletions[j].Time)
+		})
+		s.deletions = deletions
+
+		if err := s.loadRestarts(); err != nil {
+			return nil, errors.Wrap(err, "failed to load restarts")
+		}
+	}
+
+	s.expire(time.Now())
+	return s, nil
+}
+
+// expire drops deletions older than the retention period. Must be called with mu held,
+// or before the store is shared.
+func (s *Store) expire(now time.Time) {
+	s.deletions = s.trim(s.deletions, now)
+}
+
+// Record adds a deletion and saves the history to the backend. If the
+// backend is an Updater, the deletion is added to those saved by other
+// stores, rather than replacing them. The deletion is kept in memory even
+// if it could not be saved.
+func (s *Store) Record(d Deletion) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	s.deletions = append(s.deletions, d)
+	s.expire(now)
+
+	var err error
+	switch b := s.backend.(type) {
+	case nil:
+		return nil
+	case Updater:
+		err = b.Update(func(saved []Deletion) []Deletion {
+			return s.trim(merge(saved, []Deletion{d}), now)
+		})
+	default:
+		err = b.Save(s.deletions)
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to save history")
+	}
+	return nil
+}
+
+// Reload loads the deletions saved in the backend by other stores, such
+// as other replicas sharing a Redis history, and returns those that were
+// not already in memory, oldest first.
+func (s *Store) Reload() ([]Deletion, error) {
+	if s.backend == nil {
+		return nil, nil
+	}
+
+	saved, err := s.backend.Load()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to load history")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	known := make(map[string]bool, len(s.deletions))
+	for _, d := range s.deletions {
+		known[d.key()] = true
+	}
+	var added []Deletion
+	for _, d := range s.trim(merge(nil, saved), time.Now()) {
+		if !known[d.key()] {
+			added = append(added, d)
+		}
+	}
+	s.deletions = merge(s.deletions, added)
+	return added, nil
+}
+
+// trim returns the deletions within the retention period
+func (s *Store) trim(deletions []Deletion, now time.Time) []Deletion {
+	cutoff := now.Add(-s.retention)
+	i := 0
+	for i < len(deletions) && deletions[i].Time.Before(cutoff) {
+		i++
+	}
+	return deletions[i:]
+}
+
+// key identifies a deletion, so the same deletion loaded from a backend
+// more than once is only counted once.
+func (d Deletion) key() string {
+	return d.Time.UTC().Format(time.RFC3339Nano) + "/" + d.Namespace + "/" + d.Name
+}
+
+// merge returns the deletions in a and b, without duplicates, oldest first
+func merge(a []Deletion, b []Deletion) []Deletion {
+	seen := make(map[string]bool, len(a)+len(b))
+	out := make([]Deletion, 0, len(a)+len(b))
+	for _, list := range [][]Deletion{a, b} {
+		for _, d := range list {
+			if k := d.key(); !seen[k] {
+				seen[k] = true
+				out = append(out, d)
+			}
+		}
+	}
+	sort.SliceStable(out, func(i, j int) bool {
+		return out[i].Time.Before(out[j].Time)
+	})
+	return out
+}
+
+// Since returns the deletions at or after t, oldest first.
+func (s *Store) Since(t time.Time) []Deletion {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var out []Deletion
+	for _, d := range s.deletions {
+		if !d.Time.Before(t) {
+			out = append(out, d)
+		}
+	}
+	return out
+}
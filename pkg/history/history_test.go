@@ -0,0 +1,320 @@
+package history
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+func TestStore(t *testing.T) {
+	s, err := New(nil, time.Hour)
+	require.NoError(t, err)
+
+	now := time.Now()
+	require.NoError(t, s.Record(Deletion{Time: now.Add(-time.Hour * 2), Name: "old"}))
+	require.NoError(t, s.Record(Deletion{Time: now.Add(-time.Minute * 30), Name: "pod0"}))
+	require.NoError(t, s.Record(Deletion{Time: now, Name: "pod1"}))
+
+	// the old deletion is outside the retention period
+	require.Len(t, s.Since(time.Time{}), 2)
+
+	since := s.Since(now.Add(-time.Minute))
+	require.Len(t, since, 1)
+	require.Equal(t, "pod1", since[0].Name)
+}
+
+func TestFileBackend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "history")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := filepath.Join(dir, "history.json")
+
+	s, err := New(FileBackend(path), time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, s.Since(time.Time{}))
+
+	now := time.Now()
+	require.NoError(t, s.Record(Deletion{Time: now, Namespace: "default", Name: "pod0", Owner: "ReplicaSet/web"}))
+
+	// a new store loads what the first saved
+	s, err = New(FileBackend(path), time.Hour)
+	require.NoError(t, err)
+	deletions := s.Since(time.Time{})
+	require.Len(t, deletions, 1)
+	require.Equal(t, "ReplicaSet/web", deletions[0].Owner)
+
+	require.NoError(t, s.SaveRestarts([]Restart{{Time: now, Namespace: "default", Name: "pod1", Count: 3}}))
+	s, err = New(FileBackend(path), time.Hour)
+	require.NoError(t, err)
+	restarts := s.Restarts()
+	require.Len(t, restarts, 1)
+	require.Equal(t, int32(3), restarts[0].Count)
+	require.Len(t, s.Since(time.Time{}), 1)
+}
+
+// testConfigMaps holds a single ConfigMap, and rejects updates made
+// with an old resource version as the API server does
+type testConfigMaps struct {
+	cm      *v1.ConfigMap
+	version int
+	// beforeUpdate is called once before the next update
+	beforeUpdate func()
+}
+
+func (t *testConfigMaps) GetConfigMap(namespace string, name string) (*v1.ConfigMap, error) {
+	if t.cm == nil {
+		return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return t.cm.DeepCopy(), nil
+}
+
+func (t *testConfigMaps) CreateConfigMap(cm *v1.ConfigMap) error {
+	if t.cm != nil {
+		return k8sErrors.NewAlreadyExists(schema.GroupResource{Resource: "configmaps"}, cm.ObjectMeta.Name)
+	}
+	t.store(cm)
+	return nil
+}
+
+func (t *testConfigMaps) UpdateConfigMap(cm *v1.ConfigMap) error {
+	if fn := t.beforeUpdate; fn != nil {
+		t.beforeUpdate = nil
+		fn()
+	}
+	if cm.ObjectMeta.ResourceVersion != t.cm.ObjectMeta.ResourceVersion {
+		return k8sErrors.NewConflict(schema.GroupResource{Resource: "configmaps"}, cm.ObjectMeta.Name, fmt.Errorf("the object has been modified"))
+	}
+	t.store(cm)
+	return nil
+}
+
+func (t *testConfigMaps) store(cm *v1.ConfigMap) {
+	t.version++
+	cm = cm.DeepCopy()
+	cm.ObjectMeta.ResourceVersion = fmt.Sprint(t.version)
+	t.cm = cm
+}
+
+func TestConfigMapBackend(t *testing.T) {
+	client := &testConfigMaps{}
+
+	s, err := New(ConfigMapBackend(client, "kube-system", "pod-deleter-history"), time.Hour)
+	require.NoError(t, err)
+	require.NoError(t, s.Record(Deletion{Time: time.Now(), Namespace: "default", Name: "pod0"}))
+	require.NoError(t, s.Record(Deletion{Time: time.Now(), Namespace: "default", Name: "pod1"}))
+	require.Contains(t, client.cm.Data[ConfigMapKey], "pod1")
+
+	require.NoError(t, s.SaveRestarts([]Restart{{Time: time.Now(), Namespace: "default", Name: "pod2", Count: 3}}))
+	require.Contains(t, client.cm.Data[RestartsConfigMapKey], "pod2")
+
+	s, err = New(ConfigMapBackend(client, "kube-system", "pod-deleter-history"), time.Hour)
+	require.NoError(t, err)
+	require.Len(t, s.Since(time.Time{}), 2)
+	require.Len(t, s.Restarts(), 1)
+}
+
+// testRedis is a Redis server that supports AUTH, GET, SET, and
+// transactions of SET with WATCH, MULTI, and EXEC
+type testRedis struct {
+	password string
+	listener net.Listener
+
+	mu   sync.Mutex
+	data map[string]string
+	// versions counts the times each key was set, for WATCH
+	versions map[string]int
+}
+
+func newTestRedis(t *testing.T, password string) *testRedis {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	r := &testRedis{password: password, listener: l, data: make(map[string]string), versions: make(map[string]int)}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go r.serve(conn)
+		}
+	}()
+	return r
+}
+
+func (r *testRedis) serve(conn net.Conn) {
+	defer conn.Close()
+	br := bufio.NewReader(conn)
+	authed := r.password == ""
+	watched := make(map[string]int)
+	var queued [][]string
+	multi := false
+
+	for {
+		var n int
+		if _, err := fmt.Fscanf(br, "*%d\r\n", &n); err != nil {
+			return
+		}
+		args := make([]string, n)
+		for i := range args {
+			var size int
+			if _, err := fmt.Fscanf(br, "$%d\r\n", &size); err != nil {
+				return
+			}
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(br, buf); err != nil {
+				return
+			}
+			args[i] = string(buf[:size])
+		}
+
+		r.mu.Lock()
+		switch {
+		case args[0] == "AUTH" && args[1] == r.password:
+			authed = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case !authed || args[0] == "AUTH":
+			fmt.Fprint(conn, "-NOAUTH Authentication required.\r\n")
+		case args[0] == "WATCH":
+			watched[args[1]] = r.versions[args[1]]
+			fmt.Fprint(conn, "+OK\r\n")
+		case args[0] == "MULTI":
+			multi = true
+			fmt.Fprint(conn, "+OK\r\n")
+		case multi && args[0] == "SET":
+			queued = append(queued, args)
+			fmt.Fprint(conn, "+QUEUED\r\n")
+		case args[0] == "EXEC":
+			changed := false
+			for key, version := range watched {
+				changed = changed || r.versions[key] != version
+			}
+			if changed {
+				fmt.Fprint(conn, "*-1\r\n")
+			} else {
+				fmt.Fprintf(conn, "*%d\r\n", len(queued))
+				for _, q := range queued {
+					r.set(q[1], q[2])
+					fmt.Fprint(conn, "+OK\r\n")
+				}
+			}
+			watched, queued, multi = make(map[string]int), nil, false
+		case args[0] == "GET":
+			value, ok := r.data[args[1]]
+			if !ok {
+				fmt.Fprint(conn, "$-1\r\n")
+			} else {
+				fmt.Fprintf(conn, "$%d\r\n%s\r\n", len(value), value)
+			}
+		case args[0] == "SET":
+			r.set(args[1], args[2])
+			fmt.Fprint(conn, "+OK\r\n")
+		}
+		r.mu.Unlock()
+	}
+}
+
+// set must be called with mu held
+func (r *testRedis) set(key string, value string) {
+	r.data[key] = value
+	r.versions[key]++
+}
+
+func (r *testRedis) get(key string) string {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.data[key]
+}
+
+func TestRedisBackend(t *testing.T) {
+	server := newTestRedis(t, "secret")
+	defer server.listener.Close()
+	address := server.listener.Addr().String()
+
+	s, err := New(RedisBackend(address, "secret", ""), time.Hour)
+	require.NoError(t, err)
+	require.Empty(t, s.Since(time.Time{}))
+
+	require.NoError(t, s.Record(Deletion{Time: time.Now(), Namespace: "default", Name: "pod0", Owner: "ReplicaSet/web"}))
+	require.NoError(t, s.SaveRestarts([]Restart{{Time: time.Now(), Namespace: "default", Name: "pod1", Count: 3}}))
+	require.Contains(t, server.get(DefaultRedisKey), "pod0")
+	require.Contains(t, server.get(DefaultRedisKey+":restarts"), "pod1")
+
+	// another replica loads what the first saved
+	s, err = New(RedisBackend(address, "secret", ""), time.Hour)
+	require.NoError(t, err)
+	deletions := s.Since(time.Time{})
+	require.Len(t, deletions, 1)
+	require.Equal(t, "ReplicaSet/web", deletions[0].Owner)
+	require.Len(t, s.Restarts(), 1)
+
+	_, err = New(RedisBackend(address, "wrong", ""), time.Hour)
+	require.Error(t, err)
+}
+
+// testShared checks that two stores sharing a backend see each other's
+// deletions, and neither overwrites the other's.
+func testShared(t *testing.T, s1 *Store, s2 *Store) {
+	now := time.Now()
+	require.NoError(t, s1.Record(Deletion{Time: now, Namespace: "default", Name: "pod0"}))
+	require.NoError(t, s2.Record(Deletion{Time: now.Add(time.Second), Namespace: "default", Name: "pod1"}))
+
+	added, err := s1.Reload()
+	require.NoError(t, err)
+	require.Len(t, added, 1)
+	require.Equal(t, "pod1", added[0].Name)
+	require.Len(t, s1.Since(time.Time{}), 2)
+
+	added, err = s2.Reload()
+	require.NoError(t, err)
+	require.Len(t, added, 1)
+	require.Equal(t, "pod0", added[0].Name)
+
+	// deletions are only returned once
+	added, err = s1.Reload()
+	require.NoError(t, err)
+	require.Empty(t, added)
+}
+
+func TestRedisShared(t *testing.T) {
+	server := newTestRedis(t, "")
+	defer server.listener.Close()
+	address := server.listener.Addr().String()
+
+	s1, err := New(RedisBackend(address, "", ""), time.Hour)
+	require.NoError(t, err)
+	s2, err := New(RedisBackend(address, "", ""), time.Hour)
+	require.NoError(t, err)
+	testShared(t, s1, s2)
+}
+
+func TestConfigMapShared(t *testing.T) {
+	client := &testConfigMaps{}
+
+	s1, err := New(ConfigMapBackend(client, "kube-system", "pod-deleter-history"), time.Hour)
+	require.NoError(t, err)
+	s2, err := New(ConfigMapBackend(client, "kube-system", "pod-deleter-history"), time.Hour)
+	require.NoError(t, err)
+	testShared(t, s1, s2)
+
+	// another replica updates the ConfigMap between the read and the write
+	client.beforeUpdate = func() {
+		require.NoError(t, s2.Record(Deletion{Time: time.Now(), Namespace: "default", Name: "pod2"}))
+	}
+	require.NoError(t, s1.Record(Deletion{Time: time.Now(), Namespace: "default", Name: "pod3"}))
+	require.Contains(t, client.cm.Data[ConfigMapKey], "pod2")
+	require.Contains(t, client.cm.Data[ConfigMapKey], "pod3")
+}
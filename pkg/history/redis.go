@@ -0,0 +1,236 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// DefaultRedisKey is the key used for the history if none is given
+const DefaultRedisKey = "k8s-pod-deleter:history"
+
+// redisTimeout limits connecting to Redis, and then each session of
+// commands, such as an update with WATCH and MULTI
+const redisTimeout = time.Second * 10
+
+type redisBackend struct {
+	address  string
+	password string
+	key      string
+}
+
+// RedisBackend returns a Backend that saves deletions as JSON under key in
+// a Redis server, so every replica of the deleter shares the same history.
+// Restart counts are saved under the same key with a :restarts suffix. If
+// password is not empty, each connection is authenticated with it.
+func RedisBackend(address string, password string, key string) Backend {
+	if key == "" {
+		key = DefaultRedisKey
+	}
+	return &redisBackend{
+		address:  address,
+		password: password,
+		key:      key,
+	}
+}
+
+func (r *redisBackend) Load() ([]Deletion, error) {
+	var deletions []Deletion
+	if err := r.load(r.key, &deletions); err != nil {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+func (r *redisBackend) Save(deletions []Deletion) error {
+	return r.save(r.key, deletions)
+}
+
+// Update uses a transaction that watches the key, so it is retried if
+// another replica set it between reading and writing it.
+func (r *redisBackend) Update(fn func(saved []Deletion) []Deletion) error {
+	for attempt := 1; attempt <= updateAttempts; attempt++ {
+		var committed bool
+		err := r.session(func(rw *bufio.ReadWriter) error {
+			if _, err := redisCommand(rw, "WATCH", r.key); err != nil {
+				return errors.Wrapf(err, "failed to watch %q in redis", r.key)
+			}
+			data, err := redisCommand(rw, "GET", r.key)
+			if err != nil {
+				return errors.Wrapf(err, "failed to get %q from redis", r.key)
+			}
+
+			var saved []Deletion
+			if len(data) > 0 {
+				if err := json.Unmarshal(data, &saved); err != nil {
+					return errors.Wrapf(err, "failed to parse %q from redis", r.key)
+				}
+			}
+			data, err = json.Marshal(fn(saved))
+			if err != nil {
+				return errors.Wrap(err, "failed to encode history")
+			}
+
+			if _, err := redisCommand(rw, "MULTI"); err != nil {
+				return errors.Wrap(err, "failed to start transaction")
+			}
+			if _, err := redisCommand(rw, "SET", r.key, string(data)); err != nil {
+				return errors.Wrapf(err, "failed to set %q in redis", r.key)
+			}
+			reply, err := redisCommand(rw, "EXEC")
+			if err != nil {
+				return errors.Wrapf(err, "failed to set %q in redis", r.key)
+			}
+			// a nil reply means the key changed after WATCH
+			committed = reply != nil
+			return nil
+		})
+		if err != nil || committed {
+			return err
+		}
+	}
+	return errors.Errorf("failed to set %q in redis: changed by another replica %d times", r.key, updateAttempts)
+}
+
+func (r *redisBackend) LoadRestarts() ([]Restart, error) {
+	var restarts []Restart
+	if err := r.load(r.key+":restarts", &restarts); err != nil {
+		return nil, err
+	}
+	return restarts, nil
+}
+
+func (r *redisBackend) SaveRestarts(restarts []Restart) error {
+	return r.save(r.key+":restarts", restarts)
+}
+
+// load decodes the JSON in key into v. A missing key leaves v unchanged.
+func (r *redisBackend) load(key string, v interface{}) error {
+	data, err := r.do("GET", key)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get %q from redis", key)
+	}
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return errors.Wrapf(err, "failed to parse %q from redis", key)
+	}
+	return nil
+}
+
+func (r *redisBackend) save(key string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode history")
+	}
+
+	if _, err := r.do("SET", key, string(data)); err != nil {
+		return errors.Wrapf(err, "failed to set %q in redis", key)
+	}
+	return nil
+}
+
+// do sends a single command. It returns the reply, or nil if it was a
+// nil bulk string, such as for a missing key.
+func (r *redisBackend) do(args ...string) ([]byte, error) {
+	var reply []byte
+	err := r.session(func(rw *bufio.ReadWriter) error {
+		var err error
+		reply, err = redisCommand(rw, args...)
+		return err
+	})
+	return reply, err
+}
+
+// session connects to the server, authenticating if needed, and calls fn
+// to send commands on the connection.
+func (r *redisBackend) session(fn func(rw *bufio.ReadWriter) error) error {
+	conn, err := net.DialTimeout("tcp", r.address, redisTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", r.address)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(redisTimeout)); err != nil {
+		return err
+	}
+
+	rw := bufio.NewReadWriter(bufio.NewReader(conn), bufio.NewWriter(conn))
+	if r.password != "" {
+		if _, err := redisCommand(rw, "AUTH", r.password); err != nil {
+			return errors.Wrap(err, "failed to authenticate")
+		}
+	}
+	return fn(rw)
+}
+
+// redisCommand writes a command as an array of bulk strings and reads
+// the reply.
+func redisCommand(rw *bufio.ReadWriter, args ...string) ([]byte, error) {
+	fmt.Fprintf(rw, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(rw, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if err := rw.Flush(); err != nil {
+		return nil, err
+	}
+	return readRedisReply(rw.Reader)
+}
+
+// readRedisReply reads a simple string, error, integer, bulk string, or
+// array reply. Only EXEC returns an array, so the elements are read but
+// not returned. A nil array, for an aborted transaction, is returned as nil.
+func readRedisReply(r *bufio.Reader) ([]byte, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 || line[len(line)-2] != '\r' {
+		return nil, errors.Errorf("invalid reply %q", line)
+	}
+	kind, value := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+', ':':
+		return []byte(value), nil
+	case '-':
+		return nil, errors.New(value)
+	case '$':
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Errorf("invalid bulk string length %q", value)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		data := make([]byte, n+2)
+		if _, err := io.ReadFull(r, data); err != nil {
+			return nil, err
+		}
+		return data[:n], nil
+	case '*':
+		n, err := strconv.Atoi(value)
+		if err != nil {
+			return nil, errors.Errorf("invalid array length %q", value)
+		}
+		if n < 0 {
+			return nil, nil
+		}
+		for i := 0; i < n; i++ {
+			if _, err := readRedisReply(r); err != nil {
+				return nil, err
+			}
+		}
+		return []byte{}, nil
+	default:
+		return nil, errors.Errorf("unexpected reply %q", line)
+	}
+}
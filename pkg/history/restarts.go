@@ -0,0 +1,78 @@
+package history
+
+import (
+	"reflect"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Restart is a restart count of a pod observed by the controller. Saving
+// them lets restart deltas be measured across restarts of the controller.
+type Restart struct {
+	Time      time.Time `json:"time"`
+	Namespace string    `json:"namespace"`
+	Name      string    `json:"name"`
+	UID       string    `json:"uid"`
+	// Count is the total restarts of all containers in the pod
+	Count int32 `json:"count"`
+}
+
+// RestartBackend is implemented by backends that can also persist restart
+// counts. Both backends in this package implement it.
+type RestartBackend interface {
+	// LoadRestarts returns the saved restart counts. It returns none, rather
+	// than an error, if nothing has been saved.
+	LoadRestarts() ([]Restart, error)
+	// SaveRestarts replaces the saved restart counts.
+	SaveRestarts(restarts []Restart) error
+}
+
+// loadRestarts loads restart counts if the backend supports them. Must be
+// called before the store is shared.
+func (s *Store) loadRestarts() error {
+	rb, ok := s.backend.(RestartBackend)
+	if !ok {
+		return nil
+	}
+
+	restarts, err := rb.LoadRestarts()
+	if err != nil {
+		return err
+	}
+	sort.SliceStable(restarts, func(i, j int) bool {
+		return restarts[i].Time.Before(restarts[j].Time)
+	})
+	s.restarts = restarts
+	return nil
+}
+
+// Restarts returns the saved restart counts, oldest first.
+func (s *Store) Restarts() []Restart {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return append([]Restart(nil), s.restarts...)
+}
+
+// SaveRestarts replaces the restart counts and saves them to the backend,
+// if it supports them and they changed.
+func (s *Store) SaveRestarts(restarts []Restart) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(restarts) == 0 && len(s.restarts) == 0 || reflect.DeepEqual(restarts, s.restarts) {
+		return nil
+	}
+	s.restarts = append([]Restart(nil), restarts...)
+
+	rb, ok := s.backend.(RestartBackend)
+	if !ok {
+		return nil
+	}
+	if err := rb.SaveRestarts(s.restarts); err != nil {
+		return errors.Wrap(err, "failed to save restarts")
+	}
+	return nil
+}
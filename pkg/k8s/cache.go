@@ -0,0 +1,206 @@
+package k8s
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// PodCache is a PodLister that keeps a copy of pods in memory. The pods
+// are listed once and then kept up to date by watching the API server,
+// so each run does not need to list every pod.
+type PodCache struct {
+	client    *Client
+	namespace string
+	resync    time.Duration
+	logger    *zap.Logger
+	store     podStore
+	synced    chan struct{}
+	once      sync.Once
+}
+
+// NewPodCache creates a cache of the pods in namespace. Empty namespace
+// means all namespaces. The pods are listed again every resync period.
+func NewPodCache(client *Client, namespace string, resync time.Duration, logger *zap.Logger) *PodCache {
+	return &PodCache{
+		client:    client,
+		namespace: namespace,
+		resync:    resync,
+		logger:    logger,
+		synced:    make(chan struct{}),
+		store: podStore{
+			pods: make(map[string]v1.Pod),
+		},
+	}
+}
+
+// Run lists and watches pods until the context is canceled.
+func (p *PodCache) Run(ctx context.Context) {
+	for {
+		if err := p.sync(ctx); err != nil {
+			p.logger.Error("failed to sync pod cache", zap.Error(err))
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// WaitForSync blocks until pods have been listed once or the context
+// is canceled.
+func (p *PodCache) WaitForSync(ctx context.Context) error {
+	select {
+	case <-p.synced:
+		return nil
+	case <-ctx.Done():
+		return errors.Wrap(ctx.Err(), "pod cache did not sync")
+	}
+}
+
+// ListPods returns the cached pods in a namespace, optionally using a label selector.
+// Empty namespace means all namespaces
+func (p *PodCache) ListPods(namespace string, selector string) ([]v1.Pod, error) {
+	select {
+	case <-p.synced:
+	default:
+		return nil, errors.New("pod cache has not synced")
+	}
+
+	if p.namespace != "" && namespace != p.namespace {
+		return nil, errors.Errorf("pod cache only contains namespace %q", p.namespace)
+	}
+
+	s, err := labels.Parse(selector)
+	if err != nil {
+		return nil, errors.Wrapf(err, "invalid selector %q", selector)
+	}
+
+	return p.store.list(namespace, s), nil
+}
+
+// sync lists all pods and then watches for changes until the
+// resync period has passed or the watch fails.
+func (p *PodCache) sync(ctx context.Context) error {
+	var (
+		pods    []v1.Pod
+		version string
+	)
+	opts := metav1.ListOptions{
+		Limit: p.client.chunkSize,
+	}
+	for {
+		list, err := p.client.clientset().CoreV1().Pods(p.namespace).List(opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to list pods")
+		}
+		pods = append(pods, list.Items...)
+		version = list.ListMeta.ResourceVersion
+		if list.ListMeta.Continue == "" {
+			break
+		}
+		opts.Continue = list.ListMeta.Continue
+	}
+
+	p.store.replace(pods)
+	p.once.Do(func() { close(p.synced) })
+	p.logger.Debug("listed pods for cache", zap.Int("pods", len(pods)))
+
+	timeout := int64(p.resync.Seconds())
+	w, err := p.client.clientset().CoreV1().Pods(p.namespace).Watch(metav1.ListOptions{
+		ResourceVersion: version,
+		TimeoutSeconds:  &timeout,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch pods")
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				// the watch timed out, so list again
+				return nil
+			}
+			if err := p.store.apply(event); err != nil {
+				return err
+			}
+		}
+	}
+}
+
+type podStore struct {
+	sync.RWMutex
+	pods map[string]v1.Pod
+}
+
+func podKey(pod *v1.Pod) string {
+	return pod.ObjectMeta.Namespace + "/" + pod.ObjectMeta.Name
+}
+
+func (s *podStore) replace(pods []v1.Pod) {
+	m := make(map[string]v1.Pod, len(pods))
+	for i := range pods {
+		m[podKey(&pods[i])] = pods[i]
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.pods = m
+}
+
+func (s *podStore) apply(event watch.Event) error {
+	if event.Type == watch.Error {
+		return errors.Errorf("watch failed: %v", event.Object)
+	}
+
+	pod, ok := event.Object.(*v1.Pod)
+	if !ok {
+		return errors.Errorf("unexpected object in watch: %T", event.Object)
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	switch event.Type {
+	case watch.Added, watch.Modified:
+		s.pods[podKey(pod)] = *pod
+	case watch.Deleted:
+		delete(s.pods, podKey(pod))
+	}
+	return nil
+}
+
+func (s *podStore) list(namespace string, selector labels.Selector) []v1.Pod {
+	s.RLock()
+	defer s.RUnlock()
+
+	var pods []v1.Pod
+	for _, pod := range s.pods {
+		if namespace != "" && pod.ObjectMeta.Namespace != namespace {
+			continue
+		}
+		if !selector.Matches(labels.Set(pod.ObjectMeta.Labels)) {
+			continue
+		}
+		pods = append(pods, pod)
+	}
+
+	// keep the order stable between runs
+	sort.Slice(pods, func(i, j int) bool {
+		return podKey(&pods[i]) < podKey(&pods[j])
+	})
+	return pods
+}
@@ -0,0 +1,54 @@
+package k8s
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+func makePod(namespace, name string, podLabels map[string]string) *v1.Pod {
+	return &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+			Labels:    podLabels,
+		},
+	}
+}
+
+func podNames(pods []v1.Pod) []string {
+	var names []string
+	for _, p := range pods {
+		names = append(names, p.ObjectMeta.Namespace+"/"+p.ObjectMeta.Name)
+	}
+	return names
+}
+
+func TestPodStore(t *testing.T) {
+	s := podStore{}
+	s.replace([]v1.Pod{
+		*makePod("default", "web", map[string]string{"app": "web"}),
+		*makePod("default", "db", map[string]string{"app": "db"}),
+		*makePod("kube-system", "dns", nil),
+	})
+
+	require.Equal(t, []string{"default/db", "default/web", "kube-system/dns"}, podNames(s.list("", labels.Everything())))
+	require.Equal(t, []string{"default/db", "default/web"}, podNames(s.list("default", labels.Everything())))
+
+	web, err := labels.Parse("app=web")
+	require.NoError(t, err)
+	require.Equal(t, []string{"default/web"}, podNames(s.list("", web)))
+
+	require.NoError(t, s.apply(watch.Event{Type: watch.Added, Object: makePod("default", "api", nil)}))
+	require.NoError(t, s.apply(watch.Event{Type: watch.Deleted, Object: makePod("default", "db", nil)}))
+	require.NoError(t, s.apply(watch.Event{Type: watch.Modified, Object: makePod("default", "web", map[string]string{"app": "api"})}))
+
+	require.Equal(t, []string{"default/api", "default/web"}, podNames(s.list("default", labels.Everything())))
+	require.Empty(t, s.list("", web))
+
+	require.Error(t, s.apply(watch.Event{Type: watch.Error, Object: &metav1.Status{}}))
+}
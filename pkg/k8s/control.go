@@ -0,0 +1,93 @@
+package k8s
+
+import (
+	"context"
+	"time"
+
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+)
+
+// configMapResync is how long a ConfigMap is watched before it is fetched
+// again, in case a change was missed.
+const configMapResync = time.Minute * 5
+
+// WatchConfigMap calls fn with a single ConfigMap when it is first
+// fetched and each time it changes, until the context is canceled. fn is
+// called with nil if the ConfigMap does not exist or is deleted. If it
+// cannot be fetched, fn is not called, so the last value stays in effect.
+func (c *Client) WatchConfigMap(ctx context.Context, namespace string, name string, logger *zap.Logger, fn func(cm *v1.ConfigMap)) {
+	for {
+		if err := c.watchConfigMap(ctx, namespace, name, fn); err != nil {
+			logger.Error("failed to watch configmap",
+				zap.String("namespace", namespace),
+				zap.String("name", name),
+				zap.Error(err),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(time.Second):
+		}
+	}
+}
+
+// watchConfigMap fetches the ConfigMap and then watches it until the
+// resync period has passed or the watch fails.
+func (c *Client) watchConfigMap(ctx context.Context, namespace string, name string, fn func(cm *v1.ConfigMap)) error {
+	configMaps := c.clientset().CoreV1().ConfigMaps(namespace)
+
+	var version string
+	cm, err := configMaps.Get(name, metav1.GetOptions{})
+	switch {
+	case k8sErrors.IsNotFound(err):
+		fn(nil)
+	case err != nil:
+		return errors.Wrap(err, "failed to get configmap")
+	default:
+		version = cm.ObjectMeta.ResourceVersion
+		fn(cm)
+	}
+
+	timeout := int64(configMapResync.Seconds())
+	w, err := configMaps.Watch(metav1.ListOptions{
+		FieldSelector:   fields.OneTermEqualSelector("metadata.name", name).String(),
+		ResourceVersion: version,
+		TimeoutSeconds:  &timeout,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to watch configmap")
+	}
+	defer w.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-w.ResultChan():
+			if !ok {
+				// the watch timed out, so fetch again
+				return nil
+			}
+			switch event.Type {
+			case watch.Error:
+				return errors.Errorf("watch failed: %v", event.Object)
+			case watch.Added, watch.Modified:
+				cm, ok := event.Object.(*v1.ConfigMap)
+				if !ok {
+					return errors.Errorf("unexpected object in watch: %T", event.Object)
+				}
+				fn(cm)
+			case watch.Deleted:
+				fn(nil)
+			}
+		}
+	}
+}
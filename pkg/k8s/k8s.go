@@ -3,64 +3,340 @@
 package k8s
 
 import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/version"
 	"github.com/pkg/errors"
+	appsv1 "k8s.io/api/apps/v1"
+	batchv1 "k8s.io/api/batch/v1"
 	"k8s.io/api/core/v1"
+	policy "k8s.io/api/policy/v1beta1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/types"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 )
 
+const contentTypeProtobuf = "application/vnd.kubernetes.protobuf"
+
 // Client is a wrapper around a Kubernetes cluster
 type Client struct {
+	kubeconfig  string
+	context     string
+	chunkSize   int64
+	contentType string
+	qps         float32
+	burst       int
+	timeout     time.Duration
+	userAgent   string
+	impersonate rest.ImpersonationConfig
+	overrides   clientcmd.ConfigOverrides
+
+	mu     sync.RWMutex
 	client *kubernetes.Clientset
+	// files are the files the config was loaded from, checked by WatchConfig
+	files []string
 }
 
-// New creates and returns a new client. If kubeconfig is not define, then
-// an in-cluster client is created. context is only used if kubeconfig
-// is specified and sets the k8s context - if blank, current context from the
-// config file is used.
-func New(kubeconfig string, context string) (*Client, error) {
-	if kubeconfig == "" {
-		config, err := rest.InClusterConfig()
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to create an in-cluster config")
+// Option sets options when creating a new Client
+type Option func(*Client) error
+
+// New creates and returns a new client. The config is loaded like kubectl
+// does: from kubeconfig if it is set, otherwise from the files listed in
+// $KUBECONFIG, merged, or ~/.kube/config, and then from the in-cluster
+// config if none of those exist. context sets the k8s context - if blank,
+// current context from the config file is used.
+func New(kubeconfig string, context string, options ...Option) (*Client, error) {
+	c := &Client{
+		kubeconfig:  kubeconfig,
+		context:     context,
+		chunkSize:   500,
+		contentType: contentTypeProtobuf,
+		userAgent:   "k8s-pod-deleter/" + version.Version,
+	}
+
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "option failed")
 		}
-		clientset, err := kubernetes.NewForConfig(config)
-		if err != nil {
-			return nil, errors.Wrap(err, "failed to create an in-cluster client")
+	}
+
+	if err := c.build(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// build loads the config and creates the clientset, replacing the
+// current one.
+func (c *Client) build() error {
+	config, tokenFile, err := k8sConfig(c.kubeconfig, c.context, c.overrides)
+	if err != nil {
+		return errors.Wrap(err, "failed to create a config")
+	}
+
+	if tokenFile != "" {
+		// read the token again when it is rotated, rather than using it until it expires
+		token := newTokenTransport(tokenFile, config.BearerToken)
+		config.BearerToken = ""
+		wrap := config.WrapTransport
+		config.WrapTransport = func(rt http.RoundTripper) http.RoundTripper {
+			if wrap != nil {
+				rt = wrap(rt)
+			}
+			return token.wrap(rt)
 		}
-		return &Client{clientset}, nil
 	}
-	config, err := k8sConfig(kubeconfig, context)
+
+	clientset, err := kubernetes.NewForConfig(c.configure(config))
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create a config from %q", kubeconfig)
+		return errors.Wrapf(err, "failed to create a client for %q", config.Host)
 	}
 
-	clientset, err := kubernetes.NewForConfig(config)
+	files := configFiles(c.kubeconfig)
+	for _, f := range []string{config.TLSClientConfig.CAFile, config.TLSClientConfig.CertFile, config.TLSClientConfig.KeyFile} {
+		if f != "" {
+			files = append(files, f)
+		}
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.client = clientset
+	c.files = files
+	return nil
+}
+
+// clientset returns the current clientset, which changes if the config
+// is reloaded.
+func (c *Client) clientset() *kubernetes.Clientset {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return c.client
+}
+
+// configure applies the client options to a rest config
+func (c *Client) configure(config *rest.Config) *rest.Config {
+	config.ContentType = c.contentType
+	if c.contentType == contentTypeProtobuf {
+		// the server falls back to JSON for types without a protobuf encoding
+		config.AcceptContentTypes = contentTypeProtobuf + "," + runtime.ContentTypeJSON
+	}
+	config.QPS = c.qps
+	config.Burst = c.burst
+	config.Timeout = c.timeout
+	config.UserAgent = c.userAgent
+	config.Impersonate = c.impersonate
+	return config
+}
+
+// WithOverrides returns an Option that overrides values in the
+// kubeconfig, such as the server or token, like the standard kubectl
+// flags. In-cluster, only the server, token, and certificate authority
+// are used.
+func WithOverrides(overrides clientcmd.ConfigOverrides) Option {
+	return func(c *Client) error {
+		c.overrides = overrides
+		return nil
+	}
+}
+
+// WithChunkSize returns an Option that sets the maximum number of pods
+// returned by each list request. Zero lists all pods in a single request.
+// Default is 500.
+func WithChunkSize(n int64) Option {
+	return func(c *Client) error {
+		if n < 0 {
+			return errors.New("chunk size must not be negative")
+		}
+		c.chunkSize = n
+		return nil
+	}
+}
+
+// WithJSON returns an Option that uses JSON rather than protobuf to
+// talk to the API server. This is mostly useful for debugging.
+func WithJSON() Option {
+	return func(c *Client) error {
+		c.contentType = runtime.ContentTypeJSON
+		return nil
+	}
+}
+
+// WithRateLimit returns an Option that sets the maximum queries per second
+// sent to the API server and the burst allowed above it. Zero uses the
+// client-go defaults.
+func WithRateLimit(qps float32, burst int) Option {
+	return func(c *Client) error {
+		if qps < 0 || burst < 0 {
+			return errors.New("qps and burst must not be negative")
+		}
+		c.qps = qps
+		c.burst = burst
+		return nil
+	}
+}
+
+// WithTimeout returns an Option that sets the timeout for each request
+// to the API server. Zero means no timeout.
+func WithTimeout(d time.Duration) Option {
+	return func(c *Client) error {
+		if d < 0 {
+			return errors.New("timeout must not be negative")
+		}
+		c.timeout = d
+		return nil
+	}
+}
+
+// WithUserAgent returns an Option that sets the User-Agent sent with every
+// request. Default is k8s-pod-deleter/ followed by the version.
+func WithUserAgent(userAgent string) Option {
+	return func(c *Client) error {
+		c.userAgent = userAgent
+		return nil
+	}
+}
+
+// WithImpersonation returns an Option that makes every request as the
+// given user and groups. This requires permission to impersonate them.
+func WithImpersonation(user string, groups []string) Option {
+	return func(c *Client) error {
+		if user == "" && len(groups) > 0 {
+			return errors.New("impersonating groups requires a user")
+		}
+		c.impersonate = rest.ImpersonationConfig{
+			UserName: user,
+			Groups:   groups,
+		}
+		return nil
+	}
+}
+
+// k8sConfig loads the config. It also returns the file the bearer token
+// was read from, if any, so it can be read again when it is rotated.
+func k8sConfig(kubeconfig string, context string, overrides clientcmd.ConfigOverrides) (*rest.Config, string, error) {
+	rules := clientcmd.NewDefaultClientConfigLoadingRules()
+	rules.ExplicitPath = kubeconfig
+	if context != "" {
+		overrides.CurrentContext = context
+	}
+	loader := clientcmd.NewNonInteractiveDeferredLoadingClientConfig(rules, &overrides)
+	config, err := loader.ClientConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	applyOverrides(config, overrides)
+	return config, tokenFile(loader, config, overrides), nil
+}
+
+// tokenFile returns the file the bearer token in config was read from:
+// the user's tokenFile in the kubeconfig, or the service account token if
+// the in-cluster config was used. It is empty if the token was set directly.
+func tokenFile(loader clientcmd.ClientConfig, config *rest.Config, overrides clientcmd.ConfigOverrides) string {
+	if config.BearerToken == "" || overrides.AuthInfo.Token != "" {
+		return ""
+	}
+
+	raw, err := loader.RawConfig()
 	if err != nil {
-		return nil, errors.Wrapf(err, "failed to create a client from %q", kubeconfig)
+		return ""
+	}
+	if len(raw.Contexts) == 0 && len(raw.Clusters) == 0 && len(raw.AuthInfos) == 0 {
+		// no kubeconfig was found, so the in-cluster config was used
+		return inClusterTokenFile
 	}
-	return &Client{clientset}, nil
 
+	name := overrides.CurrentContext
+	if name == "" {
+		name = raw.CurrentContext
+	}
+	user := overrides.Context.AuthInfo
+	if user == "" {
+		if ctx, ok := raw.Contexts[name]; ok {
+			user = ctx.AuthInfo
+		}
+	}
+	auth, ok := raw.AuthInfos[user]
+	if !ok || auth.Token != "" {
+		return ""
+	}
+	return auth.TokenFile
 }
 
-func k8sConfig(kubeconfig string, context string) (*rest.Config, error) {
-	return clientcmd.NewNonInteractiveDeferredLoadingClientConfig(
-		&clientcmd.ClientConfigLoadingRules{ExplicitPath: kubeconfig},
-		&clientcmd.ConfigOverrides{CurrentContext: context},
-	).ClientConfig()
+// applyOverrides sets the server and credentials in overrides on config.
+// clientcmd merges them with the vendored mergo, which does not replace
+// values that are already set in the kubeconfig.
+func applyOverrides(config *rest.Config, overrides clientcmd.ConfigOverrides) {
+	cluster := overrides.ClusterInfo
+	if cluster.Server != "" {
+		config.Host = cluster.Server
+	}
+	if cluster.CertificateAuthority != "" {
+		config.TLSClientConfig.CAFile = cluster.CertificateAuthority
+		config.TLSClientConfig.CAData = nil
+	}
+	if cluster.InsecureSkipTLSVerify {
+		config.TLSClientConfig.Insecure = true
+		if cluster.CertificateAuthority == "" {
+			config.TLSClientConfig.CAFile = ""
+			config.TLSClientConfig.CAData = nil
+		}
+	}
+
+	auth := overrides.AuthInfo
+	if auth.Token != "" {
+		config.BearerToken = auth.Token
+	}
+	if auth.ClientCertificate != "" {
+		config.TLSClientConfig.CertFile = auth.ClientCertificate
+		config.TLSClientConfig.CertData = nil
+	}
+	if auth.ClientKey != "" {
+		config.TLSClientConfig.KeyFile = auth.ClientKey
+		config.TLSClientConfig.KeyData = nil
+	}
 }
 
 // ListPods will return a list of Pods in a namespace, optionally using a label selector.
 // Empty namespace means all namespaces
 func (c *Client) ListPods(namespace string, selector string) ([]v1.Pod, error) {
-	pods, err := c.client.CoreV1().Pods(namespace).List(metav1.ListOptions{LabelSelector: selector})
-	if err != nil {
-		return nil, errors.Wrap(err, "failed to list pods")
+	var pods []v1.Pod
+	err := c.ListPodPages(namespace, selector, func(page []v1.Pod) error {
+		pods = append(pods, page...)
+		return nil
+	})
+	return pods, err
+}
+
+// ListPodPages lists pods like ListPods, but requests them in chunks
+// and calls fn with each one, so all pods are never held in memory at once.
+func (c *Client) ListPodPages(namespace string, selector string, fn func(pods []v1.Pod) error) error {
+	opts := metav1.ListOptions{
+		LabelSelector: selector,
+		Limit:         c.chunkSize,
 	}
 
-	return pods.Items, nil
+	for {
+		pods, err := c.clientset().CoreV1().Pods(namespace).List(opts)
+		if err != nil {
+			return errors.Wrap(err, "failed to list pods")
+		}
+
+		if err := fn(pods.Items); err != nil {
+			return err
+		}
+
+		if pods.ListMeta.Continue == "" {
+			return nil
+		}
+		opts.Continue = pods.ListMeta.Continue
+	}
 }
 
 // DeletePod attempts to delete a single pod
@@ -68,5 +344,303 @@ func (c *Client) DeletePod(namespace string, name string) error {
 	// XXX: Do we need any delete options?
 	// https://godoc.org/k8s.io/apimachinery/pkg/apis/meta/v1#DeleteOptions
 	// we do not wrap the error here, as the caller may need to check it directly
-	return c.client.CoreV1().Pods(namespace).Delete(name, nil)
+	return c.clientset().CoreV1().Pods(namespace).Delete(name, nil)
+}
+
+// ForceDeletePod deletes a pod immediately, without waiting for the
+// kubelet to confirm that its containers have stopped.
+func (c *Client) ForceDeletePod(namespace string, name string) error {
+	var grace int64
+	// not wrapped so the caller can check for not found
+	return c.clientset().CoreV1().Pods(namespace).Delete(name, &metav1.DeleteOptions{
+		GracePeriodSeconds: &grace,
+	})
+}
+
+// PatchPod applies a JSON merge patch to a pod
+func (c *Client) PatchPod(namespace string, name string, patch []byte) error {
+	// not wrapped so the caller can check for not found
+	_, err := c.clientset().CoreV1().Pods(namespace).Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+// EvictPod evicts a pod. The eviction fails if it would violate
+// a pod disruption budget.
+func (c *Client) EvictPod(namespace string, name string) error {
+	// not wrapped so the caller can check for not found
+	return c.clientset().CoreV1().Pods(namespace).Evict(&policy.Eviction{
+		ObjectMeta: metav1.ObjectMeta{
+			Namespace: namespace,
+			Name:      name,
+		},
+	})
+}
+
+// ListPodDisruptionBudgets returns the pod disruption budgets in a namespace
+func (c *Client) ListPodDisruptionBudgets(namespace string) ([]policy.PodDisruptionBudget, error) {
+	list, err := c.clientset().PolicyV1beta1().PodDisruptionBudgets(namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list pod disruption budgets in %q", namespace)
+	}
+	return list.Items, nil
+}
+
+// GetPod returns a single pod
+func (c *Client) GetPod(namespace string, name string) (*v1.Pod, error) {
+	// not wrapped so the caller can check for not found
+	return c.clientset().CoreV1().Pods(namespace).Get(name, metav1.GetOptions{})
+}
+
+// CreatePod creates a pod and returns the created pod
+func (c *Client) CreatePod(pod *v1.Pod) (*v1.Pod, error) {
+	p, err := c.clientset().CoreV1().Pods(pod.ObjectMeta.Namespace).Create(pod)
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to create pod")
+	}
+	return p, nil
+}
+
+// CreateEvent creates an event
+func (c *Client) CreateEvent(event *v1.Event) error {
+	if _, err := c.clientset().CoreV1().Events(event.ObjectMeta.Namespace).Create(event); err != nil {
+		return errors.Wrap(err, "failed to create event")
+	}
+	return nil
+}
+
+// ListPodWarnings returns the warning events for pods in a namespace.
+// Empty namespace means all namespaces
+func (c *Client) ListPodWarnings(namespace string) ([]v1.Event, error) {
+	events, err := c.clientset().CoreV1().Events(namespace).List(metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,type=Warning",
+	})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list events")
+	}
+	return events.Items, nil
+}
+
+// ListPodEvents returns the events of a single pod
+func (c *Client) ListPodEvents(namespace string, name string) ([]v1.Event, error) {
+	events, err := c.clientset().CoreV1().Events(namespace).List(metav1.ListOptions{
+		FieldSelector: "involvedObject.kind=Pod,involvedObject.name=" + name,
+	})
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to list events of %s/%s", namespace, name)
+	}
+	return events.Items, nil
+}
+
+// podMetricsList is the subset of a metrics.k8s.io PodMetricsList that
+// is used. The metrics client is not vendored, so it is decoded here.
+type podMetricsList struct {
+	Items []struct {
+		Metadata   metav1.ObjectMeta `json:"metadata"`
+		Containers []struct {
+			Name  string          `json:"name"`
+			Usage v1.ResourceList `json:"usage"`
+		} `json:"containers"`
+	} `json:"items"`
+}
+
+// ListPodUsage returns the resource usage of each container of the pods
+// in a namespace, from the metrics API served by metrics-server. Pods are
+// keyed by name, then containers by name.
+func (c *Client) ListPodUsage(namespace string) (map[string]map[string]v1.ResourceList, error) {
+	data, err := c.clientset().CoreV1().RESTClient().Get().
+		AbsPath("/apis/metrics.k8s.io/v1beta1/namespaces", namespace, "pods").
+		SetHeader("Accept", "application/json").
+		DoRaw()
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list pod metrics")
+	}
+
+	var list podMetricsList
+	if err := json.Unmarshal(data, &list); err != nil {
+		return nil, errors.Wrap(err, "failed to decode pod metrics")
+	}
+
+	usage := make(map[string]map[string]v1.ResourceList, len(list.Items))
+	for _, item := range list.Items {
+		containers := make(map[string]v1.ResourceList, len(item.Containers))
+		for _, container := range item.Containers {
+			containers[container.Name] = container.Usage
+		}
+		usage[item.Metadata.Name] = containers
+	}
+	return usage, nil
+}
+
+// GetConfigMap returns a single ConfigMap
+func (c *Client) GetConfigMap(namespace string, name string) (*v1.ConfigMap, error) {
+	// not wrapped so the caller can check for not found
+	return c.clientset().CoreV1().ConfigMaps(namespace).Get(name, metav1.GetOptions{})
+}
+
+// CreateConfigMap creates a ConfigMap
+func (c *Client) CreateConfigMap(cm *v1.ConfigMap) error {
+	if _, err := c.clientset().CoreV1().ConfigMaps(cm.ObjectMeta.Namespace).Create(cm); err != nil {
+		return errors.Wrap(err, "failed to create configmap")
+	}
+	return nil
+}
+
+// UpdateConfigMap updates a ConfigMap
+func (c *Client) UpdateConfigMap(cm *v1.ConfigMap) error {
+	if _, err := c.clientset().CoreV1().ConfigMaps(cm.ObjectMeta.Namespace).Update(cm); err != nil {
+		return errors.Wrap(err, "failed to update configmap")
+	}
+	return nil
+}
+
+// GetOwner returns the metadata of a workload that owns pods. kind is one
+// of Deployment, ReplicaSet, StatefulSet, DaemonSet, or Job.
+func (c *Client) GetOwner(namespace string, kind string, name string) (*metav1.ObjectMeta, error) {
+	apps := c.clientset().AppsV1()
+	opts := metav1.GetOptions{}
+
+	// errors are not wrapped so the caller can check for not found
+	switch kind {
+	case "Deployment":
+		o, err := apps.Deployments(namespace).Get(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &o.ObjectMeta, nil
+	case "ReplicaSet":
+		o, err := apps.ReplicaSets(namespace).Get(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &o.ObjectMeta, nil
+	case "StatefulSet":
+		o, err := apps.StatefulSets(namespace).Get(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &o.ObjectMeta, nil
+	case "DaemonSet":
+		o, err := apps.DaemonSets(namespace).Get(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &o.ObjectMeta, nil
+	case "Job":
+		o, err := c.clientset().BatchV1().Jobs(namespace).Get(name, opts)
+		if err != nil {
+			return nil, err
+		}
+		return &o.ObjectMeta, nil
+	}
+	return nil, errors.Errorf("unsupported owner kind %q", kind)
+}
+
+// PatchOwner applies a JSON merge patch to a workload that owns pods.
+// kind is one of the kinds supported by GetOwner.
+func (c *Client) PatchOwner(namespace string, kind string, name string, patch []byte) error {
+	apps := c.clientset().AppsV1()
+
+	var err error
+	switch kind {
+	case "Deployment":
+		_, err = apps.Deployments(namespace).Patch(name, types.MergePatchType, patch)
+	case "ReplicaSet":
+		_, err = apps.ReplicaSets(namespace).Patch(name, types.MergePatchType, patch)
+	case "StatefulSet":
+		_, err = apps.StatefulSets(namespace).Patch(name, types.MergePatchType, patch)
+	case "DaemonSet":
+		_, err = apps.DaemonSets(namespace).Patch(name, types.MergePatchType, patch)
+	case "Job":
+		_, err = c.clientset().BatchV1().Jobs(namespace).Patch(name, types.MergePatchType, patch)
+	default:
+		return errors.Errorf("unsupported owner kind %q", kind)
+	}
+	// not wrapped so the caller can check for not found
+	return err
+}
+
+// ScaleDeployment sets the replicas of a Deployment and returns the
+// previous number of replicas. An unset number of replicas is one.
+func (c *Client) ScaleDeployment(namespace string, name string, replicas int32) (int32, error) {
+	deployments := c.clientset().AppsV1().Deployments(namespace)
+	d, err := deployments.Get(name, metav1.GetOptions{})
+	if err != nil {
+		return 0, errors.Wrapf(err, "failed to get deployment %s/%s", namespace, name)
+	}
+
+	previous := int32(1)
+	if d.Spec.Replicas != nil {
+		previous = *d.Spec.Replicas
+	}
+	d.Spec.Replicas = &replicas
+
+	// the update fails if the deployment changed since it was read
+	if _, err := deployments.Update(d); err != nil {
+		return 0, errors.Wrapf(err, "failed to scale deployment %s/%s", namespace, name)
+	}
+	return previous, nil
+}
+
+// GetPodLogs returns the last lines of the logs of a container. If
+// previous is set, the logs of the container's previous instance are
+// returned.
+func (c *Client) GetPodLogs(namespace string, name string, container string, previous bool, lines int64) ([]byte, error) {
+	opts := &v1.PodLogOptions{
+		Container: container,
+		Previous:  previous,
+		TailLines: &lines,
+	}
+	data, err := c.clientset().CoreV1().Pods(namespace).GetLogs(name, opts).DoRaw()
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get logs of %s/%s container %s", namespace, name, container)
+	}
+	return data, nil
+}
+
+// GetDeployment returns a single Deployment
+func (c *Client) GetDeployment(namespace string, name string) (*appsv1.Deployment, error) {
+	// not wrapped so the caller can check for not found
+	return c.clientset().AppsV1().Deployments(namespace).Get(name, metav1.GetOptions{})
+}
+
+// GetJob returns a single Job
+func (c *Client) GetJob(namespace string, name string) (*batchv1.Job, error) {
+	// not wrapped so the caller can check for not found
+	return c.clientset().BatchV1().Jobs(namespace).Get(name, metav1.GetOptions{})
+}
+
+// DeleteJob deletes a Job. Its pods are deleted in the background.
+func (c *Client) DeleteJob(namespace string, name string) error {
+	propagation := metav1.DeletePropagationBackground
+	// not wrapped so the caller can check for not found
+	return c.clientset().BatchV1().Jobs(namespace).Delete(name, &metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	})
+}
+
+// PatchJob applies a JSON merge patch to a Job
+func (c *Client) PatchJob(namespace string, name string, patch []byte) error {
+	// not wrapped so the caller can check for not found
+	_, err := c.clientset().BatchV1().Jobs(namespace).Patch(name, types.MergePatchType, patch)
+	return err
+}
+
+// ListNodes returns all nodes
+func (c *Client) ListNodes() ([]v1.Node, error) {
+	nodes, err := c.clientset().CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, errors.Wrap(err, "failed to list nodes")
+	}
+
+	return nodes.Items, nil
+}
+
+// ServerVersion returns the version of the Kubernetes API server. It is
+// used to check that the API server can be reached.
+func (c *Client) ServerVersion() (string, error) {
+	info, err := c.clientset().Discovery().ServerVersion()
+	if err != nil {
+		return "", errors.Wrap(err, "failed to get server version")
+	}
+	return info.GitVersion, nil
 }
@@ -0,0 +1,146 @@
+package k8s
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testClusters = `
+apiVersion: v1
+kind: Config
+clusters:
+- name: prod
+  cluster:
+    server: https://prod.example.com:6443
+- name: staging
+  cluster:
+    server: https://staging.example.com:6443
+`
+
+const testContexts = `
+apiVersion: v1
+kind: Config
+current-context: staging
+contexts:
+- name: prod
+  context:
+    cluster: prod
+    user: admin
+- name: staging
+  context:
+    cluster: staging
+    user: admin
+users:
+- name: admin
+  user:
+    token: secret
+`
+
+const testLocal = `
+apiVersion: v1
+kind: Config
+current-context: local
+clusters:
+- name: local
+  cluster:
+    server: https://127.0.0.1:6443
+    certificate-authority: ca.crt
+contexts:
+- name: local
+  context:
+    cluster: local
+    user: admin
+users:
+- name: admin
+  user:
+    token: secret
+`
+
+func writeFile(t *testing.T, dir string, name string, data string) string {
+	path := filepath.Join(dir, name)
+	require.NoError(t, ioutil.WriteFile(path, []byte(data), 0600))
+	return path
+}
+
+func TestConfigOverrides(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	local := writeFile(t, dir, "local", testLocal)
+	ca := writeFile(t, dir, "ca.crt", "")
+
+	config, _, err := k8sConfig(local, "", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Equal(t, "https://127.0.0.1:6443", config.Host)
+	require.Equal(t, "secret", config.BearerToken)
+	// paths are relative to the kubeconfig
+	require.Equal(t, ca, config.TLSClientConfig.CAFile)
+
+	// overrides replace values set in the kubeconfig
+	config, _, err = k8sConfig(local, "", clientcmd.ConfigOverrides{
+		ClusterInfo: clientcmdapi.Cluster{
+			Server:                "https://10.0.0.1:6443",
+			InsecureSkipTLSVerify: true,
+		},
+		AuthInfo: clientcmdapi.AuthInfo{Token: "other"},
+	})
+	require.NoError(t, err)
+	require.Equal(t, "https://10.0.0.1:6443", config.Host)
+	require.Equal(t, "other", config.BearerToken)
+	require.True(t, config.TLSClientConfig.Insecure)
+	require.Empty(t, config.TLSClientConfig.CAFile)
+
+	_, _, err = k8sConfig(local, "missing", clientcmd.ConfigOverrides{})
+	require.Error(t, err)
+}
+
+func TestConfigFromEnv(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clusters := writeFile(t, dir, "clusters", testClusters)
+	contexts := writeFile(t, dir, "contexts", testContexts)
+	local := writeFile(t, dir, "local", testLocal)
+	writeFile(t, dir, "ca.crt", "")
+
+	old, ok := os.LookupEnv(clientcmd.RecommendedConfigPathEnvVar)
+	defer func() {
+		if ok {
+			os.Setenv(clientcmd.RecommendedConfigPathEnvVar, old)
+		} else {
+			os.Unsetenv(clientcmd.RecommendedConfigPathEnvVar)
+		}
+	}()
+	// the files are merged, so contexts can refer to clusters in another file
+	os.Setenv(clientcmd.RecommendedConfigPathEnvVar, strings.Join([]string{clusters, contexts}, string(filepath.ListSeparator)))
+
+	config, _, err := k8sConfig("", "", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Equal(t, "https://staging.example.com:6443", config.Host)
+	require.Equal(t, "secret", config.BearerToken)
+
+	config, _, err = k8sConfig("", "prod", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Equal(t, "https://prod.example.com:6443", config.Host)
+
+	// the first file to set current-context wins
+	os.Setenv(clientcmd.RecommendedConfigPathEnvVar, strings.Join([]string{local, clusters, contexts}, string(filepath.ListSeparator)))
+	config, _, err = k8sConfig("", "", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Equal(t, "https://127.0.0.1:6443", config.Host)
+
+	// an explicit kubeconfig is used instead of the environment
+	os.Setenv(clientcmd.RecommendedConfigPathEnvVar, strings.Join([]string{clusters, contexts}, string(filepath.ListSeparator)))
+	config, _, err = k8sConfig(local, "", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Equal(t, "https://127.0.0.1:6443", config.Host)
+}
@@ -0,0 +1,155 @@
+package k8s
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+// inClusterTokenFile is where the service account token is mounted in a pod
+const inClusterTokenFile = "/var/run/secrets/kubernetes.io/serviceaccount/token"
+
+// tokenRefresh is how often a token file is read again
+const tokenRefresh = time.Minute
+
+// tokenTransport adds a bearer token read from a file to each request.
+// The file is read again every tokenRefresh, so short-lived tokens that
+// are rotated on disk, such as projected service account tokens, keep
+// working.
+type tokenTransport struct {
+	path string
+	now  func() time.Time
+
+	mu    sync.Mutex
+	token string
+	read  time.Time
+}
+
+func newTokenTransport(path string, token string) *tokenTransport {
+	return &tokenTransport{
+		path:  path,
+		now:   time.Now,
+		token: token,
+		read:  time.Now(),
+	}
+}
+
+// get returns the token, reading the file again if it is due. If the
+// file cannot be read, the last token is used.
+func (t *tokenTransport) get() string {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if now.Sub(t.read) < tokenRefresh {
+		return t.token
+	}
+	t.read = now
+
+	data, err := ioutil.ReadFile(t.path)
+	if err != nil {
+		return t.token
+	}
+	if token := strings.TrimSpace(string(data)); token != "" {
+		t.token = token
+	}
+	return t.token
+}
+
+func (t *tokenTransport) wrap(rt http.RoundTripper) http.RoundTripper {
+	return roundTripperFunc(func(req *http.Request) (*http.Response, error) {
+		if req.Header.Get("Authorization") != "" {
+			return rt.RoundTrip(req)
+		}
+
+		// a round tripper must not change the request it was given
+		r := new(http.Request)
+		*r = *req
+		r.Header = make(http.Header, len(req.Header)+1)
+		for k, v := range req.Header {
+			r.Header[k] = append([]string(nil), v...)
+		}
+		if token := t.get(); token != "" {
+			r.Header.Set("Authorization", "Bearer "+token)
+		}
+		return rt.RoundTrip(r)
+	})
+}
+
+type roundTripperFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// configFiles returns the kubeconfig files that are loaded, whether or
+// not they exist.
+func configFiles(kubeconfig string) []string {
+	if kubeconfig != "" {
+		return []string{kubeconfig}
+	}
+	return clientcmd.NewDefaultClientConfigLoadingRules().GetLoadingPrecedence()
+}
+
+// fingerprint returns the size and modification time of each file, to
+// detect changes.
+func fingerprint(files []string) string {
+	parts := make([]string, 0, len(files))
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			parts = append(parts, f+":missing")
+			continue
+		}
+		parts = append(parts, fmt.Sprintf("%s:%d:%d", f, info.Size(), info.ModTime().UnixNano()))
+	}
+	return strings.Join(parts, ",")
+}
+
+// WatchConfig checks the kubeconfig files, and the certificate files they
+// refer to, every interval. When any of them changes, the client is
+// created again, so rotated certificates and credentials are used
+// without restarting. If the new config cannot be loaded, such as while
+// a file is being written, the current client is kept and the files are
+// checked again next interval. It returns when the context is canceled.
+func (c *Client) WatchConfig(ctx context.Context, interval time.Duration, logger *zap.Logger) {
+	c.mu.RLock()
+	last := fingerprint(c.files)
+	c.mu.RUnlock()
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+
+		c.mu.RLock()
+		current := fingerprint(c.files)
+		c.mu.RUnlock()
+		if current == last {
+			continue
+		}
+
+		if err := c.build(); err != nil {
+			logger.Error("failed to reload kubeconfig", zap.Error(err))
+			continue
+		}
+
+		c.mu.RLock()
+		last = fingerprint(c.files)
+		c.mu.RUnlock()
+		logger.Info("reloaded kubeconfig")
+	}
+}
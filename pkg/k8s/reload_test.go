@@ -0,0 +1,154 @@
+package k8s
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"k8s.io/client-go/tools/clientcmd"
+	clientcmdapi "k8s.io/client-go/tools/clientcmd/api"
+)
+
+const testTokenFile = `
+apiVersion: v1
+kind: Config
+current-context: local
+clusters:
+- name: local
+  cluster:
+    server: https://127.0.0.1:6443
+contexts:
+- name: local
+  context:
+    cluster: local
+    user: robot
+users:
+- name: robot
+  user:
+    tokenFile: token
+`
+
+func TestTokenTransport(t *testing.T) {
+	dir, err := ioutil.TempDir("", "token")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	path := writeFile(t, dir, "token", "one\n")
+
+	var auth string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+	}))
+	defer server.Close()
+
+	now := time.Now()
+	tt := newTokenTransport(path, "one")
+	tt.now = func() time.Time { return now }
+	tt.read = now
+	client := &http.Client{Transport: tt.wrap(http.DefaultTransport)}
+
+	get := func() string {
+		resp, err := client.Get(server.URL)
+		require.NoError(t, err)
+		resp.Body.Close()
+		return auth
+	}
+
+	require.Equal(t, "Bearer one", get())
+
+	// the file is not read again until the refresh period has passed
+	writeFile(t, dir, "token", "two\n")
+	require.Equal(t, "Bearer one", get())
+
+	now = now.Add(tokenRefresh)
+	require.Equal(t, "Bearer two", get())
+
+	// the last token is kept if the file cannot be read
+	require.NoError(t, os.Remove(path))
+	now = now.Add(tokenRefresh)
+	require.Equal(t, "Bearer two", get())
+
+	// credentials set on the request are not replaced
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	require.NoError(t, err)
+	req.Header.Set("Authorization", "Basic abc")
+	resp, err := client.Do(req)
+	require.NoError(t, err)
+	resp.Body.Close()
+	require.Equal(t, "Basic abc", auth)
+}
+
+func TestTokenFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	kubeconfig := writeFile(t, dir, "config", testTokenFile)
+	writeFile(t, dir, "token", "secret")
+
+	config, file, err := k8sConfig(kubeconfig, "", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Equal(t, "secret", config.BearerToken)
+	// paths are relative to the kubeconfig
+	require.Equal(t, filepath.Join(dir, "token"), file)
+
+	// a token set directly is not read again
+	_, file, err = k8sConfig(kubeconfig, "", clientcmd.ConfigOverrides{
+		AuthInfo: clientcmdapi.AuthInfo{Token: "other"},
+	})
+	require.NoError(t, err)
+	require.Empty(t, file)
+
+	local := writeFile(t, dir, "local", testLocal)
+	writeFile(t, dir, "ca.crt", "")
+	_, file, err = k8sConfig(local, "", clientcmd.ConfigOverrides{})
+	require.NoError(t, err)
+	require.Empty(t, file)
+}
+
+func TestWatchConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	kubeconfig := writeFile(t, dir, "config", testLocal)
+	writeFile(t, dir, "ca.crt", "")
+
+	c, err := New(kubeconfig, "")
+	require.NoError(t, err)
+
+	host := func() string {
+		return c.clientset().CoreV1().RESTClient().Get().URL().Host
+	}
+	require.Equal(t, "127.0.0.1:6443", host())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go c.WatchConfig(ctx, time.Millisecond*10, zap.NewNop())
+
+	// a file that cannot be parsed keeps the current client
+	writeFile(t, dir, "config", "clusters: [")
+	time.Sleep(time.Millisecond * 50)
+	require.Equal(t, "127.0.0.1:6443", host())
+
+	writeFile(t, dir, "config", testClusters+`
+current-context: prod
+contexts:
+- name: prod
+  context:
+    cluster: prod
+`)
+
+	deadline := time.Now().Add(time.Second * 5)
+	for host() != "prod.example.com:6443" && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond * 10)
+	}
+	require.Equal(t, "prod.example.com:6443", host())
+}
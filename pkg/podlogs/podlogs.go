@@ -0,0 +1,55 @@
+// Package podlogs stores the container logs that the controller captures
+// before acting on pods.
+package podlogs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+)
+
+// timeFormat is used in directory names, so it sorts and has no colons
+const timeFormat = "20060102T150405Z"
+
+type directory struct {
+	path string
+}
+
+// Directory returns a controller.LogSink that writes the logs of each pod
+// under path, in namespace/pod-time/container.log. The logs of a
+// container's previous instance are in container.previous.log. If logs
+// could not be captured, the error is written to a file with an .error
+// suffix in place of .log.
+func Directory(path string) controller.LogSink {
+	return &directory{path: path}
+}
+
+func (d *directory) WriteLogs(logs *controller.CapturedLogs) error {
+	dir := filepath.Join(d.path, logs.Namespace, logs.Name+"-"+logs.Time.UTC().Format(timeFormat))
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return errors.Wrapf(err, "failed to create %s", dir)
+	}
+
+	for _, l := range logs.Containers {
+		name := l.Container
+		if l.Previous {
+			name += ".previous"
+		}
+		data := []byte(l.Logs)
+		if l.Error != "" {
+			name += ".error"
+			data = []byte(l.Error + "\n")
+		} else {
+			name += ".log"
+		}
+
+		path := filepath.Join(dir, name)
+		if err := ioutil.WriteFile(path, data, 0644); err != nil {
+			return errors.Wrapf(err, "failed to write %s", path)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package podlogs
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDirectory(t *testing.T) {
+	dir, err := ioutil.TempDir("", "podlogs")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	logs := &controller.CapturedLogs{
+		Time:      time.Date(2018, 3, 4, 5, 6, 7, 0, time.UTC),
+		Namespace: "default",
+		Name:      "web-1",
+		Containers: []controller.ContainerLogs{
+			{Container: "app", Logs: "starting\n"},
+			{Container: "app", Previous: true, Logs: "panic\n"},
+			{Container: "sidecar", Previous: true, Error: "not found"},
+		},
+	}
+	require.NoError(t, Directory(dir).WriteLogs(logs))
+
+	podDir := filepath.Join(dir, "default", "web-1-20180304T050607Z")
+	for name, want := range map[string]string{
+		"app.log":                "starting\n",
+		"app.previous.log":       "panic\n",
+		"sidecar.previous.error": "not found\n",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join(podDir, name))
+		require.NoError(t, err)
+		require.Equal(t, want, string(data))
+	}
+}
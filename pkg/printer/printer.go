@@ -0,0 +1,131 @@
+// Package printer writes command output as a table for people, or as
+// JSON or YAML for scripts.
+package printer
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/ghodss/yaml"
+	"github.com/pkg/errors"
+)
+
+// Output formats
+const (
+	Table = "table"
+	Wide  = "wide"
+	JSON  = "json"
+	YAML  = "yaml"
+)
+
+// Formats are the valid output formats
+var Formats = []string{Table, Wide, JSON, YAML}
+
+// Column is a column in a table
+type Column struct {
+	Name string
+	// Wide columns are only printed in the wide format
+	Wide bool
+}
+
+// TableData is the contents of a table. Each row has a value for every
+// column, including wide columns.
+type TableData struct {
+	Columns []Column
+	Rows    [][]string
+	// Footer is printed after the table, one line each, such as a summary
+	Footer []string
+}
+
+// Tabular is implemented by values that can be printed as a table.
+type Tabular interface {
+	Table() TableData
+}
+
+// Printer writes values in an output format
+type Printer struct {
+	format string
+}
+
+// New creates a printer for the format
+func New(format string) (*Printer, error) {
+	for _, f := range Formats {
+		if format == f {
+			return &Printer{format: format}, nil
+		}
+	}
+	return nil, errors.Errorf("invalid output format %q. Must be one of %s", format, strings.Join(Formats, ", "))
+}
+
+// Format returns the output format
+func (p *Printer) Format() string {
+	return p.format
+}
+
+// Print writes v to w. In the table formats, v must implement Tabular.
+func (p *Printer) Print(w io.Writer, v interface{}) error {
+	switch p.format {
+	case JSON:
+		data, err := json.MarshalIndent(v, "", "  ")
+		if err != nil {
+			return errors.Wrap(err, "failed to encode output")
+		}
+		data = append(data, '\n')
+		_, err = w.Write(data)
+		return err
+	case YAML:
+		data, err := yaml.Marshal(v)
+		if err != nil {
+			return errors.Wrap(err, "failed to encode output")
+		}
+		_, err = w.Write(data)
+		return err
+	}
+
+	t, ok := v.(Tabular)
+	if !ok {
+		return errors.Errorf("%T cannot be printed as a table", v)
+	}
+	return writeTable(w, t.Table(), p.format == Wide)
+}
+
+func writeTable(w io.Writer, t TableData, wide bool) error {
+	var show []int
+	for i, col := range t.Columns {
+		if wide || !col.Wide {
+			show = append(show, i)
+		}
+	}
+
+	tw := tabwriter.NewWriter(w, 0, 0, 3, ' ', 0)
+	writeRow(tw, show, func(i int) string { return t.Columns[i].Name })
+	for _, row := range t.Rows {
+		writeRow(tw, show, func(i int) string {
+			if i >= len(row) || row[i] == "" {
+				return "<none>"
+			}
+			return row[i]
+		})
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+
+	for _, line := range t.Footer {
+		if _, err := fmt.Fprintln(w, line); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeRow(w io.Writer, show []int, value func(int) string) {
+	cells := make([]string, len(show))
+	for j, i := range show {
+		cells[j] = value(i)
+	}
+	fmt.Fprintln(w, strings.Join(cells, "\t"))
+}
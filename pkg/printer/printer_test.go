@@ -0,0 +1,72 @@
+package printer
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testRows []struct {
+	Name string `json:"name"`
+	Node string `json:"node,omitempty"`
+}
+
+func (r testRows) Table() TableData {
+	t := TableData{
+		Columns: []Column{{Name: "NAME"}, {Name: "NODE", Wide: true}},
+		Footer:  []string{"2 pods"},
+	}
+	for _, row := range r {
+		t.Rows = append(t.Rows, []string{row.Name, row.Node})
+	}
+	return t
+}
+
+func TestPrinter(t *testing.T) {
+	rows := testRows{
+		{Name: "web-1", Node: "node-1"},
+		{Name: "web-2"},
+	}
+
+	tests := []struct {
+		format   string
+		expected string
+	}{
+		{
+			format:   Table,
+			expected: "NAME\nweb-1\nweb-2\n2 pods\n",
+		},
+		{
+			format:   Wide,
+			expected: "NAME    NODE\nweb-1   node-1\nweb-2   <none>\n2 pods\n",
+		},
+		{
+			format:   JSON,
+			expected: "[\n  {\n    \"name\": \"web-1\",\n    \"node\": \"node-1\"\n  },\n  {\n    \"name\": \"web-2\"\n  }\n]\n",
+		},
+		{
+			format:   YAML,
+			expected: "- name: web-1\n  node: node-1\n- name: web-2\n",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.format, func(t *testing.T) {
+			p, err := New(test.format)
+			require.NoError(t, err)
+
+			var buf bytes.Buffer
+			require.NoError(t, p.Print(&buf, rows))
+			require.Equal(t, test.expected, buf.String())
+		})
+	}
+
+	_, err := New("xml")
+	require.Error(t, err)
+
+	// values that are not tabular can still be printed as JSON
+	p, err := New(Table)
+	require.NoError(t, err)
+	require.Error(t, p.Print(&bytes.Buffer{}, map[string]string{"a": "b"}))
+}
@@ -0,0 +1,108 @@
+// Package statsd sends metrics to a StatsD or DogStatsD server over UDP.
+package statsd
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+	"sort"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// Client sends metrics to a StatsD server. Metrics are sent as they
+// are recorded, one per packet. Errors sending are ignored, as with
+// any UDP StatsD client.
+type Client struct {
+	conn   net.Conn
+	prefix string
+	tags   bool
+}
+
+// Option sets options when creating a new Client
+type Option func(*Client) error
+
+// New creates a client that sends metrics to address.
+func New(address string, options ...Option) (*Client, error) {
+	c := &Client{
+		prefix: "pod_deleter.",
+		tags:   true,
+	}
+
+	for _, o := range options {
+		if err := o(c); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	conn, err := net.Dial("udp", address)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to connect to %q", address)
+	}
+	c.conn = conn
+
+	return c, nil
+}
+
+// WithPrefix returns an Option that sets the prefix added to every
+// metric name. Default is "pod_deleter."
+func WithPrefix(prefix string) Option {
+	return func(c *Client) error {
+		c.prefix = prefix
+		return nil
+	}
+}
+
+// WithTags returns an Option that sets whether tags are sent, using
+// the DogStatsD format. Disable for servers that do not support tags.
+// Default is true.
+func WithTags(enabled bool) Option {
+	return func(c *Client) error {
+		c.tags = enabled
+		return nil
+	}
+}
+
+// Count adds value to a counter
+func (c *Client) Count(name string, value int64, tags map[string]string) {
+	c.send(name, fmt.Sprintf("%d|c", value), tags)
+}
+
+// Timing records a duration in milliseconds
+func (c *Client) Timing(name string, d time.Duration, tags map[string]string) {
+	c.send(name, fmt.Sprintf("%d|ms", int64(d/time.Millisecond)), tags)
+}
+
+// Close closes the connection
+func (c *Client) Close() error {
+	return c.conn.Close()
+}
+
+func (c *Client) send(name string, value string, tags map[string]string) {
+	var b bytes.Buffer
+	b.WriteString(c.prefix)
+	b.WriteString(name)
+	b.WriteByte(':')
+	b.WriteString(value)
+
+	if c.tags && len(tags) > 0 {
+		keys := make([]string, 0, len(tags))
+		for k := range tags {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+
+		b.WriteString("|#")
+		for i, k := range keys {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(k)
+			b.WriteByte(':')
+			b.WriteString(tags[k])
+		}
+	}
+
+	_, _ = c.conn.Write(b.Bytes())
+}
@@ -0,0 +1,50 @@
+package statsd
+
+import (
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func listen(t *testing.T) *net.UDPConn {
+	conn, err := net.ListenUDP("udp", &net.UDPAddr{IP: net.IPv4(127, 0, 0, 1)})
+	require.NoError(t, err)
+	return conn
+}
+
+func receive(t *testing.T, conn *net.UDPConn) string {
+	require.NoError(t, conn.SetReadDeadline(time.Now().Add(time.Second)))
+	buf := make([]byte, 1024)
+	n, err := conn.Read(buf)
+	require.NoError(t, err)
+	return string(buf[:n])
+}
+
+func TestClient(t *testing.T) {
+	conn := listen(t)
+	defer conn.Close()
+
+	c, err := New(conn.LocalAddr().String())
+	require.NoError(t, err)
+	defer c.Close()
+
+	c.Count("deleted", 2, map[string]string{"namespace": "default", "action": "deleted"})
+	require.Equal(t, "pod_deleter.deleted:2|c|#action:deleted,namespace:default", receive(t, conn))
+
+	c.Timing("run.duration", time.Millisecond*1500, nil)
+	require.Equal(t, "pod_deleter.run.duration:1500|ms", receive(t, conn))
+}
+
+func TestClientWithoutTags(t *testing.T) {
+	conn := listen(t)
+	defer conn.Close()
+
+	c, err := New(conn.LocalAddr().String(), WithPrefix("deleter."), WithTags(false))
+	require.NoError(t, err)
+	defer c.Close()
+
+	c.Count("skipped", 1, map[string]string{"reason": "Budget"})
+	require.Equal(t, "deleter.skipped:1|c", receive(t, conn))
+}
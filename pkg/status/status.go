@@ -0,0 +1,83 @@
+// Package status publishes the outcome of each run to a ConfigMap, so
+// other tools in the cluster can alert if the deleter stops making progress.
+package status
+
+import (
+	"encoding/json"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/bakins/k8s-pod-deleter/pkg/version"
+	"github.com/pkg/errors"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// ConfigMapKey is the key in the ConfigMap that holds the status
+const ConfigMapKey = "status.json"
+
+// Status is the compact status written to the ConfigMap
+type Status struct {
+	controller.RunStatus
+	Version string `json:"version"`
+}
+
+// ConfigMapClient gets, creates, and updates ConfigMaps
+type ConfigMapClient interface {
+	GetConfigMap(namespace string, name string) (*v1.ConfigMap, error)
+	CreateConfigMap(cm *v1.ConfigMap) error
+	UpdateConfigMap(cm *v1.ConfigMap) error
+}
+
+// ConfigMapPublisher writes the status of each run to a ConfigMap. It
+// implements controller.StatusPublisher.
+type ConfigMapPublisher struct {
+	client    ConfigMapClient
+	namespace string
+	name      string
+}
+
+// NewConfigMapPublisher creates a publisher that writes to the ConfigMap
+// namespace/name. The ConfigMap is created if it does not exist, and
+// other keys in it are left alone.
+func NewConfigMapPublisher(client ConfigMapClient, namespace string, name string) *ConfigMapPublisher {
+	return &ConfigMapPublisher{
+		client:    client,
+		namespace: namespace,
+		name:      name,
+	}
+}
+
+// Publish writes the status of a run
+func (p *ConfigMapPublisher) Publish(s controller.RunStatus) error {
+	data, err := json.Marshal(Status{RunStatus: s, Version: version.Version})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode status")
+	}
+
+	cm, err := p.client.GetConfigMap(p.namespace, p.name)
+	if err != nil {
+		if !k8sErrors.IsNotFound(err) {
+			return errors.Wrapf(err, "failed to get configmap %s/%s", p.namespace, p.name)
+		}
+		err := p.client.CreateConfigMap(&v1.ConfigMap{
+			ObjectMeta: metav1.ObjectMeta{
+				Namespace: p.namespace,
+				Name:      p.name,
+			},
+			Data: map[string]string{
+				ConfigMapKey: string(data),
+			},
+		})
+		return errors.Wrapf(err, "failed to create configmap %s/%s", p.namespace, p.name)
+	}
+
+	if cm.Data == nil {
+		cm.Data = make(map[string]string)
+	}
+	cm.Data[ConfigMapKey] = string(data)
+	if err := p.client.UpdateConfigMap(cm); err != nil {
+		return errors.Wrapf(err, "failed to update configmap %s/%s", p.namespace, p.name)
+	}
+	return nil
+}
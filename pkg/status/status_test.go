@@ -0,0 +1,54 @@
+package status
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+	"k8s.io/api/core/v1"
+	k8sErrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+)
+
+type testConfigMaps struct {
+	cm *v1.ConfigMap
+}
+
+func (t *testConfigMaps) GetConfigMap(namespace string, name string) (*v1.ConfigMap, error) {
+	if t.cm == nil {
+		return nil, k8sErrors.NewNotFound(schema.GroupResource{Resource: "configmaps"}, name)
+	}
+	return t.cm.DeepCopy(), nil
+}
+
+func (t *testConfigMaps) CreateConfigMap(cm *v1.ConfigMap) error {
+	t.cm = cm
+	return nil
+}
+
+func (t *testConfigMaps) UpdateConfigMap(cm *v1.ConfigMap) error {
+	t.cm = cm
+	return nil
+}
+
+func TestConfigMapPublisher(t *testing.T) {
+	client := &testConfigMaps{}
+	p := NewConfigMapPublisher(client, "kube-system", "pod-deleter-status")
+
+	now := time.Now().UTC().Truncate(time.Second)
+	require.NoError(t, p.Publish(controller.RunStatus{Time: now, Evaluated: 10, Deleted: 2}))
+	require.Equal(t, "pod-deleter-status", client.cm.ObjectMeta.Name)
+
+	// other keys are kept
+	client.cm.Data["other"] = "value"
+	require.NoError(t, p.Publish(controller.RunStatus{Time: now.Add(time.Minute), Evaluated: 10, Deleted: 1}))
+	require.Equal(t, "value", client.cm.Data["other"])
+
+	var s Status
+	require.NoError(t, json.Unmarshal([]byte(client.cm.Data[ConfigMapKey]), &s))
+	require.Equal(t, now.Add(time.Minute), s.Time)
+	require.Equal(t, 1, s.Deleted)
+	require.NotEmpty(t, s.Version)
+}
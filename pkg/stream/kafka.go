@@ -0,0 +1,92 @@
+package stream
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+type kafkaRESTPublisher struct {
+	url      string
+	user     string
+	password string
+	client   *http.Client
+}
+
+// KafkaREST returns a Publisher that produces to Kafka through a Kafka
+// REST Proxy at baseURL, such as http://kafka-rest:8082, so no Kafka
+// client or broker list is needed. If user is set, requests use basic
+// authentication. All messages of a run are sent in a single request.
+func KafkaREST(baseURL string, user string, password string) Publisher {
+	return &kafkaRESTPublisher{
+		url:      strings.TrimSuffix(baseURL, "/"),
+		user:     user,
+		password: password,
+		client:   &http.Client{Timeout: time.Second * 10},
+	}
+}
+
+type kafkaRecord struct {
+	Key   string          `json:"key"`
+	Value json.RawMessage `json:"value"`
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+// kafkaOffsets is the response. Records that could not be produced have
+// an error, even if the request succeeded.
+type kafkaOffsets struct {
+	Offsets []struct {
+		Error string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (k *kafkaRESTPublisher) Publish(topic string, messages []Message) error {
+	body := kafkaRecords{Records: make([]kafkaRecord, 0, len(messages))}
+	for _, m := range messages {
+		body.Records = append(body.Records, kafkaRecord{Key: m.Key, Value: m.Value})
+	}
+
+	data, err := json.Marshal(body)
+	if err != nil {
+		return errors.Wrap(err, "failed to encode records")
+	}
+
+	req, err := http.NewRequest(http.MethodPost, k.url+"/topics/"+url.PathEscape(topic), bytes.NewReader(data))
+	if err != nil {
+		return errors.Wrap(err, "failed to create request")
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+	if k.user != "" {
+		req.SetBasicAuth(k.user, k.password)
+	}
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return errors.Wrap(err, "failed to produce records")
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode/100 != 2 {
+		return errors.Errorf("unexpected status producing records: %s", resp.Status)
+	}
+
+	var offsets kafkaOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&offsets); err != nil {
+		return errors.Wrap(err, "failed to parse response")
+	}
+	for _, o := range offsets.Offsets {
+		if o.Error != "" {
+			return errors.Errorf("failed to produce record: %s", o.Error)
+		}
+	}
+	return nil
+}
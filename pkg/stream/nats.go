@@ -0,0 +1,110 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/pkg/errors"
+)
+
+// natsTimeout limits connecting to NATS, and then publishing the
+// messages of a run
+const natsTimeout = time.Second * 10
+
+type natsPublisher struct {
+	address  string
+	user     string
+	password string
+	token    string
+}
+
+// NATS returns a Publisher that publishes to a NATS server at address,
+// such as nats:4222. If user is set, the connection is authenticated with
+// user and password; if only password is set, it is sent as a token. A
+// connection is made for each run, and the server is asked to confirm the
+// messages before it is closed.
+func NATS(address string, user string, password string) Publisher {
+	n := &natsPublisher{address: address}
+	if user != "" {
+		n.user = user
+		n.password = password
+	} else {
+		n.token = password
+	}
+	return n
+}
+
+type natsConnect struct {
+	Verbose  bool   `json:"verbose"`
+	Pedantic bool   `json:"pedantic"`
+	Name     string `json:"name"`
+	Lang     string `json:"lang"`
+	Version  string `json:"version"`
+	User     string `json:"user,omitempty"`
+	Pass     string `json:"pass,omitempty"`
+	Token    string `json:"auth_token,omitempty"`
+}
+
+func (n *natsPublisher) Publish(subject string, messages []Message) error {
+	conn, err := net.DialTimeout("tcp", n.address, natsTimeout)
+	if err != nil {
+		return errors.Wrapf(err, "failed to connect to %s", n.address)
+	}
+	defer conn.Close()
+
+	if err := conn.SetDeadline(time.Now().Add(natsTimeout)); err != nil {
+		return err
+	}
+
+	r := bufio.NewReader(conn)
+	// the server starts with an INFO line
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return errors.Wrap(err, "failed to read server info")
+	}
+	if !strings.HasPrefix(line, "INFO ") {
+		return errors.Errorf("unexpected server greeting %q", strings.TrimSpace(line))
+	}
+
+	connect, err := json.Marshal(natsConnect{
+		Name:    "k8s-pod-deleter",
+		Lang:    "go",
+		Version: "1.0.0",
+		User:    n.user,
+		Pass:    n.password,
+		Token:   n.token,
+	})
+	if err != nil {
+		return errors.Wrap(err, "failed to encode connect")
+	}
+
+	w := bufio.NewWriter(conn)
+	fmt.Fprintf(w, "CONNECT %s\r\n", connect)
+	for _, m := range messages {
+		fmt.Fprintf(w, "PUB %s %d\r\n%s\r\n", subject, len(m.Value), m.Value)
+	}
+	// the PONG confirms the server processed everything before it
+	fmt.Fprint(w, "PING\r\n")
+	if err := w.Flush(); err != nil {
+		return errors.Wrap(err, "failed to publish")
+	}
+
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return errors.Wrap(err, "failed to read reply")
+		}
+		line = strings.TrimSpace(line)
+		switch {
+		case line == "PONG":
+			return nil
+		case strings.HasPrefix(line, "-ERR"):
+			return errors.Errorf("server error: %s", strings.TrimSpace(strings.TrimPrefix(line, "-ERR")))
+		}
+		// skip +OK, PING, and INFO updates
+	}
+}
@@ -0,0 +1,132 @@
+// Package stream publishes a message for every pod the controller acted
+// on to NATS or Kafka, so the deleter's activity can be fed into data
+// pipelines without scraping logs. Kafka is reached only through a
+// Kafka REST Proxy, not the broker protocol.
+package stream
+
+import (
+	"encoding/json"
+	"sort"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/audit"
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/pkg/errors"
+	"go.uber.org/zap"
+)
+
+// DefaultTopic is the NATS subject or Kafka topic messages are published to
+const DefaultTopic = "k8s-pod-deleter.decisions"
+
+// Message is a single message. Key is used by Kafka to choose a
+// partition; NATS ignores it.
+type Message struct {
+	Key   string
+	Value json.RawMessage
+}
+
+// Publisher sends messages to a topic
+type Publisher interface {
+	Publish(topic string, messages []Message) error
+}
+
+// Exporter publishes decisions. It implements controller.Auditor.
+type Exporter struct {
+	publisher Publisher
+	topic     string
+	level     audit.Level
+	logger    *zap.Logger
+}
+
+// Option sets options when creating a new Exporter
+type Option func(*Exporter) error
+
+// New creates an exporter that publishes with p.
+func New(p Publisher, options ...Option) (*Exporter, error) {
+	if p == nil {
+		return nil, errors.New("publisher is required")
+	}
+
+	e := &Exporter{
+		publisher: p,
+		topic:     DefaultTopic,
+		level:     audit.LevelActions,
+		logger:    zap.NewNop(),
+	}
+
+	for _, o := range options {
+		if err := o(e); err != nil {
+			return nil, errors.Wrap(err, "option failed")
+		}
+	}
+
+	return e, nil
+}
+
+// WithTopic returns an Option that sets the NATS subject or Kafka topic.
+// Default is DefaultTopic.
+func WithTopic(topic string) Option {
+	return func(e *Exporter) error {
+		if topic == "" {
+			return errors.New("topic must not be empty")
+		}
+		e.topic = topic
+		return nil
+	}
+}
+
+// WithLevel returns an Option that sets which decisions are published,
+// as for the audit log. Default is audit.LevelActions.
+func WithLevel(level audit.Level) Option {
+	return func(e *Exporter) error {
+		if err := level.Validate(); err != nil {
+			return err
+		}
+		e.level = level
+		return nil
+	}
+}
+
+// WithLogger returns an Option that sets the logger used to report
+// errors publishing messages.
+func WithLogger(logger *zap.Logger) Option {
+	return func(e *Exporter) error {
+		e.logger = logger
+		return nil
+	}
+}
+
+// Audit publishes a message for each pod acted on in a run, or that
+// could not be, and the skipped pods the level includes, oldest first.
+// Each message is a decision encoded as JSON, keyed by the pod's
+// namespace and name.
+func (e *Exporter) Audit(r *controller.RunResult) {
+	var decisions []controller.Decision
+	decisions = append(decisions, r.Deleted...)
+	decisions = append(decisions, r.Errors...)
+	for _, d := range r.Skipped {
+		if e.level.Includes(d) {
+			decisions = append(decisions, d)
+		}
+	}
+	if len(decisions) == 0 {
+		return
+	}
+
+	sort.SliceStable(decisions, func(i, j int) bool {
+		return decisions[i].Time.Before(decisions[j].Time)
+	})
+
+	messages := make([]Message, 0, len(decisions))
+	for _, d := range decisions {
+		data, err := json.Marshal(d)
+		if err != nil {
+			e.logger.Error("failed to encode decision", zap.Error(err))
+			continue
+		}
+		messages = append(messages, Message{Key: d.Namespace + "/" + d.Name, Value: data})
+	}
+
+	if err := e.publisher.Publish(e.topic, messages); err != nil {
+		e.logger.Error("failed to publish decisions", zap.String("topic", e.topic), zap.Error(err))
+	}
+}
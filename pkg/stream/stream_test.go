@@ -0,0 +1,186 @@
+package stream
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/bakins/k8s-pod-deleter/pkg/audit"
+	"github.com/bakins/k8s-pod-deleter/pkg/controller"
+	"github.com/stretchr/testify/require"
+)
+
+func testResult() *controller.RunResult {
+	now := time.Now()
+	return &controller.RunResult{
+		ID:   "f00d",
+		Time: now,
+		Deleted: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-1", Owner: "ReplicaSet/web-1234", Reason: "CrashLoopBackOff", Action: "deleted", RunID: "f00d"},
+		},
+		Errors: []controller.Decision{
+			{Time: now.Add(-time.Second), Namespace: "batch", Name: "job-1", Reason: "Error", Action: "deleted", Error: "forbidden", RunID: "f00d"},
+		},
+		Skipped: []controller.Decision{
+			{Time: now, Namespace: "default", Name: "web-2", Action: "skipped", Skip: "Budget"},
+		},
+	}
+}
+
+// testNATS is a NATS server that records published messages
+type testNATS struct {
+	token    string
+	listener net.Listener
+
+	mu       sync.Mutex
+	subjects []string
+	payloads []string
+}
+
+func newTestNATS(t *testing.T, token string) *testNATS {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+
+	n := &testNATS{token: token, listener: l}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			go n.serve(conn)
+		}
+	}()
+	return n
+}
+
+func (n *testNATS) serve(conn net.Conn) {
+	defer conn.Close()
+	fmt.Fprint(conn, "INFO {\"server_id\":\"test\",\"auth_required\":true}\r\n")
+
+	r := bufio.NewReader(conn)
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		fields := strings.Fields(line)
+		switch fields[0] {
+		case "CONNECT":
+			var c natsConnect
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(strings.TrimSpace(line), "CONNECT ")), &c); err != nil || c.Token != n.token {
+				fmt.Fprint(conn, "-ERR 'Authorization Violation'\r\n")
+				return
+			}
+		case "PUB":
+			var size int
+			fmt.Sscanf(fields[2], "%d", &size)
+			buf := make([]byte, size+2)
+			if _, err := io.ReadFull(r, buf); err != nil {
+				return
+			}
+			n.mu.Lock()
+			n.subjects = append(n.subjects, fields[1])
+			n.payloads = append(n.payloads, string(buf[:size]))
+			n.mu.Unlock()
+		case "PING":
+			fmt.Fprint(conn, "PONG\r\n")
+		}
+	}
+}
+
+func TestNATS(t *testing.T) {
+	server := newTestNATS(t, "secret")
+	defer server.listener.Close()
+	address := server.listener.Addr().String()
+
+	e, err := New(NATS(address, "", "secret"))
+	require.NoError(t, err)
+	e.Audit(testResult())
+
+	server.mu.Lock()
+	require.Equal(t, []string{DefaultTopic, DefaultTopic}, server.subjects)
+	// the oldest decision is first
+	var d controller.Decision
+	require.NoError(t, json.Unmarshal([]byte(server.payloads[0]), &d))
+	require.Equal(t, "job-1", d.Name)
+	require.Equal(t, "forbidden", d.Error)
+	server.mu.Unlock()
+
+	err = NATS(address, "", "wrong").Publish(DefaultTopic, []Message{{Value: json.RawMessage(`{}`)}})
+	require.Error(t, err)
+}
+
+func TestKafkaREST(t *testing.T) {
+	var (
+		mu      sync.Mutex
+		paths   []string
+		records kafkaRecords
+		user    string
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		paths = append(paths, r.URL.Path)
+		user, _, _ = r.BasicAuth()
+		if err := json.NewDecoder(r.Body).Decode(&records); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"offsets":[{"partition":0,"offset":1},{"partition":0,"offset":2}]}`)
+	}))
+	defer server.Close()
+
+	e, err := New(KafkaREST(server.URL+"/", "deleter", "secret"), WithTopic("pods"))
+	require.NoError(t, err)
+	e.Audit(testResult())
+
+	mu.Lock()
+	require.Equal(t, []string{"/topics/pods"}, paths)
+	require.Equal(t, "deleter", user)
+	require.Len(t, records.Records, 2)
+	require.Equal(t, "batch/job-1", records.Records[0].Key)
+	require.Equal(t, "default/web-1", records.Records[1].Key)
+	mu.Unlock()
+
+	// runs that acted on no pods are not published
+	e.Audit(&controller.RunResult{})
+	mu.Lock()
+	require.Len(t, paths, 1)
+	mu.Unlock()
+
+	// skipped candidates are published at the candidates level
+	e, err = New(KafkaREST(server.URL, "", ""), WithTopic("pods"), WithLevel(audit.LevelCandidates))
+	require.NoError(t, err)
+	e.Audit(testResult())
+
+	mu.Lock()
+	require.Len(t, records.Records, 3)
+	require.Equal(t, "default/web-2", records.Records[2].Key)
+	mu.Unlock()
+
+	_, err = New(KafkaREST(server.URL, "", ""), WithLevel("everything"))
+	require.Error(t, err)
+}
+
+func TestKafkaRESTErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"offsets":[{"error_code":40403,"error":"topic not found"}]}`)
+	}))
+	defer server.Close()
+
+	err := KafkaREST(server.URL, "", "").Publish("pods", []Message{{Value: json.RawMessage(`{}`)}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "topic not found")
+
+	_, err = New(KafkaREST(server.URL, "", ""), WithTopic(""))
+	require.Error(t, err)
+}
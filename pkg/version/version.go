@@ -0,0 +1,54 @@
+// Package version provides build information. Version, GitCommit,
+// and BuildDate are set at build time using -ldflags, e.g.
+//
+//	go build -ldflags "-X github.com/bakins/k8s-pod-deleter/pkg/version.Version=v0.1.0" ./cmd/k8s-pod-deleter
+package version
+
+import (
+	"fmt"
+	"runtime"
+)
+
+// set with -ldflags
+var (
+	Version   = "dev"
+	GitCommit = "unknown"
+	BuildDate = "unknown"
+)
+
+// These are the versions of the Kubernetes client library this was
+// compiled against. Update when the vendored client-go is updated.
+const (
+	ClientGoVersion   = "v6.0.0"
+	KubernetesVersion = "v1.9"
+)
+
+// Info is build information
+type Info struct {
+	Version           string `json:"version"`
+	GitCommit         string `json:"gitCommit"`
+	BuildDate         string `json:"buildDate"`
+	GoVersion         string `json:"goVersion"`
+	Platform          string `json:"platform"`
+	ClientGoVersion   string `json:"clientGoVersion"`
+	KubernetesVersion string `json:"kubernetesVersion"`
+}
+
+// Get returns the build information
+func Get() Info {
+	return Info{
+		Version:           Version,
+		GitCommit:         GitCommit,
+		BuildDate:         BuildDate,
+		GoVersion:         runtime.Version(),
+		Platform:          fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH),
+		ClientGoVersion:   ClientGoVersion,
+		KubernetesVersion: KubernetesVersion,
+	}
+}
+
+// String returns a human readable version
+func (i Info) String() string {
+	return fmt.Sprintf("k8s-pod-deleter %s (commit %s, built %s, %s %s, client-go %s, Kubernetes %s)",
+		i.Version, i.GitCommit, i.BuildDate, i.GoVersion, i.Platform, i.ClientGoVersion, i.KubernetesVersion)
+}